@@ -0,0 +1,376 @@
+// Package agent runs the builds of an Antares server on another host: it
+// registers with the server, leases queued builds, runs them and sends
+// their output, artifacts and outcome back.
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/client"
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/storage"
+)
+
+// maxBatchBytes bounds the output sent to the server in one request.
+const maxBatchBytes = 256 << 10
+
+// flushInterval is how often the output of a running build is sent.
+const flushInterval = time.Second
+
+// Agent leases builds from the server of Client and runs them with
+// Executor, whose Artifacts are uploaded to the server by Run. Client
+// needs an admin token.
+type Agent struct {
+	Client   *client.Client
+	Executor *build.Executor
+	// Name and Hostname identify the agent to the server.
+	Name     string
+	Hostname string
+	// Workers is the number of builds run at once; at least 1.
+	Workers int
+	// PollInterval is the wait between leases while no build is queued,
+	// and before registering again after a failure.
+	PollInterval time.Duration
+	// HeartbeatInterval must be well below the server's
+	// build.agent_timeout.
+	HeartbeatInterval time.Duration
+	// RetryDelay is the wait before retrying a failed build whose
+	// buildspec asks for retries, doubled for each further retry.
+	RetryDelay time.Duration
+	Logger     *slog.Logger
+
+	// register serializes registering
+	register sync.Mutex
+	mu       sync.Mutex
+	id       string
+	builds   map[string]context.CancelFunc
+}
+
+// buildKey carries the lease of the build an artifact is stored for.
+type buildKey struct{}
+
+type leaseRef struct {
+	agent, build string
+}
+
+// Run registers the agent and runs the builds it leases until ctx is done.
+// Builds still running then are canceled and reported so.
+func (a *Agent) Run(ctx context.Context) error {
+	if a.Workers < 1 {
+		a.Workers = 1
+	}
+	if a.Logger == nil {
+		a.Logger = slog.Default()
+	}
+	a.builds = map[string]context.CancelFunc{}
+	a.Executor.Artifacts = uploader{a}
+
+	for {
+		_, err := a.current(ctx)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		a.Logger.Warn("agent could not register", "err", err)
+		if !sleep(ctx, a.PollInterval) {
+			return ctx.Err()
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1 + a.Workers)
+	go func() {
+		defer wg.Done()
+		a.heartbeats(ctx)
+	}()
+	for i := 0; i < a.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			a.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// current returns the id the server knows the agent by, registering it
+// when it has none.
+func (a *Agent) current(ctx context.Context) (string, error) {
+	a.register.Lock()
+	defer a.register.Unlock()
+	a.mu.Lock()
+	id := a.id
+	a.mu.Unlock()
+	if id != "" {
+		return id, nil
+	}
+	ag, err := a.Client.RegisterAgent(ctx, a.Name, a.Hostname)
+	if err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	a.id = ag.Id
+	a.mu.Unlock()
+	a.Logger.Info("agent registered", "agent_id", ag.Id, "agent", ag.Name)
+	return ag.Id, nil
+}
+
+// forget drops the registration id once the server has marked the agent
+// offline, stopping the builds it held; they have failed on the server.
+func (a *Agent) forget(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.id != id {
+		return
+	}
+	a.Logger.Warn("agent was marked offline, registering again", "agent_id", id, "builds", len(a.builds))
+	a.id = ""
+	for _, cancel := range a.builds {
+		cancel()
+	}
+}
+
+// heartbeats keeps the agent online and stops the builds canceled on the
+// server, until ctx is done.
+func (a *Agent) heartbeats(ctx context.Context) {
+	tick := time.NewTicker(a.HeartbeatInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		id, err := a.current(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				a.Logger.Warn("agent could not register", "err", err)
+			}
+			continue
+		}
+		hb, err := a.Client.AgentHeartbeat(ctx, id)
+		switch {
+		case status(err) == http.StatusNotFound:
+			a.forget(id)
+			if _, err := a.current(ctx); err != nil && ctx.Err() == nil {
+				a.Logger.Warn("agent could not register", "err", err)
+			}
+		case err != nil:
+			if ctx.Err() == nil {
+				a.Logger.Warn("agent heartbeat failed", "agent_id", id, "err", err)
+			}
+		default:
+			a.cancel(hb.Cancel)
+		}
+	}
+}
+
+// cancel stops the running builds ids.
+func (a *Agent) cancel(ids []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, id := range ids {
+		if cancel, ok := a.builds[id]; ok {
+			a.Logger.Info("build canceled on the server", "build_id", id)
+			cancel()
+		}
+	}
+}
+
+// work leases and runs builds one at a time until ctx is done.
+func (a *Agent) work(ctx context.Context) {
+	for {
+		id, err := a.current(ctx)
+		if err == nil {
+			var l *lib.AgentLease
+			l, err = a.Client.LeaseBuild(ctx, id)
+			if err == nil && l != nil {
+				a.run(ctx, id, l)
+				continue
+			}
+			if status(err) == http.StatusNotFound {
+				a.forget(id)
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			a.Logger.Warn("agent could not lease a build", "err", err)
+		}
+		if !sleep(ctx, a.PollInterval) {
+			return
+		}
+	}
+}
+
+// run runs the build of lease l held by agent id, sending its output as it
+// is written and reporting each retry and its end.
+func (a *Agent) run(ctx context.Context, id string, l *lib.AgentLease) {
+	b := l.Build
+	log := a.Logger.With("build_id", b.Id, "antarian_id", l.Antarian.Id)
+	bctx, cancel := context.WithCancel(context.WithValue(ctx, buildKey{}, leaseRef{agent: id, build: b.Id}))
+	defer cancel()
+	a.mu.Lock()
+	a.builds[b.Id] = cancel
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.builds, b.Id)
+		a.mu.Unlock()
+	}()
+	log.Info("build started", "agent_id", id)
+
+	s := &shipper{a: a, agent: id, build: b.Id, cancel: cancel, log: log, full: make(chan struct{}, 1), stop: make(chan struct{})}
+	shipped := make(chan struct{})
+	go func() {
+		defer close(shipped)
+		s.loop()
+	}()
+	a.Executor.RunAttempts(bctx, &b, l.Antarian, a.RetryDelay, s.line, func(r lib.Build, delay time.Duration) {
+		s.flush()
+		log.Info("build retrying", "attempt", r.Attempt, "delay", delay)
+		if _, err := a.Client.ReportBuild(context.Background(), id, &r); err != nil {
+			a.lost(id, cancel, err, log)
+		}
+	})
+	close(s.stop)
+	<-shipped
+	s.flush()
+
+	// reported even when ctx is done, as the build is canceled then
+	if _, err := a.Client.ReportBuild(context.Background(), id, &b); err != nil {
+		log.Warn("could not report build", "err", err)
+		if status(err) == http.StatusNotFound {
+			a.forget(id)
+		}
+		return
+	}
+	log.Info("build finished", "state", b.State, "exit_code", b.ExitCode, "duration", b.End.Sub(b.Start))
+}
+
+// lost stops a build the server no longer holds for agent id, after err
+// answered a call about it.
+func (a *Agent) lost(id string, cancel context.CancelFunc, err error, log *slog.Logger) {
+	switch status(err) {
+	case http.StatusNotFound:
+		a.forget(id)
+	case http.StatusConflict:
+		log.Warn("build is no longer leased to the agent", "err", err)
+		cancel()
+	default:
+		log.Warn("could not report build", "err", err)
+	}
+}
+
+// shipper sends the output lines of a build to the server in batches.
+type shipper struct {
+	a     *Agent
+	agent string
+	build string
+	// cancel stops the build
+	cancel context.CancelFunc
+	log    *slog.Logger
+
+	mu    sync.Mutex
+	batch []lib.LogLine
+	size  int
+	// send keeps the batches in order
+	send sync.Mutex
+	full chan struct{}
+	stop chan struct{}
+}
+
+func (s *shipper) line(l lib.LogLine) {
+	s.mu.Lock()
+	s.batch = append(s.batch, l)
+	s.size += len(l.Line)
+	full := s.size >= maxBatchBytes
+	s.mu.Unlock()
+	if full {
+		select {
+		case s.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// loop sends the lines every flushInterval, or sooner when a batch is
+// full, until stop is closed.
+func (s *shipper) loop() {
+	tick := time.NewTicker(flushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-tick.C:
+		case <-s.full:
+		}
+		s.flush()
+	}
+}
+
+// flush sends the lines written since the last flush. Lines the server
+// does not take are dropped; the agent's own log files keep them.
+func (s *shipper) flush() {
+	s.send.Lock()
+	defer s.send.Unlock()
+	s.mu.Lock()
+	batch := s.batch
+	s.batch, s.size = nil, 0
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	hb, err := s.a.Client.ReportBuildLogs(context.Background(), s.agent, s.build, batch)
+	if err != nil {
+		s.a.lost(s.agent, s.cancel, err, s.log)
+		return
+	}
+	s.a.cancel(hb.Cancel)
+}
+
+// uploader stores the artifacts of leased builds on the server.
+type uploader struct {
+	a *Agent
+}
+
+func (u uploader) Put(ctx context.Context, id, name string, r io.Reader) (storage.Info, error) {
+	ref, ok := ctx.Value(buildKey{}).(leaseRef)
+	if !ok {
+		return storage.Info{}, errors.New("agent: artifact of a build not leased")
+	}
+	art, err := u.a.Client.UploadBuildArtifact(ctx, ref.agent, ref.build, r, -1, client.UploadFilename(name))
+	if err != nil {
+		return storage.Info{}, err
+	}
+	return storage.Info{Id: id, Name: art.Filename, Size: art.Size, Checksum: art.Checksum}, nil
+}
+
+// status returns the HTTP status of an *client.APIError, else zero.
+func status(err error) int {
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// sleep waits for d, reporting false when ctx was done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,306 @@
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+var (
+	ErrUnknownAgent = errors.New("build: unknown or offline agent")
+	ErrNotLeased    = errors.New("build: not leased to this agent")
+)
+
+// agent is a registered remote worker and the builds it holds.
+type agent struct {
+	lib.Agent
+	leases map[string]*lease
+}
+
+// lease is a build running on an agent.
+type lease struct {
+	job      *job
+	agent    *agent
+	canceled bool
+}
+
+// Register adds a remote worker by name, replacing an offline one of the
+// same name, and returns it with the id it calls the engine with.
+func (en *Engine) Register(name, hostname string) (lib.Agent, error) {
+	id, err := lib.NewUUID()
+	if err != nil {
+		return lib.Agent{}, err
+	}
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	if en.closed {
+		return lib.Agent{}, ErrShutdown
+	}
+	for oid, a := range en.agents {
+		if a.Name == name && a.State == lib.AgentOffline {
+			delete(en.agents, oid)
+		}
+	}
+	now := time.Now().UTC()
+	a := &agent{
+		Agent:  lib.Agent{Id: id, Name: name, Hostname: hostname, State: lib.AgentOnline, Registered: now, LastSeen: now},
+		leases: map[string]*lease{},
+	}
+	en.agents[id] = a
+	en.log.Info("agent registered", "agent_id", id, "agent", name, "hostname", hostname)
+	return a.snapshot(), nil
+}
+
+// Agents returns the registered agents by name.
+func (en *Engine) Agents() []lib.Agent {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	list := make([]lib.Agent, 0, len(en.agents))
+	for _, a := range en.agents {
+		list = append(list, a.snapshot())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Registered.Before(list[j].Registered)
+	})
+	return list
+}
+
+// Heartbeat records that agent id is alive and returns the builds it holds
+// that were canceled. It fails with ErrUnknownAgent once the agent has
+// been marked offline.
+func (en *Engine) Heartbeat(id string) (lib.AgentHeartbeat, error) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	a, err := en.agent(id)
+	if err != nil {
+		return lib.AgentHeartbeat{}, err
+	}
+	return a.heartbeat(), nil
+}
+
+// Lease hands the next runnable queued build to agent id, moving it to
+// running there. ok is false when no build is waiting.
+func (en *Engine) Lease(id string) (l lib.AgentLease, ok bool, err error) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	a, err := en.agent(id)
+	if err != nil {
+		return lib.AgentLease{}, false, err
+	}
+	if en.closed {
+		return lib.AgentLease{}, false, ErrShutdown
+	}
+	i := en.next()
+	if i < 0 {
+		return lib.AgentLease{}, false, nil
+	}
+	j := en.pending[i]
+	en.pending = append(en.pending[:i], en.pending[i+1:]...)
+	ls := &lease{job: j, agent: a}
+	a.leases[j.build.Id] = ls
+	// the agent stops the build when it next hears from the engine
+	en.cancels[j.build.Id] = func() { ls.canceled = true }
+	run, wait := en.begin(j, "agent/"+a.Name)
+	en.log.Info("build leased", "build_id", run.Id, "antarian_id", j.antarian.Id, "agent_id", a.Id, "agent", a.Name, "wait", wait)
+	return lib.AgentLease{Build: run, Antarian: j.antarian}, true, nil
+}
+
+// Leased returns the record of build buildId when agent id holds it. It
+// counts as a heartbeat.
+func (en *Engine) Leased(id, buildId string) (lib.Build, error) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	ls, err := en.leased(id, buildId)
+	if err != nil {
+		return lib.Build{}, err
+	}
+	return *ls.job.build, nil
+}
+
+// AppendLog adds lines of output of build buildId, run by agent id, to the
+// build's log files and passes them to its watchers. It counts as a
+// heartbeat.
+func (en *Engine) AppendLog(id, buildId string, lines []lib.LogLine) (lib.AgentHeartbeat, error) {
+	en.mu.Lock()
+	ls, err := en.leased(id, buildId)
+	if err != nil {
+		en.mu.Unlock()
+		return lib.AgentHeartbeat{}, err
+	}
+	logFile, linesFile := ls.job.build.LogFile, ls.job.build.LogLines
+	en.mu.Unlock()
+
+	if err := appendLines(logFile, linesFile, lines); err != nil {
+		return lib.AgentHeartbeat{}, err
+	}
+	for _, line := range lines {
+		en.step(buildId, line)
+	}
+
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	a, err := en.agent(id)
+	if err != nil {
+		return lib.AgentHeartbeat{}, err
+	}
+	return a.heartbeat(), nil
+}
+
+// Report updates build buildId, run by agent id, with the outcome reported
+// by the agent: a retry of the build when it is still running, otherwise
+// its end. The engine keeps its own id, times, worker and log files.
+func (en *Engine) Report(id, buildId string, b lib.Build) (lib.Build, error) {
+	if b.State != lib.BuildRunning && !b.State.Done() {
+		return lib.Build{}, &lib.ValidationError{Field: "state", Message: fmt.Sprintf("cannot report %q", b.State)}
+	}
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	ls, err := en.leased(id, buildId)
+	if err != nil {
+		return lib.Build{}, err
+	}
+	run := *ls.job.build
+	if b.Attempt > run.Attempt && run.Attempt > 0 {
+		en.stats.Retried += int64(b.Attempt - run.Attempt)
+	}
+	run.State, run.Running, run.ExitCode, run.Error = b.State, !b.State.Done(), b.ExitCode, b.Error
+	run.Log = b.Log
+	run.Artifacts, run.Artifact, run.Size, run.Checksum = b.Artifacts, b.Artifact, b.Size, b.Checksum
+	run.Attempt, run.Attempts = b.Attempt, b.Attempts
+	if !b.State.Done() {
+		*ls.job.build = run
+		en.save(run)
+		return run, nil
+	}
+	run.End = time.Now()
+	en.release(ls)
+	en.finish(ls.job, run)
+	en.log.Info("build finished", "build_id", run.Id, "agent_id", id, "agent", ls.agent.Name,
+		"state", run.State, "exit_code", run.ExitCode, "duration", run.End.Sub(run.Start))
+	return run, nil
+}
+
+// reap marks offline the agents not heard from within timeout, failing
+// the builds they held, until the engine shuts down.
+func (en *Engine) reap(timeout time.Duration) {
+	defer en.wg.Done()
+	tick := time.NewTicker(timeout / 3)
+	defer tick.Stop()
+	for {
+		select {
+		case <-en.done:
+			return
+		case <-tick.C:
+		}
+		en.mu.Lock()
+		for _, a := range en.agents {
+			if a.State == lib.AgentOffline || time.Since(a.LastSeen) < timeout {
+				continue
+			}
+			a.State = lib.AgentOffline
+			en.log.Warn("agent went offline", "agent_id", a.Id, "agent", a.Name, "last_seen", a.LastSeen, "builds", len(a.leases))
+			for _, ls := range a.leases {
+				run := *ls.job.build
+				markFailed(&run, fmt.Sprintf("agent %s stopped responding", a.Name))
+				en.release(ls)
+				en.finish(ls.job, run)
+			}
+		}
+		en.mu.Unlock()
+	}
+}
+
+// agent returns online agent id, recording that it was heard from.
+// Callers hold en.mu.
+func (en *Engine) agent(id string) (*agent, error) {
+	a, ok := en.agents[id]
+	if !ok || a.State == lib.AgentOffline {
+		return nil, ErrUnknownAgent
+	}
+	a.LastSeen = time.Now().UTC()
+	return a, nil
+}
+
+// leased returns the lease of build buildId by agent id. Callers hold
+// en.mu.
+func (en *Engine) leased(id, buildId string) (*lease, error) {
+	a, err := en.agent(id)
+	if err != nil {
+		return nil, err
+	}
+	ls, ok := a.leases[buildId]
+	if !ok {
+		return nil, ErrNotLeased
+	}
+	return ls, nil
+}
+
+// release drops the lease ls from its agent. Callers hold en.mu.
+func (en *Engine) release(ls *lease) {
+	delete(ls.agent.leases, ls.job.build.Id)
+}
+
+func (a *agent) snapshot() lib.Agent {
+	s := a.Agent
+	s.Builds = make([]string, 0, len(a.leases))
+	for id := range a.leases {
+		s.Builds = append(s.Builds, id)
+	}
+	sort.Strings(s.Builds)
+	return s
+}
+
+func (a *agent) heartbeat() lib.AgentHeartbeat {
+	hb := lib.AgentHeartbeat{Agent: a.snapshot()}
+	for id, ls := range a.leases {
+		if ls.canceled {
+			hb.Cancel = append(hb.Cancel, id)
+		}
+	}
+	sort.Strings(hb.Cancel)
+	return hb
+}
+
+// appendLines adds lines to the log files of a build, as the executor
+// writes them.
+func appendLines(logFile, linesFile string, lines []lib.LogLine) error {
+	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
+		return err
+	}
+	lf, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer lf.Close()
+	jf, err := os.OpenFile(linesFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer jf.Close()
+	enc := json.NewEncoder(jf)
+	for _, line := range lines {
+		if _, err := lf.WriteString(line.Line + "\n"); err != nil {
+			return err
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func markFailed(b *lib.Build, reason string) {
+	b.State = lib.BuildFailed
+	b.Running = false
+	b.End = time.Now()
+	b.Error = reason
+}
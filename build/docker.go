@@ -0,0 +1,320 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// dockerAPIVersion is the Docker Engine API version requests are made
+// against; podman's compatible API serves it too.
+const dockerAPIVersion = "v1.41"
+
+// exitError is the non-zero exit of a build run through the Docker API.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// docker runs script in a container of spec.Image through the Docker
+// Engine API at DockerHost, pulling the image when the daemon lacks it.
+// dir is mounted at /workspace, so the artifacts the build leaves there are
+// collected as for any other build; the daemon must therefore see the
+// same filesystem. The container is removed when the build ends, killing
+// it when ctx is cancelled.
+func (e *Executor) docker(ctx context.Context, b *lib.Build, spec lib.BuildSpec, dir string, env []string, script string, stdout, stderr io.Writer) error {
+	c, err := e.dockerClient()
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := c.pull(ctx, spec.Image); err != nil {
+		return fmt.Errorf("pull %s: %w", spec.Image, err)
+	}
+	id, err := c.create(ctx, "antares-"+b.Id, dockerContainer{
+		Image:      spec.Image,
+		Cmd:        []string{"/bin/sh", "-c", script},
+		Env:        env,
+		WorkingDir: path.Join("/workspace", spec.WorkDir),
+		Labels:     map[string]string{"antares.build": b.Id},
+		HostConfig: dockerHostConfig{Binds: []string{abs + ":/workspace"}, Init: true},
+	})
+	if err != nil {
+		return fmt.Errorf("create container: %w", err)
+	}
+	defer func() {
+		// ctx may be cancelled already
+		rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		c.remove(rctx, id)
+	}()
+
+	if err := c.start(ctx, id); err != nil {
+		return fmt.Errorf("start container: %w", err)
+	}
+	logCtx, stopLogs := context.WithCancel(ctx)
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		c.logs(logCtx, id, stdout, stderr)
+	}()
+	defer func() {
+		stopLogs()
+		<-logsDone
+	}()
+
+	code, err := c.wait(ctx, id)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-logsDone:
+	case <-time.After(5 * time.Second):
+	}
+	b.ExitCode = code
+	if code != 0 {
+		return &exitError{code: code}
+	}
+	return nil
+}
+
+// dockerClient returns the client of DockerHost, made on first use.
+func (e *Executor) dockerClient() (*dockerClient, error) {
+	e.dockerOnce.Do(func() {
+		e.dockerCli, e.dockerErr = newDockerClient(e.DockerHost)
+	})
+	return e.dockerCli, e.dockerErr
+}
+
+// dockerClient calls the few Docker Engine API endpoints builds need.
+type dockerClient struct {
+	base string
+	http *http.Client
+}
+
+func newDockerClient(host string) (*dockerClient, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("docker host %q: %v", host, err)
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		var dialer net.Dialer
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &dockerClient{base: "http://docker", http: &http.Client{Transport: transport}}, nil
+	case "tcp":
+		return &dockerClient{base: "http://" + u.Host, http: &http.Client{}}, nil
+	}
+	return nil, fmt.Errorf("docker host %q: must be a unix:// or tcp:// address", host)
+}
+
+type dockerContainer struct {
+	Image      string
+	Cmd        []string
+	Env        []string
+	WorkingDir string
+	Labels     map[string]string
+	HostConfig dockerHostConfig
+}
+
+type dockerHostConfig struct {
+	Binds []string
+	Init  bool
+}
+
+// request sends a request to the API and returns the response when it
+// succeeded; otherwise the daemon's message as the error.
+func (c *dockerClient) request(ctx context.Context, method, p string, q url.Values, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(buf)
+	}
+	u := c.base + "/" + dockerAPIVersion + p
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var msg struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&msg)
+		if msg.Message == "" {
+			msg.Message = resp.Status
+		}
+		return nil, &dockerError{status: resp.StatusCode, message: msg.Message}
+	}
+	return resp, nil
+}
+
+// call is request decoding the JSON response into out, unless out is nil.
+func (c *dockerClient) call(ctx context.Context, method, p string, q url.Values, in, out interface{}) error {
+	resp, err := c.request(ctx, method, p, q, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// dockerError is an error answered by the daemon.
+type dockerError struct {
+	status  int
+	message string
+}
+
+func (e *dockerError) Error() string {
+	return fmt.Sprintf("docker: %s (%d)", e.message, e.status)
+}
+
+// pull fetches image unless the daemon has it already.
+func (c *dockerClient) pull(ctx context.Context, image string) error {
+	err := c.call(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil, nil)
+	var de *dockerError
+	if !errors.As(err, &de) || de.status != http.StatusNotFound {
+		return err
+	}
+	name, tag := imageTag(image)
+	resp, err := c.request(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": {name}, "tag": {tag}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the daemon reports failures within the stream of progress
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&progress); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if progress.Error != "" {
+			return errors.New(progress.Error)
+		}
+	}
+}
+
+// imageTag splits image into the name and tag or digest to pull, latest
+// when it has neither; the API would pull every tag otherwise.
+func imageTag(image string) (name, tag string) {
+	if name, digest, ok := strings.Cut(image, "@"); ok {
+		return name, digest
+	}
+	slash := strings.LastIndex(image, "/")
+	if colon := strings.LastIndex(image, ":"); colon > slash {
+		return image[:colon], image[colon+1:]
+	}
+	return image, "latest"
+}
+
+func (c *dockerClient) create(ctx context.Context, name string, cfg dockerContainer) (string, error) {
+	var created struct {
+		Id string
+	}
+	err := c.call(ctx, http.MethodPost, "/containers/create", url.Values{"name": {name}}, cfg, &created)
+	return created.Id, err
+}
+
+func (c *dockerClient) start(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// wait returns the exit code of container id once it has stopped.
+func (c *dockerClient) wait(ctx context.Context, id string) (int, error) {
+	var result struct {
+		StatusCode int
+		Error      *struct {
+			Message string
+		}
+	}
+	if err := c.call(ctx, http.MethodPost, "/containers/"+id+"/wait", nil, nil, &result); err != nil {
+		return -1, err
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return -1, errors.New(result.Error.Message)
+	}
+	return result.StatusCode, nil
+}
+
+// remove deletes container id, killing it if it is still running.
+func (c *dockerClient) remove(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, "/containers/"+id, url.Values{"force": {"1"}}, nil, nil)
+}
+
+// logs copies the output of container id to stdout and stderr until it
+// stops.
+func (c *dockerClient) logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	resp, err := c.request(ctx, http.MethodGet, "/containers/"+id+"/logs", url.Values{"follow": {"1"}, "stdout": {"1"}, "stderr": {"1"}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return demux(resp.Body, stdout, stderr)
+}
+
+// demux splits the multiplexed output of a container without a terminal:
+// frames of an 8-byte header, naming the stream and the length, and the
+// bytes written to it.
+func demux(r io.Reader, stdout, stderr io.Writer) error {
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,525 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+var (
+	ErrNotFound  = errors.New("build: not found")
+	ErrFinished  = errors.New("build: already finished")
+	ErrQueueFull = errors.New("build: queue is full")
+	ErrShutdown  = errors.New("build: engine is shutting down")
+	ErrArchived  = errors.New("build: antarian is archived")
+)
+
+// Options size the Engine's worker pool and queue.
+type Options struct {
+	// Workers is the number of builds run at once.
+	Workers int
+	// QueueSize bounds the builds waiting for a worker.
+	QueueSize int
+	// Serialize keeps two builds of the same Antarian from running at the
+	// same time; later ones wait in the queue.
+	Serialize bool
+	// CancelOnShutdown cancels running builds on Shutdown instead of
+	// letting them finish.
+	CancelOnShutdown bool
+	// RetryDelay is the wait before the first retry of a failed build
+	// whose buildspec allows retries; it doubles with each one after.
+	RetryDelay time.Duration
+	// AgentTimeout is how long an agent may go unheard from before it is
+	// marked offline and the builds it holds fail; zero never does.
+	AgentTimeout time.Duration
+	// NamespaceLimit bounds the builds of one namespace running at once,
+	// so a busy namespace cannot hold every worker; zero is no limit.
+	NamespaceLimit int
+	// PriorityAging raises the priority of a queued build by one for each
+	// period it waits, so low priority builds are not starved; zero
+	// never does.
+	PriorityAging time.Duration
+}
+
+// Stats is a snapshot of the queue for metrics. Succeeded, Failed and
+// Canceled split Finished by outcome; Retried counts the failed attempts
+// run again.
+type Stats struct {
+	Workers   int           `json:"workers"`
+	Active    int           `json:"active"`
+	Pending   int           `json:"pending"`
+	QueueSize int           `json:"queue_size"`
+	Started   int64         `json:"started"`
+	Finished  int64         `json:"finished"`
+	Succeeded int64         `json:"succeeded"`
+	Failed    int64         `json:"failed"`
+	Canceled  int64         `json:"canceled"`
+	Retried   int64         `json:"retried"`
+	WaitTotal time.Duration `json:"wait_total_ns"`
+	WaitMax   time.Duration `json:"wait_max_ns"`
+}
+
+// Store persists build records. The Engine writes every state change
+// through it and serves finished builds from it.
+type Store interface {
+	SaveBuild(b lib.Build) error
+	FindBuild(id string) (lib.Build, bool)
+}
+
+type job struct {
+	build    *lib.Build
+	antarian lib.Antarian
+	queued   time.Time
+}
+
+func (j *job) namespace() string {
+	return j.antarian.NamespaceOrDefault()
+}
+
+// Engine queues builds and runs them on a fixed pool of workers by
+// priority and age, skipping over builds held back by Options.Serialize,
+// Options.NamespaceLimit or the builds they depend on.
+type Engine struct {
+	exec  *Executor
+	opts  Options
+	store Store
+	log   *slog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	closed  bool
+	pending []*job
+	// builds holds the queued and running builds only
+	builds  map[string]*lib.Build
+	cancels map[string]context.CancelFunc
+	running map[string]int
+	// namespaces counts the running builds by namespace
+	namespaces map[string]int
+	// watchers follow the queued and running builds, by build id
+	watchers map[string][]chan Progress
+	// agents are the remote workers, by id
+	agents map[string]*agent
+	stats  Stats
+	wg     sync.WaitGroup
+	// done is closed on Shutdown
+	done chan struct{}
+}
+
+// NewEngine starts the worker pool. Call Shutdown to stop it.
+func NewEngine(exec *Executor, opts Options, store Store, log *slog.Logger) *Engine {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize < 1 {
+		opts.QueueSize = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	en := &Engine{
+		exec:    exec,
+		opts:    opts,
+		store:   store,
+		log:     log,
+		ctx:     ctx,
+		cancel:  cancel,
+		builds:  map[string]*lib.Build{},
+		cancels: map[string]context.CancelFunc{},
+		running: map[string]int{},
+	}
+	en.namespaces = map[string]int{}
+	en.cond = sync.NewCond(&en.mu)
+	en.watchers = map[string][]chan Progress{}
+	en.agents = map[string]*agent{}
+	en.done = make(chan struct{})
+	en.stats.Workers = opts.Workers
+	en.stats.QueueSize = opts.QueueSize
+	host, err := os.Hostname()
+	if err != nil {
+		host = "antares"
+	}
+	for i := 0; i < opts.Workers; i++ {
+		en.wg.Add(1)
+		go en.worker(fmt.Sprintf("%s/%d", host, i+1))
+	}
+	if opts.AgentTimeout > 0 {
+		en.wg.Add(1)
+		go en.reap(opts.AgentTimeout)
+	}
+	return en
+}
+
+// Start queues a build of a at priority and returns its record together
+// with its 1-based position in the queue. It fails with ErrQueueFull when
+// the queue is at capacity.
+func (en *Engine) Start(a lib.Antarian, priority int) (lib.Build, int, error) {
+	builds, position, err := en.StartGraph([]Node{{Antarian: a}}, priority)
+	if err != nil {
+		return lib.Build{}, 0, err
+	}
+	return builds[0], position, nil
+}
+
+// Node is a build queued by StartGraph, of Antarian once the builds of the
+// nodes at the indices in Requires have succeeded.
+type Node struct {
+	Antarian lib.Antarian
+	Requires []int
+}
+
+// StartGraph queues a build of each of nodes at priority and returns their
+// records, in order, with the 1-based queue position of the last. Nodes
+// may only require nodes before them. Builds whose requirements are met
+// run in parallel; a build is canceled when one it requires does not
+// succeed. It fails with ErrQueueFull, queuing nothing, when the queue
+// cannot hold them all, and with ErrArchived when a node's Antarian is
+// archived.
+func (en *Engine) StartGraph(nodes []Node, priority int) ([]lib.Build, int, error) {
+	jobs := make([]*job, len(nodes))
+	now := time.Now()
+	for i, n := range nodes {
+		if n.Antarian.CurrentStatus() == lib.StatusArchived {
+			return nil, 0, ErrArchived
+		}
+		b, err := lib.NewBuild(n.Antarian)
+		if err != nil {
+			return nil, 0, err
+		}
+		b.Priority = priority
+		for _, k := range n.Requires {
+			if k < 0 || k >= i {
+				return nil, 0, fmt.Errorf("build: node %d requires node %d, which does not come before it", i, k)
+			}
+			b.DependsOn = append(b.DependsOn, jobs[k].build.Id)
+		}
+		jobs[i] = &job{build: b, antarian: n.Antarian, queued: now}
+	}
+
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	if en.closed {
+		return nil, 0, ErrShutdown
+	}
+	if len(en.pending)+len(jobs) > en.opts.QueueSize {
+		return nil, 0, ErrQueueFull
+	}
+	builds := make([]lib.Build, len(jobs))
+	for i, j := range jobs {
+		en.builds[j.build.Id] = j.build
+		en.pending = append(en.pending, j)
+		en.save(*j.build)
+		builds[i] = *j.build
+	}
+	en.cond.Signal()
+	last := jobs[len(jobs)-1]
+	position := 1
+	for _, k := range en.pending {
+		if k != last && en.before(k, last, now) {
+			position++
+		}
+	}
+	return builds, position, nil
+}
+
+// Get returns a copy of the build record.
+func (en *Engine) Get(id string) (lib.Build, bool) {
+	en.mu.Lock()
+	if b, ok := en.builds[id]; ok {
+		defer en.mu.Unlock()
+		return *b, true
+	}
+	en.mu.Unlock()
+	return en.store.FindBuild(id)
+}
+
+// Cancel drops a queued build or stops a running one. A running build moves
+// to canceled once its command has exited.
+func (en *Engine) Cancel(id string) error {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	b, ok := en.builds[id]
+	if !ok {
+		if _, ok := en.store.FindBuild(id); ok {
+			return ErrFinished
+		}
+		return ErrNotFound
+	}
+	if cancel, ok := en.cancels[id]; ok {
+		cancel()
+		return nil
+	}
+	for i, j := range en.pending {
+		if j.build.Id == id {
+			en.pending = append(en.pending[:i], en.pending[i+1:]...)
+			markCanceled(b, "build canceled")
+			delete(en.builds, id)
+			en.save(*b)
+			en.cancelDependents(id)
+			return nil
+		}
+	}
+	return ErrFinished
+}
+
+// Stats returns the current queue metrics.
+func (en *Engine) Stats() Stats {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	s := en.stats
+	s.Pending = len(en.pending)
+	return s
+}
+
+// Shutdown stops accepting builds and cancels those still queued and those
+// running on agents. Running builds are left to finish unless
+// Options.CancelOnShutdown is set or ctx expires first, in which case they
+// are cancelled. Shutdown returns once every worker has exited, so no
+// build is left running.
+func (en *Engine) Shutdown(ctx context.Context) error {
+	en.mu.Lock()
+	en.closed = true
+	close(en.done)
+	for _, j := range en.pending {
+		markCanceled(j.build, "server shutting down")
+		delete(en.builds, j.build.Id)
+		en.save(*j.build)
+	}
+	en.pending = nil
+	for _, a := range en.agents {
+		for _, ls := range a.leases {
+			run := *ls.job.build
+			markCanceled(&run, "server shutting down")
+			en.release(ls)
+			en.finish(ls.job, run)
+		}
+	}
+	en.cond.Broadcast()
+	en.mu.Unlock()
+
+	if en.opts.CancelOnShutdown {
+		en.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		en.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		en.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// worker runs builds until the engine shuts down, recording name on each.
+func (en *Engine) worker(name string) {
+	defer en.wg.Done()
+	for {
+		en.mu.Lock()
+		i := en.next()
+		for i < 0 && !en.closed {
+			en.cond.Wait()
+			i = en.next()
+		}
+		if i < 0 {
+			en.mu.Unlock()
+			return
+		}
+		j := en.pending[i]
+		en.pending = append(en.pending[:i], en.pending[i+1:]...)
+		ctx, cancel := context.WithCancel(en.ctx)
+		en.cancels[j.build.Id] = cancel
+		run, wait := en.begin(j, name)
+		en.mu.Unlock()
+
+		log := en.log.With("build_id", run.Id, "antarian_id", j.antarian.Id, "worker", name)
+		log.Info("build started", "name", j.antarian.Name, "version", j.antarian.Version, "wait", wait)
+		en.exec.RunAttempts(ctx, &run, j.antarian, en.opts.RetryDelay,
+			func(line lib.LogLine) { en.step(run.Id, line) },
+			func(retry lib.Build, delay time.Duration) {
+				log.Warn("build attempt failed, retrying", "attempt", retry.Attempt-1, "err", retry.Attempts[len(retry.Attempts)-1].Error, "delay", delay)
+				en.mu.Lock()
+				defer en.mu.Unlock()
+				en.stats.Retried++
+				*j.build = retry
+				en.save(retry)
+			})
+		cancel()
+		log.Info("build finished", "state", run.State, "exit_code", run.ExitCode, "duration", run.End.Sub(run.Start))
+
+		en.mu.Lock()
+		en.finish(j, run)
+		en.mu.Unlock()
+	}
+}
+
+// begin moves the job j, taken off the queue, to running on worker and
+// returns its record and how long it waited. Callers hold en.mu.
+func (en *Engine) begin(j *job, worker string) (lib.Build, time.Duration) {
+	en.running[j.antarian.Id]++
+	en.namespaces[j.namespace()]++
+	wait := time.Since(j.queued)
+	en.stats.Active++
+	en.stats.Started++
+	en.stats.WaitTotal += wait
+	if wait > en.stats.WaitMax {
+		en.stats.WaitMax = wait
+	}
+	j.build.State = lib.BuildRunning
+	j.build.Running = true
+	j.build.Start = time.Now()
+	j.build.Worker = worker
+	// known before the first line is, so readers can follow the files
+	j.build.LogFile, j.build.LogLines = en.exec.logPaths(j.build.Id)
+	run := *j.build
+	en.save(run)
+	return run, wait
+}
+
+// finish records run, the final record of the build of j, and frees its
+// place. Callers hold en.mu.
+func (en *Engine) finish(j *job, run lib.Build) {
+	en.save(run)
+	delete(en.builds, run.Id)
+	delete(en.cancels, run.Id)
+	if en.running[j.antarian.Id]--; en.running[j.antarian.Id] == 0 {
+		delete(en.running, j.antarian.Id)
+	}
+	if en.namespaces[j.namespace()]--; en.namespaces[j.namespace()] == 0 {
+		delete(en.namespaces, j.namespace())
+	}
+	if run.State != lib.BuildSucceeded {
+		en.cancelDependents(run.Id)
+	}
+	en.stats.Active--
+	en.stats.Finished++
+	switch run.State {
+	case lib.BuildSucceeded:
+		en.stats.Succeeded++
+	case lib.BuildFailed:
+		en.stats.Failed++
+	case lib.BuildCanceled:
+		en.stats.Canceled++
+	}
+	// a build held back by serialization or its namespace may be runnable
+	// now
+	en.cond.Broadcast()
+}
+
+// next returns the index of the pending job to run next, or -1 when none
+// is runnable. Callers hold en.mu.
+func (en *Engine) next() int {
+	now := time.Now()
+	best := -1
+	for i, j := range en.pending {
+		if en.opts.Serialize && en.running[j.antarian.Id] > 0 {
+			continue
+		}
+		if en.opts.NamespaceLimit > 0 && en.namespaces[j.namespace()] >= en.opts.NamespaceLimit {
+			continue
+		}
+		if en.waiting(j) {
+			continue
+		}
+		if best < 0 || en.before(j, en.pending[best], now) {
+			best = i
+		}
+	}
+	return best
+}
+
+// waiting reports whether a build job j depends on is still queued or
+// running. Callers hold en.mu.
+func (en *Engine) waiting(j *job) bool {
+	for _, id := range j.build.DependsOn {
+		if _, ok := en.builds[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cancelDependents cancels the queued builds that depend on build id,
+// which did not succeed, and in turn those that depend on them. Callers
+// hold en.mu.
+func (en *Engine) cancelDependents(id string) {
+	for i := 0; i < len(en.pending); i++ {
+		j := en.pending[i]
+		if !dependsOn(j.build, id) {
+			continue
+		}
+		en.pending = append(en.pending[:i], en.pending[i+1:]...)
+		markCanceled(j.build, fmt.Sprintf("required build %s did not succeed", id))
+		delete(en.builds, j.build.Id)
+		en.save(*j.build)
+		en.cancelDependents(j.build.Id)
+		// the queue may have lost any job since
+		i = -1
+	}
+}
+
+func dependsOn(b *lib.Build, id string) bool {
+	for _, dep := range b.DependsOn {
+		if dep == id {
+			return true
+		}
+	}
+	return false
+}
+
+// before reports whether job j runs before job k at now: it has the
+// higher priority, aged by Options.PriorityAging, else its namespace runs
+// fewer builds, else it was queued first. Callers hold en.mu.
+func (en *Engine) before(j, k *job, now time.Time) bool {
+	if pj, pk := en.priority(j, now), en.priority(k, now); pj != pk {
+		return pj > pk
+	}
+	if nj, nk := en.namespaces[j.namespace()], en.namespaces[k.namespace()]; nj != nk {
+		return nj < nk
+	}
+	return j.queued.Before(k.queued)
+}
+
+// priority returns the priority of job j at now, raised by one for each
+// Options.PriorityAging it has waited.
+func (en *Engine) priority(j *job, now time.Time) int {
+	p := j.build.Priority
+	if en.opts.PriorityAging > 0 {
+		p += int(now.Sub(j.queued) / en.opts.PriorityAging)
+	}
+	return p
+}
+
+// save writes b through to the store and passes it on to its watchers,
+// who are let go once b is finished. A failed write is logged rather than
+// failing the build. Callers hold en.mu.
+func (en *Engine) save(b lib.Build) {
+	if err := en.store.SaveBuild(b); err != nil {
+		en.log.Error("save build", "err", err, "build_id", b.Id, "state", b.State)
+	}
+	en.notify(Progress{Build: b})
+	if b.State.Done() {
+		for _, ch := range en.watchers[b.Id] {
+			close(ch)
+		}
+		delete(en.watchers, b.Id)
+	}
+}
+
+func markCanceled(b *lib.Build, reason string) {
+	b.State = lib.BuildCanceled
+	b.Running = false
+	b.End = time.Now()
+	b.Error = reason
+}
@@ -0,0 +1,239 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// memStore keeps build records, noting the order builds start in and how
+// many run at once.
+type memStore struct {
+	mu      sync.Mutex
+	builds  map[string]lib.Build
+	started []string
+	running map[string]bool
+	maxRun  int
+}
+
+func newMemStore() *memStore {
+	return &memStore{builds: map[string]lib.Build{}, running: map[string]bool{}}
+}
+
+func (s *memStore) SaveBuild(b lib.Build) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.builds[b.Id] = b
+	switch {
+	case b.State == lib.BuildRunning && !s.running[b.Id]:
+		s.running[b.Id] = true
+		s.started = append(s.started, b.Name)
+		if len(s.running) > s.maxRun {
+			s.maxRun = len(s.running)
+		}
+	case b.State.Done():
+		delete(s.running, b.Id)
+	}
+	return nil
+}
+
+func (s *memStore) FindBuild(id string) (lib.Build, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.builds[id]
+	return b, ok
+}
+
+// wait returns the records of ids once every one is done.
+func (s *memStore) wait(t *testing.T, ids ...string) []lib.Build {
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		s.mu.Lock()
+		builds := make([]lib.Build, 0, len(ids))
+		for _, id := range ids {
+			if b := s.builds[id]; b.State.Done() {
+				builds = append(builds, b)
+			}
+		}
+		s.mu.Unlock()
+		if len(builds) == len(ids) {
+			return builds
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d builds finished", len(builds), len(ids))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newEngine(t *testing.T, opts Options) (*Engine, *memStore) {
+	t.Helper()
+	store := newMemStore()
+	en := NewEngine(&Executor{WorkDir: t.TempDir()}, opts, store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		en.Shutdown(ctx)
+	})
+	return en, store
+}
+
+// gated returns an Antarian whose build runs until open is called.
+func gated(t *testing.T, name string) (a lib.Antarian, open func()) {
+	gate := filepath.Join(t.TempDir(), "gate")
+	a = testAntarian(name, `while [ ! -f "$GATE" ]; do sleep 0.02; done`)
+	a.BuildSpec.Env = map[string]string{"GATE": gate}
+	return a, func() { os.WriteFile(gate, nil, 0644) }
+}
+
+func start(t *testing.T, en *Engine, a lib.Antarian, priority int) lib.Build {
+	t.Helper()
+	b, _, err := en.Start(a, priority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// busy waits for a worker to take a build off the queue.
+func busy(en *Engine) {
+	for en.Stats().Active == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEngineOrder(t *testing.T) {
+	en, store := newEngine(t, Options{Workers: 1, QueueSize: 10})
+	blocker, open := gated(t, "blocker")
+	ids := []string{start(t, en, blocker, 0).Id}
+	busy(en)
+	tests := []struct {
+		name     string
+		priority int
+		position int
+	}{
+		{"first", 0, 1},
+		{"second", 0, 2},
+		{"urgent", 5, 1},
+		{"third", 0, 4},
+	}
+	for _, tt := range tests {
+		b, position, err := en.Start(testAntarian(tt.name, "true"), tt.priority)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if position != tt.position {
+			t.Errorf("%s queued at %d, want %d", tt.name, position, tt.position)
+		}
+		ids = append(ids, b.Id)
+	}
+	open()
+	store.wait(t, ids...)
+
+	want := []string{"blocker", "urgent", "first", "second", "third"}
+	if len(store.started) != len(want) {
+		t.Fatalf("started %v, want %v", store.started, want)
+	}
+	for i := range want {
+		if store.started[i] != want[i] {
+			t.Fatalf("started %v, want %v", store.started, want)
+		}
+	}
+}
+
+func TestEngineConcurrency(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		antarians []string
+		max       int
+	}{
+		{"worker cap", Options{Workers: 2, QueueSize: 10}, []string{"a", "b", "c", "d", "e", "f"}, 2},
+		{"serialized", Options{Workers: 3, QueueSize: 10, Serialize: true}, []string{"a", "a", "a", "a"}, 1},
+		{"not serialized", Options{Workers: 3, QueueSize: 10}, []string{"a", "a", "a"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			en, store := newEngine(t, tt.opts)
+			var ids []string
+			for _, name := range tt.antarians {
+				ids = append(ids, start(t, en, testAntarian(name, "sleep 0.2"), 0).Id)
+			}
+			for _, b := range store.wait(t, ids...) {
+				if b.State != lib.BuildSucceeded {
+					t.Errorf("build %s %s: %s", b.Name, b.State, b.Error)
+				}
+			}
+			if store.maxRun != tt.max {
+				t.Errorf("%d builds ran at once, want %d", store.maxRun, tt.max)
+			}
+			if s := en.Stats(); s.Active != 0 || s.Pending != 0 || s.Succeeded != int64(len(ids)) {
+				t.Errorf("stats = %+v", s)
+			}
+		})
+	}
+}
+
+func TestEngineQueueFull(t *testing.T) {
+	en, _ := newEngine(t, Options{Workers: 1, QueueSize: 2})
+	blocker, open := gated(t, "blocker")
+	defer open()
+	start(t, en, blocker, 0)
+	busy(en)
+	start(t, en, testAntarian("a", "true"), 0)
+	start(t, en, testAntarian("b", "true"), 0)
+	if _, _, err := en.Start(testAntarian("c", "true"), 0); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Start on a full queue = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestEngineShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		timeout time.Duration
+		err     error
+		state   lib.BuildState
+	}{
+		{"finish running builds", Options{Workers: 1, QueueSize: 5}, 10 * time.Second, nil, lib.BuildSucceeded},
+		{"cancel on shutdown", Options{Workers: 1, QueueSize: 5, CancelOnShutdown: true}, 10 * time.Second, nil, lib.BuildCanceled},
+		{"deadline passes", Options{Workers: 1, QueueSize: 5}, 300 * time.Millisecond, context.DeadlineExceeded, lib.BuildCanceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemStore()
+			en := NewEngine(&Executor{WorkDir: t.TempDir()}, tt.opts, store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			running := start(t, en, testAntarian("running", "sleep 1"), 0)
+			busy(en)
+			queued := start(t, en, testAntarian("queued", "true"), 0)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if err := en.Shutdown(ctx); err != tt.err {
+				t.Errorf("Shutdown = %v, want %v", err, tt.err)
+			}
+			// every build is final the moment Shutdown returns
+			if b, _ := store.FindBuild(running.Id); b.State != tt.state || b.Running {
+				t.Errorf("running build = %s, running %v; want %s", b.State, b.Running, tt.state)
+			}
+			if b, _ := store.FindBuild(queued.Id); b.State != lib.BuildCanceled || b.Error != "server shutting down" {
+				t.Errorf("queued build = %s, %q; want canceled", b.State, b.Error)
+			}
+			if len(store.running) != 0 {
+				t.Errorf("%d builds left running", len(store.running))
+			}
+			if _, _, err := en.Start(testAntarian("late", "true"), 0); !errors.Is(err, ErrShutdown) {
+				t.Errorf("Start after Shutdown = %v, want ErrShutdown", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,520 @@
+// Package build runs the build command of an Antarian and tracks the
+// resulting Build records.
+package build
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/storage"
+)
+
+// MaxLogSize bounds the output kept in Build.Log; the tail is kept. The
+// complete output is written to Build.LogFile.
+const MaxLogSize = 1 << 20
+
+// Executor runs a single build as a shell command.
+type Executor struct {
+	// Command is run when the Antarian's BuildSpec has no commands.
+	Command string
+	// Shell runs the command with "-c"; /bin/sh when empty.
+	Shell string
+	// WorkDir holds one working directory per build.
+	WorkDir string
+	// Timeout bounds each build; zero means no limit.
+	Timeout time.Duration
+	// Runtime runs the builds of specs with an Image: docker, podman or
+	// another command taking the same run arguments. Empty means docker.
+	Runtime string
+	// DockerHost, when set, runs the builds of specs with an Image through
+	// the Docker Engine API at this address, unix:///path or
+	// tcp://host:port, instead of Runtime.
+	DockerHost string
+	// Artifacts, when set, receives the artifacts of successful builds,
+	// as described by BuildSpec.Artifacts.
+	Artifacts ArtifactStore
+	// Signer, when set, signs each artifact stored, storing the signature
+	// beside it under its name plus lib.SignatureExt.
+	Signer crypto.Signer
+
+	dockerOnce sync.Once
+	dockerCli  *dockerClient
+	dockerErr  error
+}
+
+// ArtifactStore receives the artifacts of builds; a storage.Storage is
+// one.
+type ArtifactStore interface {
+	Put(ctx context.Context, id, name string, r io.Reader) (storage.Info, error)
+}
+
+// ErrNoCommand is returned for Antarians whose BuildSpec has no commands
+// when the Executor has no default command either.
+var ErrNoCommand = errors.New("build: no build command configured")
+
+// Run executes the build of a, recording output, exit code and final state
+// in b. It returns once the command has exited, ctx is cancelled or the
+// timeout passed; b.State tells which.
+func (e *Executor) Run(ctx context.Context, b *lib.Build, a lib.Antarian) {
+	e.RunLines(ctx, b, a, nil)
+}
+
+// RunLines is Run that also passes each line of output to lines as it is
+// written, unless lines is nil, and returns the error the build failed
+// with. Later attempts of a retried build, b.Attempt above 1, append to the
+// output of the earlier ones.
+func (e *Executor) RunLines(ctx context.Context, b *lib.Build, a lib.Antarian, lines func(lib.LogLine)) error {
+	b.State = lib.BuildRunning
+	b.Running = true
+	if b.Start.IsZero() {
+		b.Start = time.Now()
+	}
+
+	err := e.run(ctx, b, a, lines)
+
+	b.End = time.Now()
+	b.Running = false
+	switch {
+	case err == nil:
+		b.State = lib.BuildSucceeded
+	case errors.Is(err, context.Canceled):
+		b.State = lib.BuildCanceled
+		b.Error = "build canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		b.State = lib.BuildFailed
+		b.Error = fmt.Sprintf("build timed out after %s", e.timeout(a))
+	default:
+		b.State = lib.BuildFailed
+		b.Error = err.Error()
+	}
+	return err
+}
+
+// RunAttempts is RunLines retrying failures that may pass, non-zero exits
+// and timeouts, as often as the buildspec of a allows, after a delay
+// doubling from delay. Each attempt of such a build is recorded in
+// b.Attempts, and retry is called with b and the delay before each retry.
+func (e *Executor) RunAttempts(ctx context.Context, b *lib.Build, a lib.Antarian, delay time.Duration, lines func(lib.LogLine), retry func(lib.Build, time.Duration)) {
+	retries := 0
+	if a.BuildSpec != nil {
+		retries = a.BuildSpec.Retries
+	}
+	if retries > 0 {
+		b.Attempt = 1
+	}
+	for {
+		start := time.Now()
+		err := e.RunLines(ctx, b, a, lines)
+		if retries == 0 {
+			return
+		}
+		b.Attempts = append(b.Attempts, lib.BuildAttempt{
+			Attempt:  b.Attempt,
+			State:    b.State,
+			Start:    start,
+			End:      b.End,
+			ExitCode: b.ExitCode,
+			Error:    b.Error,
+		})
+		if b.State != lib.BuildFailed || b.Attempt > retries || !transient(err) {
+			return
+		}
+		b.Attempt++
+		b.State, b.Running, b.End = lib.BuildRunning, true, time.Time{}
+		b.ExitCode, b.Error = -1, ""
+		b.Artifacts, b.Artifact, b.Size, b.Checksum = nil, "", 0, ""
+		if retry != nil {
+			retry(*b, delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			markCanceled(b, "build canceled")
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// transient reports whether a build that failed with err may pass when run
+// again: it exited non-zero or timed out, rather than could not be run.
+func transient(err error) bool {
+	var exit *exec.ExitError
+	var containerExit *exitError
+	return errors.As(err, &exit) || errors.As(err, &containerExit) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// timeout returns how long a build of a may run: the timeout of its
+// buildspec, else Executor.Timeout.
+func (e *Executor) timeout(a lib.Antarian) time.Duration {
+	if a.BuildSpec != nil {
+		if d := a.BuildSpec.TimeoutDuration(); d > 0 {
+			return d
+		}
+	}
+	return e.Timeout
+}
+
+func (e *Executor) run(ctx context.Context, b *lib.Build, a lib.Antarian, lines func(lib.LogLine)) error {
+	var spec lib.BuildSpec
+	if a.BuildSpec != nil {
+		spec = *a.BuildSpec
+	}
+	if spec.Command == "" && len(spec.Steps) == 0 {
+		spec.Command = e.Command
+	}
+	script := spec.Command
+	if len(spec.Steps) > 0 {
+		script = "set -e\n" + strings.Join(spec.Steps, "\n")
+	}
+	if script == "" {
+		return ErrNoCommand
+	}
+
+	dir := filepath.Join(e.WorkDir, b.Id)
+	workDir := filepath.Join(dir, filepath.FromSlash(spec.WorkDir))
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return err
+	}
+
+	if timeout := e.timeout(a); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	b.LogFile, b.LogLines = e.logPaths(b.Id)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	seq := 0
+	if b.Attempt > 1 {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		// number the lines on from those of the earlier attempts
+		n, err := countLines(b.LogLines)
+		if err != nil {
+			return err
+		}
+		seq = n
+	}
+	logFile, err := os.OpenFile(b.LogFile, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	linesFile, err := os.OpenFile(b.LogLines, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer linesFile.Close()
+
+	out := &tailBuffer{max: MaxLogSize, w: logFile}
+	rec := &lineRecorder{seq: seq, attempt: b.Attempt, enc: json.NewEncoder(linesFile), lines: lines}
+	stdout, stderr := rec.stream("stdout"), rec.stream("stderr")
+	env := append(Env(b, a), specEnv(spec)...)
+	if spec.Image != "" && e.DockerHost != "" {
+		err = e.docker(ctx, b, spec, dir, env, script, io.MultiWriter(out, stdout), io.MultiWriter(out, stderr))
+	} else {
+		err = e.command(ctx, b, spec, dir, env, script, io.MultiWriter(out, stdout), io.MultiWriter(out, stderr))
+	}
+	stdout.Flush()
+	stderr.Flush()
+	b.Log = out.String()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	if len(spec.Package) > 0 {
+		if err := pack(ctx, b, a, workDir, spec.Package); err != nil {
+			return fmt.Errorf("package %s: %w", a.Filename(), err)
+		}
+	}
+	return e.collect(ctx, b, a, spec, workDir)
+}
+
+// command runs script with the shell, or in a container by the runtime
+// CLI when spec names an image, recording its exit code in b.
+func (e *Executor) command(ctx context.Context, b *lib.Build, spec lib.BuildSpec, dir string, env []string, script string, stdout, stderr io.Writer) error {
+	var cmd *exec.Cmd
+	if spec.Image != "" {
+		var err error
+		cmd, err = e.container(ctx, b, spec, dir, env, script)
+		if err != nil {
+			return err
+		}
+	} else {
+		shell := e.Shell
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		cmd = exec.CommandContext(ctx, shell, "-c", script)
+		cmd.Dir = filepath.Join(dir, filepath.FromSlash(spec.WorkDir))
+		killGroup(cmd)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = 5 * time.Second
+
+	err := cmd.Run()
+	if cmd.ProcessState != nil {
+		b.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	return err
+}
+
+// logPaths returns the files the output of build id is written to: as it
+// came and as JSON lines.
+func (e *Executor) logPaths(id string) (logFile, lines string) {
+	dir := filepath.Join(e.WorkDir, id)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return filepath.Join(dir, "build.log"), filepath.Join(dir, "build.jsonl")
+}
+
+// container returns the command running script in a container of
+// spec.Image, with dir mounted at /workspace and the variables named in env
+// passed through. Cancelling ctx removes the container.
+func (e *Executor) container(ctx context.Context, b *lib.Build, spec lib.BuildSpec, dir string, env []string, script string) (*exec.Cmd, error) {
+	runtime := e.Runtime
+	if runtime == "" {
+		runtime = "docker"
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	name := "antares-" + b.Id
+	args := []string{"run", "--rm", "--init", "--name", name,
+		"-v", abs + ":/workspace", "-w", path.Join("/workspace", spec.WorkDir)}
+	for _, kv := range env {
+		k, _, _ := strings.Cut(kv, "=")
+		args = append(args, "-e", k)
+	}
+	args = append(args, spec.Image, "/bin/sh", "-c", script)
+	cmd := exec.CommandContext(ctx, runtime, args...)
+	killGroup(cmd)
+	kill := cmd.Cancel
+	cmd.Cancel = func() error {
+		// killing the client leaves the container running
+		exec.Command(runtime, "rm", "-f", name).Run()
+		if kill != nil {
+			return kill()
+		}
+		return cmd.Process.Kill()
+	}
+	return cmd, nil
+}
+
+// specEnv returns the variables of spec.Env, sorted by name.
+func specEnv(spec lib.BuildSpec) []string {
+	env := make([]string, 0, len(spec.Env))
+	for k, v := range spec.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// collect stores the artifacts the build wrote to dir, recording them in
+// b: the files matching spec.Artifacts and, without any or when the build
+// packaged one, the file named by a's Filename if there is one. The
+// Antarian's artifact is its Filename when that is among them, else the
+// first. The build's logs are never collected.
+func (e *Executor) collect(ctx context.Context, b *lib.Build, a lib.Antarian, spec lib.BuildSpec, dir string) error {
+	if e.Artifacts == nil {
+		return nil
+	}
+	var files []string
+	packaged := filepath.Join(dir, a.Filename())
+	if len(spec.Artifacts) == 0 || len(spec.Package) > 0 {
+		if _, err := os.Stat(packaged); err == nil {
+			files = append(files, packaged)
+		}
+	}
+	for _, pattern := range spec.Artifacts {
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, m := range matches {
+			if abs, _ := filepath.Abs(m); abs == b.LogFile || abs == b.LogLines {
+				continue
+			}
+			if m == packaged && len(spec.Package) > 0 {
+				n++
+				continue
+			}
+			if fi, err := os.Stat(m); err == nil && fi.Mode().IsRegular() {
+				files = append(files, m)
+				n++
+			}
+		}
+		if n == 0 {
+			return fmt.Errorf("artifact pattern %q matched no files", pattern)
+		}
+	}
+
+	for _, file := range files {
+		info, err := e.store(ctx, a.Id, file)
+		if err != nil {
+			return fmt.Errorf("store artifact %s: %w", filepath.Base(file), err)
+		}
+		if err := e.sign(ctx, a.Id, info); err != nil {
+			return fmt.Errorf("sign artifact %s: %w", info.Name, err)
+		}
+		b.Artifacts = append(b.Artifacts, info.Name)
+		if b.Artifact == "" || info.Name == a.Filename() {
+			b.Artifact, b.Size, b.Checksum = info.Name, info.Size, info.Checksum
+		}
+	}
+	return nil
+}
+
+// store puts file in the artifact store under id by its base name.
+func (e *Executor) store(ctx context.Context, id, file string) (storage.Info, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return storage.Info{}, err
+	}
+	defer f.Close()
+	return e.Artifacts.Put(ctx, id, filepath.Base(file), f)
+}
+
+// sign stores the detached signature of the stored artifact info of the
+// Antarian id, when the Executor has a Signer.
+func (e *Executor) sign(ctx context.Context, id string, info storage.Info) error {
+	if e.Signer == nil {
+		return nil
+	}
+	sig, err := lib.SignChecksum(e.Signer, info.Checksum)
+	if err != nil {
+		return err
+	}
+	_, err = e.Artifacts.Put(ctx, id, info.Name+lib.SignatureExt, bytes.NewReader(sig))
+	return err
+}
+
+// Env returns the variables describing the build to its command.
+func Env(b *lib.Build, a lib.Antarian) []string {
+	return []string{
+		"ANTARES_BUILD_ID=" + b.Id,
+		"ANTARES_ID=" + a.Id,
+		"ANTARES_NAME=" + a.Name,
+		"ANTARES_VERSION=" + a.Version,
+		"ANTARES_RELEASE=" + a.Release,
+		"ANTARES_BASEURL=" + a.BaseUrl,
+		"ANTARES_REQUIRES=" + strings.Join(a.Requires, " "),
+		"ANTARES_FILENAME=" + a.Filename(),
+		"ANTARES_FORMAT=" + string(a.ArtifactFormat()),
+	}
+}
+
+// lineRecorder numbers and timestamps the lines of output of a build,
+// writing them to enc and passing them to lines.
+type lineRecorder struct {
+	mu      sync.Mutex
+	seq     int
+	attempt int
+	enc     *json.Encoder
+	lines   func(lib.LogLine)
+}
+
+// stream returns the writer of the output stream name.
+func (r *lineRecorder) stream(name string) *lineWriter {
+	return &lineWriter{line: func(line string) { r.record(name, line) }}
+}
+
+func (r *lineRecorder) record(stream, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	l := lib.LogLine{Seq: r.seq, Time: time.Now().UTC(), Stream: stream, Line: line, Attempt: r.attempt}
+	if r.enc != nil {
+		if err := r.enc.Encode(l); err != nil {
+			// keep passing lines on even if the file fails
+			r.enc = nil
+		}
+	}
+	if r.lines != nil {
+		r.lines(l)
+	}
+}
+
+// countLines returns the number of lines in the file at path, zero when it
+// does not exist.
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n := 0
+	buf := make([]byte, 32<<10)
+	for {
+		m, err := f.Read(buf)
+		n += bytes.Count(buf[:m], []byte{'\n'})
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// tailBuffer keeps the last max bytes written to it, copying everything to w.
+type tailBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+	w         io.Writer
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w != nil {
+		if _, err := t.w.Write(p); err != nil {
+			// keep capturing the tail even if the log file fails
+			t.w = nil
+		}
+	}
+	t.buf.Write(p)
+	if over := t.buf.Len() - t.max; over > 0 {
+		t.buf.Next(over)
+		t.truncated = true
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.truncated {
+		return "[log truncated]\n" + t.buf.String()
+	}
+	return t.buf.String()
+}
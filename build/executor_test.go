@@ -0,0 +1,165 @@
+package build
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+func testAntarian(name, command string) lib.Antarian {
+	a := lib.Antarian{Id: "a-" + name, Name: name, Version: "1.0.0"}
+	if command != "" {
+		a.BuildSpec = &lib.BuildSpec{Command: command}
+	}
+	return a
+}
+
+func newBuild(t *testing.T, a lib.Antarian) *lib.Build {
+	t.Helper()
+	b, err := lib.NewBuild(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		timeout  time.Duration
+		state    lib.BuildState
+		exitCode int
+		log      string
+		err      string
+	}{
+		{"true", "/bin/true", 0, lib.BuildSucceeded, 0, "", ""},
+		{"false", "/bin/false", 0, lib.BuildFailed, 1, "", "exit status 1"},
+		{"output", "echo building $ANTARES_NAME $ANTARES_VERSION; echo warning >&2", 0, lib.BuildSucceeded, 0, "building output 1.0.0\nwarning\n", ""},
+		{"exit code", "echo half done; exit 3", 0, lib.BuildFailed, 3, "half done\n", "exit status 3"},
+		{"timeout", "echo started; sleep 30", 200 * time.Millisecond, lib.BuildFailed, -1, "started\n", "build timed out after 200ms"},
+		{"no command", "", 0, lib.BuildFailed, -1, "", ErrNoCommand.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Executor{WorkDir: t.TempDir(), Timeout: tt.timeout}
+			a := testAntarian(tt.name, tt.command)
+			b := newBuild(t, a)
+			start := time.Now()
+			var mu sync.Mutex
+			var lines []lib.LogLine
+			e.RunLines(context.Background(), b, a, func(l lib.LogLine) {
+				mu.Lock()
+				lines = append(lines, l)
+				mu.Unlock()
+			})
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("build took %s", elapsed)
+			}
+
+			if b.State != tt.state || b.ExitCode != tt.exitCode || b.Error != tt.err {
+				t.Errorf("build = %s, exit %d, error %q; want %s, exit %d, error %q", b.State, b.ExitCode, b.Error, tt.state, tt.exitCode, tt.err)
+			}
+			if b.Running || b.End.Before(b.Start) {
+				t.Errorf("build still running, or ended %s before it started %s", b.End, b.Start)
+			}
+			if tt.command == "" {
+				return
+			}
+			// stdout and stderr may interleave either way
+			if len(b.Log) != len(tt.log) || !sameLines(b.Log, tt.log) {
+				t.Errorf("Log = %q, want %q", b.Log, tt.log)
+			}
+			logFile, err := ioutil.ReadFile(b.LogFile)
+			if err != nil || string(logFile) != b.Log {
+				t.Errorf("log file = %q, %v; want %q", logFile, err, b.Log)
+			}
+			if want := strings.Count(tt.log, "\n"); len(lines) != want {
+				t.Errorf("passed on %d lines, want %d", len(lines), want)
+			}
+			for i, l := range lines {
+				if l.Seq != i+1 {
+					t.Errorf("line %d has seq %d", i, l.Seq)
+				}
+				if l.Line == "warning" && l.Stream != "stderr" {
+					t.Errorf("%q came on %s, want stderr", l.Line, l.Stream)
+				}
+			}
+		})
+	}
+}
+
+func sameLines(a, b string) bool {
+	count := map[string]int{}
+	for _, l := range strings.Split(a, "\n") {
+		count[l]++
+	}
+	for _, l := range strings.Split(b, "\n") {
+		count[l]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRunCancel(t *testing.T) {
+	e := &Executor{WorkDir: t.TempDir()}
+	// the sleep is a child of the shell, which must go with it
+	a := testAntarian("cancel", "echo started; sleep 30 & wait")
+	b := newBuild(t, a)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx, b, a)
+		close(done)
+	}()
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return after its context was cancelled")
+	}
+	if b.State != lib.BuildCanceled || b.Error != "build canceled" || b.Running {
+		t.Errorf("build = %s, %q, running %v; want canceled", b.State, b.Error, b.Running)
+	}
+	if b.Log != "started\n" {
+		t.Errorf("Log = %q, want the output before the cancel", b.Log)
+	}
+}
+
+func TestRunAttempts(t *testing.T) {
+	e := &Executor{WorkDir: t.TempDir()}
+	// fails the first time only, leaving a mark for the retry
+	a := testAntarian("flaky", "if [ -f ../mark ]; then echo second; else touch ../mark; echo first; exit 2; fi")
+	a.BuildSpec.Retries = 2
+	b := newBuild(t, a)
+	var retries []int
+	e.RunAttempts(context.Background(), b, a, time.Millisecond, nil, func(r lib.Build, delay time.Duration) {
+		retries = append(retries, r.Attempt)
+	})
+	if b.State != lib.BuildSucceeded || b.Attempt != 2 || len(b.Attempts) != 2 {
+		t.Fatalf("build = %s at attempt %d with %d recorded", b.State, b.Attempt, len(b.Attempts))
+	}
+	if first := b.Attempts[0]; first.State != lib.BuildFailed || first.ExitCode != 2 {
+		t.Errorf("first attempt = %+v, want failed with exit 2", first)
+	}
+	if len(retries) != 1 || retries[0] != 2 {
+		t.Errorf("retry called for attempts %v, want [2]", retries)
+	}
+	if b.Log != "second\n" {
+		t.Errorf("Log = %q, want the output of the last attempt", b.Log)
+	}
+	if logFile, err := ioutil.ReadFile(b.LogFile); string(logFile) != "first\nsecond\n" {
+		t.Errorf("log file = %q, %v; want the output of both attempts", logFile, err)
+	}
+}
@@ -0,0 +1,206 @@
+package build
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// pack writes the files and directories of dir matching patterns to the
+// archive named by a's Filename in dir, in a's ArtifactFormat. Only
+// regular files and directories are packed, by their paths relative to
+// dir, and the build's logs and the archive itself are left out.
+func pack(ctx context.Context, b *lib.Build, a lib.Antarian, dir string, patterns []string) error {
+	out := filepath.Join(dir, a.Filename())
+	skip := map[string]bool{dir: true, out: true, b.LogFile: true, b.LogLines: true}
+	if abs, err := filepath.Abs(out); err == nil {
+		skip[abs] = true
+	}
+
+	seen := map[string]bool{}
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("package pattern %q matched no files", pattern)
+		}
+		for _, m := range matches {
+			err := filepath.WalkDir(m, func(p string, de fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				abs, _ := filepath.Abs(p)
+				if skip[p] || skip[abs] || seen[p] || !(de.IsDir() || de.Type().IsRegular()) {
+					return nil
+				}
+				seen[p] = true
+				files = append(files, p)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	sort.Strings(files)
+
+	tmp, err := os.CreateTemp(dir, ".package-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if a.ArtifactFormat() == lib.FormatZip {
+		err = writeZip(tmp, dir, files)
+	} else {
+		err = writeTar(ctx, tmp, a.ArtifactFormat(), dir, files)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), out)
+}
+
+// writeTar writes files to w as a tar archive compressed as format says.
+func writeTar(ctx context.Context, w io.Writer, format lib.ArtifactFormat, dir string, files []string) error {
+	cw, err := compressor(ctx, format, w)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+	if err := tarFiles(tw, dir, files); err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+func tarFiles(tw *tar.Writer, dir string, files []string) error {
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = archiveName(dir, file, fi.IsDir())
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			if err := copyFile(tw, file); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// writeZip writes files to w as a zip archive.
+func writeZip(w io.Writer, dir string, files []string) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		hdr.Name = archiveName(dir, file, fi.IsDir())
+		if !fi.IsDir() {
+			hdr.Method = zip.Deflate
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			if err := copyFile(fw, file); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// compressor returns the writer compressing a tar stream to w as format
+// says. There is no xz encoder in the standard library, so tar.xz is
+// compressed by the xz command.
+func compressor(ctx context.Context, format lib.ArtifactFormat, w io.Writer) (io.WriteCloser, error) {
+	switch format {
+	case lib.FormatTarZst:
+		return zstd.NewWriter(w)
+	case lib.FormatTarXz:
+		cmd := exec.CommandContext(ctx, "xz", "-c")
+		cmd.Stdout = w
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		return &commandWriter{WriteCloser: stdin, cmd: cmd}, nil
+	}
+	return gzip.NewWriter(w), nil
+}
+
+// commandWriter writes to the input of a command; Close waits for it to
+// exit.
+type commandWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (c *commandWriter) Close() error {
+	err := c.WriteCloser.Close()
+	if werr := c.cmd.Wait(); werr != nil {
+		return fmt.Errorf("%s: %w", c.cmd.Path, werr)
+	}
+	return err
+}
+
+// archiveName is the name of file in an archive of dir: its slash
+// separated path relative to dir, ending in a slash for directories.
+func archiveName(dir, file string, isDir bool) string {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		rel = filepath.Base(file)
+	}
+	name := filepath.ToSlash(rel)
+	if isDir {
+		name += "/"
+	}
+	return name
+}
+
+func copyFile(w io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,112 @@
+package build
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// watchBuffer is how many updates a watcher may fall behind by. Further
+// output lines are dropped for it; the final record is always available
+// from Get.
+const watchBuffer = 256
+
+// Progress is one update on a watched build: its record after a state
+// change, or, with Log set, a line of its output.
+type Progress struct {
+	Build lib.Build
+	Log   *lib.LogLine
+}
+
+// Watch follows the queued or running build id. The channel receives the
+// build's record on every state change and each line of its output, and
+// is closed after the final record. stop ends the watch early. ok is false
+// when the build is not queued or running, so there is nothing to follow.
+func (en *Engine) Watch(id string) (updates <-chan Progress, stop func(), ok bool) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	if _, ok := en.builds[id]; !ok {
+		return nil, func() {}, false
+	}
+	ch := make(chan Progress, watchBuffer)
+	en.watchers[id] = append(en.watchers[id], ch)
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			en.mu.Lock()
+			defer en.mu.Unlock()
+			watchers := en.watchers[id]
+			for i, w := range watchers {
+				if w == ch {
+					en.watchers[id] = append(watchers[:i], watchers[i+1:]...)
+					close(ch)
+					break
+				}
+			}
+		})
+	}
+	return ch, stop, true
+}
+
+// notify sends p to the watchers of its build without blocking; a watcher
+// whose buffer is full misses it. Callers hold en.mu.
+func (en *Engine) notify(p Progress) {
+	for _, ch := range en.watchers[p.Build.Id] {
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+// step passes a line of output of the running build id to its watchers.
+func (en *Engine) step(id string, line lib.LogLine) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	if len(en.watchers[id]) == 0 {
+		return
+	}
+	b, ok := en.builds[id]
+	if !ok {
+		return
+	}
+	en.notify(Progress{Build: *b, Log: &line})
+}
+
+// MaxLineSize bounds a line of output; longer ones are passed on in
+// pieces of this size.
+const MaxLineSize = 64 << 10
+
+// lineWriter calls line for every complete line written to it.
+type lineWriter struct {
+	line func(string)
+	buf  bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		if i > MaxLineSize {
+			w.line(string(w.buf.Next(MaxLineSize)))
+			continue
+		}
+		w.line(string(bytes.TrimRight(w.buf.Next(i+1), "\r\n")))
+	}
+	for w.buf.Len() > MaxLineSize {
+		w.line(string(w.buf.Next(MaxLineSize)))
+	}
+	return len(p), nil
+}
+
+// Flush passes on a last line that has no newline.
+func (w *lineWriter) Flush() {
+	if w.buf.Len() > 0 {
+		w.line(w.buf.String())
+		w.buf.Reset()
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// The agent endpoints are not namespaced and need an admin token.
+
+// agentURL returns the absolute url of an agent endpoint of agent id.
+func (c *Client) agentURL(id, path string) string {
+	return c.baseURL + c.prefix + "/agents/" + url.PathEscape(id) + path
+}
+
+// RegisterAgent registers a build agent named name, running on hostname.
+func (c *Client) RegisterAgent(ctx context.Context, name, hostname string, opts ...CallOption) (*lib.Agent, error) {
+	in := struct {
+		Name     string `json:"name"`
+		Hostname string `json:"hostname"`
+	}{name, hostname}
+	var out lib.Agent
+	if _, err := c.send(ctx, "POST", c.baseURL+c.prefix+"/agents", in, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AgentHeartbeat keeps agent id online and returns the builds it holds that
+// were canceled. An agent marked offline gets a 404 *APIError and must
+// register again.
+func (c *Client) AgentHeartbeat(ctx context.Context, id string, opts ...CallOption) (*lib.AgentHeartbeat, error) {
+	var out lib.AgentHeartbeat
+	if _, err := c.send(ctx, "POST", c.agentURL(id, "/heartbeat"), nil, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LeaseBuild takes the next queued build for agent id. It returns nil when
+// no build is waiting.
+func (c *Client) LeaseBuild(ctx context.Context, id string, opts ...CallOption) (*lib.AgentLease, error) {
+	var out lib.AgentLease
+	if _, err := c.send(ctx, "POST", c.agentURL(id, "/lease"), nil, &out, opts); err != nil {
+		return nil, err
+	}
+	if out.Build.Id == "" {
+		return nil, nil
+	}
+	return &out, nil
+}
+
+// ReportBuildLogs appends lines of output to build buildId leased by agent
+// id, answering like AgentHeartbeat.
+func (c *Client) ReportBuildLogs(ctx context.Context, id, buildId string, lines []lib.LogLine, opts ...CallOption) (*lib.AgentHeartbeat, error) {
+	var out lib.AgentHeartbeat
+	if _, err := c.send(ctx, "POST", c.agentURL(id, "/builds/"+url.PathEscape(buildId)+"/logs"), lines, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ReportBuild records the outcome of build buildId leased by agent id: a
+// retry while its state is running, otherwise its end.
+func (c *Client) ReportBuild(ctx context.Context, id string, b *lib.Build, opts ...CallOption) (*lib.Build, error) {
+	var out lib.Build
+	if _, err := c.send(ctx, "PUT", c.agentURL(id, "/builds/"+url.PathEscape(b.Id)), b, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UploadBuildArtifact stores an artifact of build buildId leased by agent
+// id, as UploadArtifact does. The server needs UploadFilename.
+func (c *Client) UploadBuildArtifact(ctx context.Context, id, buildId string, r io.Reader, size int64, opts ...UploadOption) (*lib.Artifact, error) {
+	var o uploadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	rawurl := c.agentURL(id, "/builds/"+url.PathEscape(buildId)+"/artifacts")
+	if o.filename != "" {
+		rawurl += "?" + url.Values{"filename": {o.filename}}.Encode()
+	}
+	// the server takes the raw body only
+	o.multipart = false
+	return c.upload(ctx, rawurl, r, size, &o)
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// TokenSource supplies the bearer token sent with each request. Sources that
+// mint short-lived tokens can implement Invalidate to be told when the
+// server rejected the token with 401; the request is then retried once with
+// a fresh token.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+type invalidator interface {
+	Invalidate()
+}
+
+type staticToken string
+
+func (t staticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// fileToken reads the token from disk on first use and again after the
+// server rejects it, so rotated tokens are picked up without a restart.
+type fileToken struct {
+	path string
+
+	mu    sync.Mutex
+	token string
+}
+
+func (f *fileToken) Token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token != "" {
+		return f.token, nil
+	}
+	raw, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("read token file: %v", err)
+	}
+	f.token = strings.TrimSpace(string(raw))
+	if f.token == "" {
+		return "", fmt.Errorf("read token file: %s is empty", f.path)
+	}
+	return f.token, nil
+}
+
+func (f *fileToken) Invalidate() {
+	f.mu.Lock()
+	f.token = ""
+	f.mu.Unlock()
+}
+
+// WithToken authenticates every request with a fixed bearer token.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		if token == "" {
+			c.tokens = nil
+			return
+		}
+		c.tokens = staticToken(token)
+	}
+}
+
+// WithTokenFile authenticates with a token read from path. The file is read
+// once and cached, then re-read whenever the server answers 401.
+func WithTokenFile(path string) Option {
+	return func(c *Client) { c.tokens = &fileToken{path: path} }
+}
+
+// WithTokenSource authenticates with tokens from ts.
+func WithTokenSource(ts TokenSource) Option {
+	return func(c *Client) { c.tokens = ts }
+}
+
+// AuthError is returned for 401 and 403 responses so callers can tell bad
+// or insufficient credentials apart from other failures.
+type AuthError struct {
+	APIError
+}
+
+func (e *AuthError) Unwrap() error {
+	return &e.APIError
+}
+
+// Forbidden reports whether the credentials were valid but lacked
+// permission for the request.
+func (e *AuthError) Forbidden() bool {
+	return e.StatusCode == 403
+}
+
+const redacted = "[REDACTED]"
+
+// redact removes every occurrence of token from s.
+func redact(s, token string) string {
+	if token == "" {
+		return s
+	}
+	return strings.Replace(s, token, redacted, -1)
+}
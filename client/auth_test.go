@@ -0,0 +1,188 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// authServer accepts requests bearing the token set with accept, answers
+// 403 for "readonly" and otherwise 401, echoing the offending token back
+// in the error as a careless server might.
+type authServer struct {
+	*httptest.Server
+	requests int32
+
+	mu    sync.Mutex
+	token string
+}
+
+func newAuthServer(t *testing.T, token string) *authServer {
+	t.Helper()
+	s := &authServer{token: token}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		want := s.token
+		s.mu.Unlock()
+		switch got {
+		case want:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("[]"))
+		case "readonly":
+			http.Error(w, `{"message":"readonly may not do that"}`, http.StatusForbidden)
+		default:
+			http.Error(w, `{"message":"bad token `+got+`"}`, http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *authServer) accept(token string) {
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+}
+
+func TestAuthError(t *testing.T) {
+	s := newAuthServer(t, "s3cret")
+	tests := []struct {
+		name      string
+		token     string
+		status    int
+		forbidden bool
+	}{
+		{"valid", "s3cret", 0, false},
+		{"wrong token", "wr0ng", http.StatusUnauthorized, false},
+		{"no token", "", http.StatusUnauthorized, false},
+		{"insufficient", "readonly", http.StatusForbidden, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(t, s.URL, WithToken(tt.token))
+			_, err := c.ListAntarians(context.Background(), nil)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var authErr *AuthError
+			if !errors.As(err, &authErr) {
+				t.Fatalf("error = %v, want an AuthError", err)
+			}
+			if authErr.StatusCode != tt.status || authErr.Forbidden() != tt.forbidden {
+				t.Errorf("AuthError = %d, forbidden %v; want %d, %v", authErr.StatusCode, authErr.Forbidden(), tt.status, tt.forbidden)
+			}
+			if !isStatus(err, tt.status) {
+				t.Errorf("AuthError does not unwrap to the APIError")
+			}
+			if tt.token != "" && strings.Contains(err.Error(), tt.token) {
+				t.Errorf("error %q leaks the token", err)
+			}
+		})
+	}
+}
+
+func TestTokenFile(t *testing.T) {
+	s := newAuthServer(t, "first")
+	path := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t, s.URL, WithTokenFile(path))
+	if _, err := c.ListAntarians(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate the token; the cached one is refused once, then the file is
+	// read again
+	s.accept("second")
+	if err := ioutil.WriteFile(path, []byte("second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ListAntarians(context.Background(), nil); err != nil {
+		t.Fatalf("after rotation: %v", err)
+	}
+	if s.requests != 3 {
+		t.Errorf("made %d requests, want 3", s.requests)
+	}
+
+	// a token that stays wrong is only retried once
+	s.accept("third")
+	_, err := c.ListAntarians(context.Background(), nil)
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("error = %v, want an AuthError", err)
+	}
+	if s.requests != 5 {
+		t.Errorf("made %d requests, want 5", s.requests)
+	}
+}
+
+func TestTokenFileMissing(t *testing.T) {
+	s := newAuthServer(t, "s3cret")
+	c := newClient(t, s.URL, WithTokenFile(filepath.Join(t.TempDir(), "missing")))
+	if _, err := c.ListAntarians(context.Background(), nil); err == nil {
+		t.Fatal("ListAntarians succeeded without a token file")
+	}
+	if s.requests != 0 {
+		t.Errorf("made %d requests, want none", s.requests)
+	}
+}
+
+type rotatingSource struct {
+	tokens      []string
+	invalidated int
+}
+
+func (r *rotatingSource) Token(ctx context.Context) (string, error) {
+	return r.tokens[0], nil
+}
+
+func (r *rotatingSource) Invalidate() {
+	r.invalidated++
+	r.tokens = r.tokens[1:]
+}
+
+func TestTokenSource(t *testing.T) {
+	s := newAuthServer(t, "fresh")
+	ts := &rotatingSource{tokens: []string{"expired", "fresh"}}
+	c := newClient(t, s.URL, WithTokenSource(ts))
+	if _, err := c.ListAntarians(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if ts.invalidated != 1 {
+		t.Errorf("Invalidate called %d times, want 1", ts.invalidated)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	s := newAuthServer(t, "s3cret")
+	var buf bytes.Buffer
+	c := newClient(t, s.URL, WithToken("wr0ng-t0ken"), WithLogger(log.New(&buf, "", 0)))
+	_, err := c.ListAntarians(context.Background(), nil)
+	if err == nil {
+		t.Fatal("ListAntarians succeeded with the wrong token")
+	}
+	if strings.Contains(err.Error(), "wr0ng-t0ken") {
+		t.Errorf("error %q leaks the token", err)
+	}
+	if strings.Contains(buf.String(), "wr0ng-t0ken") {
+		t.Errorf("debug log leaks the token:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "Authorization: "+redacted) {
+		t.Errorf("debug log does not show the redacted header:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,449 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// DefaultTimeout bounds each call unless overridden with WithTimeout or
+// CallTimeout.
+const DefaultTimeout = 30 * time.Second
+
+// Client talks to an Antares server over its REST API.
+type Client struct {
+	baseURL    string
+	prefix     string
+	namespace  string
+	httpClient *http.Client
+	timeout    time.Duration
+	retry      RetryPolicy
+	tokens     TokenSource
+	logger     *log.Logger
+}
+
+// Option configures a Client in New.
+type Option func(*Client)
+
+// WithTimeout sets the default per-call timeout. Zero disables it and leaves
+// cancellation entirely to the caller's context.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = d }
+}
+
+// DefaultAPIPrefix is the API version the client speaks unless
+// WithAPIPrefix says otherwise.
+const DefaultAPIPrefix = "/v1"
+
+// WithAPIPrefix sets the path prefix of the API version to call. Servers
+// older than the versioned API need "".
+func WithAPIPrefix(prefix string) Option {
+	return func(c *Client) { c.prefix = strings.TrimRight(prefix, "/") }
+}
+
+// WithNamespace confines the client to the Antarians of namespace ns.
+// Without it the server's default namespace is used.
+func WithNamespace(ns string) Option {
+	return func(c *Client) { c.namespace = ns }
+}
+
+// WithHTTPClient replaces the underlying http.Client.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithTransport swaps the http.RoundTripper, e.g. to add instrumentation.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		hc := *c.httpClient
+		hc.Transport = rt
+		c.httpClient = &hc
+	}
+}
+
+// WithLogger enables verbose logging of every request and response to l.
+// Credentials are redacted from the output.
+func WithLogger(l *log.Logger) Option {
+	return func(c *Client) { c.logger = l }
+}
+
+// CallOption overrides client defaults for a single call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout        time.Duration
+	idempotencyKey string
+}
+
+// CallTimeout overrides the client's default timeout for one call.
+func CallTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) { o.timeout = d }
+}
+
+// ListOptions restricts the page returned by ListAntarians.
+type ListOptions struct {
+	Limit  int
+	Offset int
+	// Name and Version select Antarians with exactly that name or
+	// version; Running and Finished, when set, those in that state, and
+	// Status those with that status, and Label those matching the
+	// lib.LabelSelector, e.g. "team=infra".
+	Name     string
+	Version  string
+	Running  *bool
+	Finished *bool
+	Status   lib.Status
+	Label    string
+	// Sort orders the results by comma separated fields, each prefixed
+	// with - for descending order, e.g. "start,-name".
+	Sort string
+}
+
+// New returns a Client for the server at baseURL, e.g. http://localhost:8080.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url %q: %v", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base url %q: scheme must be http or https", baseURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q: missing host", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid base url %q: query and fragment are not allowed", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimRight(u.String(), "/"),
+		prefix:     DefaultAPIPrefix,
+		httpClient: &http.Client{},
+		timeout:    DefaultTimeout,
+		retry:      DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// BaseURL returns the server url the client was created with.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// url returns the absolute url of an API path.
+func (c *Client) url(path string) string {
+	if c.namespace != "" {
+		return c.baseURL + c.prefix + "/namespaces/" + url.PathEscape(c.namespace) + path
+	}
+	return c.baseURL + c.prefix + path
+}
+
+// CreateAntarian creates an Antarian with the fields of a's CreateRequest;
+// the server sets the others.
+func (c *Client) CreateAntarian(ctx context.Context, a *lib.Antarian, opts ...CallOption) (*lib.Antarian, error) {
+	var out lib.Antarian
+	if err := c.do(ctx, "POST", "/antarians", a.CreateRequest(), &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) GetAntarian(ctx context.Context, id string, opts ...CallOption) (*lib.Antarian, error) {
+	var out lib.Antarian
+	if err := c.do(ctx, "GET", "/antarians/"+url.PathEscape(id), nil, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAntarianVersion finds the Antarian with name and version, without
+// knowing its id.
+func (c *Client) GetAntarianVersion(ctx context.Context, name, version string, opts ...CallOption) (*lib.Antarian, error) {
+	var out lib.Antarian
+	if err := c.do(ctx, "GET", "/antarians/byname/"+url.PathEscape(name)+"/"+url.PathEscape(version), nil, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) ListAntarians(ctx context.Context, lo *ListOptions, opts ...CallOption) (lib.Antarians, error) {
+	path := "/antarians"
+	if q := lo.values().Encode(); q != "" {
+		path += "?" + q
+	}
+	var out lib.Antarians
+	if err := c.do(ctx, "GET", path, nil, &out, opts); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) UpdateAntarian(ctx context.Context, a *lib.Antarian, opts ...CallOption) (*lib.Antarian, error) {
+	var out lib.Antarian
+	if err := c.do(ctx, "PUT", "/antarians/"+url.PathEscape(a.Id), a, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteAntarian(ctx context.Context, id string, opts ...CallOption) error {
+	return c.do(ctx, "DELETE", "/antarians/"+url.PathEscape(id), nil, nil, opts)
+}
+
+func (c *Client) TriggerBuild(ctx context.Context, id string, opts ...CallOption) (*lib.Build, error) {
+	var out lib.Build
+	if err := c.do(ctx, "POST", "/antarians/"+url.PathEscape(id)+"/build", nil, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) GetBuild(ctx context.Context, buildId string, opts ...CallOption) (*lib.Build, error) {
+	var out lib.Build
+	if err := c.do(ctx, "GET", "/builds/"+url.PathEscape(buildId), nil, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelBuild cancels a queued or running build. A running build may still
+// be stopping when it returns.
+func (c *Client) CancelBuild(ctx context.Context, buildId string, opts ...CallOption) (*lib.Build, error) {
+	var out lib.Build
+	if err := c.do(ctx, "DELETE", "/builds/"+url.PathEscape(buildId), nil, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Download(ctx context.Context, id string, opts ...CallOption) (*lib.Download, error) {
+	var out lib.Download
+	if err := c.do(ctx, "GET", "/antarians/"+url.PathEscape(id)+"/download", nil, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VerifySignature has the server check the signature of the artifact of
+// the Antarian id built for platform, e.g. linux/arm64, or of its own
+// artifact when platform is empty, against the server's public keys.
+func (c *Client) VerifySignature(ctx context.Context, id, platform string, opts ...CallOption) (*lib.SignatureCheck, error) {
+	path := "/antarians/" + url.PathEscape(id) + "/artifact/signature"
+	if platform != "" {
+		path += "?" + url.Values{"platform": {platform}}.Encode()
+	}
+	var out lib.SignatureCheck
+	if err := c.do(ctx, "GET", path, nil, &out, opts); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (o *ListOptions) values() url.Values {
+	v := url.Values{}
+	if o == nil {
+		return v
+	}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		v.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.Name != "" {
+		v.Set("name", o.Name)
+	}
+	if o.Version != "" {
+		v.Set("version", o.Version)
+	}
+	if o.Running != nil {
+		v.Set("running", strconv.FormatBool(*o.Running))
+	}
+	if o.Finished != nil {
+		v.Set("finished", strconv.FormatBool(*o.Finished))
+	}
+	if o.Status != "" {
+		v.Set("status", string(o.Status))
+	}
+	if o.Label != "" {
+		v.Set("label", o.Label)
+	}
+	if o.Sort != "" {
+		v.Set("sort", o.Sort)
+	}
+	return v
+}
+
+// do sends a request with in encoded as the JSON body and decodes a
+// successful response into out. Non-2xx responses become an *APIError.
+// The timeout covers reading the response body as well as the round trip.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}, opts []CallOption) error {
+	_, err := c.send(ctx, method, c.url(path), in, out, opts)
+	return err
+}
+
+// send is do for an absolute url, also returning the response headers.
+// Failed attempts are retried according to the client's RetryPolicy.
+func (c *Client) send(ctx context.Context, method, rawurl string, in, out interface{}, opts []CallOption) (header http.Header, err error) {
+	ctx, span := startSpan(ctx, method, rawurl)
+	var resp *http.Response
+	defer func() { endSpan(span, resp, err) }()
+
+	co := callOptions{timeout: c.timeout}
+	for _, opt := range opts {
+		opt(&co)
+	}
+	if co.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, co.timeout)
+		defer cancel()
+	}
+
+	var raw []byte
+	if in != nil {
+		if raw, err = json.Marshal(in); err != nil {
+			return nil, fmt.Errorf("encode request: %v", err)
+		}
+	}
+	retryable := idempotent(method) || co.idempotencyKey != ""
+	reauthed := false
+
+	for attempt := 1; ; attempt++ {
+		var body io.Reader
+		if raw != nil {
+			body = bytes.NewReader(raw)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, rawurl, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if raw != nil {
+			req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+		}
+		if co.idempotencyKey != "" {
+			req.Header.Set("Idempotency-Key", co.idempotencyKey)
+		}
+		token := ""
+		if c.tokens != nil {
+			if token, err = c.tokens.Token(ctx); err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		injectTrace(req)
+
+		c.logRequest(req, token)
+		start := time.Now()
+		resp, err = c.httpClient.Do(req)
+		c.logResponse(req, resp, err, token, time.Since(start))
+		if ctx.Err() != nil {
+			if err == nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			err = errors.New(redact(err.Error(), token))
+		}
+
+		// a rejected token may just have been rotated; refresh it once
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && !reauthed {
+			if inv, ok := c.tokens.(invalidator); ok {
+				inv.Invalidate()
+				reauthed = true
+				io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1048576))
+				resp.Body.Close()
+				attempt--
+				continue
+			}
+		}
+		failed := err != nil || resp.StatusCode < 200 || resp.StatusCode > 299
+		if failed && retryable {
+			if wait, ok := c.retry.Backoff(attempt, resp, err); ok {
+				if err == nil {
+					io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1048576))
+					resp.Body.Close()
+				}
+				if err := sleep(ctx, wait); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		header, err = c.read(ctx, resp, err, out, token)
+		if err != nil && attempt > 1 {
+			retryErr := &RetryError{Attempts: attempt, Err: err}
+			if resp != nil {
+				retryErr.StatusCode = resp.StatusCode
+			}
+			return header, retryErr
+		}
+		return header, err
+	}
+}
+
+// read finishes a single attempt, decoding a successful response into out.
+func (c *Client) read(ctx context.Context, resp *http.Response, err error, out interface{}, token string) (http.Header, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.Header, newAPIError(resp, token)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.Header, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		if ctx.Err() != nil {
+			return resp.Header, ctx.Err()
+		}
+		return resp.Header, fmt.Errorf("decode response: %v", err)
+	}
+	return resp.Header, nil
+}
+
+func (c *Client) logRequest(req *http.Request, token string) {
+	if c.logger == nil {
+		return
+	}
+	c.logger.Printf("--> %s %s", req.Method, redact(req.URL.String(), token))
+	for k, vs := range req.Header {
+		for _, v := range vs {
+			if k == "Authorization" {
+				v = redacted
+			}
+			c.logger.Printf("    %s: %s", k, redact(v, token))
+		}
+	}
+}
+
+func (c *Client) logResponse(req *http.Request, resp *http.Response, err error, token string, elapsed time.Duration) {
+	if c.logger == nil {
+		return
+	}
+	if err != nil {
+		c.logger.Printf("<-- %s %s error: %s (%s)", req.Method, redact(req.URL.String(), token), redact(err.Error(), token), elapsed)
+		return
+	}
+	c.logger.Printf("<-- %s %s %s (%s)", req.Method, redact(req.URL.String(), token), resp.Status, elapsed)
+}
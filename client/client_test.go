@@ -0,0 +1,393 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/server"
+)
+
+// newServer starts the real server handler, configured by the defaults,
+// a scratch artifact and build directory and configure, behind httptest.
+func newServer(t *testing.T, configure ...func(*config.Config)) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(nil)
+	cfg := config.Default()
+	cfg.URL = "http://" + ts.Listener.Addr().String()
+	cfg.LogLevel = "error"
+	cfg.ArtifactDir = t.TempDir()
+	cfg.Build.WorkDir = t.TempDir()
+	cfg.Build.Command = "true"
+	for _, fn := range configure {
+		fn(cfg)
+	}
+	s, err := server.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Config.Handler = s.Handler()
+	ts.Start()
+	t.Cleanup(func() {
+		ts.Close()
+		s.Shutdown(context.Background())
+	})
+	return ts
+}
+
+func newClient(t *testing.T, baseURL string, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(baseURL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testAntarian(name, version string) *lib.Antarian {
+	return &lib.Antarian{Name: name, Version: version, BaseUrl: "http://example.com/" + name, Requires: []string{}}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"http://localhost:8080", true},
+		{"https://antares.example.com/", true},
+		{"localhost:8080", false},
+		{"ftp://localhost", false},
+		{"http://", false},
+		{"http://localhost?x=1", false},
+		{"http://localhost#top", false},
+	}
+	for _, tt := range tests {
+		_, err := New(tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("New(%q) error = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestAntarianLifecycle(t *testing.T) {
+	ts := newServer(t)
+	c := newClient(t, ts.URL)
+	ctx := context.Background()
+
+	created, err := c.CreateAntarian(ctx, testAntarian("libfoo", "1.0.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Id == "" || created.Name != "libfoo" || created.Version != "1.0.0" || created.Status != lib.StatusPending {
+		t.Fatalf("CreateAntarian = %+v", created)
+	}
+
+	got, err := c.GetAntarian(ctx, created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != created.Id || got.Release != created.Release || !got.Start.Equal(created.Start) {
+		t.Errorf("GetAntarian = %+v, want %+v", got, created)
+	}
+	byVersion, err := c.GetAntarianVersion(ctx, "libfoo", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byVersion.Id != created.Id {
+		t.Errorf("GetAntarianVersion id = %s, want %s", byVersion.Id, created.Id)
+	}
+
+	got.Version = "1.0.1"
+	updated, err := c.UpdateAntarian(ctx, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != "1.0.1" {
+		t.Errorf("UpdateAntarian version = %q, want 1.0.1", updated.Version)
+	}
+
+	list, err := c.ListAntarians(ctx, &ListOptions{Name: "libfoo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Version != "1.0.1" {
+		t.Errorf("ListAntarians = %+v, want libfoo 1.0.1", list)
+	}
+
+	if err := c.DeleteAntarian(ctx, created.Id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetAntarian(ctx, created.Id)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Code != "not_found" {
+		t.Fatalf("GetAntarian after delete error = %v, want a 404 APIError", err)
+	}
+}
+
+func TestListOptions(t *testing.T) {
+	ts := newServer(t)
+	c := newClient(t, ts.URL)
+	ctx := context.Background()
+	for _, v := range []string{"1.0.0", "1.2.0", "1.10.0"} {
+		a := testAntarian("libbar", v)
+		a.Labels = map[string]string{"tier": "gold"}
+		if v == "1.2.0" {
+			a.Labels["tier"] = "silver"
+		}
+		if _, err := c.CreateAntarian(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		lo   *ListOptions
+		want []string
+	}{
+		{"by name", &ListOptions{Name: "libbar", Sort: "version"}, []string{"1.0.0", "1.2.0", "1.10.0"}},
+		{"descending", &ListOptions{Name: "libbar", Sort: "-version"}, []string{"1.10.0", "1.2.0", "1.0.0"}},
+		{"by version", &ListOptions{Version: "1.2.0"}, []string{"1.2.0"}},
+		{"by label", &ListOptions{Label: "tier=gold", Sort: "version"}, []string{"1.0.0", "1.10.0"}},
+		{"limit and offset", &ListOptions{Name: "libbar", Sort: "version", Limit: 1, Offset: 1}, []string{"1.2.0"}},
+		{"no match", &ListOptions{Name: "nothing"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := c.ListAntarians(ctx, tt.lo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, a := range list {
+				got = append(got, a.Version)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("versions = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("versions = %v, want %v", got, tt.want)
+				}
+			}
+
+			// the stream honors the same options
+			antarians, errc := c.StreamAntarians(ctx, tt.lo)
+			var streamed []string
+			for a := range antarians {
+				streamed = append(streamed, a.Version)
+			}
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(streamed, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("streamed versions = %v, want %v", streamed, tt.want)
+			}
+		})
+	}
+
+	antarians, errc := c.StreamAntarians(ctx, &ListOptions{Sort: "size"})
+	for range antarians {
+		t.Error("streamed an Antarian for an unsupported sort")
+	}
+	var apiErr *APIError
+	if err := <-errc; !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("stream with a bad sort = %v, want a 400", err)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	ts := newServer(t)
+	c := newClient(t, ts.URL)
+
+	_, err := c.CreateAntarian(context.Background(), &lib.Antarian{Name: "libfoo", Version: "1.0", BaseUrl: "not a url"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want an APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.RequestID == "" {
+		t.Errorf("APIError = %+v, want a 422 with a request id", apiErr)
+	}
+	if len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "baseurl" {
+		t.Errorf("Fields = %+v, want baseurl", apiErr.Fields)
+	}
+}
+
+func TestBuildAndDownload(t *testing.T) {
+	ts := newServer(t)
+	c := newClient(t, ts.URL)
+	ctx := context.Background()
+
+	a, err := c.CreateAntarian(ctx, testAntarian("libbaz", "2.0.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.TriggerBuild(ctx, a.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.AntarianId != a.Id {
+		t.Errorf("TriggerBuild antarian = %s, want %s", b.AntarianId, a.Id)
+	}
+	b, err = c.GetBuild(ctx, b.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.AntarianId != a.Id {
+		t.Errorf("GetBuild antarian = %s, want %s", b.AntarianId, a.Id)
+	}
+	if _, err := c.GetBuild(ctx, "missing"); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("GetBuild(missing) error = %v, want 404", err)
+	}
+
+	if _, err := c.UploadArtifact(ctx, a.Id, strings.NewReader("artifact"), 8); err != nil {
+		t.Fatal(err)
+	}
+	dl, err := c.Download(ctx, a.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl.Id != a.Id || dl.Url == "" || dl.Size != 8 {
+		t.Errorf("Download = %+v", dl)
+	}
+	resp, err := http.Get(dl.Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET %s = %d, want 200", dl.Url, resp.StatusCode)
+	}
+}
+
+// slowServer answers after wait with a JSON array it never finishes,
+// unless release is closed, and reports each connection it closes.
+func slowServer(t *testing.T, wait time.Duration) (*httptest.Server, <-chan struct{}) {
+	t.Helper()
+	release := make(chan struct{})
+	closed := make(chan struct{}, 16)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[{"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	ts.Start()
+	t.Cleanup(func() {
+		close(release)
+		ts.Close()
+	})
+	return ts, closed
+}
+
+func TestCancelSlowList(t *testing.T) {
+	tests := []struct {
+		name string
+		wait time.Duration
+	}{
+		{"before the response", time.Hour},
+		{"while reading the body", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, closed := slowServer(t, tt.wait)
+			before := runtime.NumGoroutine()
+			c := newClient(t, ts.URL, WithHTTPClient(&http.Client{Transport: &http.Transport{}}))
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			start := time.Now()
+			_, err := c.ListAntarians(ctx, nil)
+			if err != context.Canceled {
+				t.Fatalf("ListAntarians error = %v, want context.Canceled", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("ListAntarians returned %v after cancel", elapsed)
+			}
+			select {
+			case <-closed:
+			case <-time.After(2 * time.Second):
+				t.Error("the connection was not closed")
+			}
+			deadline := time.Now().Add(2 * time.Second)
+			for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if n := runtime.NumGoroutine(); n > before {
+				t.Errorf("%d goroutines still running, %d before the call", n, before)
+			}
+		})
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	ts, _ := slowServer(t, time.Hour)
+	tests := []struct {
+		name string
+		opts []Option
+		call []CallOption
+	}{
+		{"client default", []Option{WithTimeout(50 * time.Millisecond)}, nil},
+		{"per call", []Option{WithTimeout(time.Hour)}, []CallOption{CallTimeout(50 * time.Millisecond)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(t, ts.URL, tt.opts...)
+			start := time.Now()
+			_, err := c.ListAntarians(context.Background(), nil, tt.call...)
+			if err != context.DeadlineExceeded {
+				t.Fatalf("ListAntarians error = %v, want context.DeadlineExceeded", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("ListAntarians took %v", elapsed)
+			}
+		})
+	}
+}
+
+type countingTransport struct {
+	n int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.n, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithTransport(t *testing.T) {
+	ts := newServer(t)
+	rt := &countingTransport{}
+	c := newClient(t, ts.URL, WithTransport(rt))
+	if _, err := c.ListAntarians(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if rt.n != 1 {
+		t.Errorf("transport saw %d requests, want 1", rt.n)
+	}
+}
+
+func isStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// FieldError names a single request field the server rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is returned for any non-2xx response from the server. Code is
+// the server's machine readable form of the status, e.g. "not_found".
+type APIError struct {
+	StatusCode int          `json:"-"`
+	Message    string       `json:"message"`
+	Fields     []FieldError `json:"details,omitempty"`
+	RequestID  string       `json:"request_id,omitempty"`
+	Code       string       `json:"code,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if len(e.Fields) == 0 {
+		return fmt.Sprintf("antares: %d %s", e.StatusCode, msg)
+	}
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Field + ": " + f.Message
+	}
+	return fmt.Sprintf("antares: %d %s (%s)", e.StatusCode, msg, strings.Join(fields, "; "))
+}
+
+// newAPIError builds an APIError from the response, falling back to the raw
+// body text when the server did not send a JSON error envelope. 401 and 403
+// responses are returned as an *AuthError. The token is scrubbed in case the
+// server echoed it back.
+func newAPIError(resp *http.Response, token string) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	raw, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	if err == nil && len(raw) > 0 {
+		if json.Unmarshal(raw, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(raw))
+		}
+	}
+	apiErr.StatusCode = resp.StatusCode
+	apiErr.Message = redact(apiErr.Message, token)
+	for i := range apiErr.Fields {
+		apiErr.Fields[i].Message = redact(apiErr.Fields[i].Message, token)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return &AuthError{APIError: *apiErr}
+	}
+	return apiErr
+}
@@ -0,0 +1,263 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// Event is a typed notification received from Subscribe. The concrete type
+// is one of AntarianCreated, AntarianUpdated, AntarianDeleted, BuildStarted,
+// BuildFinished or UnknownEvent.
+type Event interface {
+	EventID() string
+	EventType() string
+	EventTime() time.Time
+}
+
+// EventMeta carries the fields common to every event.
+type EventMeta struct {
+	ID   string
+	Type string
+	Time time.Time
+}
+
+func (m EventMeta) EventID() string      { return m.ID }
+func (m EventMeta) EventType() string    { return m.Type }
+func (m EventMeta) EventTime() time.Time { return m.Time }
+
+type AntarianCreated struct {
+	EventMeta
+	Antarian lib.Antarian
+}
+
+type AntarianUpdated struct {
+	EventMeta
+	Antarian lib.Antarian
+}
+
+type AntarianDeleted struct {
+	EventMeta
+	Antarian lib.Antarian
+}
+
+type BuildStarted struct {
+	EventMeta
+	Build lib.Build
+}
+
+type BuildFinished struct {
+	EventMeta
+	Build lib.Build
+}
+
+// UnknownEvent is delivered for event types this client does not know about.
+type UnknownEvent struct {
+	EventMeta
+	Data json.RawMessage
+}
+
+// EventFilter selects the events delivered by Subscribe.
+type EventFilter struct {
+	// Types limits delivery to the given event types; empty means all.
+	Types []string
+	// Name limits delivery to events about Antarians with this name.
+	Name string
+	// LastEventID resumes the stream after the given event.
+	LastEventID string
+	// Follow keeps the subscription open, reconnecting when the connection
+	// drops. Without it the channel closes once the server ends the stream.
+	Follow bool
+}
+
+const (
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Subscribe connects to the server's event stream and delivers decoded
+// events on the returned channel. The first connection is made before
+// Subscribe returns so bad credentials or urls are reported immediately.
+// When following, dropped connections are re-established with backoff,
+// resuming from the last event seen; events missed in between are recovered
+// as far as the server still retains them. The channel is closed when ctx is
+// cancelled or, without Follow, when the stream ends.
+func (c *Client) Subscribe(ctx context.Context, filter EventFilter) (<-chan Event, error) {
+	resp, err := c.openEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		delay := minReconnectDelay
+		for {
+			n, retry := c.readEvents(ctx, resp.Body, events, &filter)
+			resp.Body.Close()
+			if ctx.Err() != nil || !filter.Follow {
+				return
+			}
+			if n > 0 {
+				delay = minReconnectDelay
+			}
+			if retry > 0 {
+				delay = retry
+			}
+
+			for {
+				if sleep(ctx, delay) != nil {
+					return
+				}
+				if delay *= 2; delay > maxReconnectDelay {
+					delay = maxReconnectDelay
+				}
+				if resp, err = c.openEvents(ctx, filter); err == nil {
+					break
+				}
+				if c.logger != nil {
+					c.logger.Printf("event stream reconnect failed: %v", err)
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+func (c *Client) openEvents(ctx context.Context, filter EventFilter) (*http.Response, error) {
+	q := url.Values{}
+	if len(filter.Types) > 0 {
+		q.Set("types", strings.Join(filter.Types, ","))
+	}
+	if filter.Name != "" {
+		q.Set("name", filter.Name)
+	}
+	if filter.LastEventID != "" {
+		q.Set("last_event_id", filter.LastEventID)
+	}
+	if filter.Follow {
+		q.Set("follow", "true")
+	}
+	rawurl := c.url("/events")
+	if len(q) > 0 {
+		rawurl += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if filter.LastEventID != "" {
+		req.Header.Set("Last-Event-ID", filter.LastEventID)
+	}
+	return c.openStream(ctx, req)
+}
+
+// readEvents parses a text/event-stream body until it ends, sending each
+// event to out and recording its id in filter.LastEventID. It returns the
+// number of events delivered and any reconnection delay requested by the
+// server.
+func (c *Client) readEvents(ctx context.Context, body io.Reader, out chan<- Event, filter *EventFilter) (int, time.Duration) {
+	var (
+		n     int
+		retry time.Duration
+		id    string
+		typ   string
+		data  []string
+	)
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1048576)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				ev := decodeEvent(id, typ, strings.Join(data, "\n"))
+				select {
+				case out <- ev:
+					n++
+				case <-ctx.Done():
+					return n, retry
+				}
+			}
+			if id != "" {
+				filter.LastEventID = id
+			}
+			id, typ, data = "", "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			typ = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return n, retry
+}
+
+// decodeEvent turns one SSE message into a typed Event. The data is a
+// lib.Event; the SSE id and event fields take precedence when present.
+func decodeEvent(id, typ, data string) Event {
+	var wire struct {
+		Id       string        `json:"id"`
+		Type     string        `json:"type"`
+		Time     time.Time     `json:"time"`
+		Antarian *lib.Antarian `json:"antarian"`
+		Build    *lib.Build    `json:"build"`
+	}
+	if err := json.Unmarshal([]byte(data), &wire); err != nil {
+		return UnknownEvent{EventMeta{ID: id, Type: typ}, json.RawMessage(data)}
+	}
+	meta := EventMeta{ID: wire.Id, Type: wire.Type, Time: wire.Time}
+	if id != "" {
+		meta.ID = id
+	}
+	if typ != "" {
+		meta.Type = typ
+	}
+
+	var a lib.Antarian
+	if wire.Antarian != nil {
+		a = *wire.Antarian
+	}
+	var b lib.Build
+	if wire.Build != nil {
+		b = *wire.Build
+	}
+	switch meta.Type {
+	case lib.EventAntarianCreated:
+		return AntarianCreated{meta, a}
+	case lib.EventAntarianUpdated:
+		return AntarianUpdated{meta, a}
+	case lib.EventAntarianDeleted:
+		return AntarianDeleted{meta, a}
+	case lib.EventBuildStarted:
+		return BuildStarted{meta, b}
+	case lib.EventBuildFinished:
+		return BuildFinished{meta, b}
+	}
+	return UnknownEvent{meta, json.RawMessage(data)}
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// next receives one event or fails the test after a while.
+func next(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("event channel closed")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	return nil
+}
+
+// closes waits for events to be closed, failing the test after a while.
+func closes(t *testing.T, events <-chan Event) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			t.Errorf("unexpected event %s %s", ev.EventID(), ev.EventType())
+		case <-timeout:
+			t.Fatal("event channel not closed")
+		}
+	}
+}
+
+func TestSubscribeFollow(t *testing.T) {
+	ts := newServer(t)
+	c := newClient(t, ts.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := c.Subscribe(ctx, EventFilter{Follow: true, Types: []string{lib.EventAntarianCreated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := c.CreateAntarian(ctx, testAntarian("libfoo", "1.0.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// filtered out by type
+	created.Labels = map[string]string{"team": "core"}
+	if _, err := c.UpdateAntarian(ctx, created); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateAntarian(ctx, testAntarian("libbar", "1.0.0")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"libfoo", "libbar"} {
+		ev, ok := next(t, events).(AntarianCreated)
+		if !ok || ev.Antarian.Name != name || ev.EventID() == "" || ev.EventTime().IsZero() {
+			t.Errorf("event = %+v, want AntarianCreated for %s", ev, name)
+		}
+	}
+	cancel()
+	closes(t, events)
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	ts := newServer(t)
+	c := newClient(t, ts.URL)
+	ctx := context.Background()
+	for _, name := range []string{"libfoo", "libbar", "libbaz"} {
+		if _, err := c.CreateAntarian(ctx, testAntarian(name, "1.0.0")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// without Follow the retained events are sent and the stream ends
+	events, err := c.Subscribe(ctx, EventFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for ev := range events {
+		ids = append(ids, ev.EventID())
+	}
+	if len(ids) != 3 {
+		t.Fatalf("replayed %d events, want 3", len(ids))
+	}
+
+	events, err = c.Subscribe(ctx, EventFilter{LastEventID: ids[0], Name: "libbaz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(t, events); ev.EventID() != ids[2] {
+		t.Errorf("resumed at event %s, want %s", ev.EventID(), ids[2])
+	}
+	closes(t, events)
+
+	if _, err := c.Subscribe(ctx, EventFilter{LastEventID: "yesterday"}); !isStatus(err, http.StatusBadRequest) {
+		t.Errorf("Subscribe with a bad id error = %v, want a 400", err)
+	}
+}
+
+// droppingServer streams numbered antarian.created events, closing the
+// connection after every perConn of them, until total have been sent. It
+// records the Last-Event-ID of each connection.
+type droppingServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	resume []string
+}
+
+func newDroppingServer(t *testing.T, perConn, total int) *droppingServer {
+	t.Helper()
+	s := &droppingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last := r.Header.Get("Last-Event-ID")
+		if q := r.URL.Query().Get("last_event_id"); q != last {
+			t.Errorf("last_event_id %q and Last-Event-ID %q differ", q, last)
+		}
+		s.mu.Lock()
+		s.resume = append(s.resume, last)
+		s.mu.Unlock()
+		from, _ := strconv.Atoi(last)
+		w.Header().Set("Content-Type", "text/event-stream")
+		// reconnect quickly
+		fmt.Fprint(w, "retry: 10\n\n")
+		for id := from + 1; id <= from+perConn && id <= total; id++ {
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: {\"antarian\":{\"name\":\"lib%d\"}}\n\n", id, lib.EventAntarianCreated, id)
+		}
+		w.(http.Flusher).Flush()
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	s := newDroppingServer(t, 3, 7)
+	c := newClient(t, s.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := c.Subscribe(ctx, EventFilter{Follow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 7; i++ {
+		ev := next(t, events)
+		created, ok := ev.(AntarianCreated)
+		if !ok || ev.EventID() != strconv.Itoa(i) || created.Antarian.Name != fmt.Sprintf("lib%d", i) {
+			t.Fatalf("event %d = %+v", i, ev)
+		}
+	}
+	cancel()
+	closes(t, events)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	want := []string{"", "3", "6"}
+	if len(s.resume) < len(want) {
+		t.Fatalf("connections resumed at %q, want %q", s.resume, want)
+	}
+	for i := range want {
+		if s.resume[i] != want[i] {
+			t.Errorf("connection %d resumed at %q, want %q", i, s.resume[i], want[i])
+		}
+	}
+}
+
+func TestSubscribeNoFollow(t *testing.T) {
+	s := newDroppingServer(t, 3, 7)
+	c := newClient(t, s.URL)
+	events, err := c.Subscribe(context.Background(), EventFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range events {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("received %d events, want the 3 of the first connection", n)
+	}
+}
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		typ, data string
+		want      string
+	}{
+		{lib.EventAntarianCreated, `{"antarian":{"name":"libfoo"}}`, "client.AntarianCreated"},
+		{lib.EventAntarianUpdated, `{}`, "client.AntarianUpdated"},
+		{lib.EventAntarianDeleted, `{}`, "client.AntarianDeleted"},
+		{lib.EventBuildStarted, `{"build":{"id":"b1"}}`, "client.BuildStarted"},
+		{lib.EventBuildFinished, `{}`, "client.BuildFinished"},
+		{"", `{"type":"build.finished"}`, "client.BuildFinished"},
+		{"antarian.renamed", `{}`, "client.UnknownEvent"},
+		{lib.EventAntarianCreated, `not json`, "client.UnknownEvent"},
+	}
+	for _, tt := range tests {
+		ev := decodeEvent("7", tt.typ, tt.data)
+		if got := fmt.Sprintf("%T", ev); got != tt.want {
+			t.Errorf("decodeEvent(%q, %s) = %s, want %s", tt.typ, tt.data, got, tt.want)
+		}
+		if ev.EventID() != "7" {
+			t.Errorf("decodeEvent(%q, %s) id = %q, want 7", tt.typ, tt.data, ev.EventID())
+		}
+	}
+}
@@ -0,0 +1,360 @@
+// Package fake provides an in-memory client.AntaresClient for tests that do
+// not need a running server.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xbcsmith/antares/client"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// Client mimics the server's semantics: ids are assigned on create, unknown
+// ids yield a 404 *client.APIError and a second Antarian with the same name
+// and version yields a 409.
+type Client struct {
+	// BaseURL is used to build Uri and download urls.
+	BaseURL string
+
+	// ErrorHook, when set, is called at the start of every method with the
+	// method name (e.g. "GetAntarian") and the id involved, if any. A non-nil
+	// return value is returned from the call without touching the store.
+	ErrorHook func(method, id string) error
+
+	mu        sync.Mutex
+	order     []string
+	antarians map[string]lib.Antarian
+	builds    map[string]lib.Build
+	failures  map[string][]error
+}
+
+var _ client.AntaresClient = (*Client)(nil)
+
+// NewClient returns an empty fake client.
+func NewClient() *Client {
+	return &Client{
+		BaseURL:   "http://antares.invalid",
+		antarians: map[string]lib.Antarian{},
+		builds:    map[string]lib.Build{},
+		failures:  map[string][]error{},
+	}
+}
+
+// FailNext makes the next call to method return err.
+func (f *Client) FailNext(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = append(f.failures[method], err)
+}
+
+func (f *Client) CreateAntarian(ctx context.Context, a *lib.Antarian, opts ...client.CallOption) (*lib.Antarian, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail("CreateAntarian", a.Id); err != nil {
+		return nil, err
+	}
+	if _, ok := f.antarians[a.Id]; ok && a.Id != "" {
+		return nil, conflict("Antarian with id %s already exists", a.Id)
+	}
+	if dup := f.duplicate(a, ""); dup != "" {
+		return nil, conflict("Antarian %s %s already exists with id %s", a.Name, a.Version, dup)
+	}
+
+	created := a.DeepCopy()
+	if created.Id == "" {
+		id, err := lib.NewUUID()
+		if err != nil {
+			return nil, err
+		}
+		created.Id = id
+	}
+	if created.Uri == "" {
+		created.Uri = f.BaseURL + "/antarians"
+	}
+	// new Antarians are pending, as on the server
+	created.Status, created.Running, created.Finished = lib.StatusPending, false, false
+	f.antarians[created.Id] = created
+	f.order = append(f.order, created.Id)
+	out := created.DeepCopy()
+	return &out, nil
+}
+
+func (f *Client) GetAntarian(ctx context.Context, id string, opts ...client.CallOption) (*lib.Antarian, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail("GetAntarian", id); err != nil {
+		return nil, err
+	}
+	a, ok := f.antarians[id]
+	if !ok {
+		return nil, notFound(id)
+	}
+	out := a.DeepCopy()
+	return &out, nil
+}
+
+func (f *Client) ListAntarians(ctx context.Context, lo *client.ListOptions, opts ...client.CallOption) (lib.Antarians, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail("ListAntarians", ""); err != nil {
+		return nil, err
+	}
+	ids := f.order
+	if lo != nil {
+		var err error
+		if ids, err = f.query(lo); err != nil {
+			return nil, err
+		}
+		if lo.Offset >= len(ids) {
+			ids = nil
+		} else {
+			ids = ids[lo.Offset:]
+		}
+		if lo.Limit > 0 && lo.Limit < len(ids) {
+			ids = ids[:lo.Limit]
+		}
+	}
+	list := make(lib.Antarians, 0, len(ids))
+	for _, id := range ids {
+		a := f.antarians[id]
+		list = append(list, a.DeepCopy())
+	}
+	return list, nil
+}
+
+func (f *Client) ListAll(ctx context.Context, lo *client.ListOptions, opts ...client.CallOption) (lib.Antarians, error) {
+	all := &client.ListOptions{}
+	if lo != nil {
+		*all = *lo
+		all.Limit = 0
+	}
+	return f.ListAntarians(ctx, all, opts...)
+}
+
+// query returns the ids matching the filters of lo, in the order of
+// lo.Sort. Ties keep creation order. A label selector that does not parse
+// is refused as the server would.
+func (f *Client) query(lo *client.ListOptions) ([]string, error) {
+	sel, err := lib.ParseLabelSelector(lo.Label)
+	if lo.Label != "" && err != nil {
+		return nil, &client.APIError{StatusCode: http.StatusBadRequest, Code: "bad_request", Message: fmt.Sprintf("label: %v", err)}
+	}
+	var ids []string
+	for _, id := range f.order {
+		a := f.antarians[id]
+		switch {
+		case lo.Name != "" && a.Name != lo.Name:
+		case lo.Version != "" && a.Version != lo.Version:
+		case lo.Running != nil && a.Running != *lo.Running:
+		case lo.Finished != nil && a.Finished != *lo.Finished:
+		case lo.Status != "" && a.CurrentStatus() != lo.Status:
+		case lo.Label != "" && !sel.Matches(a.Labels):
+		default:
+			ids = append(ids, id)
+		}
+	}
+	if lo.Sort == "" {
+		return ids, nil
+	}
+	fields := strings.Split(lo.Sort, ",")
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, b := f.antarians[ids[i]], f.antarians[ids[j]]
+		for _, field := range fields {
+			desc := strings.HasPrefix(field, "-")
+			if desc {
+				a, b = b, a
+			}
+			c := 0
+			switch strings.TrimPrefix(field, "-") {
+			case "id":
+				c = strings.Compare(a.Id, b.Id)
+			case "name":
+				c = strings.Compare(a.Name, b.Name)
+			case "version":
+				c = compareVersions(a.Version, b.Version)
+			case "release":
+				c = strings.Compare(a.Release, b.Release)
+			case "start":
+				c = a.Start.Compare(b.Start)
+			case "end":
+				c = a.End.Compare(b.End)
+			}
+			if desc {
+				a, b = b, a
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return ids, nil
+}
+
+// compareVersions orders semantic versions above those that do not parse,
+// which compare as strings.
+func compareVersions(a, b string) int {
+	av, aerr := lib.ParseVersion(a)
+	bv, berr := lib.ParseVersion(b)
+	switch {
+	case aerr == nil && berr == nil:
+		return av.Compare(bv)
+	case aerr == nil:
+		return 1
+	case berr == nil:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+func (f *Client) UpdateAntarian(ctx context.Context, a *lib.Antarian, opts ...client.CallOption) (*lib.Antarian, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail("UpdateAntarian", a.Id); err != nil {
+		return nil, err
+	}
+	if _, ok := f.antarians[a.Id]; !ok {
+		return nil, notFound(a.Id)
+	}
+	if dup := f.duplicate(a, a.Id); dup != "" {
+		return nil, conflict("Antarian %s %s already exists with id %s", a.Name, a.Version, dup)
+	}
+	updated := a.DeepCopy()
+	f.antarians[a.Id] = updated
+	out := updated.DeepCopy()
+	return &out, nil
+}
+
+func (f *Client) DeleteAntarian(ctx context.Context, id string, opts ...client.CallOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail("DeleteAntarian", id); err != nil {
+		return err
+	}
+	if _, ok := f.antarians[id]; !ok {
+		return notFound(id)
+	}
+	delete(f.antarians, id)
+	for bid, b := range f.builds {
+		if b.AntarianId == id {
+			delete(f.builds, bid)
+		}
+	}
+	for i, o := range f.order {
+		if o == id {
+			f.order = append(f.order[:i], f.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (f *Client) TriggerBuild(ctx context.Context, id string, opts ...client.CallOption) (*lib.Build, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail("TriggerBuild", id); err != nil {
+		return nil, err
+	}
+	a, ok := f.antarians[id]
+	if !ok {
+		return nil, notFound(id)
+	}
+	build, err := lib.NewBuild(a)
+	if err != nil {
+		return nil, err
+	}
+	build.State = lib.BuildRunning
+	build.Running = true
+	build.Start = time.Now()
+	f.builds[build.Id] = *build
+	return build, nil
+}
+
+func (f *Client) GetBuild(ctx context.Context, buildId string, opts ...client.CallOption) (*lib.Build, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail("GetBuild", buildId); err != nil {
+		return nil, err
+	}
+	build, ok := f.builds[buildId]
+	if !ok {
+		return nil, &client.APIError{StatusCode: http.StatusNotFound, Code: "not_found", Message: fmt.Sprintf("Could not find Build with id of %s", buildId)}
+	}
+	return &build, nil
+}
+
+func (f *Client) CancelBuild(ctx context.Context, buildId string, opts ...client.CallOption) (*lib.Build, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail("CancelBuild", buildId); err != nil {
+		return nil, err
+	}
+	build, ok := f.builds[buildId]
+	if !ok {
+		return nil, &client.APIError{StatusCode: http.StatusNotFound, Code: "not_found", Message: fmt.Sprintf("Could not find Build with id of %s", buildId)}
+	}
+	if build.State.Done() {
+		return nil, conflict("Build %s has already finished", buildId)
+	}
+	build.State = lib.BuildCanceled
+	build.Running = false
+	build.End = time.Now()
+	build.Error = "build canceled"
+	f.builds[buildId] = build
+	return &build, nil
+}
+
+func (f *Client) Download(ctx context.Context, id string, opts ...client.CallOption) (*lib.Download, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail("Download", id); err != nil {
+		return nil, err
+	}
+	a, ok := f.antarians[id]
+	if !ok {
+		return nil, notFound(id)
+	}
+	return &lib.Download{
+		Id:      a.Id,
+		Name:    a.Name,
+		Version: a.Version,
+		Url:     a.Uri + "/files/" + a.Id + "/" + a.Filename(),
+	}, nil
+}
+
+// fail returns an injected error for method, if any. Callers hold f.mu.
+func (f *Client) fail(method, id string) error {
+	if queued := f.failures[method]; len(queued) > 0 {
+		f.failures[method] = queued[1:]
+		return queued[0]
+	}
+	if f.ErrorHook != nil {
+		return f.ErrorHook(method, id)
+	}
+	return nil
+}
+
+// duplicate returns the id of another Antarian sharing a's name and
+// version, ignoring the record with id self.
+func (f *Client) duplicate(a *lib.Antarian, self string) string {
+	for id, o := range f.antarians {
+		if id != self && o.Name == a.Name && o.Version == a.Version {
+			return id
+		}
+	}
+	return ""
+}
+
+func notFound(id string) error {
+	return &client.APIError{StatusCode: http.StatusNotFound, Code: "not_found", Message: fmt.Sprintf("Could not find Antarian with id of %s", id)}
+}
+
+func conflict(format string, args ...interface{}) error {
+	return &client.APIError{StatusCode: http.StatusConflict, Code: "conflict", Message: fmt.Sprintf(format, args...)}
+}
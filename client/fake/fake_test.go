@@ -0,0 +1,192 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xbcsmith/antares/client"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/server"
+)
+
+func testAntarian(name, version string) *lib.Antarian {
+	return &lib.Antarian{Name: name, Version: version, BaseUrl: "http://example.com/" + name, Requires: []string{}}
+}
+
+func status(err error) int {
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// realClient returns a client of the real server handler, to check the
+// fake against.
+func realClient(t *testing.T) client.AntaresClient {
+	t.Helper()
+	cfg := config.Default()
+	cfg.LogLevel = "error"
+	cfg.ArtifactDir = t.TempDir()
+	cfg.Build.WorkDir = t.TempDir()
+	cfg.Build.Command = "true"
+	s, err := server.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Shutdown(context.Background())
+	})
+	c, err := client.New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// TestSemantics runs the same calls against the fake and the real server
+// and expects the same outcomes.
+func TestSemantics(t *testing.T) {
+	clients := map[string]func(*testing.T) client.AntaresClient{
+		"fake":   func(*testing.T) client.AntaresClient { return NewClient() },
+		"server": realClient,
+	}
+	for name, newClient := range clients {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			c := newClient(t)
+
+			created, err := c.CreateAntarian(ctx, testAntarian("libfoo", "1.0.0"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created.Id == "" || created.Status != lib.StatusPending {
+				t.Errorf("created = %+v, want an id and pending", created)
+			}
+			if _, err := c.CreateAntarian(ctx, testAntarian("libfoo", "1.0.0")); status(err) != http.StatusConflict {
+				t.Errorf("duplicate create error = %v, want a 409", err)
+			}
+
+			other, err := c.CreateAntarian(ctx, testAntarian("libfoo", "2.0.0"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			other.Version = "1.0.0"
+			if _, err := c.UpdateAntarian(ctx, other); status(err) != http.StatusConflict {
+				t.Errorf("update onto an existing version error = %v, want a 409", err)
+			}
+
+			got, err := c.GetAntarian(ctx, created.Id)
+			if err != nil || got.Name != "libfoo" || got.Version != "1.0.0" {
+				t.Errorf("GetAntarian = %+v, %v", got, err)
+			}
+			list, err := c.ListAntarians(ctx, &client.ListOptions{Name: "libfoo", Sort: "-version"})
+			if err != nil || len(list) != 2 || list[0].Version != "2.0.0" {
+				t.Errorf("ListAntarians = %+v, %v; want 2.0.0 then 1.0.0", list, err)
+			}
+			if _, err := c.ListAntarians(ctx, &client.ListOptions{Label: "a in"}); status(err) != http.StatusBadRequest {
+				t.Errorf("bad label selector error = %v, want a 400", err)
+			}
+
+			build, err := c.TriggerBuild(ctx, created.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.GetBuild(ctx, build.Id); err != nil {
+				t.Errorf("GetBuild: %v", err)
+			}
+
+			if err := c.DeleteAntarian(ctx, created.Id); err != nil {
+				t.Fatal(err)
+			}
+			for _, call := range []func() error{
+				func() error { _, err := c.GetAntarian(ctx, created.Id); return err },
+				func() error { return c.DeleteAntarian(ctx, created.Id) },
+				func() error { _, err := c.TriggerBuild(ctx, created.Id); return err },
+				func() error { _, err := c.Download(ctx, created.Id); return err },
+				func() error { _, err := c.GetBuild(ctx, "no-such-build"); return err },
+			} {
+				if err := call(); status(err) != http.StatusNotFound {
+					t.Errorf("call on a missing id error = %v, want a 404", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCopies(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	a := testAntarian("libfoo", "1.0.0")
+	a.Labels = map[string]string{"team": "core"}
+	created, err := c.CreateAntarian(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// neither the caller's value nor a returned one aliases the store
+	a.Labels["team"] = "changed"
+	created.Labels["team"] = "changed"
+	got, _ := c.GetAntarian(ctx, created.Id)
+	if got.Labels["team"] != "core" {
+		t.Errorf("stored labels = %v, want team=core", got.Labels)
+	}
+}
+
+func TestFailNext(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	boom := errors.New("boom")
+	c.FailNext("CreateAntarian", boom)
+	if _, err := c.CreateAntarian(ctx, testAntarian("libfoo", "1.0.0")); err != boom {
+		t.Fatalf("first create error = %v, want boom", err)
+	}
+	if list, _ := c.ListAntarians(ctx, nil); len(list) != 0 {
+		t.Errorf("a failed create stored %d Antarians", len(list))
+	}
+	// only the next call fails
+	if _, err := c.CreateAntarian(ctx, testAntarian("libfoo", "1.0.0")); err != nil {
+		t.Errorf("second create error = %v", err)
+	}
+}
+
+func TestErrorHook(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	created, err := c.CreateAntarian(ctx, testAntarian("libfoo", "1.0.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unavailable := &client.APIError{StatusCode: http.StatusServiceUnavailable}
+	var calls []string
+	c.ErrorHook = func(method, id string) error {
+		calls = append(calls, method+" "+id)
+		if method == "DeleteAntarian" {
+			return unavailable
+		}
+		return nil
+	}
+	if _, err := c.GetAntarian(ctx, created.Id); err != nil {
+		t.Errorf("GetAntarian error = %v", err)
+	}
+	if err := c.DeleteAntarian(ctx, created.Id); err != unavailable {
+		t.Errorf("DeleteAntarian error = %v, want the hook's", err)
+	}
+	if _, err := c.GetAntarian(ctx, created.Id); err != nil {
+		t.Errorf("the hooked delete removed the Antarian: %v", err)
+	}
+	want := []string{"GetAntarian " + created.Id, "DeleteAntarian " + created.Id, "GetAntarian " + created.Id}
+	if len(calls) != len(want) {
+		t.Fatalf("hook calls = %q, want %q", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("hook call %d = %q, want %q", i, calls[i], want[i])
+		}
+	}
+}
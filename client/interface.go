@@ -0,0 +1,25 @@
+package client
+
+import (
+	"context"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// AntaresClient is the method set of Client. Depend on it rather than on
+// *Client so tests can substitute the in-memory implementation in
+// client/fake.
+type AntaresClient interface {
+	CreateAntarian(ctx context.Context, a *lib.Antarian, opts ...CallOption) (*lib.Antarian, error)
+	GetAntarian(ctx context.Context, id string, opts ...CallOption) (*lib.Antarian, error)
+	ListAntarians(ctx context.Context, lo *ListOptions, opts ...CallOption) (lib.Antarians, error)
+	ListAll(ctx context.Context, lo *ListOptions, opts ...CallOption) (lib.Antarians, error)
+	UpdateAntarian(ctx context.Context, a *lib.Antarian, opts ...CallOption) (*lib.Antarian, error)
+	DeleteAntarian(ctx context.Context, id string, opts ...CallOption) error
+	TriggerBuild(ctx context.Context, id string, opts ...CallOption) (*lib.Build, error)
+	GetBuild(ctx context.Context, buildId string, opts ...CallOption) (*lib.Build, error)
+	CancelBuild(ctx context.Context, buildId string, opts ...CallOption) (*lib.Build, error)
+	Download(ctx context.Context, id string, opts ...CallOption) (*lib.Download, error)
+}
+
+var _ AntaresClient = (*Client)(nil)
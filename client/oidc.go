@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiryMargin renews access tokens this long before they expire, so a
+// token does not lapse on its way to the server.
+const expiryMargin = 30 * time.Second
+
+// clientCredentials logs in to an OpenID Connect provider with the OAuth2
+// client credentials grant.
+type clientCredentials struct {
+	issuerURL    string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	httpClient   *http.Client
+
+	mu            sync.Mutex
+	tokenEndpoint string
+	token         string
+	expires       time.Time
+}
+
+// ClientCredentials returns a TokenSource that logs in to the OpenID
+// Connect provider at issuerURL as clientID, for servers configured to
+// accept its tokens. Each access token is reused until shortly before it
+// expires or until the server rejects it.
+func ClientCredentials(issuerURL, clientID, clientSecret string, scopes ...string) TokenSource {
+	return &clientCredentials{
+		issuerURL:    strings.TrimSuffix(issuerURL, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+func (c *clientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+	if c.tokenEndpoint == "" {
+		var doc struct {
+			TokenEndpoint string `json:"token_endpoint"`
+		}
+		if err := c.get(ctx, c.issuerURL+"/.well-known/openid-configuration", &doc); err != nil {
+			return "", fmt.Errorf("oidc discovery: %v", err)
+		}
+		if doc.TokenEndpoint == "" {
+			return "", fmt.Errorf("oidc discovery: %s has no token endpoint", c.issuerURL)
+		}
+		c.tokenEndpoint = doc.TokenEndpoint
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := c.send(req, &resp); err != nil {
+		return "", fmt.Errorf("oidc login: %v", err)
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("oidc login: no access token in response")
+	}
+	c.token = resp.AccessToken
+	c.expires = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - expiryMargin)
+	if resp.ExpiresIn == 0 {
+		// no expiry given; keep the token until the server rejects it
+		c.expires = time.Now().Add(24 * time.Hour)
+	}
+	return c.token, nil
+}
+
+func (c *clientCredentials) Invalidate() {
+	c.mu.Lock()
+	c.token = ""
+	c.mu.Unlock()
+}
+
+func (c *clientCredentials) get(ctx context.Context, rawurl string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawurl, nil)
+	if err != nil {
+		return err
+	}
+	return c.send(req, out)
+}
+
+func (c *clientCredentials) send(req *http.Request, out interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1048576))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
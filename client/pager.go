@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// DefaultPageSize is the page size used by Pages and ListAll when the
+// ListOptions do not set a Limit.
+const DefaultPageSize = 100
+
+// Done is returned by Pager.Next once every page has been read.
+var Done = errors.New("client: no more pages")
+
+// Pager walks the Antarian collection one page at a time.
+type Pager struct {
+	c      *Client
+	ctx    context.Context
+	opts   []CallOption
+	lo     ListOptions
+	limit  int
+	offset int
+	next   string
+	done   bool
+	err    error
+}
+
+// Pages returns a Pager starting at lo.Offset. Only the current page is held
+// in memory, so it is suitable for streaming large collections.
+func (c *Client) Pages(ctx context.Context, lo *ListOptions, opts ...CallOption) *Pager {
+	p := &Pager{c: c, ctx: ctx, opts: opts, limit: DefaultPageSize}
+	if lo != nil {
+		p.lo = *lo
+		if lo.Limit > 0 {
+			p.limit = lo.Limit
+		}
+		p.offset = lo.Offset
+	}
+	return p
+}
+
+// Next returns the next page. It returns Done when the collection is
+// exhausted; any other error is sticky and returned by every later call.
+func (p *Pager) Next() ([]lib.Antarian, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.done {
+		return nil, Done
+	}
+
+	rawurl := p.next
+	if rawurl == "" {
+		lo := p.lo
+		lo.Limit, lo.Offset = p.limit, p.offset
+		rawurl = p.c.url("/antarians?") + lo.values().Encode()
+	}
+
+	var out lib.Antarians
+	header, err := p.c.send(p.ctx, "GET", rawurl, nil, &out, p.opts)
+	if err != nil {
+		p.err = err
+		return nil, err
+	}
+	p.advance(rawurl, header, len(out))
+	if len(out) == 0 {
+		p.done = true
+		return nil, Done
+	}
+	return out, nil
+}
+
+// advance works out where the next page starts. A Link header is
+// authoritative; otherwise X-Total-Count bounds the walk, and failing that a
+// short page marks the end.
+func (p *Pager) advance(current string, header http.Header, n int) {
+	p.offset += n
+	p.next = ""
+
+	if links := strings.Join(header.Values("Link"), ","); links != "" {
+		next := linkRel(links, "next")
+		if next == "" {
+			p.done = true
+			return
+		}
+		base, err := url.Parse(current)
+		ref, err2 := url.Parse(next)
+		if err != nil || err2 != nil {
+			p.err = errors.New("client: malformed Link header")
+			return
+		}
+		p.next = base.ResolveReference(ref).String()
+		return
+	}
+
+	if total, err := strconv.Atoi(header.Get("X-Total-Count")); err == nil {
+		p.done = p.offset >= total
+		return
+	}
+	p.done = n < p.limit
+}
+
+// ListAll follows pagination until the collection is exhausted and returns
+// every Antarian.
+func (c *Client) ListAll(ctx context.Context, lo *ListOptions, opts ...CallOption) (lib.Antarians, error) {
+	var all lib.Antarians
+	pager := c.Pages(ctx, lo, opts...)
+	for {
+		page, err := pager.Next()
+		if err == Done {
+			return all, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+	}
+}
+
+// linkRel returns the target of the first link with relation rel in an
+// RFC 8288 Link header value.
+func linkRel(header, rel string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 || strings.ToLower(kv[0]) != "rel" {
+				continue
+			}
+			for _, r := range strings.Fields(strings.Trim(kv[1], `"`)) {
+				if r == rel {
+					return target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
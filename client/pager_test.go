@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// pageServer serves a collection of total Antarians named a0, a1, ... and
+// describes the pages with Link headers, X-Total-Count or nothing at all,
+// as mode says. A request for the page at failAt gets a 500.
+func pageServer(t *testing.T, total int, mode string, failAt int) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset == failAt {
+			http.Error(w, `{"error":"boom"}`, http.StatusInternalServerError)
+			return
+		}
+		page := lib.Antarians{}
+		for i := offset; i < offset+limit && i < total; i++ {
+			page = append(page, lib.Antarian{Id: strconv.Itoa(i), Name: fmt.Sprintf("a%d", i)})
+		}
+		switch mode {
+		case "link":
+			if offset+limit < total {
+				w.Header().Add("Link", fmt.Sprintf(`</antarians?limit=%d&offset=%d>; rel="next"`, limit, offset+limit))
+			}
+			if offset > 0 {
+				w.Header().Add("Link", fmt.Sprintf(`</antarians?limit=%d&offset=%d>; rel="prev"`, limit, offset-limit))
+			}
+		case "total":
+			w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+func TestPages(t *testing.T) {
+	tests := []struct {
+		mode     string
+		total    int
+		pages    int
+		requests int32
+	}{
+		// a full last page costs an extra request only when nothing says
+		// it was the last
+		{"link", 9, 3, 3},
+		{"total", 9, 3, 3},
+		{"none", 9, 3, 4},
+		{"none", 7, 3, 3},
+		{"link", 0, 0, 1},
+		{"total", 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.mode, tt.total), func(t *testing.T) {
+			ts, requests := pageServer(t, tt.total, tt.mode, -1)
+			c := newClient(t, ts.URL)
+			pager := c.Pages(context.Background(), &ListOptions{Limit: 3})
+			var pages, seen int
+			for {
+				page, err := pager.Next()
+				if err == Done {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, a := range page {
+					if want := fmt.Sprintf("a%d", seen); a.Name != want {
+						t.Fatalf("Antarian %d is %s, want %s", seen, a.Name, want)
+					}
+					seen++
+				}
+				pages++
+			}
+			if pages != tt.pages || seen != tt.total {
+				t.Errorf("read %d Antarians in %d pages, want %d in %d", seen, pages, tt.total, tt.pages)
+			}
+			if *requests != tt.requests {
+				t.Errorf("made %d requests, want %d", *requests, tt.requests)
+			}
+			if _, err := pager.Next(); err != Done {
+				t.Errorf("Next after the end = %v, want Done", err)
+			}
+		})
+	}
+}
+
+func TestPagesError(t *testing.T) {
+	ts, requests := pageServer(t, 9, "link", 3)
+	c := newClient(t, ts.URL, WithRetryPolicy(NoRetry))
+	pager := c.Pages(context.Background(), &ListOptions{Limit: 3})
+	if page, err := pager.Next(); err != nil || len(page) != 3 {
+		t.Fatalf("first page = %d Antarians, %v", len(page), err)
+	}
+	_, err := pager.Next()
+	if !isStatus(err, http.StatusInternalServerError) {
+		t.Fatalf("second page error = %v, want a 500", err)
+	}
+	// the error sticks without asking the server again
+	if _, again := pager.Next(); again != err {
+		t.Errorf("Next after an error = %v, want %v", again, err)
+	}
+	if *requests != 2 {
+		t.Errorf("made %d requests, want 2", *requests)
+	}
+
+	if list, err := c.ListAll(context.Background(), &ListOptions{Limit: 3}); err == nil || list != nil {
+		t.Errorf("ListAll = %d Antarians, %v; want the error", len(list), err)
+	}
+}
+
+func TestListAll(t *testing.T) {
+	ts := newServer(t)
+	c := newClient(t, ts.URL)
+	for i := 0; i < 7; i++ {
+		if _, err := c.CreateAntarian(context.Background(), testAntarian(fmt.Sprintf("libpage%d", i), "1.0.0")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the seeded AntarianMain is listed too
+	list, err := c.ListAll(context.Background(), &ListOptions{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 8 {
+		t.Errorf("ListAll returned %d Antarians, want 8", len(list))
+	}
+	ids := map[string]bool{}
+	for _, a := range list {
+		if ids[a.Id] {
+			t.Errorf("%s listed twice", a.Id)
+		}
+		ids[a.Id] = true
+	}
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides whether a failed attempt is tried again. The client
+// only consults it for idempotent requests, or POSTs carrying an
+// IdempotencyKey, so implementations need not check the method.
+type RetryPolicy interface {
+	// Backoff is called after attempt n (starting at 1) failed with either a
+	// response or a transport error. It returns how long to wait before the
+	// next attempt, or false to give up.
+	Backoff(attempt int, resp *http.Response, err error) (time.Duration, bool)
+}
+
+// ExponentialBackoff retries connection errors, 429 and 5xx responses,
+// doubling the delay after each attempt and adding jitter. A Retry-After
+// header on the response takes precedence over the computed delay.
+type ExponentialBackoff struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is used by clients created without WithRetryPolicy.
+var DefaultRetryPolicy RetryPolicy = ExponentialBackoff{
+	MaxAttempts: 3,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// NoRetry never retries.
+var NoRetry RetryPolicy = ExponentialBackoff{MaxAttempts: 1}
+
+func (b ExponentialBackoff) Backoff(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= b.MaxAttempts {
+		return 0, false
+	}
+	if err == nil && !retryableStatus(resp.StatusCode) {
+		return 0, false
+	}
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return d, true
+		}
+	}
+
+	d := b.BaseDelay << uint(attempt-1)
+	if d <= 0 || (b.MaxDelay > 0 && d > b.MaxDelay) {
+		d = b.MaxDelay
+	}
+	// jitter within [d/2, d) so concurrent clients spread out
+	if half := int64(d / 2); half > 0 {
+		d = time.Duration(half + rand.Int63n(half))
+	}
+	return d, true
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryAfter parses a Retry-After value given either in seconds or as an
+// HTTP date.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy for the client.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) { c.retry = p }
+}
+
+// IdempotencyKey sends key in the Idempotency-Key header, allowing a POST
+// to be retried under the client's retry policy.
+func IdempotencyKey(key string) CallOption {
+	return func(o *callOptions) { o.idempotencyKey = key }
+}
+
+// RetryError is returned when a request still failed after more than one
+// attempt. Err is the failure from the final attempt.
+type RetryError struct {
+	Attempts   int
+	StatusCode int
+	Err        error
+}
+
+func (e *RetryError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("antares: giving up after %d attempts (last status %d): %v", e.Attempts, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("antares: giving up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
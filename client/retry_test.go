@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+var fastRetry = ExponentialBackoff{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+// flakyServer fails the first failures requests with status, or by
+// dropping the connection when status is 0, and then answers with an
+// empty list.
+func flakyServer(t *testing.T, failures int32, status int) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			if status == 0 {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, `{"error":"try again"}`, status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32
+		status   int
+		requests int32
+		wantErr  bool
+	}{
+		{"recovers from 503", 2, http.StatusServiceUnavailable, 3, false},
+		{"recovers from 429", 1, http.StatusTooManyRequests, 2, false},
+		{"recovers from a dropped connection", 2, 0, 3, false},
+		{"gives up after max attempts", 5, http.StatusBadGateway, 3, true},
+		{"does not retry 404", 5, http.StatusNotFound, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, requests := flakyServer(t, tt.failures, tt.status)
+			c := newClient(t, ts.URL, WithRetryPolicy(fastRetry))
+			_, err := c.ListAntarians(context.Background(), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListAntarians error = %v, want error %v", err, tt.wantErr)
+			}
+			if *requests != tt.requests {
+				t.Errorf("made %d requests, want %d", *requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestRetryError(t *testing.T) {
+	ts, _ := flakyServer(t, 5, http.StatusBadGateway)
+	c := newClient(t, ts.URL, WithRetryPolicy(fastRetry))
+	_, err := c.ListAntarians(context.Background(), nil)
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("error = %v, want a RetryError", err)
+	}
+	if retryErr.Attempts != 3 || retryErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("RetryError = %d attempts, status %d; want 3, 502", retryErr.Attempts, retryErr.StatusCode)
+	}
+	if !isStatus(err, http.StatusBadGateway) {
+		t.Errorf("RetryError does not unwrap to the APIError: %v", err)
+	}
+
+	// a single attempt is not worth a RetryError
+	ts, _ = flakyServer(t, 5, http.StatusNotFound)
+	c = newClient(t, ts.URL, WithRetryPolicy(fastRetry))
+	_, err = c.ListAntarians(context.Background(), nil)
+	if errors.As(err, &retryErr) {
+		t.Errorf("error = %v, want no RetryError", err)
+	}
+}
+
+func TestRetryPost(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []CallOption
+		requests int32
+	}{
+		{"without a key", nil, 1},
+		{"with an idempotency key", []CallOption{IdempotencyKey("create-libfoo")}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, requests := flakyServer(t, 1, http.StatusServiceUnavailable)
+			c := newClient(t, ts.URL, WithRetryPolicy(fastRetry))
+			c.CreateAntarian(context.Background(), &lib.Antarian{Name: "libfoo"}, tt.opts...)
+			if *requests != tt.requests {
+				t.Errorf("made %d requests, want %d", *requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name       string
+		attempt    int
+		status     int
+		retryAfter string
+		min, max   time.Duration
+		retry      bool
+	}{
+		{"first attempt", 1, 503, "", 50 * time.Millisecond, 100 * time.Millisecond, true},
+		{"doubles", 2, 503, "", 100 * time.Millisecond, 200 * time.Millisecond, true},
+		{"capped", 3, 503, "", 150 * time.Millisecond, 300 * time.Millisecond, true},
+		{"retry-after seconds", 1, 429, "7", 7 * time.Second, 7 * time.Second, true},
+		{"retry-after date", 1, 503, date, 59 * time.Minute, time.Hour, true},
+		{"malformed retry-after", 1, 503, "soon", 50 * time.Millisecond, 100 * time.Millisecond, true},
+		{"client error", 1, 400, "", 0, 0, false},
+		{"out of attempts", 4, 503, "", 0, 0, false},
+	}
+	policy := ExponentialBackoff{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			d, retry := policy.Backoff(tt.attempt, resp, nil)
+			if retry != tt.retry {
+				t.Fatalf("Backoff retry = %v, want %v", retry, tt.retry)
+			}
+			if d < tt.min || d > tt.max {
+				t.Errorf("Backoff = %v, want within [%v, %v]", d, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// countingPolicy retries everything up to max attempts without waiting.
+type countingPolicy struct {
+	max   int
+	calls int
+}
+
+func (p *countingPolicy) Backoff(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	p.calls++
+	return 0, attempt < p.max
+}
+
+func TestCustomRetryPolicy(t *testing.T) {
+	ts, requests := flakyServer(t, 5, http.StatusNotFound)
+	policy := &countingPolicy{max: 4}
+	c := newClient(t, ts.URL, WithRetryPolicy(policy))
+	if _, err := c.ListAntarians(context.Background(), nil); err == nil {
+		t.Fatal("ListAntarians succeeded, want the 404")
+	}
+	if *requests != 4 || policy.calls != 4 {
+		t.Errorf("made %d requests and %d Backoff calls, want 4 and 4", *requests, policy.calls)
+	}
+}
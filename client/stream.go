@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// maxStreamLine bounds a single NDJSON record.
+const maxStreamLine = 1048576
+
+// StreamAntarians reads the Antarians selected by lo, as ListAntarians
+// would return them, from the NDJSON stream endpoint, delivering each
+// Antarian as soon as it is decoded so that memory use does not grow with
+// the size of the collection. The Antarian channel is closed
+// when the stream ends or ctx is cancelled; the error channel then yields
+// the error that ended it, if any, and is closed.
+//
+//	antarians, errc := c.StreamAntarians(ctx, nil)
+//	for a := range antarians {
+//		...
+//	}
+//	if err := <-errc; err != nil {
+//		...
+//	}
+func (c *Client) StreamAntarians(ctx context.Context, lo *ListOptions) (<-chan lib.Antarian, <-chan error) {
+	antarians := make(chan lib.Antarian)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(antarians)
+		if err := c.streamAntarians(ctx, lo, antarians); err != nil {
+			errc <- err
+		}
+	}()
+	return antarians, errc
+}
+
+func (c *Client) streamAntarians(ctx context.Context, lo *ListOptions, out chan<- lib.Antarian) error {
+	rawurl := c.url("/antarians/stream")
+	if q := lo.values().Encode(); q != "" {
+		rawurl += "?" + q
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", rawurl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/x-ndjson")
+	resp, err := c.openStream(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 4096), maxStreamLine)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var a lib.Antarian
+		if err := json.Unmarshal(line, &a); err != nil {
+			return fmt.Errorf("decode response: %v", err)
+		}
+		select {
+		case out <- a:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("read response: %v", err)
+	}
+	return nil
+}
+
+// openStream sends a single attempt of req, which is expected to return a
+// long-lived body, and returns the response once a 200 has been received.
+// Streams are not retried and the per-call timeout does not apply.
+func (c *Client) openStream(ctx context.Context, req *http.Request) (*http.Response, error) {
+	token := ""
+	if c.tokens != nil {
+		var err error
+		if token, err = c.tokens.Token(ctx); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	injectTrace(req)
+
+	c.logRequest(req, token)
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	c.logResponse(req, resp, err, token, time.Since(start))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%s", redact(err.Error(), token))
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			if inv, ok := c.tokens.(invalidator); ok {
+				inv.Invalidate()
+			}
+		}
+		return nil, newAPIError(resp, token)
+	}
+	return resp, nil
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// UploadOption configures UploadArtifact.
+type UploadOption func(*uploadOptions)
+
+type uploadOptions struct {
+	filename  string
+	multipart bool
+	progress  func(sent, total int64)
+	factory   func() (io.Reader, error)
+}
+
+// UploadFilename names the stored file; the server derives one otherwise.
+func UploadFilename(name string) UploadOption {
+	return func(o *uploadOptions) { o.filename = name }
+}
+
+// UploadMultipart sends the artifact as a multipart/form-data "file" part
+// instead of as the raw request body.
+func UploadMultipart() UploadOption {
+	return func(o *uploadOptions) { o.multipart = true }
+}
+
+// UploadProgress calls fn as bytes are sent. total is the size passed to
+// UploadArtifact and may be -1 if unknown.
+func UploadProgress(fn func(sent, total int64)) UploadOption {
+	return func(o *uploadOptions) { o.progress = fn }
+}
+
+// UploadBodyFactory supplies a fresh reader for each attempt, enabling
+// retries for readers that cannot seek.
+func UploadBodyFactory(fn func() (io.Reader, error)) UploadOption {
+	return func(o *uploadOptions) { o.factory = fn }
+}
+
+// ChecksumError is returned when the checksum stored by the server differs
+// from the one computed while sending.
+type ChecksumError struct {
+	Sent   string
+	Stored string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("antares: artifact checksum mismatch: sent %s, server stored %s", e.Sent, e.Stored)
+}
+
+// UploadArtifact streams r to the artifact endpoint of the Antarian without
+// buffering it in memory, hashing it on the way so the server's recorded
+// sha256 can be checked. size may be -1 when unknown. Failed attempts are
+// retried only if r is an io.ReadSeeker or UploadBodyFactory is given.
+// The client's default timeout does not apply; bound uploads through ctx.
+func (c *Client) UploadArtifact(ctx context.Context, antarianID string, r io.Reader, size int64, opts ...UploadOption) (*lib.Artifact, error) {
+	var o uploadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	rawurl := c.url("/antarians/" + url.PathEscape(antarianID) + "/artifact")
+	if o.filename != "" && !o.multipart {
+		rawurl += "?" + url.Values{"filename": {o.filename}}.Encode()
+	}
+	return c.upload(ctx, rawurl, r, size, &o)
+}
+
+// upload sends r to rawurl as UploadArtifact does, retrying when the body
+// can be replayed.
+func (c *Client) upload(ctx context.Context, rawurl string, r io.Reader, size int64, o *uploadOptions) (*lib.Artifact, error) {
+	body := o.factory
+	replayable := body != nil
+	if body == nil {
+		if rs, ok := r.(io.ReadSeeker); ok {
+			start, err := rs.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			replayable = true
+			body = func() (io.Reader, error) {
+				_, err := rs.Seek(start, io.SeekStart)
+				return rs, err
+			}
+		} else {
+			used := false
+			body = func() (io.Reader, error) {
+				if used {
+					return nil, errors.New("upload body already consumed")
+				}
+				used = true
+				return r, nil
+			}
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		src, err := body()
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.New()
+		resp, token, err := c.postArtifact(ctx, rawurl, src, size, sum, o)
+		if ctx.Err() != nil {
+			if err == nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+
+		failed := err != nil || resp.StatusCode < 200 || resp.StatusCode > 299
+		if failed && replayable {
+			if wait, ok := c.retry.Backoff(attempt, resp, err); ok {
+				if err == nil {
+					io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1048576))
+					resp.Body.Close()
+				}
+				if err := sleep(ctx, wait); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		artifact, err := readArtifact(resp, err, token)
+		if err == nil {
+			if sent := hex.EncodeToString(sum.Sum(nil)); artifact.Checksum != sent {
+				err = &ChecksumError{Sent: sent, Stored: artifact.Checksum}
+			}
+		}
+		if err != nil && attempt > 1 {
+			retryErr := &RetryError{Attempts: attempt, Err: err}
+			if resp != nil {
+				retryErr.StatusCode = resp.StatusCode
+			}
+			return nil, retryErr
+		}
+		return artifact, err
+	}
+}
+
+// postArtifact sends one upload attempt, feeding every byte through sum.
+func (c *Client) postArtifact(ctx context.Context, rawurl string, src io.Reader, size int64, sum hash.Hash, o *uploadOptions) (*http.Response, string, error) {
+	src = &progressReader{r: io.TeeReader(src, sum), total: size, fn: o.progress}
+
+	var (
+		reqBody     io.Reader = src
+		contentType           = "application/octet-stream"
+		length                = size
+	)
+	if o.multipart {
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		go func() {
+			part, err := mw.CreateFormFile("file", o.filename)
+			if err == nil {
+				_, err = io.Copy(part, src)
+			}
+			if err == nil {
+				err = mw.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		reqBody, contentType, length = pr, mw.FormDataContentType(), -1
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", rawurl, reqBody)
+	if err != nil {
+		return nil, "", err
+	}
+	if length >= 0 {
+		req.ContentLength = length
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	token := ""
+	if c.tokens != nil {
+		if token, err = c.tokens.Token(ctx); err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	injectTrace(req)
+
+	c.logRequest(req, token)
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	c.logResponse(req, resp, err, token, time.Since(start))
+	if err != nil {
+		err = errors.New(redact(err.Error(), token))
+	}
+	return resp, token, err
+}
+
+func readArtifact(resp *http.Response, err error, token string) (*lib.Artifact, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newAPIError(resp, token)
+	}
+	var artifact lib.Artifact
+	if err := json.NewDecoder(resp.Body).Decode(&artifact); err != nil {
+		return nil, fmt.Errorf("decode response: %v", err)
+	}
+	return &artifact, nil
+}
+
+// progressReader reports the running byte count to fn after every read.
+type progressReader struct {
+	r     io.Reader
+	sent  int64
+	total int64
+	fn    func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 && p.fn != nil {
+		p.sent += int64(n)
+		p.fn(p.sent, p.total)
+	}
+	return n, err
+}
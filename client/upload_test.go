@@ -0,0 +1,154 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+func randomBlob(size int) []byte {
+	blob := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(blob)
+	return blob
+}
+
+func TestUploadArtifact(t *testing.T) {
+	blob := randomBlob(5 << 20)
+	sum := sha256.Sum256(blob)
+	want := hex.EncodeToString(sum[:])
+	tests := []struct {
+		name string
+		opts []UploadOption
+	}{
+		{"raw", nil},
+		{"raw with a filename", []UploadOption{UploadFilename("libfoo.tar.gz")}},
+		{"multipart", []UploadOption{UploadMultipart()}},
+		{"multipart with a filename", []UploadOption{UploadMultipart(), UploadFilename("libfoo.tar.gz")}},
+	}
+	ts := newServer(t)
+	c := newClient(t, ts.URL)
+	ctx := context.Background()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := c.CreateAntarian(ctx, testAntarian("libfoo", fmt.Sprintf("%d.0.0", i+1)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sent, total int64
+			opts := append(tt.opts, UploadProgress(func(s, tot int64) { sent, total = s, tot }))
+			artifact, err := c.UploadArtifact(ctx, a.Id, bytes.NewReader(blob), int64(len(blob)), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if artifact.Checksum != want || artifact.Size != int64(len(blob)) {
+				t.Errorf("artifact = %d bytes, %s; want %d, %s", artifact.Size, artifact.Checksum, len(blob), want)
+			}
+			if sent != int64(len(blob)) || total != int64(len(blob)) {
+				t.Errorf("progress ended at %d of %d, want %d", sent, total, len(blob))
+			}
+
+			stored, err := c.GetAntarian(ctx, a.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Checksum != want {
+				t.Errorf("stored checksum = %s, want %s", stored.Checksum, want)
+			}
+			dl, err := c.Download(ctx, a.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.Get(dl.Url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil || !bytes.Equal(got, blob) {
+				t.Errorf("downloaded %d bytes, %v; want the uploaded blob", len(got), err)
+			}
+		})
+	}
+}
+
+// uploadServer answers the first failures uploads with 503 and stores the
+// rest, reporting checksum in place of the real one when it is set.
+func uploadServer(t *testing.T, failures int32, checksum string) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := sha256.New()
+		n, _ := io.Copy(h, r.Body)
+		if atomic.AddInt32(&requests, 1) <= failures {
+			http.Error(w, `{"message":"busy"}`, http.StatusServiceUnavailable)
+			return
+		}
+		sum := hex.EncodeToString(h.Sum(nil))
+		if checksum != "" {
+			sum = checksum
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(lib.Artifact{Id: "a1", Size: n, Checksum: sum})
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+func TestUploadRetry(t *testing.T) {
+	blob := randomBlob(1 << 20)
+	tests := []struct {
+		name     string
+		body     func() io.Reader
+		opts     []UploadOption
+		requests int32
+		ok       bool
+	}{
+		{"seekable", func() io.Reader { return bytes.NewReader(blob) }, nil, 2, true},
+		{"not seekable", func() io.Reader { return io.MultiReader(bytes.NewReader(blob)) }, nil, 1, false},
+		{"body factory", func() io.Reader { return io.MultiReader(bytes.NewReader(blob)) },
+			[]UploadOption{UploadBodyFactory(func() (io.Reader, error) { return bytes.NewReader(blob), nil })}, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, requests := uploadServer(t, 1, "")
+			c := newClient(t, ts.URL, WithRetryPolicy(fastRetry))
+			artifact, err := c.UploadArtifact(context.Background(), "a1", tt.body(), int64(len(blob)), tt.opts...)
+			if (err == nil) != tt.ok {
+				t.Fatalf("UploadArtifact error = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && artifact.Size != int64(len(blob)) {
+				t.Errorf("server received %d bytes, want %d", artifact.Size, len(blob))
+			}
+			if *requests != tt.requests {
+				t.Errorf("made %d requests, want %d", *requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestUploadChecksumMismatch(t *testing.T) {
+	ts, _ := uploadServer(t, 0, "0000")
+	c := newClient(t, ts.URL)
+	_, err := c.UploadArtifact(context.Background(), "a1", bytes.NewReader([]byte("artifact")), 8)
+	var sumErr *ChecksumError
+	if !errors.As(err, &sumErr) || sumErr.Stored != "0000" {
+		t.Fatalf("error = %v, want a ChecksumError", err)
+	}
+	sum := sha256.Sum256([]byte("artifact"))
+	if sumErr.Sent != hex.EncodeToString(sum[:]) {
+		t.Errorf("ChecksumError.Sent = %s, want the sha256 of the body", sumErr.Sent)
+	}
+}
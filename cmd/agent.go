@@ -0,0 +1,122 @@
+// Copyright © 2016 Brett Smith <bc.smith@sas.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xbcsmith/antares/agent"
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/server"
+)
+
+var (
+	agentName              string
+	agentWorkers           int
+	agentPollInterval      time.Duration
+	agentHeartbeatInterval time.Duration
+)
+
+// agentCmd represents the agent command
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Antares build agent",
+	Long: `Run the builds of the antares server at --url on this host. The
+build section of the config file sets how builds are run; --token must
+be an admin token.`,
+	Run: runAgent,
+}
+
+func runAgent(cmd *cobra.Command, args []string) {
+
+	cfg, err := loadServerConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	c, err := newClient()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	logger, _ := server.NewLogger(cfg, os.Stderr)
+
+	hostname, _ := os.Hostname()
+	name := agentName
+	if name == "" {
+		name = hostname
+	}
+	workers := agentWorkers
+	if workers == 0 {
+		workers = cfg.Build.Workers
+	}
+
+	var signer crypto.Signer
+	if cfg.Signing.Key != "" {
+		if signer, err = lib.LoadSigningKey(cfg.Signing.Key); err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	a := &agent.Agent{
+		Client: c,
+		Executor: &build.Executor{
+			Command:    cfg.Build.Command,
+			Shell:      cfg.Build.Shell,
+			Runtime:    cfg.Build.Runtime,
+			DockerHost: cfg.Build.DockerHost,
+			WorkDir:    cfg.Build.WorkDir,
+			Timeout:    cfg.Build.Timeout,
+			Signer:     signer,
+		},
+		Name:              name,
+		Hostname:          hostname,
+		Workers:           workers,
+		PollInterval:      agentPollInterval,
+		HeartbeatInterval: agentHeartbeatInterval,
+		RetryDelay:        cfg.Build.RetryDelay,
+		Logger:            logger,
+	}
+	if err := a.Run(ctx); err != nil && ctx.Err() == nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(agentCmd)
+
+	agentCmd.Flags().StringVar(&serverConfigFile, "config", "", "server config file for the build settings (default is ./"+defaultServerConfig+" when it exists)")
+	agentCmd.Flags().StringVar(&agentName, "name", "", "name of the agent (default is the hostname)")
+	agentCmd.Flags().IntVar(&agentWorkers, "workers", 0, "builds run at once (default is build.workers of the config)")
+	agentCmd.Flags().DurationVar(&agentPollInterval, "poll-interval", 5*time.Second, "wait between leases while no build is queued")
+	agentCmd.Flags().DurationVar(&agentHeartbeatInterval, "heartbeat-interval", 10*time.Second, "interval of heartbeats; keep it well below build.agent_timeout of the server")
+}
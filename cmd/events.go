@@ -0,0 +1,85 @@
+// Copyright © 2016 Brett Smith <bc.smith@sas.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xbcsmith/antares/client"
+)
+
+var eventsFilter client.EventFilter
+
+// eventsCmd represents the events command
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "print server events",
+	Long:  `Print Antarian and build events from the antares server`,
+	Run:   events,
+}
+
+func events(cmd *cobra.Command, args []string) {
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	stream, err := c.Subscribe(ctx, eventsFilter)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	for ev := range stream {
+		fmt.Printf("%s\t%s\t%s\n", ev.EventTime().Format(time.RFC3339), ev.EventType(), eventSubject(ev))
+	}
+}
+
+// eventSubject describes what an event is about for display.
+func eventSubject(ev client.Event) string {
+	switch e := ev.(type) {
+	case client.AntarianCreated:
+		return fmt.Sprintf("%s %s %s", e.Antarian.Id, e.Antarian.Name, e.Antarian.Version)
+	case client.AntarianUpdated:
+		return fmt.Sprintf("%s %s %s", e.Antarian.Id, e.Antarian.Name, e.Antarian.Version)
+	case client.AntarianDeleted:
+		return fmt.Sprintf("%s %s %s", e.Antarian.Id, e.Antarian.Name, e.Antarian.Version)
+	case client.BuildStarted:
+		return fmt.Sprintf("%s %s %s", e.Build.Id, e.Build.Name, e.Build.Version)
+	case client.BuildFinished:
+		return fmt.Sprintf("%s %s %s", e.Build.Id, e.Build.Name, e.Build.Version)
+	case client.UnknownEvent:
+		return string(e.Data)
+	}
+	return ev.EventID()
+}
+
+func init() {
+	RootCmd.AddCommand(eventsCmd)
+
+	eventsCmd.Flags().BoolVarP(&eventsFilter.Follow, "follow", "f", false, "keep streaming new events")
+	eventsCmd.Flags().StringSliceVar(&eventsFilter.Types, "type", nil, "only show events of these types")
+	eventsCmd.Flags().StringVar(&eventsFilter.Name, "name", "", "only show events for Antarians with this name")
+	eventsCmd.Flags().StringVar(&eventsFilter.LastEventID, "since", "", "resume after this event id")
+}
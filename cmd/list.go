@@ -0,0 +1,82 @@
+// Copyright © 2016 Brett Smith <bc.smith@sas.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xbcsmith/antares/client"
+	"github.com/xbcsmith/antares/lib"
+)
+
+var (
+	listName     string
+	listLabel    string
+	listPlatform string
+	listLatest   bool
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list Antarians",
+	Long:  `List the Antarians on the antares server as a table, by name and newest version first`,
+	Args:  cobra.NoArgs,
+	Run:   list,
+}
+
+func list(cmd *cobra.Command, args []string) {
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+
+	antarians, err := c.ListAll(context.Background(), &client.ListOptions{Name: listName, Label: listLabel})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	if listPlatform != "" {
+		antarians = antarians.Filter(func(a lib.Antarian) bool { return a.Platform() == listPlatform })
+	}
+	if listLatest {
+		antarians = antarians.Latest()
+	} else {
+		antarians.SortBy(lib.ByName, lib.Descending(lib.ByVersion), lib.Descending(lib.ByStart))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tVERSION\tRELEASE\tPLATFORM\tSTATUS\tSTART")
+	for _, a := range antarians {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", a.Id, a.Name, a.Version, a.Release, a.Platform(), a.Status, a.Start.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+func init() {
+	RootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringVar(&listName, "name", "", "list only Antarians with this name")
+	listCmd.Flags().StringVarP(&listLabel, "selector", "l", "", "list only Antarians matching this label selector, e.g. team=infra")
+	listCmd.Flags().StringVar(&listPlatform, "platform", "", "list only Antarians built for this platform, e.g. linux/arm64")
+	listCmd.Flags().BoolVar(&listLatest, "latest", false, "list only the latest version of each name")
+}
@@ -15,40 +15,81 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"github.com/spf13/cobra"
 	"io/ioutil"
 	"os"
-    "github.com/xbcsmith/antares/loader"
+
+	"github.com/spf13/cobra"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/loader"
+	"github.com/xbcsmith/antares/telemetry"
+)
+
+var (
+	otlpEndpoint string
+	otlpInsecure bool
+	loadFormat   string
 )
 
 // loaderCmd represents the loader command
 var loadCmd = &cobra.Command{
-	Use:   "load",
-	Short: "load json from stdin",
-	Long:  `Load json into antares from stdin`,
-	Run:   load,
+	Use:   "load [file]",
+	Short: "load json, yaml or toml from a file or stdin",
+	Long: `Load an Antarian definition into antares from a file or stdin, as json,
+yaml or toml by --format or else the file's extension`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  load,
 }
 
 func load(cmd *cobra.Command, args []string) {
 
-	raw, err := ioutil.ReadAll(os.Stdin)
+	format := loader.Format(loadFormat)
+	var raw []byte
+	var err error
+	if len(args) == 1 {
+		if format == "" {
+			format = loader.FormatOf(args[0])
+		}
+		raw, err = ioutil.ReadFile(args[0])
+	} else {
+		if format == "" {
+			format = loader.FormatJSON
+		}
+		raw, err = ioutil.ReadAll(os.Stdin)
+	}
 
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(-1)
 	}
-    resp, err := loader.Load(raw)
+	c, err := newClient()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	tracing := config.Tracing{Endpoint: otlpEndpoint, Insecure: otlpInsecure, SampleRatio: 1}
+	stopTracing, err := telemetry.Setup(context.Background(), tracing, "antares-loader")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	resp, err := loader.LoadFormat(context.Background(), c, raw, format)
+	// os.Exit skips deferred calls, so flush the spans first
+	stopTracing(context.Background())
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(-1)
 	}
-    fmt.Printf("%#v\n", resp)
+	fmt.Printf("%s\t%s\t%s\n", resp.Antarian.Id, resp.Antarian.Name, resp.Antarian.Version)
 	os.Exit(0)
 }
 
 func init() {
 	RootCmd.AddCommand(loadCmd)
+	loadCmd.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP gRPC collector to send traces to")
+	loadCmd.Flags().BoolVar(&otlpInsecure, "otlp-insecure", false, "send traces without TLS")
+	loadCmd.Flags().StringVar(&loadFormat, "format", "", "json, yaml or toml; by default the file's extension, or json")
 
 	// Here you will define your flags and configuration settings.
 
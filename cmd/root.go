@@ -20,9 +20,24 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/xbcsmith/antares/client"
+	"github.com/xbcsmith/antares/config"
 )
 
-var cfgFile string
+var (
+	cfgFile   string
+	serverUrl string
+	token     string
+	caFile    string
+	certFile  string
+	keyFile   string
+
+	namespace string
+
+	oidcIssuer       string
+	oidcClientID     string
+	oidcClientSecret string
+)
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
@@ -52,6 +67,15 @@ func init() {
 	// will be global for your application.
 
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.antares.yaml)")
+	RootCmd.PersistentFlags().StringVar(&serverUrl, "url", config.DefaultURL(), "base url of the antares server")
+	RootCmd.PersistentFlags().StringVar(&token, "token", "", "api token sent as a bearer token")
+	RootCmd.PersistentFlags().StringVar(&namespace, "namespace", "", "namespace to work in (default is the server's default namespace)")
+	RootCmd.PersistentFlags().StringVar(&caFile, "ca-file", "", "PEM file of the CAs trusted to sign the server certificate")
+	RootCmd.PersistentFlags().StringVar(&certFile, "cert-file", "", "client certificate for servers requiring mutual TLS")
+	RootCmd.PersistentFlags().StringVar(&keyFile, "key-file", "", "key of the client certificate")
+	RootCmd.PersistentFlags().StringVar(&oidcIssuer, "oidc-issuer", "", "OpenID Connect provider to log in to instead of passing --token")
+	RootCmd.PersistentFlags().StringVar(&oidcClientID, "oidc-client-id", "", "client id to log in to the OpenID Connect provider as")
+	RootCmd.PersistentFlags().StringVar(&oidcClientSecret, "oidc-client-secret", os.Getenv("ANTARES_OIDC_CLIENT_SECRET"), "client secret for --oidc-client-id (default $ANTARES_OIDC_CLIENT_SECRET)")
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	RootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
@@ -61,14 +85,32 @@ func init() {
 func initConfig() {
 	if cfgFile != "" { // enable ability to specify config file via flag
 		viper.SetConfigFile(cfgFile)
+	} else {
+		viper.SetConfigName(".antares") // name of config file (without extension)
+		viper.AddConfigPath("$HOME")    // adding home directory as first search path
 	}
-
-	viper.SetConfigName(".antares") // name of config file (without extension)
-	viper.AddConfigPath("$HOME")  // adding home directory as first search path
-	viper.AutomaticEnv()          // read in environment variables that match
+	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
 }
+
+// newClient returns an API client for the server selected by --url and
+// --token, or logged in with the --oidc-* flags, using the --ca-file,
+// --cert-file and --key-file TLS settings.
+func newClient() (*client.Client, error) {
+	opts := []client.Option{client.WithToken(token), client.WithNamespace(namespace)}
+	if oidcIssuer != "" {
+		opts = append(opts, client.WithTokenSource(client.ClientCredentials(oidcIssuer, oidcClientID, oidcClientSecret)))
+	}
+	if caFile != "" || certFile != "" || keyFile != "" {
+		tc, err := client.LoadTLSConfig(caFile, certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithTLSConfig(tc))
+	}
+	return client.New(serverUrl, opts...)
+}
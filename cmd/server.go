@@ -16,11 +16,24 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/spf13/cobra"
 	"os"
-    "github.com/xbcsmith/antares/server"
+
+	"github.com/spf13/cobra"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/server"
 )
 
+var (
+	serverConfigFile string
+	printConfig      bool
+	listenAddr       string
+	httpConfig       config.HTTP
+)
+
+// defaultServerConfig is the config file serve and agent read when --config
+// is not given and it exists in the working directory.
+const defaultServerConfig = "antares.yml"
+
 // serverCmd represents the server command
 var serveCmd = &cobra.Command{
 	Use:   "serve",
@@ -31,11 +44,69 @@ var serveCmd = &cobra.Command{
 
 func serve(cmd *cobra.Command, args []string) {
 
-    fmt.Println("SERVER  MODULE")
-    server.Server()
+	cfg, err := loadServerConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	applyServeFlags(cmd, cfg)
+	if err := cfg.Validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	if printConfig {
+		if err := cfg.PrintEffective(os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(-1)
+		}
+		os.Exit(0)
+	}
+
+	fmt.Println("SERVER  MODULE")
+	server.Server(cfg)
 	os.Exit(0)
 }
 
+// loadServerConfig reads the server config named by --config, or
+// defaultServerConfig when there is one, under the ANTARES_* environment.
+// The CLI's own config file, ~/.antares.yaml, holds client settings and is
+// never read as a server config.
+func loadServerConfig() (*config.Config, error) {
+	path := serverConfigFile
+	if path == "" {
+		if _, err := os.Stat(defaultServerConfig); err == nil {
+			path = defaultServerConfig
+		}
+	}
+	return config.Load(path)
+}
+
+// applyServeFlags overrides cfg with the flags given on the command line.
+func applyServeFlags(cmd *cobra.Command, cfg *config.Config) {
+	flags := cmd.Flags()
+	if flags.Changed("addr") {
+		cfg.Addr = listenAddr
+	}
+	if flags.Changed("read-timeout") {
+		cfg.HTTP.ReadTimeout = httpConfig.ReadTimeout
+	}
+	if flags.Changed("read-header-timeout") {
+		cfg.HTTP.ReadHeaderTimeout = httpConfig.ReadHeaderTimeout
+	}
+	if flags.Changed("write-timeout") {
+		cfg.HTTP.WriteTimeout = httpConfig.WriteTimeout
+	}
+	if flags.Changed("idle-timeout") {
+		cfg.HTTP.IdleTimeout = httpConfig.IdleTimeout
+	}
+	if flags.Changed("max-header-bytes") {
+		cfg.HTTP.MaxHeaderBytes = httpConfig.MaxHeaderBytes
+	}
+	if flags.Changed("shutdown-timeout") {
+		cfg.HTTP.ShutdownTimeout = httpConfig.ShutdownTimeout
+	}
+}
+
 func init() {
 	RootCmd.AddCommand(serveCmd)
 
@@ -48,5 +119,15 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// keyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-
+	// --config shadows the persistent flag naming the CLI's config file
+	serveCmd.Flags().StringVar(&serverConfigFile, "config", "", "server config file (default is ./"+defaultServerConfig+" when it exists)")
+	serveCmd.Flags().BoolVar(&printConfig, "print-config", false, "print the effective configuration and exit")
+	// These override the addr and http settings of the config file.
+	serveCmd.Flags().StringVar(&listenAddr, "addr", "", "address to listen on, e.g. :8080 or unix:///run/antares.sock")
+	serveCmd.Flags().DurationVar(&httpConfig.ReadTimeout, "read-timeout", 0, "maximum time to read a request, body included")
+	serveCmd.Flags().DurationVar(&httpConfig.ReadHeaderTimeout, "read-header-timeout", 0, "maximum time to read request headers")
+	serveCmd.Flags().DurationVar(&httpConfig.WriteTimeout, "write-timeout", 0, "maximum time to write a response")
+	serveCmd.Flags().DurationVar(&httpConfig.IdleTimeout, "idle-timeout", 0, "how long idle keep-alive connections are kept")
+	serveCmd.Flags().IntVar(&httpConfig.MaxHeaderBytes, "max-header-bytes", 0, "maximum size of request headers")
+	serveCmd.Flags().DurationVar(&httpConfig.ShutdownTimeout, "shutdown-timeout", 0, "how long to drain requests and builds on SIGINT or SIGTERM")
 }
@@ -0,0 +1,87 @@
+// Copyright © 2016 Brett Smith <bc.smith@sas.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/xbcsmith/antares/client"
+)
+
+var (
+	uploadMultipart bool
+	uploadQuiet     bool
+)
+
+// uploadCmd represents the upload command
+var uploadCmd = &cobra.Command{
+	Use:   "upload <id> <file>",
+	Short: "upload an artifact",
+	Long:  `Upload the artifact file for an Antarian to the antares server`,
+	Args:  cobra.ExactArgs(2),
+	Run:   upload,
+}
+
+func upload(cmd *cobra.Command, args []string) {
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+
+	f, err := os.Open(args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+
+	opts := []client.UploadOption{client.UploadFilename(filepath.Base(args[1]))}
+	if uploadMultipart {
+		opts = append(opts, client.UploadMultipart())
+	}
+	if !uploadQuiet {
+		opts = append(opts, client.UploadProgress(func(sent, total int64) {
+			fmt.Fprintf(os.Stderr, "\r%d/%d bytes", sent, total)
+		}))
+	}
+
+	artifact, err := c.UploadArtifact(context.Background(), args[0], f, info.Size(), opts...)
+	if !uploadQuiet {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	fmt.Printf("%s\t%d\tsha256:%s\n", artifact.Filename, artifact.Size, artifact.Checksum)
+}
+
+func init() {
+	RootCmd.AddCommand(uploadCmd)
+
+	uploadCmd.Flags().BoolVar(&uploadMultipart, "multipart", false, "send the file as multipart/form-data")
+	uploadCmd.Flags().BoolVarP(&uploadQuiet, "quiet", "q", false, "do not print progress")
+}
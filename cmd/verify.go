@@ -0,0 +1,60 @@
+// Copyright © 2016 Brett Smith <bc.smith@sas.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyPlatform string
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify <id>",
+	Short: "verify the signature of an artifact",
+	Long:  `Check the signature of the artifact of an Antarian against the public keys of the antares server`,
+	Args:  cobra.ExactArgs(1),
+	Run:   verify,
+}
+
+func verify(cmd *cobra.Command, args []string) {
+
+	c, err := newClient()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+
+	check, err := c.VerifySignature(context.Background(), args[0], verifyPlatform)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	if !check.Valid {
+		fmt.Printf("%s\tinvalid\t%s\n", check.Filename, check.Error)
+		os.Exit(1)
+	}
+	fmt.Printf("%s\tvalid\tkey:%s\n", check.Filename, check.KeyId)
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringVar(&verifyPlatform, "platform", "", "verify the artifact built for this platform, e.g. linux/arm64")
+}
@@ -0,0 +1,994 @@
+// Package config holds the server configuration, loaded from a YAML or JSON
+// file with ANTARES_* environment overrides.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables that override file settings.
+// The variable name is derived from the yaml key path, e.g. tls.cert_file is
+// ANTARES_TLS_CERT_FILE. List values are comma separated.
+const EnvPrefix = "ANTARES_"
+
+type Config struct {
+	// Server is the host name used in urls handed out to clients.
+	Server string `yaml:"server"`
+	// Port is the TCP port to listen on.
+	Port int `yaml:"port"`
+	// Addr overrides the bind address, which is ":<port>" by default.
+	// "unix:///path/to/antares.sock" listens on a unix socket instead.
+	Addr string `yaml:"addr"`
+	// SocketMode is the octal file mode given to unix sockets.
+	SocketMode string `yaml:"socket_mode"`
+	// GRPCAddr is the address the gRPC API listens on; empty disables it.
+	GRPCAddr string `yaml:"grpc_addr"`
+	// URL is the external base url of the server, used for seed data and
+	// download links. Defaults to http://<server>:<port>, taking the host
+	// and port from Addr when it names them.
+	URL string `yaml:"url"`
+	// Backend selects the repository implementation: "stateless" keeps
+	// everything in memory, "bolt" stores it in the file at DBPath and
+	// "postgres" in the database described by Postgres.
+	Backend string `yaml:"backend"`
+	// DBPath is the database file of the bolt backend.
+	DBPath   string   `yaml:"db_path"`
+	Postgres Postgres `yaml:"postgres"`
+	// ArtifactStore selects where artifacts are kept: "local" stores them
+	// under ArtifactDir and "s3" in the bucket described by S3.
+	ArtifactStore string `yaml:"artifact_store"`
+	// ArtifactDir is the root directory for stored artifacts.
+	ArtifactDir string `yaml:"artifact_dir"`
+	S3          S3     `yaml:"s3"`
+	// ArtifactMaxBytes bounds the size of an uploaded artifact; zero
+	// allows any size.
+	ArtifactMaxBytes int64 `yaml:"artifact_max_bytes"`
+	// ArtifactFsync flushes artifacts to disk before an upload completes.
+	ArtifactFsync bool `yaml:"artifact_fsync"`
+	// ArtifactGCInterval runs artifact garbage collection, deleting
+	// orphaned files, this often; zero disables the background run.
+	ArtifactGCInterval time.Duration `yaml:"artifact_gc_interval"`
+	// ArtifactGCGrace protects files written more recently than this from
+	// garbage collection, so uploads in flight are never collected.
+	ArtifactGCGrace time.Duration `yaml:"artifact_gc_grace"`
+	// ArtifactURLTTL is how long the download links handed out by
+	// /antarians/{id}/download stay valid. The s3 store presigns them;
+	// the local store signs them with ArtifactURLSecret, and hands out
+	// plain links needing a token when it is empty. Zero disables signed
+	// links altogether.
+	ArtifactURLTTL time.Duration `yaml:"artifact_url_ttl"`
+	// ArtifactURLSecret is the HMAC key of signed /files links. Servers
+	// sharing a store must share the secret.
+	ArtifactURLSecret string `yaml:"artifact_url_secret" secret:"true"`
+	// ArtifactGCDryRun makes the background garbage collection only log
+	// what it would delete.
+	ArtifactGCDryRun bool `yaml:"artifact_gc_dry_run"`
+	// ArtifactRetention expires Antarians, with their artifacts, created
+	// longer ago than this; zero keeps them forever.
+	ArtifactRetention time.Duration `yaml:"artifact_retention"`
+	// ArtifactKeepVersions expires all but this many of the newest versions
+	// of each name; zero keeps every version.
+	ArtifactKeepVersions int `yaml:"artifact_keep_versions"`
+	// ArtifactMinFree is the free space, in bytes, below which /readyz
+	// reports the artifact filesystem as full; zero disables the check.
+	ArtifactMinFree int64 `yaml:"artifact_min_free"`
+	// Tokens are the API tokens accepted by the server. With none the API
+	// is open to anyone who can reach it.
+	Tokens []string `yaml:"tokens" secret:"true"`
+	// ReadTokens are API tokens that can list and show but not change
+	// anything.
+	ReadTokens []string `yaml:"read_tokens" secret:"true"`
+	// PublicRoutes names routes, e.g. AntarianIndex, served without a
+	// token. The health and metrics endpoints are always public.
+	PublicRoutes []string `yaml:"public_routes"`
+	// AdminTokens are accepted on the /admin endpoints, which ordinary
+	// tokens cannot reach.
+	AdminTokens []string `yaml:"admin_tokens" secret:"true"`
+	// JWT accepts signed JSON Web Tokens alongside the static tokens.
+	JWT JWT `yaml:"jwt"`
+	// OIDC accepts tokens issued by an OpenID Connect provider.
+	OIDC OIDC `yaml:"oidc"`
+	// AuditFile, when set, also appends every audit entry to this file as
+	// one JSON object per line.
+	AuditFile string `yaml:"audit_file"`
+	// AllowDestructiveAdmin enables the admin endpoints that wipe data.
+	AllowDestructiveAdmin bool `yaml:"allow_destructive_admin"`
+	// CORSOrigins lists origins allowed to make cross-origin requests.
+	CORSOrigins []string `yaml:"cors_origins"`
+	// CORSMethods and CORSHeaders are the methods and request headers
+	// allowed in cross-origin requests.
+	CORSMethods []string `yaml:"cors_methods"`
+	CORSHeaders []string `yaml:"cors_headers"`
+	// CORSMaxAge is how long browsers may cache a preflight response.
+	CORSMaxAge time.Duration `yaml:"cors_max_age"`
+	TLS        TLS           `yaml:"tls"`
+	HTTP       HTTP          `yaml:"http"`
+	Tracing    Tracing       `yaml:"tracing"`
+	Build      Build         `yaml:"build"`
+	Request    Request       `yaml:"request"`
+	RateLimit  RateLimit     `yaml:"rate_limit"`
+	Webhooks   Webhooks      `yaml:"webhooks"`
+	GitHooks   GitHooks      `yaml:"git_hooks"`
+	Release    Release       `yaml:"release"`
+	Signing    Signing       `yaml:"signing"`
+	NATS       NATS          `yaml:"nats"`
+	Kafka      Kafka         `yaml:"kafka"`
+	// LogFormat is "text" or "json".
+	LogFormat string `yaml:"log_format"`
+	// LogLevel is one of debug, info, warn or error.
+	LogLevel string `yaml:"log_level"`
+}
+
+// TLS serves the APIs over TLS when CertFile and KeyFile are set.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile requires clients to present a certificate signed by one
+	// of the CAs in this PEM file.
+	ClientCAFile string `yaml:"client_ca_file"`
+	// RedirectAddr is the address of a plain HTTP listener that redirects
+	// every request to the https base url; empty disables it.
+	RedirectAddr string `yaml:"redirect_addr"`
+}
+
+// JWT verifies bearer tokens that are JSON Web Tokens. HMAC tokens are
+// checked with Secret and RSA tokens with the key in PublicKeyFile; at
+// least one must be set to enable it.
+type JWT struct {
+	Secret        string `yaml:"secret" secret:"true"`
+	PublicKeyFile string `yaml:"public_key_file"`
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// RolesClaim names the claim holding the caller's roles, a string or
+	// a list of strings.
+	RolesClaim string `yaml:"roles_claim"`
+}
+
+// OIDC verifies bearer tokens issued by an OpenID Connect provider such as
+// Keycloak or Dex, giving callers the roles mapped from their groups.
+type OIDC struct {
+	// IssuerURL is the provider's issuer; empty disables OIDC. Its
+	// discovery document is fetched when the server starts.
+	IssuerURL string `yaml:"issuer_url"`
+	// ClientID, when set, must be in the aud claim of every token.
+	ClientID string `yaml:"client_id"`
+	// GroupsClaim names the claim listing the caller's groups.
+	GroupsClaim string `yaml:"groups_claim"`
+	// GroupRoles maps provider groups to Antares roles; callers in no
+	// mapped group get no roles. In the environment it is written as
+	// group=role pairs separated by commas.
+	GroupRoles map[string]string `yaml:"group_roles"`
+}
+
+// HTTP tunes the server of the REST API. Zero timeouts are disabled.
+type HTTP struct {
+	// ReadTimeout bounds reading a whole request, body included, so it
+	// also bounds artifact uploads.
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// ReadHeaderTimeout bounds reading the request headers.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	// WriteTimeout bounds writing a response, which cuts off streams and
+	// downloads that run longer.
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// IdleTimeout closes keep-alive connections idle for this long.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// MaxHeaderBytes bounds the size of the request headers.
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+	// ShutdownTimeout is how long a stopping server waits for in-flight
+	// requests and builds before closing connections and cancelling builds.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// Compress gzip or deflate encodes JSON and text responses for clients
+	// that accept it.
+	Compress bool `yaml:"compress"`
+}
+
+// Tracing exports OpenTelemetry traces over OTLP/gRPC.
+type Tracing struct {
+	// Endpoint is the host:port of the OTLP collector; empty disables
+	// tracing.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure sends traces without TLS.
+	Insecure bool `yaml:"insecure"`
+	// SampleRatio is the fraction of new traces recorded. Requests that
+	// carry a sampled parent span are always recorded.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Postgres configures the postgres backend, which several servers can share.
+type Postgres struct {
+	// DSN is the connection string, as a postgres:// url or key=value
+	// pairs.
+	DSN string `yaml:"dsn" secret:"true"`
+	// MaxOpenConns bounds the connection pool.
+	MaxOpenConns int `yaml:"max_open_conns"`
+	// MaxIdleConns is how many unused connections are kept open.
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// ConnMaxLifetime closes connections older than this; zero keeps them.
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// S3 locates the artifact bucket on Amazon S3 or a compatible service
+// such as MinIO, Ceph or the interoperability endpoint of Google Cloud
+// Storage.
+type S3 struct {
+	// Endpoint is the host[:port] of the service, e.g. s3.amazonaws.com.
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// Prefix is prepended to every object name.
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"access_key" secret:"true"`
+	SecretKey string `yaml:"secret_key" secret:"true"`
+	// UseSSL connects over https.
+	UseSSL bool `yaml:"use_ssl"`
+}
+
+// Build configures how builds are executed.
+type Build struct {
+	// Command is the shell command run for Antarians without a buildspec.
+	// The Antarian's fields are passed as ANTARES_* environment variables.
+	// A file named $ANTARES_FILENAME left in the working directory by a
+	// successful build is stored as the Antarian's artifact.
+	Command string `yaml:"command"`
+	// Shell runs the command with -c.
+	Shell string `yaml:"shell"`
+	// Runtime is the container CLI, docker or podman, that runs the
+	// builds of buildspecs naming an image.
+	Runtime string `yaml:"runtime"`
+	// DockerHost runs those builds through the Docker Engine API at this
+	// address, unix:///var/run/docker.sock or tcp://host:2375, instead of
+	// the runtime CLI. The daemon must see the build's working directory.
+	DockerHost string `yaml:"docker_host"`
+	// WorkDir holds a working directory per build.
+	WorkDir string `yaml:"workdir"`
+	// Timeout bounds each build; zero disables it. A buildspec may set
+	// its own.
+	Timeout time.Duration `yaml:"timeout"`
+	// RetryDelay is the wait before retrying a failed build whose
+	// buildspec asks for retries, doubled for each further retry.
+	RetryDelay time.Duration `yaml:"retry_delay"`
+	// Workers is the number of builds run concurrently.
+	Workers int `yaml:"workers"`
+	// QueueSize bounds the builds waiting for a worker.
+	QueueSize int `yaml:"queue_size"`
+	// Serialize prevents concurrent builds of the same Antarian.
+	Serialize bool `yaml:"serialize"`
+	// CancelOnShutdown cancels running builds at shutdown rather than
+	// waiting for them.
+	CancelOnShutdown bool `yaml:"cancel_on_shutdown"`
+	// AgentTimeout is how long a build agent may go without a heartbeat
+	// before it is marked offline and the builds it holds fail; zero
+	// never marks agents offline.
+	AgentTimeout time.Duration `yaml:"agent_timeout"`
+	// NamespaceLimit bounds the builds of one namespace running at once,
+	// so one namespace cannot starve the others; zero is no limit.
+	NamespaceLimit int `yaml:"namespace_limit"`
+	// PriorityAging raises the priority of a queued build by one for each
+	// period it waits, so low priority builds still run; zero disables it.
+	PriorityAging time.Duration `yaml:"priority_aging"`
+	// Retention is how long finished build records are kept; zero keeps
+	// them forever.
+	Retention time.Duration `yaml:"retention"`
+}
+
+// Request bounds and checks the JSON bodies accepted by the API.
+type Request struct {
+	// MaxBytes is the largest body accepted.
+	MaxBytes int64 `yaml:"max_bytes"`
+	// MaxDepth is the deepest nesting of objects and arrays accepted.
+	MaxDepth int `yaml:"max_depth"`
+	// Lenient ignores unknown fields, duplicate keys and trailing data
+	// instead of rejecting the request, for clients that cannot be fixed.
+	Lenient bool `yaml:"lenient"`
+}
+
+// RateLimit throttles each client, identified by its token or else its IP
+// address, on the routes that create Antarians and start builds.
+type RateLimit struct {
+	// Rate is the number of requests per second a client may sustain;
+	// zero disables rate limiting.
+	Rate float64 `yaml:"rate"`
+	// Burst is the number of requests a client may make at once.
+	Burst int `yaml:"burst"`
+}
+
+// Webhooks controls the delivery of events to registered webhooks.
+type Webhooks struct {
+	// Timeout bounds each delivery attempt.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxAttempts is how many times a delivery is tried, backing off
+	// exponentially from RetryDelay, before it is marked failed.
+	MaxAttempts int           `yaml:"max_attempts"`
+	RetryDelay  time.Duration `yaml:"retry_delay"`
+}
+
+// GitHooks accepts the push and tag push events of GitHub and GitLab at
+// /hooks/git and builds the Antarians their Rules map them to.
+type GitHooks struct {
+	// GitHubSecret verifies the X-Hub-Signature-256 of GitHub deliveries
+	// and GitLabToken the X-Gitlab-Token of GitLab ones. Deliveries from
+	// a provider without one are refused.
+	GitHubSecret string `yaml:"github_secret" secret:"true"`
+	GitLabToken  string `yaml:"gitlab_token" secret:"true"`
+	// Rules are matched in order, and every rule matching a push starts
+	// a build. They can only be set in the config file.
+	Rules []GitHookRule `yaml:"rules"`
+}
+
+// GitHookRule maps pushes to a repository to an Antarian: the one with
+// AntarianId, or else the newest version of the one named Name in
+// Namespace.
+type GitHookRule struct {
+	// Repository is the full path of the repository, e.g. org/repo.
+	Repository string `yaml:"repository"`
+	// Ref is a path.Match pattern of the pushed ref, e.g. refs/tags/v*;
+	// empty matches every branch and tag.
+	Ref        string `yaml:"ref"`
+	AntarianId string `yaml:"antarian_id"`
+	Namespace  string `yaml:"namespace"`
+	Name       string `yaml:"name"`
+	// Priority is given to the builds the rule starts.
+	Priority int `yaml:"priority"`
+}
+
+// Release chooses how the release of each new Antarian is made.
+type Release struct {
+	// Scheme is "date", the creation date formatted with Layout,
+	// "counter", numbering the Antarians of each name from 1, or "git",
+	// the short SHA of the commit given when the Antarian is created.
+	Scheme string `yaml:"scheme"`
+	// Layout is the Go time layout of the date scheme.
+	Layout string `yaml:"layout"`
+}
+
+// Signing signs the artifacts of builds and checks their signatures.
+type Signing struct {
+	// Key is the PEM file of the ECDSA or Ed25519 private key builds sign
+	// their artifacts with; without one they are not signed.
+	Key string `yaml:"key"`
+	// PublicKeys are the PEM files of the public keys signatures are
+	// checked against, besides that of Key.
+	PublicKeys []string `yaml:"public_keys"`
+}
+
+// NATS publishes every event to a NATS server.
+type NATS struct {
+	// URL of the server, e.g. nats://localhost:4222; empty disables
+	// publishing. It may carry credentials.
+	URL string `yaml:"url" secret:"true"`
+	// CredsFile authenticates with a NATS credentials file.
+	CredsFile string `yaml:"creds_file"`
+	// SubjectPrefix is prepended to the event type to form the subject,
+	// e.g. antares.build.finished.
+	SubjectPrefix string `yaml:"subject_prefix"`
+	// Subjects replaces the subject of individual event types.
+	Subjects map[string]string `yaml:"subjects"`
+}
+
+// Kafka publishes every event to Kafka, keyed by the id of its Antarian so
+// the events of one Antarian stay in order on one partition.
+type Kafka struct {
+	// Brokers are the host:port of the bootstrap brokers; none disables
+	// publishing.
+	Brokers []string `yaml:"brokers"`
+	// Topic receives the events whose type has no entry in Topics. Empty
+	// publishes only the types listed there.
+	Topic  string            `yaml:"topic"`
+	Topics map[string]string `yaml:"topics"`
+	// Format is the serialization of the messages: json, the lib.Event
+	// as JSON, or avro, Avro single-object encoding.
+	Format string `yaml:"format"`
+}
+
+// KafkaFormats lists the accepted values of Kafka.Format.
+var KafkaFormats = []string{"json", "avro"}
+
+// Backends lists the accepted values of Config.Backend.
+var Backends = []string{"stateless", "bolt", "postgres"}
+
+// ArtifactStores lists the accepted values of Config.ArtifactStore.
+var ArtifactStores = []string{"local", "s3"}
+
+// LogFormats and LogLevels list the accepted logging settings.
+var (
+	LogFormats = []string{"text", "json"}
+	LogLevels  = []string{"debug", "info", "warn", "error"}
+)
+
+// Roles lists the roles that oidc.group_roles can grant.
+var Roles = []string{"read", "write", "admin"}
+
+// Default returns the configuration used when nothing is overridden.
+func Default() *Config {
+	return &Config{
+		Server:           hostname(),
+		Port:             8080,
+		SocketMode:       "0660",
+		Backend:          "stateless",
+		DBPath:           "antares.db",
+		ArtifactStore:    "local",
+		ArtifactDir:      "artifacts",
+		ArtifactMaxBytes: 1 << 30,
+		ArtifactGCGrace:  time.Hour,
+		ArtifactURLTTL:   15 * time.Minute,
+		ArtifactMinFree:  100 << 20,
+		LogFormat:        "text",
+		LogLevel:         "info",
+		Build: Build{
+			Shell:         "/bin/sh",
+			Runtime:       "docker",
+			WorkDir:       "builds",
+			Timeout:       30 * time.Minute,
+			RetryDelay:    10 * time.Second,
+			Workers:       2,
+			QueueSize:     100,
+			Serialize:     true,
+			AgentTimeout:  30 * time.Second,
+			PriorityAging: time.Minute,
+		},
+		HTTP: HTTP{
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   30 * time.Second,
+			Compress:          true,
+		},
+		Request: Request{
+			MaxBytes: 1048576,
+			MaxDepth: 32,
+		},
+		CORSMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		CORSHeaders: []string{"Authorization", "Content-Type", "If-None-Match", "X-Request-Id"},
+		CORSMaxAge:  10 * time.Minute,
+		RateLimit: RateLimit{
+			Burst: 10,
+		},
+		Webhooks: Webhooks{
+			Timeout:     10 * time.Second,
+			MaxAttempts: 5,
+			RetryDelay:  time.Second,
+		},
+		Release: Release{
+			Scheme: string(lib.ReleaseDate),
+			Layout: lib.DefaultReleaseLayout,
+		},
+		NATS: NATS{
+			SubjectPrefix: "antares",
+		},
+		Kafka: Kafka{
+			Topic:  "antares.events",
+			Format: "json",
+		},
+		Postgres: Postgres{
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Tracing: Tracing{
+			SampleRatio: 1,
+		},
+		JWT: JWT{
+			RolesClaim: "roles",
+		},
+		OIDC: OIDC{
+			GroupsClaim: "groups",
+		},
+	}
+}
+
+// Load builds the effective configuration: defaults, then the file at path
+// (skipped when path is empty), then the environment. The result is
+// validated before it is returned.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.decode(raw); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if err := cfg.applyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decode merges a YAML (or JSON, which YAML accepts) document into c,
+// rejecting keys that do not map to a field.
+func (c *Config) decode(raw []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// Validate reports the first setting that cannot work.
+func (c *Config) Validate() error {
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("port: %d is out of range 1-65535", c.Port)
+	}
+	if c.Server == "" {
+		return fmt.Errorf("server: must not be empty")
+	}
+	if _, err := strconv.ParseUint(c.SocketMode, 8, 32); err != nil {
+		return fmt.Errorf("socket_mode: %q is not an octal file mode", c.SocketMode)
+	}
+	if IsUnixAddr(c.ListenAddr()) && c.URL == "" {
+		return fmt.Errorf("url: must be set when listening on a unix socket")
+	}
+	if !contains(Backends, c.Backend) {
+		return fmt.Errorf("backend: %q is not one of %s", c.Backend, strings.Join(Backends, ", "))
+	}
+	if c.Backend == "bolt" && c.DBPath == "" {
+		return fmt.Errorf("db_path: must be set for the bolt backend")
+	}
+	if c.Backend == "postgres" && c.Postgres.DSN == "" {
+		return fmt.Errorf("postgres.dsn: must be set for the postgres backend")
+	}
+	if c.Postgres.MaxOpenConns < 1 {
+		return fmt.Errorf("postgres.max_open_conns: must be at least 1")
+	}
+	if c.Postgres.MaxIdleConns < 0 {
+		return fmt.Errorf("postgres.max_idle_conns: must not be negative")
+	}
+	if c.Postgres.ConnMaxLifetime < 0 {
+		return fmt.Errorf("postgres.conn_max_lifetime: must not be negative")
+	}
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return fmt.Errorf("url: %v", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("url: %q must be an absolute http or https url", c.URL)
+		}
+	}
+	if !contains(ArtifactStores, c.ArtifactStore) {
+		return fmt.Errorf("artifact_store: %q is not one of %s", c.ArtifactStore, strings.Join(ArtifactStores, ", "))
+	}
+	if c.ArtifactStore == "local" && c.ArtifactDir == "" {
+		return fmt.Errorf("artifact_dir: must not be empty")
+	}
+	if c.ArtifactStore == "s3" && (c.S3.Endpoint == "" || c.S3.Bucket == "") {
+		return fmt.Errorf("s3: endpoint and bucket must be set for the s3 artifact store")
+	}
+	if c.ArtifactGCInterval < 0 {
+		return fmt.Errorf("artifact_gc_interval: must not be negative")
+	}
+	if c.ArtifactGCGrace < 0 {
+		return fmt.Errorf("artifact_gc_grace: must not be negative")
+	}
+	if c.ArtifactURLTTL < 0 {
+		return fmt.Errorf("artifact_url_ttl: must not be negative")
+	}
+	if c.ArtifactStore == "s3" && c.ArtifactURLTTL > 7*24*time.Hour {
+		return fmt.Errorf("artifact_url_ttl: must not exceed 168h for the s3 artifact store")
+	}
+	if c.ArtifactRetention < 0 {
+		return fmt.Errorf("artifact_retention: must not be negative")
+	}
+	if c.ArtifactKeepVersions < 0 {
+		return fmt.Errorf("artifact_keep_versions: must not be negative")
+	}
+	if c.ArtifactMinFree < 0 {
+		return fmt.Errorf("artifact_min_free: must not be negative")
+	}
+	if c.ArtifactMaxBytes < 0 {
+		return fmt.Errorf("artifact_max_bytes: must not be negative")
+	}
+	for i, t := range c.Tokens {
+		if strings.TrimSpace(t) == "" {
+			return fmt.Errorf("tokens[%d]: must not be empty", i)
+		}
+	}
+	for i, t := range c.AdminTokens {
+		if strings.TrimSpace(t) == "" {
+			return fmt.Errorf("admin_tokens[%d]: must not be empty", i)
+		}
+	}
+	if c.JWT.RolesClaim == "" {
+		return fmt.Errorf("jwt.roles_claim: must not be empty")
+	}
+	for i, t := range c.ReadTokens {
+		if strings.TrimSpace(t) == "" {
+			return fmt.Errorf("read_tokens[%d]: must not be empty", i)
+		}
+	}
+	if c.OIDC.IssuerURL != "" {
+		if u, err := url.Parse(c.OIDC.IssuerURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("oidc.issuer_url: %q is not an http or https url", c.OIDC.IssuerURL)
+		}
+	}
+	if c.OIDC.GroupsClaim == "" {
+		return fmt.Errorf("oidc.groups_claim: must not be empty")
+	}
+	for group, role := range c.OIDC.GroupRoles {
+		if !contains(Roles, role) {
+			return fmt.Errorf("oidc.group_roles[%s]: %q is not one of %s", group, role, strings.Join(Roles, ", "))
+		}
+	}
+	for i, name := range c.PublicRoutes {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("public_routes[%d]: must not be empty", i)
+		}
+	}
+	for i, o := range c.CORSOrigins {
+		if o == "*" {
+			continue
+		}
+		if u, err := url.Parse(o); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("cors_origins[%d]: %q must be * or a scheme://host origin", i, o)
+		}
+	}
+	for i, m := range c.CORSMethods {
+		if strings.TrimSpace(m) == "" {
+			return fmt.Errorf("cors_methods[%d]: must not be empty", i)
+		}
+	}
+	if c.CORSMaxAge < 0 {
+		return fmt.Errorf("cors_max_age: must not be negative")
+	}
+	for name, t := range map[string]time.Duration{
+		"read_timeout":        c.HTTP.ReadTimeout,
+		"read_header_timeout": c.HTTP.ReadHeaderTimeout,
+		"write_timeout":       c.HTTP.WriteTimeout,
+		"idle_timeout":        c.HTTP.IdleTimeout,
+		"shutdown_timeout":    c.HTTP.ShutdownTimeout,
+	} {
+		if t < 0 {
+			return fmt.Errorf("http.%s: must not be negative", name)
+		}
+	}
+	if c.HTTP.MaxHeaderBytes < 1 {
+		return fmt.Errorf("http.max_header_bytes: must be at least 1")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio: %g is out of range 0-1", c.Tracing.SampleRatio)
+	}
+	if c.Build.WorkDir == "" {
+		return fmt.Errorf("build.workdir: must not be empty")
+	}
+	if c.Build.Timeout < 0 {
+		return fmt.Errorf("build.timeout: must not be negative")
+	}
+	if h := c.Build.DockerHost; h != "" && !strings.HasPrefix(h, "unix://") && !strings.HasPrefix(h, "tcp://") {
+		return fmt.Errorf("build.docker_host: %q must be a unix:// or tcp:// address", h)
+	}
+	if c.Build.RetryDelay < 0 {
+		return fmt.Errorf("build.retry_delay: must not be negative")
+	}
+	if c.Build.AgentTimeout < 0 {
+		return fmt.Errorf("build.agent_timeout: must not be negative")
+	}
+	if c.Build.NamespaceLimit < 0 {
+		return fmt.Errorf("build.namespace_limit: must not be negative")
+	}
+	if c.Build.PriorityAging < 0 {
+		return fmt.Errorf("build.priority_aging: must not be negative")
+	}
+	if c.Build.Workers < 1 {
+		return fmt.Errorf("build.workers: must be at least 1")
+	}
+	if c.Build.QueueSize < 1 {
+		return fmt.Errorf("build.queue_size: must be at least 1")
+	}
+	if c.Build.Retention < 0 {
+		return fmt.Errorf("build.retention: must not be negative")
+	}
+	if c.Request.MaxBytes < 1 {
+		return fmt.Errorf("request.max_bytes: must be at least 1")
+	}
+	if c.Request.MaxDepth < 1 {
+		return fmt.Errorf("request.max_depth: must be at least 1")
+	}
+	if c.RateLimit.Rate < 0 {
+		return fmt.Errorf("rate_limit.rate: must not be negative")
+	}
+	if c.RateLimit.Rate > 0 && c.RateLimit.Burst < 1 {
+		return fmt.Errorf("rate_limit.burst: must be at least 1")
+	}
+	if c.Webhooks.Timeout <= 0 {
+		return fmt.Errorf("webhooks.timeout: must be positive")
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		return fmt.Errorf("webhooks.max_attempts: must be at least 1")
+	}
+	if c.Webhooks.RetryDelay < 0 {
+		return fmt.Errorf("webhooks.retry_delay: must not be negative")
+	}
+	for i, rule := range c.GitHooks.Rules {
+		if rule.Repository == "" {
+			return fmt.Errorf("git_hooks.rules[%d].repository: must not be empty", i)
+		}
+		if _, err := path.Match(rule.Ref, ""); err != nil {
+			return fmt.Errorf("git_hooks.rules[%d].ref: %q is not a valid pattern", i, rule.Ref)
+		}
+		if (rule.AntarianId == "") == (rule.Name == "") {
+			return fmt.Errorf("git_hooks.rules[%d]: exactly one of antarian_id and name must be set", i)
+		}
+		if rule.Priority < lib.MinBuildPriority || rule.Priority > lib.MaxBuildPriority {
+			return fmt.Errorf("git_hooks.rules[%d].priority: %d is out of range %d-%d", i, rule.Priority, lib.MinBuildPriority, lib.MaxBuildPriority)
+		}
+	}
+	if err := (lib.ReleaseOptions{Scheme: lib.ReleaseScheme(c.Release.Scheme), Layout: c.Release.Layout}).Validate(); err != nil {
+		return fmt.Errorf("release.%v", err)
+	}
+	if c.Signing.Key != "" {
+		if _, err := lib.LoadSigningKey(c.Signing.Key); err != nil {
+			return fmt.Errorf("signing.key: %v", err)
+		}
+	}
+	for i, path := range c.Signing.PublicKeys {
+		if _, err := lib.LoadPublicKey(path); err != nil {
+			return fmt.Errorf("signing.public_keys[%d]: %v", i, err)
+		}
+	}
+	if c.NATS.URL != "" {
+		if c.NATS.SubjectPrefix == "" && len(c.NATS.Subjects) == 0 {
+			return fmt.Errorf("nats.subject_prefix: must be set")
+		}
+		for typ, subject := range c.NATS.Subjects {
+			if subject == "" || strings.ContainsAny(subject, " \t*>") {
+				return fmt.Errorf("nats.subjects: %q is not a valid subject for %s", subject, typ)
+			}
+		}
+	}
+	if len(c.Kafka.Brokers) > 0 {
+		if c.Kafka.Topic == "" && len(c.Kafka.Topics) == 0 {
+			return fmt.Errorf("kafka.topic: must be set")
+		}
+		if !contains(KafkaFormats, c.Kafka.Format) {
+			return fmt.Errorf("kafka.format: %q is not one of %s", c.Kafka.Format, strings.Join(KafkaFormats, ", "))
+		}
+	}
+	if !contains(LogFormats, c.LogFormat) {
+		return fmt.Errorf("log_format: %q is not one of %s", c.LogFormat, strings.Join(LogFormats, ", "))
+	}
+	if !contains(LogLevels, c.LogLevel) {
+		return fmt.Errorf("log_level: %q is not one of %s", c.LogLevel, strings.Join(LogLevels, ", "))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls: cert_file and key_file must be set together")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		return fmt.Errorf("tls.client_ca_file: requires cert_file and key_file")
+	}
+	if c.TLS.RedirectAddr != "" {
+		if c.TLS.CertFile == "" {
+			return fmt.Errorf("tls.redirect_addr: requires cert_file and key_file")
+		}
+		if !strings.HasPrefix(c.BaseURL(), "https://") {
+			return fmt.Errorf("tls.redirect_addr: url must be an https url")
+		}
+	}
+	return nil
+}
+
+// ListenAddr is the address the server binds to.
+func (c *Config) ListenAddr() string {
+	if c.Addr != "" {
+		return c.Addr
+	}
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// SocketFileMode is SocketMode as a file mode.
+func (c *Config) SocketFileMode() os.FileMode {
+	mode, _ := strconv.ParseUint(c.SocketMode, 8, 32)
+	return os.FileMode(mode)
+}
+
+// IsUnixAddr reports whether addr names a unix socket, as
+// "unix:///path/to/antares.sock".
+func IsUnixAddr(addr string) bool {
+	return strings.HasPrefix(addr, "unix://")
+}
+
+// BaseURL is the external url of the server without a trailing slash. With
+// no URL set it is derived from the listen address: its port, and its host
+// unless that is empty or a wildcard, in which case Server names the host.
+func (c *Config) BaseURL() string {
+	if c.URL != "" {
+		return strings.TrimRight(c.URL, "/")
+	}
+	scheme := "http"
+	if c.TLS.CertFile != "" {
+		scheme = "https"
+	}
+	host, port := c.Server, strconv.Itoa(c.Port)
+	if h, p, err := net.SplitHostPort(c.ListenAddr()); err == nil {
+		port = p
+		if ip := net.ParseIP(h); h != "" && (ip == nil || !ip.IsUnspecified()) {
+			host = h
+		}
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// DefaultURL is the base url of a server run with the default settings and
+// the ANTARES_* environment, e.g. http://myhost:9000 with ANTARES_PORT=9000.
+// Clients given no url of their own use it.
+func DefaultURL() string {
+	cfg := Default()
+	// a malformed variable is the server's to report
+	cfg.applyEnv(os.Environ())
+	return cfg.BaseURL()
+}
+
+// PrintEffective writes the configuration as YAML with secrets redacted.
+func (c *Config) PrintEffective(w io.Writer) error {
+	redacted := *c
+	redact(reflect.ValueOf(&redacted).Elem())
+	out, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// redact blanks every field tagged secret:"true", recursing into structs.
+// Slices are replaced rather than modified so the original is untouched.
+func redact(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if f.Tag.Get("secret") == "true" {
+			switch fv.Kind() {
+			case reflect.String:
+				if fv.Len() > 0 {
+					fv.SetString("REDACTED")
+				}
+			case reflect.Slice:
+				masked := reflect.MakeSlice(fv.Type(), fv.Len(), fv.Len())
+				for j := 0; j < fv.Len(); j++ {
+					masked.Index(j).SetString("REDACTED")
+				}
+				fv.Set(masked)
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Struct {
+			redact(fv)
+		}
+	}
+}
+
+// applyEnv sets fields from ANTARES_* variables in environ.
+func (c *Config) applyEnv(environ []string) error {
+	env := map[string]string{}
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i > 0 && strings.HasPrefix(kv, EnvPrefix) {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	return setEnv(reflect.ValueOf(c).Elem(), EnvPrefix, env)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setEnv(v reflect.Value, prefix string, env map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		key := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(key)
+		if fv.Kind() == reflect.Struct {
+			if err := setEnv(fv, name+"_", env); err != nil {
+				return err
+			}
+			continue
+		}
+		val, ok := env[name]
+		if !ok {
+			continue
+		}
+		if err := setValue(fv, val); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(fv reflect.Value, val string) error {
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(val)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", val)
+		}
+		fv.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", val)
+		}
+		fv.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", val)
+		}
+		fv.SetBool(b)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", fv.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		pairs := map[string]string{}
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("%q is not a key=value pair", item)
+			}
+			pairs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+		fv.Set(reflect.ValueOf(pairs))
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil || h == "" {
+		return "localhost"
+	}
+	return h
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "antares.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+port: 9000
+log_level: debug
+http:
+  read_timeout: 5s
+admin_tokens: [from-file]
+`)
+	t.Setenv("ANTARES_LOG_LEVEL", "warn")
+	t.Setenv("ANTARES_HTTP_IDLE_TIMEOUT", "1m")
+	t.Setenv("ANTARES_ADMIN_TOKENS", "one,two")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		setting   string
+		got, want interface{}
+	}{
+		{"port from the file", cfg.Port, 9000},
+		{"log_level from the environment over the file", cfg.LogLevel, "warn"},
+		{"http.read_timeout from the file", cfg.HTTP.ReadTimeout, 5 * time.Second},
+		{"http.idle_timeout from the environment", cfg.HTTP.IdleTimeout, time.Minute},
+		{"http.max_header_bytes by default", cfg.HTTP.MaxHeaderBytes, 1 << 20},
+		{"admin_tokens from the environment", strings.Join(cfg.AdminTokens, ","), "one,two"},
+		{"backend by default", cfg.Backend, "stateless"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.setting, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	t.Setenv("ANTARES_PORT", "9100")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 9100 || cfg.ArtifactDir != "artifacts" {
+		t.Errorf("Load(\"\") = port %d, artifact_dir %q", cfg.Port, cfg.ArtifactDir)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     [2]string
+		want    string
+	}{
+		{"unknown key", "prot: 9000\n", [2]string{}, "prot"},
+		{"wrong type", "port: eighty\n", [2]string{}, "line 1"},
+		{"unknown nested key", "http:\n  timeout: 5s\n", [2]string{}, "timeout"},
+		{"bad environment value", "", [2]string{"ANTARES_PORT", "eighty"}, "ANTARES_PORT"},
+		{"bad environment duration", "", [2]string{"ANTARES_HTTP_READ_TIMEOUT", "soon"}, "ANTARES_HTTP_READ_TIMEOUT"},
+		{"invalid value", "port: 70000\n", [2]string{}, "port: 70000 is out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env[0] != "" {
+				t.Setenv(tt.env[0], tt.env[1])
+			}
+			_, err := Load(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Error("Load of a missing file succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"port out of range", func(c *Config) { c.Port = 0 }, "port:"},
+		{"empty server", func(c *Config) { c.Server = "" }, "server:"},
+		{"bad socket mode", func(c *Config) { c.SocketMode = "rw" }, "socket_mode:"},
+		{"unix socket without url", func(c *Config) { c.Addr = "unix:///run/antares.sock" }, "url:"},
+		{"unix socket with url", func(c *Config) { c.Addr = "unix:///run/antares.sock"; c.URL = "https://antares.example.com" }, ""},
+		{"unknown backend", func(c *Config) { c.Backend = "mysql" }, "backend:"},
+		{"bolt without a path", func(c *Config) { c.Backend = "bolt"; c.DBPath = "" }, "db_path:"},
+		{"postgres without a dsn", func(c *Config) { c.Backend = "postgres" }, "postgres.dsn:"},
+		{"relative url", func(c *Config) { c.URL = "antares.example.com" }, "url:"},
+		{"ftp url", func(c *Config) { c.URL = "ftp://antares.example.com" }, "url:"},
+		{"unknown artifact store", func(c *Config) { c.ArtifactStore = "tape" }, "artifact_store:"},
+		{"s3 without a bucket", func(c *Config) { c.ArtifactStore = "s3" }, "s3:"},
+		{"negative grace", func(c *Config) { c.ArtifactGCGrace = -time.Second }, "artifact_gc_grace:"},
+		{"blank admin token", func(c *Config) { c.AdminTokens = []string{" "} }, "admin_tokens[0]:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Validate error = %v, want one starting %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"defaults", func(*Config) {}, "http://localhost:8080"},
+		{"port", func(c *Config) { c.Port = 9000 }, "http://localhost:9000"},
+		{"addr port", func(c *Config) { c.Addr = ":9090" }, "http://localhost:9090"},
+		{"addr wins over port", func(c *Config) { c.Port = 9000; c.Addr = ":9090" }, "http://localhost:9090"},
+		{"addr host", func(c *Config) { c.Addr = "10.0.0.5:9090" }, "http://10.0.0.5:9090"},
+		{"addr host name", func(c *Config) { c.Addr = "antares.internal:9090" }, "http://antares.internal:9090"},
+		{"wildcard host", func(c *Config) { c.Addr = "0.0.0.0:9090"; c.Server = "builds" }, "http://builds:9090"},
+		{"ipv6 wildcard", func(c *Config) { c.Addr = "[::]:9090" }, "http://localhost:9090"},
+		{"ipv6 host", func(c *Config) { c.Addr = "[::1]:9090" }, "http://[::1]:9090"},
+		{"tls", func(c *Config) { c.Addr = ":8443"; c.TLS.CertFile = "cert.pem" }, "https://localhost:8443"},
+		{"url wins", func(c *Config) { c.Addr = ":9090"; c.URL = "https://antares.example.com/" }, "https://antares.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Server = "localhost"
+			tt.change(cfg)
+			if got := cfg.BaseURL(); got != tt.want {
+				t.Errorf("BaseURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package lib
+
+import "time"
+
+// AgentState tells whether an Agent is taking builds.
+type AgentState string
+
+const (
+	AgentOnline AgentState = "online"
+	// AgentOffline agents missed their heartbeats; the builds they held
+	// failed, and they must register again.
+	AgentOffline AgentState = "offline"
+)
+
+// Agent is a remote worker that leases queued builds from the server, runs
+// them and reports their output and outcome back.
+type Agent struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hostname   string     `json:"hostname,omitempty"`
+	State      AgentState `json:"state"`
+	Registered time.Time  `json:"registered"`
+	LastSeen   time.Time  `json:"last_seen"`
+	// Builds are the ids of the builds the agent is running.
+	Builds []string `json:"builds,omitempty"`
+}
+
+// AgentLease hands a build, already running, to an agent with the Antarian
+// to build.
+type AgentLease struct {
+	Build    Build    `json:"build"`
+	Antarian Antarian `json:"antarian"`
+}
+
+// AgentHeartbeat answers an agent's heartbeat. Cancel lists the builds
+// held by the agent that were canceled since they were leased; the agent
+// stops them and reports them canceled.
+type AgentHeartbeat struct {
+	Agent  Agent    `json:"agent"`
+	Cancel []string `json:"cancel,omitempty"`
+}
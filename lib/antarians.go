@@ -1,78 +1,184 @@
 package lib
 
 import (
-    "time"
-    "fmt"
-    "bytes"
-    "encoding/json"
+	"fmt"
+	"time"
 )
 
 type Antarian struct {
-	Id          string      `json:"id"`
-	Name        string      `json:"name"`
-	Version     string      `json:"version"`
-	Release     string      `json:"release"`
-	Uri         string      `json:"uri"`
-	Running     bool        `json:"running"`
-	Finished    bool        `json:"finished"`
-	Start       time.Time   `json:"start"`
-    End         time.Time   `json:"end"`
-    BaseUrl     string      `json:"baseurl"`
-    Requires    []string    `json:"requires"`
+	Id        string `json:"id" yaml:"id,omitempty" toml:"id,omitempty"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty" toml:"namespace,omitempty"`
+	Name      string `json:"name" yaml:"name,omitempty" toml:"name,omitempty"`
+	Version   string `json:"version" yaml:"version,omitempty" toml:"version,omitempty"`
+	Release   string `json:"release" yaml:"release,omitempty" toml:"release,omitempty"`
+	// Commit is the git commit the Antarian was created from, when its
+	// creator gave one.
+	Commit string `json:"commit,omitempty" yaml:"commit,omitempty" toml:"commit,omitempty"`
+	// OS and Arch are the platform the Antarian's artifact is built for,
+	// e.g. linux and amd64. Artifacts for others are its Variants.
+	OS   string `json:"os,omitempty" yaml:"os,omitempty" toml:"os,omitempty"`
+	Arch string `json:"arch,omitempty" yaml:"arch,omitempty" toml:"arch,omitempty"`
+	// Format is the archive format of the artifact, DefaultArtifactFormat
+	// when empty.
+	Format ArtifactFormat `json:"format,omitempty" yaml:"format,omitempty" toml:"format,omitempty"`
+	Uri    string         `json:"uri" yaml:"uri,omitempty" toml:"uri,omitempty"`
+	// Running and Finished mirror Status, which sets them, for clients
+	// older than it.
+	Running   bool       `json:"running" yaml:"running,omitempty" toml:"running,omitempty"`
+	Finished  bool       `json:"finished" yaml:"finished,omitempty" toml:"finished,omitempty"`
+	Status    Status     `json:"status" yaml:"status,omitempty" toml:"status,omitempty"`
+	Start     time.Time  `json:"start" yaml:"start,omitempty" toml:"start,omitzero"`
+	End       time.Time  `json:"end" yaml:"end,omitempty" toml:"end,omitzero"`
+	BaseUrl   string     `json:"baseurl" yaml:"baseurl,omitempty" toml:"baseurl,omitempty"`
+	Requires  []string   `json:"requires" yaml:"requires,omitempty" toml:"requires,omitempty"`
+	BuildSpec *BuildSpec `json:"buildspec,omitempty" yaml:"buildspec,omitempty" toml:"buildspec,omitempty"`
+	// Labels are short name=value pairs Antarians are selected by, as in
+	// ?label=team=infra; Annotations hold longer notes about it.
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" toml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty" toml:"annotations,omitempty"`
+	// Artifact names the uploaded artifact file, of Size bytes with the
+	// hex sha256 Checksum. They are set by uploads only.
+	Artifact string `json:"artifact,omitempty" yaml:"artifact,omitempty" toml:"artifact,omitempty"`
+	Size     int64  `json:"size,omitempty" yaml:"size,omitempty" toml:"size,omitempty"`
+	Checksum string `json:"checksum,omitempty" yaml:"checksum,omitempty" toml:"checksum,omitempty"`
+	// Variants are the artifacts uploaded for other platforms.
+	Variants []Variant `json:"variants,omitempty" yaml:"variants,omitempty" toml:"variants,omitempty"`
 }
 
 type Antarians []Antarian
 
-func (a *Antarian) Filename() string {
-    return fmt.Sprintf("%s-%s-%s.tgz", a.Name, a.Version, a.Release)
-}
-
-func (a *Antarian) UnmarshalJSON(raw []byte) error {
+// DefaultNamespace holds the Antarians created without a namespace,
+// including those stored before namespaces existed.
+const DefaultNamespace = "default"
 
-    var data struct {
-        Name string
-        Version string
-        BaseUrl string
-        Requires []string
-    }
+// NamespaceOrDefault returns the namespace of a, DefaultNamespace when it
+// has none.
+func (a *Antarian) NamespaceOrDefault() string {
+	if a.Namespace == "" {
+		return DefaultNamespace
+	}
+	return a.Namespace
+}
 
-    r := bytes.NewReader(raw)
-    if err := json.NewDecoder(r).Decode(&data); err != nil {
-                    return fmt.Errorf("decode Data: %v", err)
-                    }
+// Filename is the name of the artifact of a, which includes its platform
+// when it has one and ends in the extension of its ArtifactFormat.
+func (a *Antarian) Filename() string {
+	return a.FilenameFor(a.OS, a.Arch)
+}
 
-    if a.Id == "" {
-	    uuid, err := NewUUID()
-	    if err != nil {
-		    fmt.Printf("error: %v\n", err)
-	    } else {
-	    a.Id = uuid
-        }
-    }
+// CreateRequest holds the fields of an Antarian that its creator chooses.
+// The rest are set by NewAntarianFromRequest.
+type CreateRequest struct {
+	Name        string            `json:"name" yaml:"name,omitempty" toml:"name,omitempty"`
+	Version     string            `json:"version" yaml:"version,omitempty" toml:"version,omitempty"`
+	BaseUrl     string            `json:"baseurl" yaml:"baseurl,omitempty" toml:"baseurl,omitempty"`
+	Requires    []string          `json:"requires" yaml:"requires,omitempty" toml:"requires,omitempty"`
+	BuildSpec   *BuildSpec        `json:"buildspec,omitempty" yaml:"buildspec,omitempty" toml:"buildspec,omitempty"`
+	Commit      string            `json:"commit,omitempty" yaml:"commit,omitempty" toml:"commit,omitempty"`
+	OS          string            `json:"os,omitempty" yaml:"os,omitempty" toml:"os,omitempty"`
+	Arch        string            `json:"arch,omitempty" yaml:"arch,omitempty" toml:"arch,omitempty"`
+	Format      ArtifactFormat    `json:"format,omitempty" yaml:"format,omitempty" toml:"format,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" toml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty" toml:"annotations,omitempty"`
+}
 
-    if a.Uri == "" {
-        uri := GetUrl()
-        a.Uri = uri
-    }
+// CreateRequest returns the fields of a that a CreateRequest holds, for
+// creating a copy of it.
+func (a *Antarian) CreateRequest() CreateRequest {
+	return CreateRequest{
+		Name:        a.Name,
+		Version:     a.Version,
+		BaseUrl:     a.BaseUrl,
+		Requires:    a.Requires,
+		BuildSpec:   a.BuildSpec,
+		Commit:      a.Commit,
+		OS:          a.OS,
+		Arch:        a.Arch,
+		Format:      a.Format,
+		Labels:      a.Labels,
+		Annotations: a.Annotations,
+	}
+}
 
-    t := time.Now()
-    a.Name = data.Name
-    a.Version = data.Version
-    a.Release = t.Format("20160101")
-    a.BaseUrl = data.BaseUrl
-    a.Requires = data.Requires
-	a.Running = true
-	a.Start = time.Now()
-    return nil
+// NewAntarianFromRequest returns the Antarian req creates, with a new Id,
+// a Release made as release says and a pending Status. Its Uri is uri, or
+// GetUrl when uri is empty.
+func NewAntarianFromRequest(req CreateRequest, uri string, release ReleaseOptions) (Antarian, error) {
+	now := time.Now()
+	rel, err := release.Release(now, req.Commit)
+	if err != nil {
+		return Antarian{}, err
+	}
+	id, err := NewUUID()
+	if err != nil {
+		return Antarian{}, err
+	}
+	if uri == "" {
+		uri = GetUrl()
+	}
+	return Antarian{
+		Id:          id,
+		Name:        req.Name,
+		Version:     req.Version,
+		Release:     rel,
+		Commit:      req.Commit,
+		OS:          req.OS,
+		Arch:        req.Arch,
+		Format:      req.Format,
+		Uri:         uri,
+		Status:      StatusPending,
+		Start:       now,
+		BaseUrl:     req.BaseUrl,
+		Requires:    req.Requires,
+		BuildSpec:   req.BuildSpec,
+		Labels:      req.Labels,
+		Annotations: req.Annotations,
+	}, nil
 }
 
 func NewAntarian() (*Antarian, error) {
-    uuid, err := NewUUID()
+	uuid, err := NewUUID()
 	if err != nil {
 		fmt.Printf("error: %v\n", err)
-        return &Antarian{}, err
+		return &Antarian{}, err
 	}
-    return &Antarian{Id: uuid}, nil
+	return &Antarian{Id: uuid}, nil
 }
 
+type Download struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Platform is that of the artifact, when the Antarian has one.
+	Platform string `json:"platform,omitempty"`
+	Url      string `json:"url"`
+	// Expires is when Url stops working, for signed links.
+	Expires *time.Time `json:"expires,omitempty"`
+	// Size and Checksum, the hex sha256, describe an uploaded artifact.
+	Size     int64  `json:"size,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+type Artifact struct {
+	Id       string `json:"id"`
+	Filename string `json:"filename"`
+	Platform string `json:"platform,omitempty"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
 
+// ArtifactCheck compares a stored artifact with the Size and Checksum
+// recorded when it was uploaded.
+type ArtifactCheck struct {
+	Id             string `json:"id"`
+	Filename       string `json:"filename"`
+	Platform       string `json:"platform,omitempty"`
+	Size           int64  `json:"size"`
+	Checksum       string `json:"checksum"`
+	ActualSize     int64  `json:"actual_size"`
+	ActualChecksum string `json:"actual_checksum,omitempty"`
+	// Valid is true when the file is present and matches.
+	Valid bool `json:"valid"`
+	// Error says why the file could not be read, e.g. it is missing.
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var start = time.Date(2024, 3, 1, 12, 30, 15, 123456789, time.UTC)
+
+// complete has every field of an Antarian set.
+func complete() Antarian {
+	return Antarian{
+		Id: "a1", Namespace: "team", Name: "libfoo", Version: "1.2.3", Release: "20240301.1", Commit: "0a1b2c3",
+		OS: "linux", Arch: "amd64", Format: "tgz", Uri: "https://antares.example.com/v1/antarians/a1",
+		Running: false, Finished: true, Status: StatusSucceeded, Start: start, End: start.Add(90 * time.Second),
+		BaseUrl: "https://antares.example.com", Requires: []string{"libbar", "libbaz"},
+		BuildSpec: &BuildSpec{Command: "make install", Steps: []string{"make"}, Env: map[string]string{"CC": "gcc"}},
+		Labels:    map[string]string{"team": "infra"}, Annotations: map[string]string{"owner": "build team"},
+		Artifact: "libfoo-1.2.3-20240301.1-linux-amd64.tgz", Size: 1024, Checksum: strings.Repeat("ab", 32),
+		Variants: []Variant{{OS: "linux", Arch: "arm64", Artifact: "libfoo-1.2.3-20240301.1-linux-arm64.tgz", Size: 998, Checksum: strings.Repeat("cd", 32)}},
+	}
+}
+
+func TestAntarianJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		a    Antarian
+	}{
+		{"complete", complete()},
+		{"running", Antarian{Id: "a2", Name: "libfoo", Version: "1.0.0", Release: "1", Uri: "http://localhost:8080", Running: true, Status: StatusBuilding, Start: start, Requires: []string{}}},
+		{"zero", Antarian{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Antarian
+			if err := json.Unmarshal(raw, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.a) {
+				t.Errorf("round trip = %+v\nwant %+v", got, tt.a)
+			}
+		})
+	}
+}
+
+// TestAntarianDecodeResponse decodes a body as the server sends it, and
+// checks that none of the fields the server sets is dropped or defaulted.
+func TestAntarianDecodeResponse(t *testing.T) {
+	body := `{"id":"a1","name":"libfoo","version":"1.2.3","release":"7","uri":"https://antares.example.com",
+		"running":true,"finished":false,"status":"building","start":"2024-03-01T12:30:15.123456789Z",
+		"end":"0001-01-01T00:00:00Z","baseurl":"","requires":null}`
+	var got Antarian
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := Antarian{Id: "a1", Name: "libfoo", Version: "1.2.3", Release: "7", Uri: "https://antares.example.com",
+		Running: true, Status: StatusBuilding, Start: start}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %+v\nwant %+v", got, want)
+	}
+
+	// and nothing is made up for a body without them
+	var bare Antarian
+	if err := json.Unmarshal([]byte(`{"name":"libfoo"}`), &bare); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bare, Antarian{Name: "libfoo"}) {
+		t.Errorf("decoded %+v, want only the name", bare)
+	}
+}
+
+func TestAntarianYAMLRoundTrip(t *testing.T) {
+	a := complete()
+	raw, err := yaml.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Antarian
+	if err := yaml.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, a) {
+		t.Errorf("round trip = %+v\nwant %+v", got, a)
+	}
+
+	if err := yaml.Unmarshal([]byte("name: libfoo\nverion: 1.0.0\n"), &got); err == nil || !strings.Contains(err.Error(), "verion") {
+		t.Errorf("unknown key error = %v", err)
+	}
+}
+
+func TestNewAntarianFromRequest(t *testing.T) {
+	a := complete()
+	req := a.CreateRequest()
+	before := time.Now()
+	got, err := NewAntarianFromRequest(req, "https://antares.example.com", ReleaseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Id == "" || got.Id == a.Id || got.Release == "" || got.Status != StatusPending || got.Start.Before(before) {
+		t.Errorf("server fields = id %q release %q status %q start %v", got.Id, got.Release, got.Status, got.Start)
+	}
+	if got.Uri != "https://antares.example.com" {
+		t.Errorf("uri = %q", got.Uri)
+	}
+	// the creator's fields carry over and nothing else does
+	if !reflect.DeepEqual(got.CreateRequest(), req) {
+		t.Errorf("request fields = %+v\nwant %+v", got.CreateRequest(), req)
+	}
+	if got.Running || got.Finished || !got.End.IsZero() || got.Artifact != "" || got.Variants != nil || got.Namespace != "" {
+		t.Errorf("NewAntarianFromRequest copied server fields: %+v", got)
+	}
+
+	if got, _ := NewAntarianFromRequest(CreateRequest{Name: "libfoo"}, "", ReleaseOptions{}); got.Uri != GetUrl() {
+		t.Errorf("default uri = %q, want %q", got.Uri, GetUrl())
+	}
+}
@@ -0,0 +1,40 @@
+package lib
+
+import "time"
+
+// Audit actions, one per kind of mutating operation, plus downloads.
+const (
+	AuditAntarianCreate   = "antarian.create"
+	AuditAntarianUpdate   = "antarian.update"
+	AuditAntarianDelete   = "antarian.delete"
+	AuditAntarianDownload = "antarian.download"
+	AuditBuildTrigger     = "build.trigger"
+	AuditBuildCancel      = "build.cancel"
+	AuditStorePurge       = "store.purge"
+	AuditArtifactGC       = "artifact.gc"
+	AuditArtifactUpload   = "artifact.upload"
+	AuditWebhookCreate    = "webhook.create"
+	AuditWebhookDelete    = "webhook.delete"
+	AuditAgentRegister    = "agent.register"
+	AuditScheduleCreate   = "schedule.create"
+	AuditScheduleUpdate   = "schedule.update"
+	AuditScheduleDelete   = "schedule.delete"
+)
+
+// AuditEntry records who changed what and when. Before and After are short
+// summaries of the Antarian around an update, and Changes names the fields
+// it changed.
+type AuditEntry struct {
+	Id         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	Namespace  string    `json:"namespace,omitempty"`
+	AntarianId string    `json:"antarian_id,omitempty"`
+	BuildId    string    `json:"build_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	RequestId  string    `json:"request_id,omitempty"`
+	Before     string    `json:"before,omitempty"`
+	After      string    `json:"after,omitempty"`
+	Changes    []string  `json:"changes,omitempty"`
+}
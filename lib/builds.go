@@ -0,0 +1,230 @@
+package lib
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// BuildState is the lifecycle position of a Build.
+type BuildState string
+
+const (
+	BuildQueued    BuildState = "queued"
+	BuildRunning   BuildState = "running"
+	BuildSucceeded BuildState = "succeeded"
+	BuildFailed    BuildState = "failed"
+	BuildCanceled  BuildState = "canceled"
+)
+
+// Done reports whether the state is final.
+func (s BuildState) Done() bool {
+	return s == BuildSucceeded || s == BuildFailed || s == BuildCanceled
+}
+
+// BuildSpec describes how an Antarian is built. Command, or each of Steps
+// in order, is run by the shell with the Antarian's fields and Env in the
+// environment; the build fails at the first step that does.
+type BuildSpec struct {
+	Command string   `json:"command" yaml:"command,omitempty" toml:"command,omitempty"`
+	Steps   []string `json:"steps,omitempty" yaml:"steps,omitempty" toml:"steps,omitempty"`
+	// Image runs the build in a container of this image, with the build's
+	// working directory mounted at /workspace.
+	Image string            `json:"image,omitempty" yaml:"image,omitempty" toml:"image,omitempty"`
+	Env   map[string]string `json:"env,omitempty" yaml:"env,omitempty" toml:"env,omitempty"`
+	// WorkDir is where the commands run, relative to the build's working
+	// directory.
+	WorkDir string `json:"workdir,omitempty" yaml:"workdir,omitempty" toml:"workdir,omitempty"`
+	// Artifacts are glob patterns, relative to WorkDir, of the files a
+	// successful build stores. Each must match at least one file. Without
+	// any the build stores the file named by the Antarian's Filename, if
+	// it made one.
+	Artifacts []string `json:"artifacts,omitempty" yaml:"artifacts,omitempty" toml:"artifacts,omitempty"`
+	// Package are glob patterns, relative to WorkDir, of the files and
+	// directories a successful build packs into the Antarian's Filename,
+	// in its ArtifactFormat, before its artifacts are stored. Each must
+	// match at least one file.
+	Package []string `json:"package,omitempty" yaml:"package,omitempty" toml:"package,omitempty"`
+	// Timeout bounds each attempt of the build, as a Go duration such as
+	// "10m", in place of the server's build timeout.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+	// Retries is how many times a build that failed for a reason that may
+	// pass, a non-zero exit or a timeout, is run again, up to
+	// MaxBuildRetries.
+	Retries int `json:"retries,omitempty" yaml:"retries,omitempty" toml:"retries,omitempty"`
+}
+
+// MaxBuildRetries bounds BuildSpec.Retries.
+const MaxBuildRetries = 10
+
+// MinBuildPriority and MaxBuildPriority bound Build.Priority.
+const (
+	MinBuildPriority = -100
+	MaxBuildPriority = 100
+)
+
+// ValidatePriority rejects a build priority out of range.
+func ValidatePriority(p int) error {
+	if p < MinBuildPriority || p > MaxBuildPriority {
+		return &ValidationError{Field: "priority", Message: fmt.Sprintf("must be between %d and %d", MinBuildPriority, MaxBuildPriority)}
+	}
+	return nil
+}
+
+// ValidationError rejects one field of a submitted record.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate reports the first field of s that cannot be built, as a
+// *ValidationError with the field's path under "buildspec".
+func (s *BuildSpec) Validate() error {
+	invalid := func(field, format string, args ...interface{}) error {
+		return &ValidationError{Field: "buildspec." + field, Message: fmt.Sprintf(format, args...)}
+	}
+	if s.Command != "" && len(s.Steps) > 0 {
+		return invalid("steps", "must not be set together with command")
+	}
+	for i, step := range s.Steps {
+		if strings.TrimSpace(step) == "" {
+			return invalid(fmt.Sprintf("steps[%d]", i), "must not be empty")
+		}
+	}
+	if strings.ContainsAny(s.Image, " \t\n") {
+		return invalid("image", "%q is not an image reference", s.Image)
+	}
+	for name := range s.Env {
+		if !envName.MatchString(name) {
+			return invalid("env", "%q is not a variable name", name)
+		}
+		if strings.HasPrefix(name, "ANTARES_") {
+			return invalid("env", "%s: ANTARES_ variables are set by the build", name)
+		}
+	}
+	if !localPath(s.WorkDir) {
+		return invalid("workdir", "%q must be a relative path inside the build directory", s.WorkDir)
+	}
+	for _, list := range []struct {
+		field    string
+		patterns []string
+	}{{"artifacts", s.Artifacts}, {"package", s.Package}} {
+		for i, pattern := range list.patterns {
+			field := fmt.Sprintf("%s[%d]", list.field, i)
+			if pattern == "" || !localPath(pattern) {
+				return invalid(field, "%q must be a relative path inside the build directory", pattern)
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return invalid(field, "%q: %v", pattern, err)
+			}
+		}
+	}
+	if s.Timeout != "" {
+		if d, err := time.ParseDuration(s.Timeout); err != nil || d <= 0 {
+			return invalid("timeout", "%q is not a positive duration", s.Timeout)
+		}
+	}
+	if s.Retries < 0 || s.Retries > MaxBuildRetries {
+		return invalid("retries", "must be between 0 and %d", MaxBuildRetries)
+	}
+	return nil
+}
+
+// TimeoutDuration returns s.Timeout, or zero when it is unset or invalid.
+func (s *BuildSpec) TimeoutDuration() time.Duration {
+	d, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// localPath reports whether p is empty or a relative slash-separated path
+// that stays below the directory it is taken from.
+func localPath(p string) bool {
+	return p == "" || !path.IsAbs(p) && path.Clean(p) != ".." && !strings.HasPrefix(path.Clean(p), "../")
+}
+
+type Build struct {
+	Id         string     `json:"id"`
+	AntarianId string     `json:"antarian_id"`
+	Name       string     `json:"name"`
+	Version    string     `json:"version"`
+	State      BuildState `json:"state"`
+	Start      time.Time  `json:"start"`
+	End        time.Time  `json:"end"`
+	Running    bool       `json:"running"`
+	ExitCode   int        `json:"exit_code"`
+	Error      string     `json:"error,omitempty"`
+	// Priority orders the queue: higher runs first, then older.
+	Priority int `json:"priority,omitempty"`
+	// DependsOn lists the builds, of the Antarians this one requires, that
+	// must succeed before it starts. It is canceled when one does not.
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Worker names the engine worker that ran the build, as host/number.
+	Worker string `json:"worker,omitempty"`
+	// Log holds the tail of the build output; LogFile the full output.
+	Log     string `json:"log,omitempty"`
+	LogFile string `json:"log_file,omitempty"`
+	// LogLines is the file of the output as JSON lines, one LogLine each.
+	LogLines string `json:"log_lines,omitempty"`
+	// Artifacts names every file a successful build stored; Artifact the
+	// one recorded as the Antarian's, of Size bytes with the hex sha256
+	// Checksum.
+	Artifacts []string `json:"artifacts,omitempty"`
+	Artifact  string   `json:"artifact,omitempty"`
+	Size      int64    `json:"size,omitempty"`
+	Checksum  string   `json:"checksum,omitempty"`
+	// Attempt numbers the runs of a build whose buildspec allows retries,
+	// from 1; Attempts records each that has finished.
+	Attempt  int            `json:"attempt,omitempty"`
+	Attempts []BuildAttempt `json:"attempts,omitempty"`
+}
+
+// BuildAttempt is one run of a build that may be retried.
+type BuildAttempt struct {
+	Attempt  int        `json:"attempt"`
+	State    BuildState `json:"state"`
+	Start    time.Time  `json:"start"`
+	End      time.Time  `json:"end"`
+	ExitCode int        `json:"exit_code"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// LogLine is a line of build output. Lines longer than the build package's
+// MaxLineSize are split into several.
+type LogLine struct {
+	// Seq numbers the lines of a build from 1, across both streams.
+	Seq  int       `json:"seq"`
+	Time time.Time `json:"time"`
+	// Stream is "stdout" or "stderr".
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
+	// Attempt is the run of the build the line came from, when it may be
+	// retried.
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// NewBuild returns a queued Build of a with a fresh id.
+func NewBuild(a Antarian) (*Build, error) {
+	uuid, err := NewUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &Build{
+		Id:         uuid,
+		AntarianId: a.Id,
+		Name:       a.Name,
+		Version:    a.Version,
+		State:      BuildQueued,
+		ExitCode:   -1,
+	}, nil
+}
@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"sort"
+	"strings"
+)
+
+// Filter returns the Antarians of list for which keep is true, in order,
+// in a new slice that is empty rather than nil when none are.
+func (list Antarians) Filter(keep func(Antarian) bool) Antarians {
+	out := Antarians{}
+	for _, a := range list {
+		if keep(a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// SortBy sorts list in place by cmps, each consulted when those before it
+// tie. The sort is stable, so Antarians equal by all of them keep their
+// order.
+func (list Antarians) SortBy(cmps ...func(a, b Antarian) int) {
+	sort.SliceStable(list, func(i, j int) bool {
+		for _, cmp := range cmps {
+			if c := cmp(list[i], list[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// ByName orders Antarians by name.
+func ByName(a, b Antarian) int {
+	return strings.Compare(a.Name, b.Name)
+}
+
+// ByVersion orders Antarians by semantic version, with versions that do
+// not parse below those that do and compared as strings among themselves.
+func ByVersion(a, b Antarian) int {
+	av, aerr := ParseVersion(a.Version)
+	bv, berr := ParseVersion(b.Version)
+	switch {
+	case aerr == nil && berr == nil:
+		return av.Compare(bv)
+	case aerr == nil:
+		return 1
+	case berr == nil:
+		return -1
+	}
+	return strings.Compare(a.Version, b.Version)
+}
+
+// ByStart orders Antarians by the time they were created.
+func ByStart(a, b Antarian) int {
+	return a.Start.Compare(b.Start)
+}
+
+// Descending reverses the order of cmp.
+func Descending(cmp func(a, b Antarian) int) func(a, b Antarian) int {
+	return func(a, b Antarian) int { return cmp(b, a) }
+}
+
+// Newer reports whether a is a newer version than b. Semantic versions
+// order above versions that do not parse, and the later Start breaks ties.
+func Newer(a, b Antarian) bool {
+	av, aerr := ParseVersion(a.Version)
+	bv, berr := ParseVersion(b.Version)
+	if (aerr == nil) != (berr == nil) {
+		return aerr == nil
+	}
+	if aerr == nil {
+		if c := av.Compare(bv); c != 0 {
+			return c > 0
+		}
+	}
+	return a.Start.After(b.Start)
+}
+
+// GroupByName returns the Antarians of list by name, each group in the
+// order of list.
+func (list Antarians) GroupByName() map[string]Antarians {
+	groups := map[string]Antarians{}
+	for _, a := range list {
+		groups[a.Name] = append(groups[a.Name], a)
+	}
+	return groups
+}
+
+// Latest returns the latest version of each name in list, ordered by
+// name: the newest release, or the newest prerelease of a name with no
+// release, as a bare requirement on the name resolves.
+func (list Antarians) Latest() Antarians {
+	var out Antarians
+	for _, group := range list.GroupByName() {
+		best := group[0]
+		for _, a := range group[1:] {
+			if betterMatch(a, best) {
+				best = a
+			}
+		}
+		out = append(out, best)
+	}
+	out.SortBy(ByName)
+	return out
+}
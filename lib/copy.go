@@ -0,0 +1,103 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DeepCopy returns a copy of a sharing no slices, maps or pointers with
+// it, so changing one leaves the other as it was.
+func (a *Antarian) DeepCopy() Antarian {
+	c := *a
+	c.Requires = copyList(a.Requires)
+	c.BuildSpec = a.BuildSpec.DeepCopy()
+	c.Labels = copyMap(a.Labels)
+	c.Annotations = copyMap(a.Annotations)
+	if a.Variants != nil {
+		c.Variants = append(make([]Variant, 0, len(a.Variants)), a.Variants...)
+	}
+	return c
+}
+
+// DeepCopy returns a copy of s like Antarian.DeepCopy, nil when s is.
+func (s *BuildSpec) DeepCopy() *BuildSpec {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Steps = copyList(s.Steps)
+	c.Env = copyMap(s.Env)
+	c.Artifacts = copyList(s.Artifacts)
+	c.Package = copyList(s.Package)
+	return &c
+}
+
+// DeepCopy returns a copy of list and of each of its Antarians.
+func (list Antarians) DeepCopy() Antarians {
+	if list == nil {
+		return nil
+	}
+	c := make(Antarians, len(list))
+	for i := range list {
+		c[i] = list[i].DeepCopy()
+	}
+	return c
+}
+
+// copyList returns a copy of s that is nil only when s is, as nil and
+// empty lists encode differently.
+func copyList(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(s)), s...)
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// Diff returns the JSON names of the fields that differ between a and b,
+// in the order Antarian declares them. Empty and nil slices and maps are
+// the same, and times are the same when they are the same instant.
+func Diff(a, b Antarian) []string {
+	var changed []string
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := av.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if !sameValue(av.Field(i), bv.Field(i)) {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func sameValue(a, b reflect.Value) bool {
+	switch {
+	case a.Type() == timeType:
+		return a.Interface().(time.Time).Equal(b.Interface().(time.Time))
+	case a.Kind() == reflect.Slice || a.Kind() == reflect.Map:
+		if a.Len() == 0 && b.Len() == 0 {
+			return true
+		}
+	case a.Kind() == reflect.Pointer && !a.IsNil() && !b.IsNil() && a.Elem().Kind() == reflect.Struct:
+		for i := 0; i < a.Elem().NumField(); i++ {
+			if !sameValue(a.Elem().Field(i), b.Elem().Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
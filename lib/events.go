@@ -0,0 +1,31 @@
+package lib
+
+import "time"
+
+// Event types published on the server's event stream.
+const (
+	EventAntarianCreated = "antarian.created"
+	EventAntarianUpdated = "antarian.updated"
+	EventAntarianDeleted = "antarian.deleted"
+	EventBuildStarted    = "build.started"
+	EventBuildFinished   = "build.finished"
+)
+
+// EventTypes lists every event type.
+var EventTypes = []string{
+	EventAntarianCreated,
+	EventAntarianUpdated,
+	EventAntarianDeleted,
+	EventBuildStarted,
+	EventBuildFinished,
+}
+
+// Event is the wire form of a lifecycle notification. Antarian or Build is
+// set depending on Type.
+type Event struct {
+	Id       string    `json:"id"`
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Antarian *Antarian `json:"antarian,omitempty"`
+	Build    *Build    `json:"build,omitempty"`
+}
@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ArtifactFormat is the archive format of an Antarian's artifact, which
+// names the extension of its Filename.
+type ArtifactFormat string
+
+const (
+	FormatTgz    ArtifactFormat = "tgz"
+	FormatZip    ArtifactFormat = "zip"
+	FormatTarZst ArtifactFormat = "tar.zst"
+	FormatTarXz  ArtifactFormat = "tar.xz"
+)
+
+// ArtifactFormats lists every ArtifactFormat.
+var ArtifactFormats = []ArtifactFormat{FormatTgz, FormatZip, FormatTarZst, FormatTarXz}
+
+// DefaultArtifactFormat is the format of Antarians that do not name one.
+const DefaultArtifactFormat = FormatTgz
+
+// formatTypes are the content types of each ArtifactFormat.
+var formatTypes = map[ArtifactFormat]string{
+	FormatTgz:    "application/gzip",
+	FormatZip:    "application/zip",
+	FormatTarZst: "application/zstd",
+	FormatTarXz:  "application/x-xz",
+}
+
+// Valid reports whether f is one of ArtifactFormats.
+func (f ArtifactFormat) Valid() bool {
+	_, ok := formatTypes[f]
+	return ok
+}
+
+// Ext returns the file extension of f, e.g. ".tar.zst".
+func (f ArtifactFormat) Ext() string {
+	return "." + string(f)
+}
+
+// ContentType returns the media type of archives in format f.
+func (f ArtifactFormat) ContentType() string {
+	return formatTypes[f]
+}
+
+// FormatOf returns the ArtifactFormat of filename by its extension.
+func FormatOf(filename string) (ArtifactFormat, bool) {
+	for _, f := range ArtifactFormats {
+		if strings.HasSuffix(filename, f.Ext()) {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// ArtifactFormat returns the format of a's artifact, DefaultArtifactFormat
+// when it names none.
+func (a *Antarian) ArtifactFormat() ArtifactFormat {
+	if a.Format == "" {
+		return DefaultArtifactFormat
+	}
+	return a.Format
+}
+
+// validateFormat reports a Format that is not one of ArtifactFormats,
+// adding to errs.
+func (a *Antarian) validateFormat(errs ValidationErrors) ValidationErrors {
+	if a.Format != "" && !a.Format.Valid() {
+		errs = append(errs, &ValidationError{Field: "format", Message: fmt.Sprintf("%q is not one of %v", a.Format, ArtifactFormats)})
+	}
+	return errs
+}
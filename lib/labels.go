@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Limits of labels and annotations.
+const (
+	MaxLabelValueLength  = 63
+	MaxAnnotationsLength = 64 << 10
+)
+
+// labelName is what the keys of labels and annotations must look like: a
+// name of letters, digits, '-', '_' and '.' starting and ending with a
+// letter or digit, optionally after a DNS prefix and a slash, as in
+// example.com/team.
+var labelName = regexp.MustCompile(`^([a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?/)?[A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?$`)
+
+// labelValue is what label values must look like: empty, or like a name
+// without a prefix.
+var labelValue = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?)?$`)
+
+// validateLabels reports the keys and values of Labels and Annotations
+// that cannot be stored, adding to errs.
+func (a *Antarian) validateLabels(errs ValidationErrors) ValidationErrors {
+	invalid := func(field, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	for _, k := range sortedKeys(a.Labels) {
+		v := a.Labels[k]
+		switch {
+		case !labelName.MatchString(k):
+			invalid("labels", "%q is not a label name such as team or example.com/team", k)
+		case len(v) > MaxLabelValueLength:
+			invalid("labels."+k, "must be at most %d bytes", MaxLabelValueLength)
+		case !labelValue.MatchString(v):
+			invalid("labels."+k, "%q must be letters, digits, '-', '_' and '.', starting and ending with a letter or digit", v)
+		}
+	}
+	size := 0
+	for _, k := range sortedKeys(a.Annotations) {
+		if !labelName.MatchString(k) {
+			invalid("annotations", "%q is not an annotation name such as note or example.com/note", k)
+		}
+		size += len(k) + len(a.Annotations[k])
+	}
+	if size > MaxAnnotationsLength {
+		invalid("annotations", "must be at most %d bytes in all", MaxAnnotationsLength)
+	}
+	return errs
+}
+
+// sortedKeys returns the keys of m in order, so errors come out the same
+// each time.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LabelSelector selects Antarians by their labels, as a comma separated
+// list of requirements that must all hold: key=value, key!=value, key, for
+// an Antarian with the label, and !key, for one without it.
+type LabelSelector []labelRequirement
+
+type labelRequirement struct {
+	Key   string
+	Value string
+	// Op is "=", "!=", "exists" or "!exists".
+	Op string
+}
+
+// ParseLabelSelector parses a LabelSelector such as "team=infra,!legacy".
+func ParseLabelSelector(s string) (LabelSelector, error) {
+	var sel LabelSelector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		var req labelRequirement
+		switch {
+		case term == "":
+			return nil, fmt.Errorf("%q has an empty requirement", s)
+		case strings.Contains(term, "!="):
+			k, v, _ := strings.Cut(term, "!=")
+			req = labelRequirement{Key: strings.TrimSpace(k), Value: strings.TrimSpace(v), Op: "!="}
+		case strings.Contains(term, "="):
+			k, v, _ := strings.Cut(term, "=")
+			req = labelRequirement{Key: strings.TrimSpace(k), Value: strings.TrimSpace(strings.TrimPrefix(v, "=")), Op: "="}
+		case strings.HasPrefix(term, "!"):
+			req = labelRequirement{Key: strings.TrimSpace(term[1:]), Op: "!exists"}
+		default:
+			req = labelRequirement{Key: term, Op: "exists"}
+		}
+		if !labelName.MatchString(req.Key) {
+			return nil, fmt.Errorf("%q is not a label name", req.Key)
+		}
+		if !labelValue.MatchString(req.Value) {
+			return nil, fmt.Errorf("%q is not a label value", req.Value)
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels meet every requirement of sel.
+func (sel LabelSelector) Matches(labels map[string]string) bool {
+	for _, req := range sel {
+		v, ok := labels[req.Key]
+		var holds bool
+		switch req.Op {
+		case "=":
+			holds = ok && v == req.Value
+		case "!=":
+			holds = !ok || v != req.Value
+		case "exists":
+			holds = ok
+		case "!exists":
+			holds = !ok
+		}
+		if !holds {
+			return false
+		}
+	}
+	return true
+}
+
+func (sel LabelSelector) String() string {
+	terms := make([]string, len(sel))
+	for i, req := range sel {
+		switch req.Op {
+		case "exists":
+			terms[i] = req.Key
+		case "!exists":
+			terms[i] = "!" + req.Key
+		default:
+			terms[i] = req.Key + req.Op + req.Value
+		}
+	}
+	return strings.Join(terms, ",")
+}
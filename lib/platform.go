@@ -0,0 +1,106 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// platformPart is what an OS or architecture name must look like, as in
+// linux, darwin, amd64 or arm64.
+var platformPart = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// Variant is an artifact of an Antarian built for another platform than
+// its own OS and Arch, uploaded beside its main artifact.
+type Variant struct {
+	OS       string `json:"os" yaml:"os,omitempty" toml:"os,omitempty"`
+	Arch     string `json:"arch" yaml:"arch,omitempty" toml:"arch,omitempty"`
+	Artifact string `json:"artifact" yaml:"artifact,omitempty" toml:"artifact,omitempty"`
+	Size     int64  `json:"size" yaml:"size,omitempty" toml:"size,omitempty"`
+	Checksum string `json:"checksum" yaml:"checksum,omitempty" toml:"checksum,omitempty"`
+}
+
+// Platform returns the platform of v, e.g. linux/arm64.
+func (v Variant) Platform() string {
+	return v.OS + "/" + v.Arch
+}
+
+// ParsePlatform splits a platform such as linux/amd64 into its OS and
+// architecture.
+func ParsePlatform(s string) (os, arch string, err error) {
+	os, arch, ok := strings.Cut(s, "/")
+	if !ok || !platformPart.MatchString(os) || !platformPart.MatchString(arch) {
+		return "", "", fmt.Errorf("%q is not a platform such as linux/amd64", s)
+	}
+	return os, arch, nil
+}
+
+// Platform returns the platform of a, e.g. linux/amd64, or "" when its OS
+// and Arch are not set.
+func (a *Antarian) Platform() string {
+	if a.OS == "" {
+		return ""
+	}
+	return a.OS + "/" + a.Arch
+}
+
+// FilenameFor is Filename for the artifact of a built for os and arch.
+func (a *Antarian) FilenameFor(os, arch string) string {
+	if os == "" {
+		return fmt.Sprintf("%s-%s-%s%s", a.Name, a.Version, a.Release, a.ArtifactFormat().Ext())
+	}
+	return fmt.Sprintf("%s-%s-%s-%s-%s%s", a.Name, a.Version, a.Release, os, arch, a.ArtifactFormat().Ext())
+}
+
+// Variant returns the variant of a for os and arch.
+func (a *Antarian) Variant(os, arch string) (Variant, bool) {
+	for _, v := range a.Variants {
+		if v.OS == os && v.Arch == arch {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// SetVariant records v as the variant of a for its platform, replacing
+// any earlier one, and returns the artifact of the one replaced.
+func (a *Antarian) SetVariant(v Variant) (previous string) {
+	for i, old := range a.Variants {
+		if old.OS == v.OS && old.Arch == v.Arch {
+			a.Variants[i] = v
+			return old.Artifact
+		}
+	}
+	a.Variants = append(a.Variants, v)
+	return ""
+}
+
+// Platforms lists the platforms a has artifacts for: its own, when its
+// main artifact is uploaded, then those of its variants.
+func (a *Antarian) Platforms() []string {
+	var list []string
+	if a.Artifact != "" && a.OS != "" {
+		list = append(list, a.Platform())
+	}
+	for _, v := range a.Variants {
+		list = append(list, v.Platform())
+	}
+	return list
+}
+
+// validatePlatform reports an OS or Arch that is not a platform name, or
+// one set without the other, adding to errs.
+func (a *Antarian) validatePlatform(errs ValidationErrors) ValidationErrors {
+	invalid := func(field, format string, args ...interface{}) ValidationErrors {
+		return append(errs, &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	switch {
+	case (a.OS == "") != (a.Arch == ""):
+		return invalid("os", "must be set together with arch")
+	case a.OS != "" && !platformPart.MatchString(a.OS):
+		return invalid("os", "%q is not an OS name such as linux", a.OS)
+	case a.Arch != "" && !platformPart.MatchString(a.Arch):
+		return invalid("arch", "%q is not an architecture name such as amd64", a.Arch)
+	}
+	return errs
+}
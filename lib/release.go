@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReleaseScheme is how NewAntarianFromRequest makes an Antarian's
+// Release.
+type ReleaseScheme string
+
+const (
+	// ReleaseDate formats the creation time with ReleaseOptions.Layout.
+	ReleaseDate ReleaseScheme = "date"
+	// ReleaseCounter is ReleaseOptions.Counter, numbering the Antarians
+	// of a name 1, 2, 3 and on.
+	ReleaseCounter ReleaseScheme = "counter"
+	// ReleaseGit is the short SHA of the commit the Antarian was created
+	// from, which its creator must give.
+	ReleaseGit ReleaseScheme = "git"
+)
+
+// ReleaseSchemes lists every ReleaseScheme.
+var ReleaseSchemes = []ReleaseScheme{ReleaseDate, ReleaseCounter, ReleaseGit}
+
+// DefaultReleaseLayout is the time layout of ReleaseDate, e.g. 20240131.
+const DefaultReleaseLayout = "20060102"
+
+// shortCommit is the length of the commit SHAs of ReleaseGit.
+const shortCommit = 7
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+
+// ReleaseOptions choose how Releases are made. The zero value is
+// ReleaseDate with DefaultReleaseLayout.
+type ReleaseOptions struct {
+	Scheme ReleaseScheme
+	// Layout is the time layout of ReleaseDate; DefaultReleaseLayout when
+	// empty.
+	Layout string
+	// Counter is the Release given by ReleaseCounter, worked out by the
+	// caller from the Antarians already stored.
+	Counter int
+}
+
+// Validate rejects an unknown scheme, and a layout making releases that
+// could not be part of a file name.
+func (o ReleaseOptions) Validate() error {
+	switch o.Scheme {
+	case "", ReleaseDate, ReleaseCounter, ReleaseGit:
+	default:
+		return fmt.Errorf("scheme: %q is not one of %v", o.Scheme, ReleaseSchemes)
+	}
+	if o.Layout != "" {
+		s := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(o.Layout)
+		if strings.TrimSpace(s) == "" || strings.ContainsAny(s, "/ \t\n") {
+			return fmt.Errorf("layout: %q makes releases such as %q, which are empty or hold slashes or spaces", o.Layout, s)
+		}
+	}
+	return nil
+}
+
+// Release makes the release of an Antarian created at now from commit,
+// failing with a *ValidationError on "commit" when ReleaseGit has none to
+// use.
+func (o ReleaseOptions) Release(now time.Time, commit string) (string, error) {
+	switch o.Scheme {
+	case ReleaseCounter:
+		return strconv.Itoa(o.Counter), nil
+	case ReleaseGit:
+		commit = strings.ToLower(commit)
+		if !commitSHA.MatchString(commit) {
+			return "", &ValidationError{Field: "commit", Message: fmt.Sprintf("%q is not a commit SHA, which releases are made from", commit)}
+		}
+		return commit[:shortCommit], nil
+	}
+	layout := o.Layout
+	if layout == "" {
+		layout = DefaultReleaseLayout
+	}
+	return now.Format(layout), nil
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Requirement is a parsed entry of Antarian.Requires: the name of an
+// Antarian, optionally followed by a version Constraint, as in "libfoo",
+// "libfoo ^1.2" or "libfoo >= 1.2.0, < 2.0.0".
+type Requirement struct {
+	Name       string
+	Constraint Constraint
+}
+
+// ParseRequirement parses an entry of Antarian.Requires. The constraint
+// may follow the name without a space, as in "libfoo>=1.2".
+func ParseRequirement(s string) (Requirement, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t<>=!^~")
+	if i < 0 {
+		i = len(s)
+	}
+	r := Requirement{Name: s[:i]}
+	if r.Name == "" {
+		return Requirement{}, fmt.Errorf("requirement %q: no name", s)
+	}
+	if rest := strings.TrimSpace(s[i:]); rest != "" {
+		c, err := ParseConstraint(rest)
+		if err != nil {
+			return Requirement{}, fmt.Errorf("requirement %q: %v", s, err)
+		}
+		r.Constraint = c
+	}
+	return r, nil
+}
+
+func (r Requirement) String() string {
+	if c := r.Constraint.String(); c != "" {
+		return r.Name + " " + c
+	}
+	return r.Name
+}
+
+// Match reports whether a is a version of the Antarian r names that
+// satisfies its constraint. Versions that are not semantic versions only
+// match a requirement without a constraint.
+func (r Requirement) Match(a Antarian) bool {
+	if a.Name != r.Name {
+		return false
+	}
+	v, err := ParseVersion(a.Version)
+	if err != nil {
+		return len(r.Constraint.groups) == 0
+	}
+	return r.Constraint.Check(v)
+}
+
+// Resolve picks the best of candidates for r: of those matching it, the
+// newest release, or the newest prerelease when no release matches.
+// Semantic versions rank above those that do not parse, and the later
+// Start breaks ties. ok is false when no candidate matches.
+func (r Requirement) Resolve(candidates Antarians) (best Antarian, ok bool) {
+	for _, a := range candidates {
+		if !r.Match(a) {
+			continue
+		}
+		if !ok || betterMatch(a, best) {
+			best, ok = a, true
+		}
+	}
+	return best, ok
+}
+
+// betterMatch reports whether a resolves a requirement better than b.
+func betterMatch(a, b Antarian) bool {
+	av, aerr := ParseVersion(a.Version)
+	bv, berr := ParseVersion(b.Version)
+	if (aerr == nil) != (berr == nil) {
+		return aerr == nil
+	}
+	if aerr == nil {
+		if ap, bp := av.Prerelease(), bv.Prerelease(); ap != bp {
+			return !ap
+		}
+		if c := av.Compare(bv); c != 0 {
+			return c > 0
+		}
+	}
+	return a.Start.After(b.Start)
+}
@@ -0,0 +1,177 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SBOMExt is added to the name of an artifact to name the SBOM of the
+// build that made it, stored beside it.
+const SBOMExt = ".cdx.json"
+
+// SBOMContentType is the media type of an SBOM.
+const SBOMContentType = "application/vnd.cyclonedx+json"
+
+// SBOM is a CycloneDX 1.5 software bill of materials, in its JSON form,
+// listing the Antarians a build required and the build's environment.
+type SBOM struct {
+	BOMFormat    string           `json:"bomFormat"`
+	SpecVersion  string           `json:"specVersion"`
+	SerialNumber string           `json:"serialNumber"`
+	Version      int              `json:"version"`
+	Metadata     SBOMMetadata     `json:"metadata"`
+	Components   []SBOMComponent  `json:"components"`
+	Dependencies []SBOMDependency `json:"dependencies"`
+}
+
+// SBOMMetadata describes the build: the Antarian built, as Component,
+// and its environment, as Properties.
+type SBOMMetadata struct {
+	Timestamp  time.Time      `json:"timestamp"`
+	Tools      SBOMTools      `json:"tools"`
+	Component  SBOMComponent  `json:"component"`
+	Properties []SBOMProperty `json:"properties,omitempty"`
+}
+
+type SBOMTools struct {
+	Components []SBOMComponent `json:"components"`
+}
+
+// SBOMComponent is an Antarian in an SBOM, referred to by its id.
+type SBOMComponent struct {
+	Type       string         `json:"type"`
+	BOMRef     string         `json:"bom-ref,omitempty"`
+	Name       string         `json:"name"`
+	Version    string         `json:"version,omitempty"`
+	PURL       string         `json:"purl,omitempty"`
+	Hashes     []SBOMHash     `json:"hashes,omitempty"`
+	Properties []SBOMProperty `json:"properties,omitempty"`
+}
+
+type SBOMHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type SBOMProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SBOMDependency lists the components the component Ref requires.
+type SBOMDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// NewSBOM returns the SBOM of build b of a, made at now, without its
+// dependencies; AddDependency adds them.
+func NewSBOM(a Antarian, b Build, now time.Time) (SBOM, error) {
+	serial, err := NewUUID()
+	if err != nil {
+		return SBOM{}, err
+	}
+	main := a.sbomComponent("application")
+	if b.Checksum != "" {
+		main.Hashes = []SBOMHash{{Alg: "SHA-256", Content: b.Checksum}}
+	}
+	sbom := SBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + serial,
+		Version:      1,
+		Metadata: SBOMMetadata{
+			Timestamp:  now.UTC().Truncate(time.Second),
+			Tools:      SBOMTools{Components: []SBOMComponent{{Type: "application", Name: "antares"}}},
+			Component:  main,
+			Properties: buildProperties(a, b),
+		},
+		Components:   []SBOMComponent{},
+		Dependencies: []SBOMDependency{{Ref: a.Id, DependsOn: []string{}}},
+	}
+	return sbom, nil
+}
+
+// AddDependency records that the Antarian from requires dep, adding dep to
+// the components once.
+func (s *SBOM) AddDependency(from string, dep Antarian) {
+	if dep.Id != s.Metadata.Component.BOMRef && s.dependency(dep.Id) == nil {
+		c := dep.sbomComponent("library")
+		if dep.Checksum != "" {
+			c.Hashes = []SBOMHash{{Alg: "SHA-256", Content: dep.Checksum}}
+		}
+		s.Components = append(s.Components, c)
+		s.Dependencies = append(s.Dependencies, SBOMDependency{Ref: dep.Id, DependsOn: []string{}})
+	}
+	d := s.dependency(from)
+	for _, ref := range d.DependsOn {
+		if ref == dep.Id {
+			return
+		}
+	}
+	d.DependsOn = append(d.DependsOn, dep.Id)
+}
+
+// AddUnresolved records a requires entry of the build's Antarian that
+// resolved to no Antarian, for reason.
+func (s *SBOM) AddUnresolved(entry, reason string) {
+	s.Metadata.Properties = append(s.Metadata.Properties, SBOMProperty{Name: "antares:unresolved", Value: fmt.Sprintf("%s: %s", entry, reason)})
+}
+
+func (s *SBOM) dependency(ref string) *SBOMDependency {
+	for i := range s.Dependencies {
+		if s.Dependencies[i].Ref == ref {
+			return &s.Dependencies[i]
+		}
+	}
+	return nil
+}
+
+// sbomComponent describes a as a component of type typ.
+func (a *Antarian) sbomComponent(typ string) SBOMComponent {
+	purl := "pkg:generic/" + url.PathEscape(a.Name) + "@" + url.PathEscape(a.Version)
+	if a.Release != "" {
+		purl += "?release=" + url.QueryEscape(a.Release)
+	}
+	c := SBOMComponent{Type: typ, BOMRef: a.Id, Name: a.Name, Version: a.Version, PURL: purl}
+	if a.Commit != "" {
+		c.Properties = append(c.Properties, SBOMProperty{Name: "antares:commit", Value: a.Commit})
+	}
+	return c
+}
+
+// buildProperties describes the environment build b of a ran in. The
+// values of its variables are left out, as they may hold secrets.
+func buildProperties(a Antarian, b Build) []SBOMProperty {
+	var props []SBOMProperty
+	add := func(name, value string) {
+		if value != "" {
+			props = append(props, SBOMProperty{Name: "antares:" + name, Value: value})
+		}
+	}
+	add("build_id", b.Id)
+	add("worker", b.Worker)
+	add("start", b.Start.UTC().Format(time.RFC3339))
+	add("end", b.End.UTC().Format(time.RFC3339))
+	add("release", a.Release)
+	add("platform", a.Platform())
+	add("format", string(a.ArtifactFormat()))
+	if spec := a.BuildSpec; spec != nil {
+		add("image", spec.Image)
+		add("workdir", spec.WorkDir)
+		add("command", spec.Command)
+		for _, step := range spec.Steps {
+			add("step", step)
+		}
+		names := make([]string, 0, len(spec.Env))
+		for name := range spec.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		add("env", strings.Join(names, " "))
+	}
+	return props
+}
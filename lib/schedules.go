@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+// OverlapPolicy tells what a Schedule does when it is due while the build
+// it last started is still queued or running.
+type OverlapPolicy string
+
+const (
+	// OverlapSkip starts no build until the last one has finished.
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue starts another build regardless.
+	OverlapQueue OverlapPolicy = "queue"
+)
+
+// Schedule builds an Antarian at the times of a cron expression, read in
+// Timezone, an IANA name, or UTC when that is empty.
+type Schedule struct {
+	Id         string        `json:"id"`
+	AntarianId string        `json:"antarian_id"`
+	Cron       string        `json:"cron"`
+	Timezone   string        `json:"timezone,omitempty"`
+	Overlap    OverlapPolicy `json:"overlap"`
+	// Priority is given to the builds the schedule starts.
+	Priority int       `json:"priority,omitempty"`
+	Enabled  bool      `json:"enabled"`
+	Created  time.Time `json:"created"`
+	// NextRun is when the schedule is next due, zero while it is disabled.
+	NextRun time.Time `json:"next_run"`
+	// LastRun is when it was last due, and LastBuildId the build it then
+	// started; LastError tells why it started none.
+	LastRun     time.Time `json:"last_run"`
+	LastBuildId string    `json:"last_build_id,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Validate reports the first field of s that cannot be scheduled, as a
+// *ValidationError. An empty Overlap is taken as OverlapSkip.
+func (s *Schedule) Validate() error {
+	if s.AntarianId == "" {
+		return &ValidationError{Field: "antarian_id", Message: "must not be empty"}
+	}
+	if _, err := ParseCron(s.Cron); err != nil {
+		return &ValidationError{Field: "cron", Message: err.Error()}
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return &ValidationError{Field: "timezone", Message: fmt.Sprintf("unknown time zone %q", s.Timezone)}
+	}
+	switch s.Overlap {
+	case "":
+		s.Overlap = OverlapSkip
+	case OverlapSkip, OverlapQueue:
+	default:
+		return &ValidationError{Field: "overlap", Message: fmt.Sprintf("%q is not skip or queue", s.Overlap)}
+	}
+	return ValidatePriority(s.Priority)
+}
+
+// Next returns the first time after t that s is due, or the zero time when
+// it never is. s must be valid.
+func (s *Schedule) Next(t time.Time) time.Time {
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}
+	}
+	next := c.Next(t.In(loc))
+	if next.IsZero() {
+		return next
+	}
+	return next.UTC()
+}
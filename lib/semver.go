@@ -0,0 +1,281 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed semantic version. A leading "v" and missing minor or
+// patch numbers are accepted, so "v2" parses as 2.0.0.
+type Version struct {
+	Major, Minor, Patch uint64
+	// Pre holds the dot separated prerelease identifiers.
+	Pre   []string
+	Build string
+}
+
+// ParseVersion parses s as a semantic version.
+func ParseVersion(s string) (Version, error) {
+	v, _, err := parseVersion(s)
+	return v, err
+}
+
+// parseVersion also returns how many of major, minor and patch were given.
+func parseVersion(s string) (Version, int, error) {
+	var v Version
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		v.Build = rest[i+1:]
+		rest = rest[:i]
+		if v.Build == "" {
+			return Version{}, 0, fmt.Errorf("version %q: empty build metadata", s)
+		}
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		pre := rest[i+1:]
+		rest = rest[:i]
+		if pre == "" {
+			return Version{}, 0, fmt.Errorf("version %q: empty prerelease", s)
+		}
+		v.Pre = strings.Split(pre, ".")
+		for _, id := range v.Pre {
+			if id == "" {
+				return Version{}, 0, fmt.Errorf("version %q: empty prerelease identifier", s)
+			}
+		}
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 || rest == "" {
+		return Version{}, 0, fmt.Errorf("version %q: want MAJOR[.MINOR[.PATCH]]", s)
+	}
+	nums := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return Version{}, 0, fmt.Errorf("version %q: %q is not a number", s, p)
+		}
+		*nums[i] = n
+	}
+	return v, len(parts), nil
+}
+
+// ValidateVersion rejects a version that does not parse, as a
+// *ValidationError on "version".
+func ValidateVersion(s string) error {
+	if _, err := ParseVersion(s); err != nil {
+		return &ValidationError{Field: "version", Message: fmt.Sprintf("%q is not a semantic version such as 1.2.3", s)}
+	}
+	return nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Pre) > 0 {
+		s += "-" + strings.Join(v.Pre, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Prerelease reports whether v carries prerelease identifiers.
+func (v Version) Prerelease() bool {
+	return len(v.Pre) > 0
+}
+
+// Compare returns -1, 0 or 1 as v orders before, with or after o under
+// semantic version precedence. Build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	for _, p := range [][2]uint64{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if p[0] != p[1] {
+			if p[0] < p[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	// a release orders after its prereleases
+	switch {
+	case len(v.Pre) == 0 && len(o.Pre) == 0:
+		return 0
+	case len(v.Pre) == 0:
+		return 1
+	case len(o.Pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Pre) && i < len(o.Pre); i++ {
+		if c := comparePre(v.Pre[i], o.Pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.Pre) < len(o.Pre):
+		return -1
+	case len(v.Pre) > len(o.Pre):
+		return 1
+	}
+	return 0
+}
+
+// comparePre orders numeric identifiers numerically and before
+// alphanumeric ones, which order lexically.
+func comparePre(a, b string) int {
+	an, aerr := strconv.ParseUint(a, 10, 64)
+	bn, berr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aerr == nil && berr == nil:
+		if an == bn {
+			return 0
+		}
+		if an < bn {
+			return -1
+		}
+		return 1
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Constraint matches versions against a range such as "^2.0",
+// ">=1.2, <1.5", ">= 1.2.0, < 2.0.0" or "~1.4 || ^2". Comparators in a
+// group separated by commas or spaces must all hold; any one of the groups
+// separated by "||" must.
+type Constraint struct {
+	raw    string
+	groups [][]comparator
+}
+
+type comparator struct {
+	op string
+	v  Version
+}
+
+// ParseConstraint parses s. "*" and the empty string match every version.
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{raw: s}
+	for _, group := range strings.Split(s, "||") {
+		var cmps []comparator
+		for _, term := range constraintTerms(group) {
+			expanded, err := parseComparator(term)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("constraint %q: %v", s, err)
+			}
+			cmps = append(cmps, expanded...)
+		}
+		c.groups = append(c.groups, cmps)
+	}
+	return c, nil
+}
+
+// constraintTerms splits a group of comparators at commas and spaces,
+// keeping an operator together with the version after it.
+func constraintTerms(group string) []string {
+	var terms []string
+	op := ""
+	for _, field := range strings.FieldsFunc(group, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if strings.Trim(field, "<>=!^~") == "" {
+			op += field
+			continue
+		}
+		terms = append(terms, op+field)
+		op = ""
+	}
+	if op != "" {
+		terms = append(terms, op)
+	}
+	return terms
+}
+
+// parseComparator expands a single term into plain comparisons.
+func parseComparator(term string) ([]comparator, error) {
+	if term == "*" || term == "x" {
+		return nil, nil
+	}
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, prefix) {
+			op, term = prefix, strings.TrimSpace(term[len(prefix):])
+			break
+		}
+	}
+	v, given, err := parseVersion(term)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "^":
+		upper := Version{Major: v.Major + 1}
+		switch {
+		case v.Major > 0 || given == 1:
+		case v.Minor > 0 || given == 2:
+			upper = Version{Minor: v.Minor + 1}
+		default:
+			upper = Version{Patch: v.Patch + 1}
+		}
+		return []comparator{{">=", v}, {"<", upper}}, nil
+	case "~":
+		upper := Version{Major: v.Major, Minor: v.Minor + 1}
+		if given == 1 {
+			upper = Version{Major: v.Major + 1}
+		}
+		return []comparator{{">=", v}, {"<", upper}}, nil
+	case "", "=":
+		// a partial version matches everything it covers
+		switch given {
+		case 1:
+			return []comparator{{">=", v}, {"<", Version{Major: v.Major + 1}}}, nil
+		case 2:
+			return []comparator{{">=", v}, {"<", Version{Major: v.Major, Minor: v.Minor + 1}}}, nil
+		}
+		return []comparator{{"=", v}}, nil
+	}
+	return []comparator{{op, v}}, nil
+}
+
+// Check reports whether v satisfies the constraint.
+func (c Constraint) Check(v Version) bool {
+	if len(c.groups) == 0 {
+		return true
+	}
+	for _, group := range c.groups {
+		ok := true
+		for _, cmp := range group {
+			if !cmp.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c comparator) check(v Version) bool {
+	n := v.Compare(c.v)
+	switch c.op {
+	case "=":
+		return n == 0
+	case "!=":
+		return n != 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	}
+	return false
+}
+
+func (c Constraint) String() string {
+	return c.raw
+}
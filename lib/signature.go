@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SignatureExt is added to the name of an artifact to name its detached
+// signature, stored beside it.
+const SignatureExt = ".sig"
+
+// SignatureCheck verifies the detached signature of a stored artifact
+// against the server's public keys.
+type SignatureCheck struct {
+	Id        string `json:"id"`
+	Filename  string `json:"filename"`
+	Platform  string `json:"platform,omitempty"`
+	Signature string `json:"signature"`
+	Checksum  string `json:"checksum"`
+	// KeyId names the public key the signature was made with, when one
+	// of them verifies it.
+	KeyId string `json:"key_id,omitempty"`
+	Valid bool   `json:"valid"`
+	// Error says why the signature could not be checked, e.g. it is
+	// missing.
+	Error string `json:"error,omitempty"`
+}
+
+// ParseSigningKey parses a PEM encoded ECDSA or Ed25519 private key, in
+// PKCS #8 or, for ECDSA, SEC 1 form, as written by openssl or cosign
+// generate-key-pair without a password.
+func ParseSigningKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+	default:
+		return nil, fmt.Errorf("found a %s, not a private key", block.Type)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("%T keys are not supported, only ECDSA and Ed25519", key)
+}
+
+// ParsePublicKey parses a PEM encoded ECDSA or Ed25519 public key.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("found a %s, not a public key", block.Type)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%T keys are not supported, only ECDSA and Ed25519", key)
+}
+
+// LoadSigningKey reads the private key in the PEM file path.
+func LoadSigningKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseSigningKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+// LoadPublicKey reads the public key in the PEM file path.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+// KeyId names pub by the start of the sha256 of its PKIX encoding.
+func KeyId(pub crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignChecksum signs the artifact with the hex sha256 checksum, returning
+// the base64 signature stored as its detached signature. ECDSA keys sign
+// the digest, as cosign sign-blob does, and Ed25519 keys the digest bytes.
+func SignChecksum(key crypto.Signer, checksum string) ([]byte, error) {
+	digest, err := hex.DecodeString(checksum)
+	if err != nil || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("%q is not a sha256 checksum", checksum)
+	}
+	var opts crypto.SignerOpts = crypto.SHA256
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		opts = crypto.Hash(0)
+	}
+	sig, err := key.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), nil
+}
+
+// VerifyChecksum reports whether sig, as made by SignChecksum, signs the
+// artifact with the hex sha256 checksum with the key of pub.
+func VerifyChecksum(pub crypto.PublicKey, checksum string, sig []byte) bool {
+	digest, err := hex.DecodeString(checksum)
+	if err != nil || len(digest) != sha256.Size {
+		return false
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return false
+	}
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest, raw)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, digest, raw)
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package lib
+
+import "fmt"
+
+// Status is the lifecycle position of an Antarian, moved along by its
+// builds. It replaces the Running and Finished flags, which are kept in
+// step with it for the clients reading them.
+type Status string
+
+const (
+	// StatusPending is an Antarian not built since it was created or
+	// unarchived.
+	StatusPending   Status = "pending"
+	StatusBuilding  Status = "building"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+	// StatusArchived is an Antarian retired from building.
+	StatusArchived Status = "archived"
+)
+
+// Statuses lists every Status, in lifecycle order.
+var Statuses = []Status{StatusPending, StatusBuilding, StatusSucceeded, StatusFailed, StatusCanceled, StatusArchived}
+
+// statusTransitions lists the statuses each Status may move to, besides
+// itself.
+var statusTransitions = map[Status][]Status{
+	StatusPending:   {StatusBuilding, StatusArchived},
+	StatusBuilding:  {StatusSucceeded, StatusFailed, StatusCanceled},
+	StatusSucceeded: {StatusBuilding, StatusArchived},
+	StatusFailed:    {StatusBuilding, StatusArchived},
+	StatusCanceled:  {StatusBuilding, StatusArchived},
+	StatusArchived:  {StatusPending},
+}
+
+// Valid reports whether s is one of Statuses.
+func (s Status) Valid() bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+// Done reports whether no build of the Antarian is under way, that is
+// whether it is finished in the sense of the Finished flag: built or
+// archived.
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled || s == StatusArchived
+}
+
+// CanBecome reports whether an Antarian in status s may move to to. Staying
+// put is allowed, as when a second build starts while one is running.
+func (s Status) CanBecome(to Status) bool {
+	if s == to {
+		return s.Valid()
+	}
+	for _, next := range statusTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildStatus is the Status a build in state st gives its Antarian. Queued
+// builds give none, so ok is false.
+func BuildStatus(st BuildState) (s Status, ok bool) {
+	switch st {
+	case BuildRunning:
+		return StatusBuilding, true
+	case BuildSucceeded:
+		return StatusSucceeded, true
+	case BuildFailed:
+		return StatusFailed, true
+	case BuildCanceled:
+		return StatusCanceled, true
+	}
+	return "", false
+}
+
+// LegacyStatus is the Status of a record stored before Status existed,
+// from its Running and Finished flags. Records were created running, and
+// no build outlives a restart, so a record running but not finished is
+// pending; a finished one is taken to have succeeded.
+func LegacyStatus(running, finished bool) Status {
+	if finished {
+		return StatusSucceeded
+	}
+	return StatusPending
+}
+
+// TransitionError is returned by SetStatus for a move the lifecycle does
+// not allow.
+type TransitionError struct {
+	From Status
+	To   Status
+}
+
+func (e *TransitionError) Error() string {
+	if !e.To.Valid() {
+		return fmt.Sprintf("%q is not one of %v", e.To, Statuses)
+	}
+	return fmt.Sprintf("cannot change from %s to %s", e.From, e.To)
+}
+
+// CurrentStatus returns the Status of a, worked out from Running and
+// Finished for records stored before Status existed.
+func (a *Antarian) CurrentStatus() Status {
+	if a.Status == "" {
+		return LegacyStatus(a.Running, a.Finished)
+	}
+	return a.Status
+}
+
+// SetStatus moves a to status to, keeping Running and Finished in step,
+// or returns a *TransitionError when the lifecycle does not allow it.
+func (a *Antarian) SetStatus(to Status) error {
+	from := a.CurrentStatus()
+	if !from.CanBecome(to) {
+		return &TransitionError{From: from, To: to}
+	}
+	a.Status = to
+	a.Running, a.Finished = to == StatusBuilding, to.Done()
+	return nil
+}
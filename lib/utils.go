@@ -1,10 +1,10 @@
 package lib
 
 import (
-    "io"
-    "crypto/rand"
-    "fmt"
-    "os"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
 )
 
 // newUUID generates a random UUID according to RFC 4122
@@ -21,16 +21,15 @@ func NewUUID() (string, error) {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
 }
 
-
 func GetHostname() string {
-    h, err := os.Hostname()
-    if err != nil {
-        fmt.Println(err)
-    }
-    return h
+	h, err := os.Hostname()
+	if err != nil {
+		fmt.Println(err)
+	}
+	return h
 }
 
 func GetUrl() string {
-    port := "8080"
-    return `http://` + GetHostname() + ":" + port + `/antarians`
+	port := "8080"
+	return `http://` + GetHostname() + ":" + port + `/antarians`
 }
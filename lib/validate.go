@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Length limits of the fields of an Antarian.
+const (
+	MaxNameLength    = 128
+	MaxVersionLength = 128
+	MaxURLLength     = 2048
+	MaxRequires      = 256
+)
+
+// ValidationErrors rejects several fields of a submitted record, each
+// once.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ve := range e {
+		msgs[i] = ve.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Without returns the errors of e on fields other than field, nil when
+// there are none.
+func (e ValidationErrors) Without(field string) error {
+	var out ValidationErrors
+	for _, ve := range e {
+		if ve.Field != field {
+			out = append(out, ve)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// Validate reports every field of a that cannot be stored, as
+// ValidationErrors: the name is required and may not hold slashes or
+// spaces, the version must be a semantic version, Uri and BaseUrl must be
+// http or https URLs when set, and each of Requires must parse, name
+// another Antarian and appear once. OS and Arch are set together, and
+// Format is one of ArtifactFormats. Labels and Annotations must have names
+// such as example.com/team, and label values be short words. Fields are
+// bounded by the Max lengths.
+func (a *Antarian) Validate() error {
+	var errs ValidationErrors
+	invalid := func(field, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case a.Name == "":
+		invalid("name", "is required")
+	case len(a.Name) > MaxNameLength:
+		invalid("name", "must be at most %d bytes", MaxNameLength)
+	case strings.ContainsFunc(a.Name, func(r rune) bool { return r == '/' || unicode.IsSpace(r) || unicode.IsControl(r) }):
+		invalid("name", "%q must not contain slashes or spaces", a.Name)
+	}
+
+	if len(a.Version) > MaxVersionLength {
+		invalid("version", "must be at most %d bytes", MaxVersionLength)
+	} else if err := ValidateVersion(a.Version); err != nil {
+		errs = append(errs, err.(*ValidationError))
+	}
+
+	if msg := checkURL(a.Uri); msg != "" {
+		invalid("uri", "%s", msg)
+	}
+	if msg := checkURL(a.BaseUrl); msg != "" {
+		invalid("baseurl", "%s", msg)
+	}
+
+	if len(a.Requires) > MaxRequires {
+		invalid("requires", "must have at most %d entries", MaxRequires)
+	} else {
+		seen := map[string]bool{}
+		for i, entry := range a.Requires {
+			field := fmt.Sprintf("requires[%d]", i)
+			req, err := ParseRequirement(entry)
+			switch {
+			case err != nil:
+				invalid(field, "%v", err)
+			case len(req.Name) > MaxNameLength:
+				invalid(field, "names must be at most %d bytes", MaxNameLength)
+			case req.Name == a.Name:
+				invalid(field, "%s cannot require itself", a.Name)
+			case seen[req.Name]:
+				invalid(field, "%s is already required", req.Name)
+			}
+			seen[req.Name] = true
+		}
+	}
+
+	errs = a.validatePlatform(errs)
+	errs = a.validateFormat(errs)
+	errs = a.validateLabels(errs)
+
+	if a.BuildSpec != nil {
+		if err := a.BuildSpec.Validate(); err != nil {
+			errs = append(errs, err.(*ValidationError))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// checkURL returns why s is not an absolute http or https URL, or "" when
+// it is one or empty.
+func checkURL(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) > MaxURLLength {
+		return fmt.Sprintf("must be at most %d bytes", MaxURLLength)
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Sprintf("%q is not an http or https URL", s)
+	}
+	return ""
+}
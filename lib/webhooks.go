@@ -0,0 +1,39 @@
+package lib
+
+import "time"
+
+// Webhook is a URL the server POSTs events to. Each request carries an
+// HMAC-SHA256 signature of its body made with Secret, which is only ever
+// shown when the webhook is created.
+type Webhook struct {
+	Id     string `json:"id"`
+	Url    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	// Events limits delivery to these event types; empty means all.
+	Events  []string  `json:"events,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// DeliveryState is the outcome of delivering an event to a Webhook.
+type DeliveryState string
+
+const (
+	DeliveryPending   DeliveryState = "pending"
+	DeliverySucceeded DeliveryState = "succeeded"
+	DeliveryFailed    DeliveryState = "failed"
+)
+
+// WebhookDelivery records the attempts to deliver one event to one
+// Webhook. StatusCode and Error describe the last attempt.
+type WebhookDelivery struct {
+	Id         string        `json:"id"`
+	WebhookId  string        `json:"webhook_id"`
+	EventId    string        `json:"event_id"`
+	EventType  string        `json:"event_type"`
+	State      DeliveryState `json:"state"`
+	Attempts   int           `json:"attempts"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Created    time.Time     `json:"created"`
+	Updated    time.Time     `json:"updated"`
+}
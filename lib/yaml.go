@@ -0,0 +1,61 @@
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UnmarshalYAML decodes a from YAML, by the field names of its JSON
+// encoding, refusing keys that name no field as the server refuses them
+// in JSON bodies, so a misspelt key in a definition file is not silently
+// dropped.
+func (a *Antarian) UnmarshalYAML(n *yaml.Node) error {
+	if err := knownKeys(n, reflect.TypeOf(*a)); err != nil {
+		return err
+	}
+	type plain Antarian
+	return n.Decode((*plain)(a))
+}
+
+// UnmarshalYAML decodes s from YAML, refusing unknown keys like
+// Antarian.UnmarshalYAML.
+func (s *BuildSpec) UnmarshalYAML(n *yaml.Node) error {
+	if err := knownKeys(n, reflect.TypeOf(*s)); err != nil {
+		return err
+	}
+	type plain BuildSpec
+	return n.Decode((*plain)(s))
+}
+
+// UnmarshalYAML decodes req from YAML, refusing unknown keys like
+// Antarian.UnmarshalYAML.
+func (req *CreateRequest) UnmarshalYAML(n *yaml.Node) error {
+	if err := knownKeys(n, reflect.TypeOf(*req)); err != nil {
+		return err
+	}
+	type plain CreateRequest
+	return n.Decode((*plain)(req))
+}
+
+// knownKeys returns an error naming the first key of the mapping n that
+// is not the yaml name of a field of the struct type t. Nodes that are
+// not mappings are left for Decode to refuse.
+func knownKeys(n *yaml.Node, t reflect.Type) error {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		names[name] = true
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if key := n.Content[i]; !names[key.Value] {
+			return fmt.Errorf("line %d: field %s not found in type %s", key.Line, key.Value, t)
+		}
+	}
+	return nil
+}
@@ -1,61 +1,110 @@
 package loader
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-    "os"
-    "net/http"
-	"github.com/parnurzeal/gorequest"
-    "github.com/xbcsmith/antares/lib"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/xbcsmith/antares/client"
+	"github.com/xbcsmith/antares/lib"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the encoding of an Antarian definition. YAML and TOML use the
+// field names of JSON.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
 )
 
+// Formats lists every Format.
+var Formats = []Format{FormatJSON, FormatYAML, FormatTOML}
+
+// FormatOf returns the Format of the file filename by its extension, JSON
+// for any but .yaml, .yml and .toml.
+func FormatOf(filename string) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatJSON
+}
+
+// Decode decodes the definition raw, in format, into a new Antarian. YAML
+// and TOML definitions may not hold keys that name no field.
+func Decode(raw []byte, format Format) (*lib.Antarian, error) {
+	antarian, err := lib.NewAntarian()
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatJSON:
+		err = json.Unmarshal(raw, antarian)
+	case FormatYAML:
+		err = yaml.Unmarshal(raw, antarian)
+	case FormatTOML:
+		dec := toml.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(antarian)
+	default:
+		err = fmt.Errorf("format %q is not one of %v", format, Formats)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return antarian, nil
+}
+
 type Loader struct {
-    Response    string
-    Status      string
-    Header      http.Header
-    Body        string
-    Errors      []error
+	Request  *lib.Antarian
+	Antarian *lib.Antarian
+	Errors   []error
 }
 
-func Load(raw []byte) (*Loader, error) {
+// Load decodes the JSON raw into an Antarian and creates it on the server
+// behind c, unless it fails Antarian.Validate. The call is traced as a
+// child of any span in ctx.
+func Load(ctx context.Context, c client.AntaresClient, raw []byte) (*Loader, error) {
+	return LoadFormat(ctx, c, raw, FormatJSON)
+}
 
-    antarian, err := lib.NewAntarian()
-    if err != nil {
-        fmt.Println(err)
-        return &Loader{Errors: []error{err}}, nil
-    }
+// LoadFormat is Load for a definition in format.
+func LoadFormat(ctx context.Context, c client.AntaresClient, raw []byte, format Format) (*Loader, error) {
+	ctx, span := otel.Tracer("github.com/xbcsmith/antares/loader").Start(ctx, "loader.Load")
+	defer span.End()
+	span.SetAttributes(attribute.String("antares.format", string(format)))
 
-    fmt.Printf("%#v\n", antarian)
+	antarian, err := Decode(raw, format)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &Loader{Errors: []error{err}}, err
+	}
 
-    if err := json.Unmarshal(raw, &antarian); err != nil {
-		fmt.Println(err)
-        return &Loader{Errors: []error{err}}, nil
+	span.SetAttributes(attribute.String("antares.name", antarian.Name))
+	// the server would refuse it, so do not send it
+	if err := antarian.Validate(); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &Loader{Request: antarian, Errors: []error{err}}, err
 	}
-    fmt.Printf("%#v\n", antarian)
-    a, err := json.Marshal(antarian)
-    if err != nil {
-        fmt.Println(err)
-        return &Loader{Errors: []error{err}}, nil
-    }
-    url := lib.GetUrl()
-	request := gorequest.New()
-    response := string(a)
-	resp, body, errs := request.Post(url).
-		Set("Content-Type", "application/json; charset=UTF-8").
-		Send(response).
-		End()
-	if errs != nil {
-		fmt.Println(errs)
-		os.Exit(1)
+	created, err := c.CreateAntarian(ctx, antarian)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &Loader{Request: antarian, Errors: []error{err}}, err
 	}
-	fmt.Println("response Status:", resp.Status)
-	fmt.Println("response Headers:", resp.Header)
-	fmt.Println("response Body:", body)
-    return &Loader{
-        Response: response,
-        Status: resp.Status,
-        Header: resp.Header,
-        Body:   body,
-        Errors: errs,
-    }, nil
+	return &Loader{
+		Request:  antarian,
+		Antarian: created,
+	}, nil
 }
@@ -0,0 +1,61 @@
+package loader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xbcsmith/antares/client/fake"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"valid", `{"name":"libfoo","version":"1.0.0","baseurl":"http://example.com/libfoo","requires":[]}`, false},
+		{"malformed", `{"name":"libfoo",`, true},
+		{"invalid", `{"name":"libfoo","version":"1.0.0","baseurl":"not a url","requires":[]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClient()
+			l, err := Load(context.Background(), c, []byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load error = %v, want error %v", err, tt.wantErr)
+			}
+			if l == nil {
+				t.Fatal("Load returned no Loader")
+			}
+			list, _ := c.ListAntarians(context.Background(), nil)
+			if tt.wantErr {
+				if len(l.Errors) == 0 || l.Antarian != nil {
+					t.Errorf("Loader = %+v, want only errors", l)
+				}
+				if len(list) != 0 {
+					t.Errorf("created %d Antarians, want none", len(list))
+				}
+				return
+			}
+			if l.Antarian == nil || l.Antarian.Id == "" || l.Antarian.Name != "libfoo" {
+				t.Errorf("Loader.Antarian = %+v", l.Antarian)
+			}
+			if len(list) != 1 {
+				t.Errorf("created %d Antarians, want 1", len(list))
+			}
+		})
+	}
+}
+
+func TestLoadCreateError(t *testing.T) {
+	c := fake.NewClient()
+	raw := []byte(`{"name":"libfoo","version":"1.0.0","baseurl":"http://example.com/libfoo","requires":[]}`)
+	if _, err := Load(context.Background(), c, raw); err != nil {
+		t.Fatal(err)
+	}
+	// the fake refuses a second libfoo 1.0.0 as the server does
+	l, err := Load(context.Background(), c, raw)
+	if err == nil || len(l.Errors) != 1 {
+		t.Fatalf("second Load = %+v, %v; want a conflict", l, err)
+	}
+}
@@ -0,0 +1,728 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: antares.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Antarian struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Version       string                 `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	Release       string                 `protobuf:"bytes,4,opt,name=release,proto3" json:"release,omitempty"`
+	Uri           string                 `protobuf:"bytes,5,opt,name=uri,proto3" json:"uri,omitempty"`
+	Running       bool                   `protobuf:"varint,6,opt,name=running,proto3" json:"running,omitempty"`
+	Finished      bool                   `protobuf:"varint,7,opt,name=finished,proto3" json:"finished,omitempty"`
+	Start         *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=start,proto3" json:"start,omitempty"`
+	End           *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=end,proto3" json:"end,omitempty"`
+	Baseurl       string                 `protobuf:"bytes,10,opt,name=baseurl,proto3" json:"baseurl,omitempty"`
+	Requires      []string               `protobuf:"bytes,11,rep,name=requires,proto3" json:"requires,omitempty"`
+	Buildspec     *BuildSpec             `protobuf:"bytes,12,opt,name=buildspec,proto3" json:"buildspec,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Antarian) Reset() {
+	*x = Antarian{}
+	mi := &file_antares_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Antarian) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Antarian) ProtoMessage() {}
+
+func (x *Antarian) ProtoReflect() protoreflect.Message {
+	mi := &file_antares_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Antarian.ProtoReflect.Descriptor instead.
+func (*Antarian) Descriptor() ([]byte, []int) {
+	return file_antares_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Antarian) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Antarian) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Antarian) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Antarian) GetRelease() string {
+	if x != nil {
+		return x.Release
+	}
+	return ""
+}
+
+func (x *Antarian) GetUri() string {
+	if x != nil {
+		return x.Uri
+	}
+	return ""
+}
+
+func (x *Antarian) GetRunning() bool {
+	if x != nil {
+		return x.Running
+	}
+	return false
+}
+
+func (x *Antarian) GetFinished() bool {
+	if x != nil {
+		return x.Finished
+	}
+	return false
+}
+
+func (x *Antarian) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *Antarian) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *Antarian) GetBaseurl() string {
+	if x != nil {
+		return x.Baseurl
+	}
+	return ""
+}
+
+func (x *Antarian) GetRequires() []string {
+	if x != nil {
+		return x.Requires
+	}
+	return nil
+}
+
+func (x *Antarian) GetBuildspec() *BuildSpec {
+	if x != nil {
+		return x.Buildspec
+	}
+	return nil
+}
+
+type BuildSpec struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Command       string                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BuildSpec) Reset() {
+	*x = BuildSpec{}
+	mi := &file_antares_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BuildSpec) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BuildSpec) ProtoMessage() {}
+
+func (x *BuildSpec) ProtoReflect() protoreflect.Message {
+	mi := &file_antares_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BuildSpec.ProtoReflect.Descriptor instead.
+func (*BuildSpec) Descriptor() ([]byte, []int) {
+	return file_antares_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BuildSpec) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+type Build struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	AntarianId    string                 `protobuf:"bytes,2,opt,name=antarian_id,json=antarianId,proto3" json:"antarian_id,omitempty"`
+	Name          string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	Version       string                 `protobuf:"bytes,4,opt,name=version,proto3" json:"version,omitempty"`
+	State         string                 `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	Start         *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=start,proto3" json:"start,omitempty"`
+	End           *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=end,proto3" json:"end,omitempty"`
+	Running       bool                   `protobuf:"varint,8,opt,name=running,proto3" json:"running,omitempty"`
+	ExitCode      int32                  `protobuf:"varint,9,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	Error         string                 `protobuf:"bytes,10,opt,name=error,proto3" json:"error,omitempty"`
+	Log           string                 `protobuf:"bytes,11,opt,name=log,proto3" json:"log,omitempty"`
+	LogFile       string                 `protobuf:"bytes,12,opt,name=log_file,json=logFile,proto3" json:"log_file,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Build) Reset() {
+	*x = Build{}
+	mi := &file_antares_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Build) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Build) ProtoMessage() {}
+
+func (x *Build) ProtoReflect() protoreflect.Message {
+	mi := &file_antares_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Build.ProtoReflect.Descriptor instead.
+func (*Build) Descriptor() ([]byte, []int) {
+	return file_antares_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Build) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Build) GetAntarianId() string {
+	if x != nil {
+		return x.AntarianId
+	}
+	return ""
+}
+
+func (x *Build) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Build) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Build) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Build) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *Build) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *Build) GetRunning() bool {
+	if x != nil {
+		return x.Running
+	}
+	return false
+}
+
+func (x *Build) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *Build) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Build) GetLog() string {
+	if x != nil {
+		return x.Log
+	}
+	return ""
+}
+
+func (x *Build) GetLogFile() string {
+	if x != nil {
+		return x.LogFile
+	}
+	return ""
+}
+
+type CreateAntarianRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Antarian      *Antarian              `protobuf:"bytes,1,opt,name=antarian,proto3" json:"antarian,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateAntarianRequest) Reset() {
+	*x = CreateAntarianRequest{}
+	mi := &file_antares_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateAntarianRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateAntarianRequest) ProtoMessage() {}
+
+func (x *CreateAntarianRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_antares_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateAntarianRequest.ProtoReflect.Descriptor instead.
+func (*CreateAntarianRequest) Descriptor() ([]byte, []int) {
+	return file_antares_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CreateAntarianRequest) GetAntarian() *Antarian {
+	if x != nil {
+		return x.Antarian
+	}
+	return nil
+}
+
+type GetAntarianRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetAntarianRequest) Reset() {
+	*x = GetAntarianRequest{}
+	mi := &file_antares_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetAntarianRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetAntarianRequest) ProtoMessage() {}
+
+func (x *GetAntarianRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_antares_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetAntarianRequest.ProtoReflect.Descriptor instead.
+func (*GetAntarianRequest) Descriptor() ([]byte, []int) {
+	return file_antares_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetAntarianRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListAntariansRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAntariansRequest) Reset() {
+	*x = ListAntariansRequest{}
+	mi := &file_antares_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAntariansRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAntariansRequest) ProtoMessage() {}
+
+func (x *ListAntariansRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_antares_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAntariansRequest.ProtoReflect.Descriptor instead.
+func (*ListAntariansRequest) Descriptor() ([]byte, []int) {
+	return file_antares_proto_rawDescGZIP(), []int{5}
+}
+
+type TriggerBuildRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AntarianId    string                 `protobuf:"bytes,1,opt,name=antarian_id,json=antarianId,proto3" json:"antarian_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TriggerBuildRequest) Reset() {
+	*x = TriggerBuildRequest{}
+	mi := &file_antares_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TriggerBuildRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TriggerBuildRequest) ProtoMessage() {}
+
+func (x *TriggerBuildRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_antares_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TriggerBuildRequest.ProtoReflect.Descriptor instead.
+func (*TriggerBuildRequest) Descriptor() ([]byte, []int) {
+	return file_antares_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TriggerBuildRequest) GetAntarianId() string {
+	if x != nil {
+		return x.AntarianId
+	}
+	return ""
+}
+
+type TriggerBuildResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Build *Build                 `protobuf:"bytes,1,opt,name=build,proto3" json:"build,omitempty"`
+	// queue_position is the build's 1-based position in the build queue.
+	QueuePosition int32 `protobuf:"varint,2,opt,name=queue_position,json=queuePosition,proto3" json:"queue_position,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TriggerBuildResponse) Reset() {
+	*x = TriggerBuildResponse{}
+	mi := &file_antares_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TriggerBuildResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TriggerBuildResponse) ProtoMessage() {}
+
+func (x *TriggerBuildResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_antares_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TriggerBuildResponse.ProtoReflect.Descriptor instead.
+func (*TriggerBuildResponse) Descriptor() ([]byte, []int) {
+	return file_antares_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TriggerBuildResponse) GetBuild() *Build {
+	if x != nil {
+		return x.Build
+	}
+	return nil
+}
+
+func (x *TriggerBuildResponse) GetQueuePosition() int32 {
+	if x != nil {
+		return x.QueuePosition
+	}
+	return 0
+}
+
+type WatchBuildRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BuildId       string                 `protobuf:"bytes,1,opt,name=build_id,json=buildId,proto3" json:"build_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchBuildRequest) Reset() {
+	*x = WatchBuildRequest{}
+	mi := &file_antares_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchBuildRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchBuildRequest) ProtoMessage() {}
+
+func (x *WatchBuildRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_antares_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchBuildRequest.ProtoReflect.Descriptor instead.
+func (*WatchBuildRequest) Descriptor() ([]byte, []int) {
+	return file_antares_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *WatchBuildRequest) GetBuildId() string {
+	if x != nil {
+		return x.BuildId
+	}
+	return ""
+}
+
+var File_antares_proto protoreflect.FileDescriptor
+
+const file_antares_proto_rawDesc = "" +
+	"\n" +
+	"\rantares.proto\x12\n" +
+	"antares.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xf5\x02\n" +
+	"\bAntarian\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\tR\aversion\x12\x18\n" +
+	"\arelease\x18\x04 \x01(\tR\arelease\x12\x10\n" +
+	"\x03uri\x18\x05 \x01(\tR\x03uri\x12\x18\n" +
+	"\arunning\x18\x06 \x01(\bR\arunning\x12\x1a\n" +
+	"\bfinished\x18\a \x01(\bR\bfinished\x120\n" +
+	"\x05start\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12,\n" +
+	"\x03end\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\x03end\x12\x18\n" +
+	"\abaseurl\x18\n" +
+	" \x01(\tR\abaseurl\x12\x1a\n" +
+	"\brequires\x18\v \x03(\tR\brequires\x123\n" +
+	"\tbuildspec\x18\f \x01(\v2\x15.antares.v1.BuildSpecR\tbuildspec\"%\n" +
+	"\tBuildSpec\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\tR\acommand\"\xd6\x02\n" +
+	"\x05Build\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1f\n" +
+	"\vantarian_id\x18\x02 \x01(\tR\n" +
+	"antarianId\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\tR\aversion\x12\x14\n" +
+	"\x05state\x18\x05 \x01(\tR\x05state\x120\n" +
+	"\x05start\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12,\n" +
+	"\x03end\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\x03end\x12\x18\n" +
+	"\arunning\x18\b \x01(\bR\arunning\x12\x1b\n" +
+	"\texit_code\x18\t \x01(\x05R\bexitCode\x12\x14\n" +
+	"\x05error\x18\n" +
+	" \x01(\tR\x05error\x12\x10\n" +
+	"\x03log\x18\v \x01(\tR\x03log\x12\x19\n" +
+	"\blog_file\x18\f \x01(\tR\alogFile\"I\n" +
+	"\x15CreateAntarianRequest\x120\n" +
+	"\bantarian\x18\x01 \x01(\v2\x14.antares.v1.AntarianR\bantarian\"$\n" +
+	"\x12GetAntarianRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x16\n" +
+	"\x14ListAntariansRequest\"6\n" +
+	"\x13TriggerBuildRequest\x12\x1f\n" +
+	"\vantarian_id\x18\x01 \x01(\tR\n" +
+	"antarianId\"f\n" +
+	"\x14TriggerBuildResponse\x12'\n" +
+	"\x05build\x18\x01 \x01(\v2\x11.antares.v1.BuildR\x05build\x12%\n" +
+	"\x0equeue_position\x18\x02 \x01(\x05R\rqueuePosition\".\n" +
+	"\x11WatchBuildRequest\x12\x19\n" +
+	"\bbuild_id\x18\x01 \x01(\tR\abuildId2\xf9\x02\n" +
+	"\aAntares\x12I\n" +
+	"\x0eCreateAntarian\x12!.antares.v1.CreateAntarianRequest\x1a\x14.antares.v1.Antarian\x12C\n" +
+	"\vGetAntarian\x12\x1e.antares.v1.GetAntarianRequest\x1a\x14.antares.v1.Antarian\x12I\n" +
+	"\rListAntarians\x12 .antares.v1.ListAntariansRequest\x1a\x14.antares.v1.Antarian0\x01\x12Q\n" +
+	"\fTriggerBuild\x12\x1f.antares.v1.TriggerBuildRequest\x1a .antares.v1.TriggerBuildResponse\x12@\n" +
+	"\n" +
+	"WatchBuild\x12\x1d.antares.v1.WatchBuildRequest\x1a\x11.antares.v1.Build0\x01B!Z\x1fgithub.com/xbcsmith/antares/rpcb\x06proto3"
+
+var (
+	file_antares_proto_rawDescOnce sync.Once
+	file_antares_proto_rawDescData []byte
+)
+
+func file_antares_proto_rawDescGZIP() []byte {
+	file_antares_proto_rawDescOnce.Do(func() {
+		file_antares_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_antares_proto_rawDesc), len(file_antares_proto_rawDesc)))
+	})
+	return file_antares_proto_rawDescData
+}
+
+var file_antares_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_antares_proto_goTypes = []any{
+	(*Antarian)(nil),              // 0: antares.v1.Antarian
+	(*BuildSpec)(nil),             // 1: antares.v1.BuildSpec
+	(*Build)(nil),                 // 2: antares.v1.Build
+	(*CreateAntarianRequest)(nil), // 3: antares.v1.CreateAntarianRequest
+	(*GetAntarianRequest)(nil),    // 4: antares.v1.GetAntarianRequest
+	(*ListAntariansRequest)(nil),  // 5: antares.v1.ListAntariansRequest
+	(*TriggerBuildRequest)(nil),   // 6: antares.v1.TriggerBuildRequest
+	(*TriggerBuildResponse)(nil),  // 7: antares.v1.TriggerBuildResponse
+	(*WatchBuildRequest)(nil),     // 8: antares.v1.WatchBuildRequest
+	(*timestamppb.Timestamp)(nil), // 9: google.protobuf.Timestamp
+}
+var file_antares_proto_depIdxs = []int32{
+	9,  // 0: antares.v1.Antarian.start:type_name -> google.protobuf.Timestamp
+	9,  // 1: antares.v1.Antarian.end:type_name -> google.protobuf.Timestamp
+	1,  // 2: antares.v1.Antarian.buildspec:type_name -> antares.v1.BuildSpec
+	9,  // 3: antares.v1.Build.start:type_name -> google.protobuf.Timestamp
+	9,  // 4: antares.v1.Build.end:type_name -> google.protobuf.Timestamp
+	0,  // 5: antares.v1.CreateAntarianRequest.antarian:type_name -> antares.v1.Antarian
+	2,  // 6: antares.v1.TriggerBuildResponse.build:type_name -> antares.v1.Build
+	3,  // 7: antares.v1.Antares.CreateAntarian:input_type -> antares.v1.CreateAntarianRequest
+	4,  // 8: antares.v1.Antares.GetAntarian:input_type -> antares.v1.GetAntarianRequest
+	5,  // 9: antares.v1.Antares.ListAntarians:input_type -> antares.v1.ListAntariansRequest
+	6,  // 10: antares.v1.Antares.TriggerBuild:input_type -> antares.v1.TriggerBuildRequest
+	8,  // 11: antares.v1.Antares.WatchBuild:input_type -> antares.v1.WatchBuildRequest
+	0,  // 12: antares.v1.Antares.CreateAntarian:output_type -> antares.v1.Antarian
+	0,  // 13: antares.v1.Antares.GetAntarian:output_type -> antares.v1.Antarian
+	0,  // 14: antares.v1.Antares.ListAntarians:output_type -> antares.v1.Antarian
+	7,  // 15: antares.v1.Antares.TriggerBuild:output_type -> antares.v1.TriggerBuildResponse
+	2,  // 16: antares.v1.Antares.WatchBuild:output_type -> antares.v1.Build
+	12, // [12:17] is the sub-list for method output_type
+	7,  // [7:12] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_antares_proto_init() }
+func file_antares_proto_init() {
+	if File_antares_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_antares_proto_rawDesc), len(file_antares_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_antares_proto_goTypes,
+		DependencyIndexes: file_antares_proto_depIdxs,
+		MessageInfos:      file_antares_proto_msgTypes,
+	}.Build()
+	File_antares_proto = out.File
+	file_antares_proto_goTypes = nil
+	file_antares_proto_depIdxs = nil
+}
@@ -0,0 +1,290 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: antares.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Antares_CreateAntarian_FullMethodName = "/antares.v1.Antares/CreateAntarian"
+	Antares_GetAntarian_FullMethodName    = "/antares.v1.Antares/GetAntarian"
+	Antares_ListAntarians_FullMethodName  = "/antares.v1.Antares/ListAntarians"
+	Antares_TriggerBuild_FullMethodName   = "/antares.v1.Antares/TriggerBuild"
+	Antares_WatchBuild_FullMethodName     = "/antares.v1.Antares/WatchBuild"
+)
+
+// AntaresClient is the client API for Antares service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Antares mirrors the REST API. Requests are authenticated with the same
+// bearer tokens, sent in the "authorization" metadata key.
+type AntaresClient interface {
+	CreateAntarian(ctx context.Context, in *CreateAntarianRequest, opts ...grpc.CallOption) (*Antarian, error)
+	GetAntarian(ctx context.Context, in *GetAntarianRequest, opts ...grpc.CallOption) (*Antarian, error)
+	ListAntarians(ctx context.Context, in *ListAntariansRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Antarian], error)
+	TriggerBuild(ctx context.Context, in *TriggerBuildRequest, opts ...grpc.CallOption) (*TriggerBuildResponse, error)
+	// WatchBuild sends the build's current record and then every state change
+	// until the build is finished.
+	WatchBuild(ctx context.Context, in *WatchBuildRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Build], error)
+}
+
+type antaresClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAntaresClient(cc grpc.ClientConnInterface) AntaresClient {
+	return &antaresClient{cc}
+}
+
+func (c *antaresClient) CreateAntarian(ctx context.Context, in *CreateAntarianRequest, opts ...grpc.CallOption) (*Antarian, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Antarian)
+	err := c.cc.Invoke(ctx, Antares_CreateAntarian_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *antaresClient) GetAntarian(ctx context.Context, in *GetAntarianRequest, opts ...grpc.CallOption) (*Antarian, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Antarian)
+	err := c.cc.Invoke(ctx, Antares_GetAntarian_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *antaresClient) ListAntarians(ctx context.Context, in *ListAntariansRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Antarian], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Antares_ServiceDesc.Streams[0], Antares_ListAntarians_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListAntariansRequest, Antarian]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Antares_ListAntariansClient = grpc.ServerStreamingClient[Antarian]
+
+func (c *antaresClient) TriggerBuild(ctx context.Context, in *TriggerBuildRequest, opts ...grpc.CallOption) (*TriggerBuildResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TriggerBuildResponse)
+	err := c.cc.Invoke(ctx, Antares_TriggerBuild_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *antaresClient) WatchBuild(ctx context.Context, in *WatchBuildRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Build], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Antares_ServiceDesc.Streams[1], Antares_WatchBuild_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchBuildRequest, Build]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Antares_WatchBuildClient = grpc.ServerStreamingClient[Build]
+
+// AntaresServer is the server API for Antares service.
+// All implementations must embed UnimplementedAntaresServer
+// for forward compatibility.
+//
+// Antares mirrors the REST API. Requests are authenticated with the same
+// bearer tokens, sent in the "authorization" metadata key.
+type AntaresServer interface {
+	CreateAntarian(context.Context, *CreateAntarianRequest) (*Antarian, error)
+	GetAntarian(context.Context, *GetAntarianRequest) (*Antarian, error)
+	ListAntarians(*ListAntariansRequest, grpc.ServerStreamingServer[Antarian]) error
+	TriggerBuild(context.Context, *TriggerBuildRequest) (*TriggerBuildResponse, error)
+	// WatchBuild sends the build's current record and then every state change
+	// until the build is finished.
+	WatchBuild(*WatchBuildRequest, grpc.ServerStreamingServer[Build]) error
+	mustEmbedUnimplementedAntaresServer()
+}
+
+// UnimplementedAntaresServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAntaresServer struct{}
+
+func (UnimplementedAntaresServer) CreateAntarian(context.Context, *CreateAntarianRequest) (*Antarian, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAntarian not implemented")
+}
+func (UnimplementedAntaresServer) GetAntarian(context.Context, *GetAntarianRequest) (*Antarian, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAntarian not implemented")
+}
+func (UnimplementedAntaresServer) ListAntarians(*ListAntariansRequest, grpc.ServerStreamingServer[Antarian]) error {
+	return status.Errorf(codes.Unimplemented, "method ListAntarians not implemented")
+}
+func (UnimplementedAntaresServer) TriggerBuild(context.Context, *TriggerBuildRequest) (*TriggerBuildResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerBuild not implemented")
+}
+func (UnimplementedAntaresServer) WatchBuild(*WatchBuildRequest, grpc.ServerStreamingServer[Build]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchBuild not implemented")
+}
+func (UnimplementedAntaresServer) mustEmbedUnimplementedAntaresServer() {}
+func (UnimplementedAntaresServer) testEmbeddedByValue()                 {}
+
+// UnsafeAntaresServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AntaresServer will
+// result in compilation errors.
+type UnsafeAntaresServer interface {
+	mustEmbedUnimplementedAntaresServer()
+}
+
+func RegisterAntaresServer(s grpc.ServiceRegistrar, srv AntaresServer) {
+	// If the following call pancis, it indicates UnimplementedAntaresServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Antares_ServiceDesc, srv)
+}
+
+func _Antares_CreateAntarian_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAntarianRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AntaresServer).CreateAntarian(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Antares_CreateAntarian_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AntaresServer).CreateAntarian(ctx, req.(*CreateAntarianRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Antares_GetAntarian_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAntarianRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AntaresServer).GetAntarian(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Antares_GetAntarian_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AntaresServer).GetAntarian(ctx, req.(*GetAntarianRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Antares_ListAntarians_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListAntariansRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AntaresServer).ListAntarians(m, &grpc.GenericServerStream[ListAntariansRequest, Antarian]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Antares_ListAntariansServer = grpc.ServerStreamingServer[Antarian]
+
+func _Antares_TriggerBuild_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerBuildRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AntaresServer).TriggerBuild(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Antares_TriggerBuild_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AntaresServer).TriggerBuild(ctx, req.(*TriggerBuildRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Antares_WatchBuild_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchBuildRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AntaresServer).WatchBuild(m, &grpc.GenericServerStream[WatchBuildRequest, Build]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Antares_WatchBuildServer = grpc.ServerStreamingServer[Build]
+
+// Antares_ServiceDesc is the grpc.ServiceDesc for Antares service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Antares_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "antares.v1.Antares",
+	HandlerType: (*AntaresServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateAntarian",
+			Handler:    _Antares_CreateAntarian_Handler,
+		},
+		{
+			MethodName: "GetAntarian",
+			Handler:    _Antares_GetAntarian_Handler,
+		},
+		{
+			MethodName: "TriggerBuild",
+			Handler:    _Antares_TriggerBuild_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListAntarians",
+			Handler:       _Antares_ListAntarians_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchBuild",
+			Handler:       _Antares_WatchBuild_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "antares.proto",
+}
@@ -0,0 +1,116 @@
+// Package rpc holds the gRPC definition of the Antares API and the
+// conversions between its messages and the lib types.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative antares.proto
+
+import (
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// FromAntarian converts a to its message form.
+func FromAntarian(a lib.Antarian) *Antarian {
+	m := &Antarian{
+		Id:       a.Id,
+		Name:     a.Name,
+		Version:  a.Version,
+		Release:  a.Release,
+		Uri:      a.Uri,
+		Running:  a.Running,
+		Finished: a.Finished,
+		Start:    timestamp(a.Start),
+		End:      timestamp(a.End),
+		Baseurl:  a.BaseUrl,
+		Requires: a.Requires,
+	}
+	if a.BuildSpec != nil {
+		m.Buildspec = &BuildSpec{Command: a.BuildSpec.Command}
+	}
+	return m
+}
+
+// ToAntarian converts m back to a lib.Antarian. A nil message gives the
+// zero Antarian.
+func ToAntarian(m *Antarian) lib.Antarian {
+	if m == nil {
+		return lib.Antarian{}
+	}
+	a := lib.Antarian{
+		Id:       m.GetId(),
+		Name:     m.GetName(),
+		Version:  m.GetVersion(),
+		Release:  m.GetRelease(),
+		Uri:      m.GetUri(),
+		Running:  m.GetRunning(),
+		Finished: m.GetFinished(),
+		Start:    fromTimestamp(m.GetStart()),
+		End:      fromTimestamp(m.GetEnd()),
+		BaseUrl:  m.GetBaseurl(),
+		Requires: m.GetRequires(),
+	}
+	// the message predates Status
+	a.Status = lib.LegacyStatus(a.Running, a.Finished)
+	if m.Buildspec != nil {
+		a.BuildSpec = &lib.BuildSpec{Command: m.Buildspec.GetCommand()}
+	}
+	return a
+}
+
+// FromBuild converts b to its message form.
+func FromBuild(b lib.Build) *Build {
+	return &Build{
+		Id:         b.Id,
+		AntarianId: b.AntarianId,
+		Name:       b.Name,
+		Version:    b.Version,
+		State:      string(b.State),
+		Start:      timestamp(b.Start),
+		End:        timestamp(b.End),
+		Running:    b.Running,
+		ExitCode:   int32(b.ExitCode),
+		Error:      b.Error,
+		Log:        b.Log,
+		LogFile:    b.LogFile,
+	}
+}
+
+// ToBuild converts m back to a lib.Build. A nil message gives the zero
+// Build.
+func ToBuild(m *Build) lib.Build {
+	if m == nil {
+		return lib.Build{}
+	}
+	return lib.Build{
+		Id:         m.GetId(),
+		AntarianId: m.GetAntarianId(),
+		Name:       m.GetName(),
+		Version:    m.GetVersion(),
+		State:      lib.BuildState(m.GetState()),
+		Start:      fromTimestamp(m.GetStart()),
+		End:        fromTimestamp(m.GetEnd()),
+		Running:    m.GetRunning(),
+		ExitCode:   int(m.GetExitCode()),
+		Error:      m.GetError(),
+		Log:        m.GetLog(),
+		LogFile:    m.GetLogFile(),
+	}
+}
+
+// timestamp leaves unset times unset, so the zero time survives a round
+// trip instead of becoming the Unix epoch.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func fromTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
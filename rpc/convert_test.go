@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+	"google.golang.org/protobuf/proto"
+)
+
+var start = time.Date(2024, 3, 1, 12, 30, 15, 123456789, time.UTC)
+
+// wire sends m through its binary encoding, as a gRPC call would.
+func wire[M proto.Message](t *testing.T, m M, into M) M {
+	t.Helper()
+	raw, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proto.Unmarshal(raw, into); err != nil {
+		t.Fatal(err)
+	}
+	return into
+}
+
+// carried keeps the fields of a that the message carries, with the Status
+// they imply, which is what a round trip gives back.
+func carried(a lib.Antarian) lib.Antarian {
+	c := lib.Antarian{
+		Id:       a.Id,
+		Name:     a.Name,
+		Version:  a.Version,
+		Release:  a.Release,
+		Uri:      a.Uri,
+		Running:  a.Running,
+		Finished: a.Finished,
+		Start:    a.Start,
+		End:      a.End,
+		BaseUrl:  a.BaseUrl,
+		Status:   lib.LegacyStatus(a.Running, a.Finished),
+	}
+	if len(a.Requires) > 0 {
+		c.Requires = a.Requires
+	}
+	if a.BuildSpec != nil {
+		c.BuildSpec = &lib.BuildSpec{Command: a.BuildSpec.Command}
+	}
+	return c
+}
+
+func TestAntarianRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		a    lib.Antarian
+	}{
+		{"complete", lib.Antarian{
+			Id: "a1", Name: "libfoo", Version: "1.2.3", Release: "20240301.1", Uri: "https://antares.example.com/v1/antarians/a1",
+			Running: false, Finished: true, Status: lib.StatusSucceeded, Start: start, End: start.Add(90 * time.Second),
+			BaseUrl: "https://antares.example.com", Requires: []string{"libbar", "libbaz"},
+			BuildSpec: &lib.BuildSpec{Command: "make install"},
+		}},
+		{"zero times", lib.Antarian{Id: "a2", Name: "libfoo", Version: "1.0.0", Running: true}},
+		{"no requires", lib.Antarian{Id: "a3", Name: "libfoo", Requires: []string{}}},
+		{"empty buildspec", lib.Antarian{Id: "a4", Name: "libfoo", BuildSpec: &lib.BuildSpec{}}},
+		{"zero", lib.Antarian{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ToAntarian(wire(t, FromAntarian(tt.a), &Antarian{}))
+			if want := carried(tt.a); !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip = %+v\nwant %+v", got, want)
+			}
+			if got.Start.IsZero() != tt.a.Start.IsZero() {
+				t.Errorf("start %v came back as %v", tt.a.Start, got.Start)
+			}
+		})
+	}
+
+	if got := ToAntarian(nil); !reflect.DeepEqual(got, lib.Antarian{}) {
+		t.Errorf("ToAntarian(nil) = %+v, want the zero Antarian", got)
+	}
+}
+
+func TestBuildRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		b    lib.Build
+	}{
+		{"finished", lib.Build{
+			Id: "b1", AntarianId: "a1", Name: "libfoo", Version: "1.2.3", State: lib.BuildFailed,
+			Start: start, End: start.Add(time.Minute), ExitCode: 2, Error: "exit status 2",
+			Log: "compiling\nerror: missing header\n", LogFile: "/var/lib/antares/builds/b1/build.log",
+		}},
+		{"running", lib.Build{Id: "b2", AntarianId: "a1", State: lib.BuildRunning, Start: start, Running: true, ExitCode: -1}},
+		{"queued", lib.Build{Id: "b3", State: lib.BuildQueued, ExitCode: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ToBuild(wire(t, FromBuild(tt.b), &Build{}))
+			if !reflect.DeepEqual(got, tt.b) {
+				t.Errorf("round trip = %+v\nwant %+v", got, tt.b)
+			}
+		})
+	}
+
+	if got := ToBuild(nil); !reflect.DeepEqual(got, lib.Build{}) {
+		t.Errorf("ToBuild(nil) = %+v, want the zero Build", got)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// purgeResult counts what AdminPurge removed.
+type purgeResult struct {
+	Antarians int `json:"antarians"`
+	Builds    int `json:"builds"`
+	Artifacts int `json:"artifacts"`
+}
+
+// AdminPurge removes every Antarian, build record and, unless
+// ?keep_artifacts=true, every artifact file. It is refused unless the server
+// was started with allow_destructive_admin.
+func AdminPurge(d *Deps) http.HandlerFunc {
+	var mu sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !d.Config.AllowDestructiveAdmin {
+			writeError(d, w, r, http.StatusForbidden, "purge is disabled; start the server with allow_destructive_admin")
+			return
+		}
+		keep := false
+		if v := r.URL.Query().Get("keep_artifacts"); v != "" {
+			var err error
+			if keep, err = strconv.ParseBool(v); err != nil {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("keep_artifacts: %q is not a boolean", v))
+				return
+			}
+		}
+
+		// one purge at a time, so two requests never race over the files
+		mu.Lock()
+		defer mu.Unlock()
+
+		var res purgeResult
+		var err error
+		res.Antarians, res.Builds, err = d.repo(r.Context()).Purge()
+		if err != nil {
+			internalError(d, w, r, "purge store", err)
+			return
+		}
+		if !keep {
+			res.Artifacts, err = purgeArtifacts(d, r)
+		}
+
+		log := requestLogger(d.Logger, r)
+		log.Warn("purged store", "antarians", res.Antarians, "builds", res.Builds, "artifacts", res.Artifacts, "keep_artifacts", keep)
+		e := requestAudit(r, lib.AuditStorePurge)
+		e.Before = fmt.Sprintf("%d antarians, %d builds, %d artifacts", res.Antarians, res.Builds, res.Artifacts)
+		audit(r.Context(), d, e)
+
+		if err != nil {
+			log.Error("purge artifacts", "err", err, "removed", res.Artifacts)
+			writeError(d, w, r, http.StatusInternalServerError, fmt.Sprintf("removed %d artifacts before failing: %v", res.Artifacts, err))
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, res)
+	}
+}
+
+// purgeArtifacts deletes every stored file and returns how many it removed.
+func purgeArtifacts(d *Deps, r *http.Request) (int, error) {
+	files, err := d.Storage.List(r.Context(), "")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range files {
+		if err := d.Storage.Delete(r.Context(), f.Id, f.Name); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
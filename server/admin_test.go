@@ -0,0 +1,182 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// files counts the artifact files stored under dir.
+func files(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestAdminPurgeGuard(t *testing.T) {
+	s, ts := newTestServer(t, func(c *config.Config) {
+		c.Tokens = []string{"writer"}
+		c.AdminTokens = []string{"adm"}
+	})
+	var a lib.Antarian
+	call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "libfoo", Version: "1.0.0"}, &a, "Authorization", "Bearer writer")
+
+	tests := []struct {
+		token  string
+		status int
+	}{
+		{"adm", http.StatusForbidden},
+		{"writer", http.StatusForbidden},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		var apiErr APIError
+		if status := call(t, ts, "DELETE", "/v1/admin/antarians", nil, &apiErr, "Authorization", "Bearer "+tt.token); status != tt.status {
+			t.Errorf("purge with %q = %d, want %d", tt.token, status, tt.status)
+		}
+	}
+	if _, err := s.Deps().Repo.FindAntarian(a.Id); err != nil {
+		t.Errorf("a refused purge removed %s: %v", a.Id, err)
+	}
+}
+
+func TestAdminPurge(t *testing.T) {
+	tests := []struct {
+		query     string
+		artifacts int
+		kept      int
+	}{
+		{"", 2, 0},
+		{"?keep_artifacts=true", 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run("purge"+tt.query, func(t *testing.T) {
+			s, ts := newTestServer(t, func(c *config.Config) {
+				c.AdminTokens = []string{"adm"}
+				c.AllowDestructiveAdmin = true
+			})
+			var antarians []lib.Antarian
+			call(t, ts, "GET", "/v1/antarians", nil, &antarians)
+			seeded := len(antarians)
+			for i := 0; i < 3; i++ {
+				var a lib.Antarian
+				call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "libfoo", Version: fmt.Sprintf("1.0.%d", i)}, &a)
+				if i < 2 {
+					if status := call(t, ts, "POST", "/v1/antarians/"+a.Id+"/artifact", "artifact", nil, "Content-Type", "application/octet-stream"); status != http.StatusCreated {
+						t.Fatalf("upload = %d", status)
+					}
+					continue
+				}
+				var b lib.Build
+				call(t, ts, "POST", "/v1/antarians/"+a.Id+"/build", nil, &b)
+				waitBuild(t, ts, b.Id)
+			}
+
+			var res purgeResult
+			if status := call(t, ts, "DELETE", "/v1/admin/antarians"+tt.query, nil, &res, "Authorization", "Bearer adm"); status != http.StatusOK {
+				t.Fatalf("purge = %d", status)
+			}
+			if want := (purgeResult{Antarians: seeded + 3, Builds: 1, Artifacts: tt.artifacts}); res != want {
+				t.Errorf("purge = %+v, want %+v", res, want)
+			}
+			call(t, ts, "GET", "/v1/antarians", nil, &antarians)
+			var builds []lib.Build
+			call(t, ts, "GET", "/v1/builds", nil, &builds)
+			if len(antarians) != 0 || len(builds) != 0 {
+				t.Errorf("after the purge %d antarians and %d builds remain", len(antarians), len(builds))
+			}
+			if n := files(t, s.Deps().Config.ArtifactDir); n != tt.kept {
+				t.Errorf("%d artifact files on disk, want %d", n, tt.kept)
+			}
+		})
+	}
+
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.AdminTokens = []string{"adm"}
+		c.AllowDestructiveAdmin = true
+	})
+	if status := call(t, ts, "DELETE", "/v1/admin/antarians?keep_artifacts=maybe", nil, nil, "Authorization", "Bearer adm"); status != http.StatusBadRequest {
+		t.Errorf("purge with keep_artifacts=maybe = %d, want 400", status)
+	}
+}
+
+func TestAdminPurgeConcurrent(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.AdminTokens = []string{"adm"}
+		c.AllowDestructiveAdmin = true
+	})
+	var seed []lib.Antarian
+	call(t, ts, "GET", "/v1/antarians", nil, &seed)
+
+	const writers, creates, purges = 4, 25, 5
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	removed := 0
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < creates; i++ {
+				if status := call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: fmt.Sprintf("lib%d", w), Version: fmt.Sprintf("1.0.%d", i)}, nil); status != http.StatusCreated {
+					t.Errorf("create during a purge = %d", status)
+				}
+			}
+		}(w)
+	}
+	for p := 0; p < purges; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			time.Sleep(time.Duration(p) * 5 * time.Millisecond)
+			var res purgeResult
+			if status := call(t, ts, "DELETE", "/v1/admin/antarians", nil, &res, "Authorization", "Bearer adm"); status != http.StatusOK {
+				t.Errorf("concurrent purge = %d", status)
+			}
+			mu.Lock()
+			removed += res.Antarians
+			mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	// every Antarian was removed by exactly one purge or is still there
+	var left []lib.Antarian
+	call(t, ts, "GET", "/v1/antarians", nil, &left)
+	if total := len(seed) + writers*creates; removed+len(left) != total {
+		t.Errorf("purges removed %d and %d remain, want %d in all", removed, len(left), total)
+	}
+}
+
+// waitBuild waits for the build id to finish.
+func waitBuild(t *testing.T, ts *httptest.Server, id string) lib.Build {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var b lib.Build
+		call(t, ts, "GET", "/v1/builds/"+id, nil, &b)
+		if b.State.Done() {
+			return b
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("build %s still %s", id, b.State)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
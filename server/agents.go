@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// agentRequest registers an agent.
+type agentRequest struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+}
+
+// AgentRegister adds a remote build agent. The agent then leases builds
+// with AgentLease and keeps itself online with AgentHeartbeat.
+func AgentRegister(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req agentRequest
+		if err := decodeJSON(d, r, &req); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		if req.Name == "" {
+			writeDecodeError(d, w, r, &lib.ValidationError{Field: "name", Message: "must not be empty"})
+			return
+		}
+		a, err := d.Builds.Register(req.Name, req.Hostname)
+		if err != nil {
+			writeAgentError(d, w, r, err)
+			return
+		}
+		e := requestAudit(r, lib.AuditAgentRegister)
+		e.After = a.Id + " " + a.Name
+		audit(r.Context(), d, e)
+		writeJSON(d, w, r, http.StatusCreated, a)
+	}
+}
+
+// AgentIndex lists the registered agents, online and offline.
+func AgentIndex(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(d, w, r, http.StatusOK, d.Builds.Agents())
+	}
+}
+
+// AgentHeartbeat keeps an agent online and tells it which of its builds
+// were canceled. An agent marked offline is 404 and must register again.
+func AgentHeartbeat(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hb, err := d.Builds.Heartbeat(mux.Vars(r)["agentId"])
+		if err != nil {
+			writeAgentError(d, w, r, err)
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, hb)
+	}
+}
+
+// AgentLease hands the next queued build to the agent, or answers 204
+// when there is none.
+func AgentLease(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l, ok, err := d.Builds.Lease(mux.Vars(r)["agentId"])
+		if err != nil {
+			writeAgentError(d, w, r, err)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, l)
+	}
+}
+
+// AgentBuildLogs appends a batch of output lines of a leased build to its
+// log, answering like AgentHeartbeat.
+func AgentBuildLogs(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		var lines []lib.LogLine
+		if err := decodeJSON(d, r, &lines); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		hb, err := d.Builds.AppendLog(vars["agentId"], vars["buildId"], lines)
+		if err != nil {
+			writeAgentError(d, w, r, err)
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, hb)
+	}
+}
+
+// AgentBuildArtifact stores an artifact of a leased build, sent as the
+// raw body and named by ?filename=, for the build's report to record.
+func AgentBuildArtifact(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		b, err := d.Builds.Leased(vars["agentId"], vars["buildId"])
+		if err != nil {
+			writeAgentError(d, w, r, err)
+			return
+		}
+		filename := r.URL.Query().Get("filename")
+		if filename == "" {
+			writeError(d, w, r, http.StatusBadRequest, "filename: must be given")
+			return
+		}
+		if d.Config.ArtifactMaxBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, d.Config.ArtifactMaxBytes)
+		}
+		info, err := d.Storage.Put(r.Context(), b.AntarianId, filename, r.Body)
+		if err != nil {
+			writeUploadError(d, w, r, err)
+			return
+		}
+		requestLogger(d.Logger, r).Info("stored build artifact", "build_id", b.Id, "antarian_id", b.AntarianId,
+			"filename", info.Name, "size", info.Size)
+		writeJSON(d, w, r, http.StatusCreated, lib.Artifact{Id: b.AntarianId, Filename: info.Name, Size: info.Size, Checksum: info.Checksum})
+	}
+}
+
+// AgentBuildReport records the outcome of a leased build: a retry while it
+// is still running, or its end, which releases it from the agent.
+func AgentBuildReport(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		var b lib.Build
+		if err := decodeJSON(d, r, &b); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		b, err := d.Builds.Report(vars["agentId"], vars["buildId"], b)
+		if err != nil {
+			writeAgentError(d, w, r, err)
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, b)
+	}
+}
+
+// writeAgentError answers a failed agent call: 404 for an agent that must
+// register again, 409 for a build it no longer holds, 503 while shutting
+// down and 422 for a report that cannot be taken.
+func writeAgentError(d *Deps, w http.ResponseWriter, r *http.Request, err error) {
+	var ve *lib.ValidationError
+	switch {
+	case errors.Is(err, build.ErrUnknownAgent):
+		writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find agent with id of %s", mux.Vars(r)["agentId"]))
+	case errors.Is(err, build.ErrNotLeased):
+		writeError(d, w, r, http.StatusConflict, fmt.Sprintf("Build %s is not held by this agent", mux.Vars(r)["buildId"]))
+	case errors.Is(err, build.ErrShutdown):
+		writeError(d, w, r, http.StatusServiceUnavailable, err.Error())
+	case errors.As(err, &ve):
+		writeDecodeError(d, w, r, err)
+	default:
+		internalError(d, w, r, "agent", err)
+	}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/storage"
+)
+
+// AntarianArtifactUpload stores the artifact of an Antarian and records its
+// name, size and sha256 on it, replacing any earlier upload. The file is
+// the raw request body, named by ?filename=, or the "file" part of a
+// multipart/form-data body, named by its filename; either way it defaults
+// to the Antarian's Filename. With ?platform= naming another platform than
+// the Antarian's own, e.g. linux/arm64, it is recorded as the variant for
+// that platform instead. The body is streamed to storage, never held in
+// memory.
+func AntarianArtifactUpload(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		antarianId := mux.Vars(r)["antarianId"]
+		repo := d.repo(r.Context())
+		a, err := repo.FindAntarian(antarianId)
+		if err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "find antarian", err)
+			return
+		}
+		var goos, arch string
+		if p := r.URL.Query().Get("platform"); p != "" {
+			if goos, arch, err = lib.ParsePlatform(p); err != nil {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("platform: %v", err))
+				return
+			}
+		}
+		variant := goos != "" && (goos != a.OS || arch != a.Arch)
+		if d.Config.ArtifactMaxBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, d.Config.ArtifactMaxBytes)
+		}
+
+		filename := r.URL.Query().Get("filename")
+		var body io.Reader = r.Body
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+			part, err := artifactPart(r)
+			if err != nil {
+				writeUploadError(d, w, r, err)
+				return
+			}
+			defer part.Close()
+			if name := part.FileName(); name != "" {
+				filename = name
+			}
+			body = part
+		}
+		if filename == "" {
+			filename = a.FilenameFor(goos, arch)
+			if !variant {
+				filename = a.Filename()
+			}
+		}
+
+		info, err := d.Storage.Put(r.Context(), a.Id, filename, body)
+		if err != nil {
+			writeUploadError(d, w, r, err)
+			return
+		}
+		log := requestLogger(d.Logger, r)
+		var previous string
+		if variant {
+			previous = a.SetVariant(lib.Variant{OS: goos, Arch: arch, Artifact: info.Name, Size: info.Size, Checksum: info.Checksum})
+		} else {
+			previous = a.Artifact
+			a.Artifact, a.Size, a.Checksum = info.Name, info.Size, info.Checksum
+		}
+		if _, err := repo.UpdateAntarian(a); err != nil {
+			internalError(d, w, r, "record artifact", err)
+			return
+		}
+		// signatures and SBOMs are made by builds, and do not describe an upload
+		stale := sidecars(info.Name)
+		if previous != "" && previous != info.Name {
+			// the old file is unreachable now; leftovers are found by /admin/gc
+			stale = append(append(stale, previous), sidecars(previous)...)
+		}
+		for _, name := range stale {
+			if err := d.Storage.Delete(r.Context(), a.Id, name); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				log.Error("remove previous artifact", "err", err, "antarian_id", a.Id, "filename", name)
+			}
+		}
+		platform := a.Platform()
+		if variant {
+			platform = goos + "/" + arch
+		}
+		log.Info("uploaded artifact", "antarian_id", a.Id, "filename", info.Name, "platform", platform, "size", info.Size)
+		e := requestAudit(r, lib.AuditArtifactUpload)
+		e.AntarianId, e.After = a.Id, fmt.Sprintf("%s %d sha256:%s", info.Name, info.Size, info.Checksum)
+		audit(r.Context(), d, e)
+		writeJSON(d, w, r, http.StatusCreated, lib.Artifact{Id: a.Id, Filename: info.Name, Platform: platform, Size: info.Size, Checksum: info.Checksum})
+	}
+}
+
+// AntarianArtifactVerify reads the uploaded artifact of an Antarian back
+// from storage and reports whether its size and sha256 still match those
+// recorded on upload. The platform is chosen as for AntarianDownload. A
+// missing file is reported as invalid; an Antarian without an upload is
+// 404.
+func AntarianArtifactVerify(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		antarianId := mux.Vars(r)["antarianId"]
+		a, err := d.repo(r.Context()).FindAntarian(antarianId)
+		if err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "find antarian", err)
+			return
+		}
+		v, ok := platformArtifact(d, w, r, a)
+		if !ok {
+			return
+		}
+		if v.Checksum == "" {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Antarian %s has no uploaded artifact", antarianId))
+			return
+		}
+
+		check := lib.ArtifactCheck{Id: a.Id, Filename: v.Artifact, Platform: variantPlatform(v), Size: v.Size, Checksum: v.Checksum}
+		f, _, err := d.Storage.Get(r.Context(), a.Id, v.Artifact)
+		if errors.Is(err, storage.ErrNotFound) {
+			check.Error = "file is missing"
+		} else if err != nil {
+			internalError(d, w, r, "open artifact", err)
+			return
+		} else {
+			defer f.Close()
+			h := sha256.New()
+			n, err := io.Copy(h, f)
+			if err != nil {
+				internalError(d, w, r, "read artifact", err)
+				return
+			}
+			check.ActualSize, check.ActualChecksum = n, hex.EncodeToString(h.Sum(nil))
+			check.Valid = n == v.Size && check.ActualChecksum == v.Checksum
+		}
+		if !check.Valid {
+			requestLogger(d.Logger, r).Warn("artifact failed verification", "antarian_id", a.Id, "filename", v.Artifact,
+				"checksum", v.Checksum, "actual_checksum", check.ActualChecksum, "err", check.Error)
+		}
+		writeJSON(d, w, r, http.StatusOK, check)
+	}
+}
+
+// artifactName returns the name of a's artifact file: the uploaded one, or
+// the name builds store it under.
+func artifactName(a lib.Antarian) string {
+	if a.Artifact != "" {
+		return a.Artifact
+	}
+	return a.Filename()
+}
+
+// requestedPlatform returns the platform r asks for, by ?platform= or the
+// platform parameter of a media range of its Accept header, as in
+// "Accept: application/json; platform=linux/arm64". os is "" when it asks
+// for none.
+func requestedPlatform(r *http.Request) (os, arch string, err error) {
+	if p := r.URL.Query().Get("platform"); p != "" {
+		return lib.ParsePlatform(p)
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if p, ok := params["platform"]; ok {
+			return lib.ParsePlatform(p)
+		}
+	}
+	return "", "", nil
+}
+
+// platformArtifact returns the artifact of a for the platform r asks for:
+// its main artifact, for none or its own, else the variant for it. It
+// answers 400 or 404 itself when it cannot.
+func platformArtifact(d *Deps, w http.ResponseWriter, r *http.Request, a lib.Antarian) (lib.Variant, bool) {
+	goos, arch, err := requestedPlatform(r)
+	if err != nil {
+		writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("platform: %v", err))
+		return lib.Variant{}, false
+	}
+	if goos == "" || (goos == a.OS && arch == a.Arch) {
+		return lib.Variant{OS: a.OS, Arch: a.Arch, Artifact: artifactName(a), Size: a.Size, Checksum: a.Checksum}, true
+	}
+	v, ok := a.Variant(goos, arch)
+	if !ok {
+		writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Antarian %s has no artifact for %s/%s, only for %v", a.Id, goos, arch, a.Platforms()))
+		return lib.Variant{}, false
+	}
+	return v, true
+}
+
+// sidecars are the files stored beside the artifact name by the build that
+// made it: its signature and SBOM.
+func sidecars(name string) []string {
+	return []string{name + lib.SignatureExt, name + lib.SBOMExt}
+}
+
+// variantPlatform is the platform of v, "" when it has none.
+func variantPlatform(v lib.Variant) string {
+	if v.OS == "" {
+		return ""
+	}
+	return v.Platform()
+}
+
+// artifactChecksum returns the sha256 recorded for the uploaded file
+// filename of a, "" when there is none.
+func artifactChecksum(a lib.Antarian, filename string) string {
+	if a.Artifact == filename {
+		return a.Checksum
+	}
+	for _, v := range a.Variants {
+		if v.Artifact == filename {
+			return v.Checksum
+		}
+	}
+	return ""
+}
+
+// errMalformedUpload is returned for multipart bodies that cannot be read.
+var errMalformedUpload = errors.New("malformed multipart body")
+
+// artifactPart returns the "file" part of a multipart request, skipping
+// any parts before it.
+func artifactPart(r *http.Request) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedUpload, err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf(`%w: no "file" part`, errMalformedUpload)
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errMalformedUpload, err)
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// writeUploadError answers a failed upload: 413 when the body was too
+// large, 422 for an unusable file name, 400 for a malformed body and 500
+// otherwise.
+func writeUploadError(d *Deps, w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(d, w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("artifact exceeds %d bytes", tooLarge.Limit))
+	case errors.Is(err, storage.ErrInvalidName):
+		writeError(d, w, r, http.StatusUnprocessableEntity, fmt.Sprintf("filename: %v", err))
+	case errors.Is(err, errMalformedUpload):
+		writeError(d, w, r, http.StatusBadRequest, err.Error())
+	default:
+		if r.Context().Err() != nil {
+			// the client went away; there is nobody to answer
+			return
+		}
+		internalError(d, w, r, "store artifact", err)
+	}
+}
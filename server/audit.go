@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// AuditIndex lists audit entries, filtered by the since and until (RFC 3339),
+// action, actor and resource_id query parameters. resource_id matches an
+// Antarian or build id.
+func AuditIndex(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q AuditQuery
+		for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+			v := r.URL.Query().Get(name)
+			if v == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("%s: %q is not an RFC 3339 time", name, v))
+				return
+			}
+			*t = parsed
+		}
+		q.Action = r.URL.Query().Get("action")
+		q.Actor = r.URL.Query().Get("actor")
+		q.Resource = r.URL.Query().Get("resource_id")
+		list, err := d.repo(r.Context()).ListAudit(q)
+		if err != nil {
+			internalError(d, w, r, "list audit entries", err)
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, list)
+	}
+}
+
+// audit records e, stamping it with an id and the current time. Failing to
+// write the audit log must not fail the operation being audited, so errors
+// are only logged.
+func audit(ctx context.Context, d *Deps, e lib.AuditEntry) {
+	id, err := lib.NewUUID()
+	if err != nil {
+		d.Logger.Error("generate audit id", "err", err, "action", e.Action)
+	}
+	e.Id = id
+	e.Time = time.Now()
+	if err := d.repo(ctx).AppendAudit(e); err != nil {
+		d.Logger.Error("write audit entry", "err", err, "action", e.Action, "antarian_id", e.AntarianId, "build_id", e.BuildId)
+	}
+}
+
+// requestAudit starts an audit entry for an HTTP request.
+func requestAudit(r *http.Request, action string) lib.AuditEntry {
+	ns, _ := NamespaceFrom(r.Context())
+	return lib.AuditEntry{
+		Actor:      principalActor(r.Context(), r.Header.Get("Authorization")),
+		Action:     action,
+		Namespace:  ns,
+		RemoteAddr: r.RemoteAddr,
+		RequestId:  RequestID(r.Context()),
+	}
+}
+
+// callAudit starts an audit entry for a gRPC call.
+func callAudit(ctx context.Context, action string) lib.AuditEntry {
+	authorization := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			authorization = v[0]
+		}
+	}
+	e := lib.AuditEntry{Actor: principalActor(ctx, authorization), Action: action}
+	if p, ok := peer.FromContext(ctx); ok {
+		e.RemoteAddr = p.Addr.String()
+	}
+	return e
+}
+
+// actor names the caller in the audit log. Tokens have no names, so a
+// token is identified by a short fingerprint rather than recorded as is.
+func actor(authorization string) string {
+	token, ok := bearerToken(authorization)
+	if !ok {
+		return "anonymous"
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// principalActor names the authenticated caller in ctx by its subject,
+// falling back to actor for static tokens and open servers.
+func principalActor(ctx context.Context, authorization string) string {
+	if p, ok := PrincipalFrom(ctx); ok && p.Subject != "" {
+		return p.Subject
+	}
+	return actor(authorization)
+}
+
+// auditSummary describes a for the Before and After fields.
+func auditSummary(a lib.Antarian) string {
+	return fmt.Sprintf("%s %s-%s", a.Name, a.Version, a.Release)
+}
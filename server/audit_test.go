@@ -0,0 +1,198 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+func TestAuditEveryMutation(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.Tokens = []string{"writer"}
+		c.AdminTokens = []string{"adm"}
+		c.AllowDestructiveAdmin = true
+		// long enough for the build to be canceled
+		c.Build.Command = "sleep 5"
+	})
+	writer, admin := actor("Bearer writer"), actor("Bearer adm")
+
+	var a lib.Antarian
+	var b lib.Build
+	var hook lib.Webhook
+	var sched lib.Schedule
+	steps := []struct {
+		method string
+		path   func() string
+		body   func() interface{}
+		token  string
+		out    interface{}
+		status int
+		action string
+		// resource is the Antarian or build the entry names
+		resource func() string
+	}{
+		{"POST", fixed("/v1/antarians"), value(lib.Antarian{Name: "libfoo", Version: "1.0.0"}), "writer", &a, 201, lib.AuditAntarianCreate, func() string { return a.Id }},
+		{"GET", func() string { return "/v1/antarians/" + a.Id }, nil, "writer", nil, 200, "", nil},
+		{"PUT", func() string { return "/v1/antarians/" + a.Id }, func() interface{} { u := a; u.Version = "1.0.1"; return u }, "writer", nil, 200, lib.AuditAntarianUpdate, func() string { return a.Id }},
+		{"PATCH", func() string { return "/v1/antarians/" + a.Id }, value(`{"baseurl":"https://mirror.example.com"}`), "writer", nil, 200, lib.AuditAntarianUpdate, func() string { return a.Id }},
+		{"POST", func() string { return "/v1/antarians/" + a.Id + "/artifact" }, value("artifact bytes"), "writer", nil, 201, lib.AuditArtifactUpload, func() string { return a.Id }},
+		{"GET", func() string { return "/v1/antarians/" + a.Id + "/download" }, nil, "writer", nil, 200, lib.AuditAntarianDownload, func() string { return a.Id }},
+		{"POST", func() string { return "/v1/antarians/" + a.Id + "/build" }, nil, "writer", &b, 202, lib.AuditBuildTrigger, func() string { return b.Id }},
+		{"DELETE", func() string { return "/v1/builds/" + b.Id }, nil, "writer", nil, 202, lib.AuditBuildCancel, func() string { return b.Id }},
+		{"POST", fixed("/v1/webhooks"), value(map[string]string{"url": "https://hooks.example.com/antares"}), "adm", &hook, 201, lib.AuditWebhookCreate, nil},
+		{"DELETE", func() string { return "/v1/webhooks/" + hook.Id }, nil, "adm", nil, 204, lib.AuditWebhookDelete, nil},
+		{"POST", fixed("/v1/schedules"), func() interface{} { return map[string]string{"antarian_id": a.Id, "cron": "0 3 * * *"} }, "adm", &sched, 201, lib.AuditScheduleCreate, func() string { return a.Id }},
+		{"PUT", func() string { return "/v1/schedules/" + sched.Id }, func() interface{} { return map[string]string{"antarian_id": a.Id, "cron": "0 4 * * *"} }, "adm", nil, 200, lib.AuditScheduleUpdate, func() string { return a.Id }},
+		{"DELETE", func() string { return "/v1/schedules/" + sched.Id }, nil, "adm", nil, 204, lib.AuditScheduleDelete, nil},
+		{"POST", fixed("/v1/agents"), value(map[string]string{"name": "agent1"}), "adm", nil, 201, lib.AuditAgentRegister, nil},
+		{"POST", fixed("/v1/admin/gc?delete=true"), nil, "adm", nil, 200, lib.AuditArtifactGC, nil},
+		{"DELETE", func() string { return "/v1/antarians/" + a.Id }, nil, "writer", nil, 204, lib.AuditAntarianDelete, func() string { return a.Id }},
+		{"DELETE", fixed("/v1/admin/antarians"), nil, "adm", nil, 200, lib.AuditStorePurge, nil},
+	}
+
+	type expected struct {
+		actor, requestId, resource string
+	}
+	want := map[string][]expected{}
+	for i, st := range steps {
+		var reqBody interface{}
+		if st.body != nil {
+			reqBody = st.body()
+		}
+		requestId := fmt.Sprintf("step-%d", i)
+		p := st.path()
+		header := []string{"Authorization", "Bearer " + st.token, "X-Request-Id", requestId}
+		if _, raw := reqBody.(string); raw && strings.HasSuffix(p, "/artifact") {
+			header = append(header, "Content-Type", "application/octet-stream")
+		}
+		if status := call(t, ts, st.method, p, reqBody, st.out, header...); status != st.status {
+			t.Fatalf("%s %s = %d, want %d", st.method, p, status, st.status)
+		}
+		if st.action == "" {
+			continue
+		}
+		e := expected{actor: writer, requestId: requestId}
+		if st.token == "adm" {
+			e.actor = admin
+		}
+		if st.resource != nil {
+			e.resource = st.resource()
+		}
+		want[st.action] = append(want[st.action], e)
+	}
+
+	var entries []lib.AuditEntry
+	if status := call(t, ts, "GET", "/v1/admin/audit", nil, &entries, "Authorization", "Bearer adm"); status != 200 {
+		t.Fatalf("GET /v1/admin/audit = %d", status)
+	}
+	got := map[string][]lib.AuditEntry{}
+	for _, e := range entries {
+		got[e.Action] = append(got[e.Action], e)
+	}
+	for action, exp := range want {
+		if len(got[action]) != len(exp) {
+			t.Errorf("%d %s entries, want %d", len(got[action]), action, len(exp))
+			continue
+		}
+		for _, w := range exp {
+			e, ok := entryFor(got[action], w.requestId)
+			if !ok {
+				t.Errorf("no %s entry for request %s", action, w.requestId)
+				continue
+			}
+			if e.Id == "" || e.Time.IsZero() || e.RemoteAddr == "" || e.Actor != w.actor {
+				t.Errorf("%s entry = %+v, want an id, time, remote address and actor %s", action, e, w.actor)
+			}
+			if w.resource != "" && e.AntarianId != w.resource && e.BuildId != w.resource {
+				t.Errorf("%s entry names %s/%s, want %s", action, e.AntarianId, e.BuildId, w.resource)
+			}
+		}
+	}
+	if len(entries) != len(steps)-1 {
+		t.Errorf("%d entries for %d audited requests", len(entries), len(steps)-1)
+	}
+	for _, e := range got[lib.AuditAntarianUpdate] {
+		if e.Before == "" || e.After == "" || len(e.Changes) == 0 {
+			t.Errorf("update entry = %+v, want a before and after summary and the changes", e)
+		}
+	}
+
+	// the filters
+	filters := []struct {
+		query string
+		n     int
+	}{
+		{"?action=" + lib.AuditAntarianUpdate, 2},
+		{"?resource_id=" + b.Id, 2},
+		{"?actor=" + admin, 8},
+		{"?since=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339), 0},
+		{"?until=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339), len(entries)},
+	}
+	for _, f := range filters {
+		var list []lib.AuditEntry
+		call(t, ts, "GET", "/v1/admin/audit"+f.query, nil, &list, "Authorization", "Bearer adm")
+		if len(list) != f.n {
+			t.Errorf("GET /v1/admin/audit%s = %d entries, want %d", f.query, len(list), f.n)
+		}
+	}
+
+	// the log is read only, and only for admins
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		if status := call(t, ts, method, "/v1/admin/audit", `{"action":"forged"}`, nil, "Authorization", "Bearer adm"); status != http.StatusNotFound && status != http.StatusMethodNotAllowed {
+			t.Errorf("%s /v1/admin/audit = %d, want it not routed", method, status)
+		}
+	}
+	var after []lib.AuditEntry
+	call(t, ts, "GET", "/v1/admin/audit", nil, &after, "Authorization", "Bearer adm")
+	if len(after) != len(entries) {
+		t.Errorf("the log went from %d to %d entries", len(entries), len(after))
+	}
+	if status := call(t, ts, "GET", "/v1/admin/audit", nil, nil, "Authorization", "Bearer writer"); status != http.StatusForbidden {
+		t.Errorf("GET /v1/admin/audit with a write token = %d, want 403", status)
+	}
+}
+
+func fixed(p string) func() string { return func() string { return p } }
+
+func value(v interface{}) func() interface{} { return func() interface{} { return v } }
+
+func entryFor(entries []lib.AuditEntry, requestId string) (lib.AuditEntry, bool) {
+	for _, e := range entries {
+		if e.RequestId == requestId {
+			return e, true
+		}
+	}
+	return lib.AuditEntry{}, false
+}
+
+// failingAudit is a Repository that cannot write the audit log.
+type failingAudit struct {
+	Repository
+}
+
+func (failingAudit) AppendAudit(lib.AuditEntry) error {
+	return errors.New("audit store is read only")
+}
+
+func TestAuditFailure(t *testing.T) {
+	log, capture := newCapture()
+	d := newDeps(log)
+	d.Repo = failingAudit{d.Repo}
+	router := NewRouter(d, Routes{{Name: "AntarianCreate", Method: "POST", Pattern: "/antarians", HandlerFunc: AntarianCreate(d)}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/antarians", strings.NewReader(`{"name":"libfoo","version":"1.0.0"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create with a failing audit log = %d %s, want 201", w.Code, w.Body)
+	}
+	if attrs, _, ok := capture.find("write audit entry"); !ok || attrs["action"].String() != lib.AuditAntarianCreate {
+		t.Errorf("audit failure log = %v", attrs)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// auditFileRepo copies every audit entry of a Repository to an append-only
+// file, one JSON object per line, so the trail survives a purge of the
+// repository and can be shipped elsewhere.
+type auditFileRepo struct {
+	Repository
+	mu   sync.Mutex
+	file *os.File
+}
+
+// withAuditFile opens path for appending and returns repo wrapped so every
+// audit entry is written to it as well.
+func withAuditFile(repo Repository, path string) (Repository, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditFileRepo{Repository: repo, file: f}, nil
+}
+
+func (r *auditFileRepo) AppendAudit(e lib.AuditEntry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	_, err = r.file.Write(append(raw, '\n'))
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.Repository.AppendAudit(e)
+}
+
+// Close closes the audit file and the wrapped repository.
+func (r *auditFileRepo) Close() error {
+	err := r.file.Close()
+	if cerr := closeRepository(r.Repository); cerr != nil {
+		err = cerr
+	}
+	return err
+}
+
+// Ping checks the wrapped repository.
+func (r *auditFileRepo) Ping(ctx context.Context) error {
+	return pingRepository(ctx, r.Repository)
+}
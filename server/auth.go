@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/xbcsmith/antares/config"
+)
+
+var (
+	errNoToken      = errors.New("missing bearer token")
+	errInvalidToken = errors.New("invalid bearer token")
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Subject names the caller: the sub claim of a JWT, or a fingerprint
+	// of a static token.
+	Subject string
+	// Roles are taken from the roles claim of a JWT or mapped from the
+	// groups of an OIDC token. Static tokens hold
+	// RoleAdmin, RoleWrite or RoleRead, by the setting they are listed in.
+	Roles []string
+}
+
+// HasRole reports whether p holds role.
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// PrincipalFrom returns the caller authenticated by Deps.Auth or the gRPC
+// interceptors. ok is false on public routes and open servers.
+func PrincipalFrom(ctx context.Context) (p Principal, ok bool) {
+	p, ok = ctx.Value(principalKey).(Principal)
+	return p, ok
+}
+
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>"
+// value.
+func bearerToken(header string) (string, bool) {
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(header[len(prefix):])
+	return token, token != ""
+}
+
+// validToken reports whether token is one of the configured tokens. The
+// comparison takes the same time wherever the tokens differ.
+func validToken(tokens []string, token string) bool {
+	ok := false
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// authRequired reports whether callers must authenticate, which they must
+// once static tokens or JWT verification are configured. Admin tokens
+// alone only guard the admin routes.
+func authRequired(d *Deps) bool {
+	return len(d.Config.Tokens) > 0 || len(d.Config.ReadTokens) > 0 || len(d.verifiers) > 0
+}
+
+// tokenVerifier identifies the caller presenting a JWT it can check.
+type tokenVerifier interface {
+	verify(ctx context.Context, token string) (Principal, error)
+}
+
+// newVerifiers returns the JWT and OIDC verifiers configured in cfg.
+func newVerifiers(cfg *config.Config) ([]tokenVerifier, error) {
+	var verifiers []tokenVerifier
+	jv, err := newJWTVerifier(cfg.JWT)
+	if err != nil {
+		return nil, err
+	}
+	if jv != nil {
+		verifiers = append(verifiers, jv)
+	}
+	if cfg.OIDC.IssuerURL != "" {
+		ov, err := newOIDCVerifier(cfg.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, ov)
+	}
+	return verifiers, nil
+}
+
+// authenticate identifies the caller presenting authorization, which may
+// hold a static token or a JWT accepted by one of d's verifiers.
+func authenticate(ctx context.Context, d *Deps, authorization string) (Principal, error) {
+	token, ok := bearerToken(authorization)
+	if !ok {
+		return Principal{}, errNoToken
+	}
+	for _, static := range []struct {
+		tokens []string
+		role   string
+	}{
+		{d.Config.AdminTokens, RoleAdmin},
+		{d.Config.Tokens, RoleWrite},
+		{d.Config.ReadTokens, RoleRead},
+	} {
+		if validToken(static.tokens, token) {
+			return Principal{Subject: actor(authorization), Roles: []string{static.role}}, nil
+		}
+	}
+	if strings.Count(token, ".") != 2 {
+		return Principal{}, errInvalidToken
+	}
+	err := errInvalidToken
+	for _, v := range d.verifiers {
+		p, verr := v.verify(ctx, token)
+		if verr == nil {
+			return p, nil
+		}
+		err = verr
+	}
+	return Principal{}, err
+}
+
+// Authenticate admits requests bearing a valid token, recording the caller
+// for PrincipalFrom, and answers 401 to the rest. It is installed as
+// Deps.Auth when tokens or JWT verification are configured.
+func Authenticate(d *Deps) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := authenticate(r.Context(), d, r.Header.Get("Authorization"))
+			if err != nil {
+				unauthorized(d, w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// unauthorized answers 401 for the authentication failure err.
+func unauthorized(d *Deps, w http.ResponseWriter, r *http.Request, err error) {
+	if err == errNoToken {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="antares"`)
+		writeError(d, w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+	requestLogger(d.Logger, r).Info("rejected token", "err", err)
+	w.Header().Set("WWW-Authenticate", `Bearer realm="antares", error="invalid_token"`)
+	writeError(d, w, r, http.StatusUnauthorized, errInvalidToken.Error())
+}
+
+// public reports whether route is served without authentication, either
+// by its own definition or by the public_routes setting.
+func public(d *Deps, route Route) bool {
+	if route.Public {
+		return true
+	}
+	for _, name := range d.Config.PublicRoutes {
+		if name == route.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// EventAvroSchema is the Avro schema of events published in the avro
+// format. Data holds the whole lib.Event as JSON, so consumers get the
+// Antarian or build record without the schema following every field.
+const EventAvroSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "com.xbcsmith.antares",
+  "fields": [
+    {"name": "id", "type": "string"},
+    {"name": "type", "type": "string"},
+    {"name": "time", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+    {"name": "antarian_id", "type": "string"},
+    {"name": "build_id", "type": ["null", "string"]},
+    {"name": "build_state", "type": ["null", "string"]},
+    {"name": "data", "type": "string"}
+  ]
+}`
+
+// eventAvroCanonical is the Parsing Canonical Form of EventAvroSchema,
+// which its fingerprint is taken of.
+const eventAvroCanonical = `{"name":"com.xbcsmith.antares.Event","type":"record","fields":[` +
+	`{"name":"id","type":"string"},{"name":"type","type":"string"},{"name":"time","type":"long"},` +
+	`{"name":"antarian_id","type":"string"},{"name":"build_id","type":["null","string"]},` +
+	`{"name":"build_state","type":["null","string"]},{"name":"data","type":"string"}]}`
+
+// eventAvroHeader starts every message in Avro single-object encoding: a
+// marker and the little-endian CRC-64-AVRO fingerprint of the schema.
+var eventAvroHeader = func() []byte {
+	h := []byte{0xc3, 0x01, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint64(h[2:], avroFingerprint([]byte(eventAvroCanonical)))
+	return h
+}()
+
+// encodeEventAvro encodes ev by EventAvroSchema in single-object encoding.
+func encodeEventAvro(ev lib.Event) ([]byte, error) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	buf := append([]byte{}, eventAvroHeader...)
+	buf = avroString(buf, ev.Id)
+	buf = avroString(buf, ev.Type)
+	buf = avroLong(buf, ev.Time.UnixMicro())
+	buf = avroString(buf, eventAntarianId(ev))
+	if ev.Build != nil {
+		buf = avroString(avroLong(buf, 1), ev.Build.Id)
+		buf = avroString(avroLong(buf, 1), string(ev.Build.State))
+	} else {
+		buf = avroLong(avroLong(buf, 0), 0)
+	}
+	return avroString(buf, string(data)), nil
+}
+
+// avroLong appends n zig-zag encoded as a variable-length integer.
+func avroLong(buf []byte, n int64) []byte {
+	return binary.AppendUvarint(buf, uint64((n<<1)^(n>>63)))
+}
+
+// avroString appends s prefixed with its length.
+func avroString(buf []byte, s string) []byte {
+	return append(avroLong(buf, int64(len(s))), s...)
+}
+
+// avroEmpty is the CRC-64-AVRO fingerprint of no data.
+const avroEmpty = 0xc15d213aa4d7a795
+
+var avroTable = func() (t [256]uint64) {
+	for i := range t {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = (fp >> 1) ^ (avroEmpty & -(fp & 1))
+		}
+		t[i] = fp
+	}
+	return t
+}()
+
+// avroFingerprint is the CRC-64-AVRO (Rabin) fingerprint of b.
+func avroFingerprint(b []byte) uint64 {
+	fp := uint64(avroEmpty)
+	for _, c := range b {
+		fp = (fp >> 8) ^ avroTable[byte(fp)^c]
+	}
+	return fp
+}
@@ -0,0 +1,599 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltSchema is the layout version written to the meta bucket. Open refuses
+// files written by a newer layout.
+const boltSchema = 1
+
+// eachBatch is how many Antarians EachAntarian reads per transaction.
+const eachBatch = 100
+
+var (
+	bucketMeta      = []byte("meta")
+	bucketAntarians = []byte("antarians")
+	// bucketAntarianIds maps an Antarian id to its key in bucketAntarians,
+	// which is a sequence number so records list in creation order.
+	bucketAntarianIds = []byte("antarian_ids")
+	bucketBuilds      = []byte("builds")
+	bucketAudit       = []byte("audit")
+	// bucketWebhooks maps a sequence number to a webhook, so they list in
+	// creation order.
+	bucketWebhooks = []byte("webhooks")
+	// bucketSchedules maps a sequence number to a schedule, likewise.
+	bucketSchedules = []byte("schedules")
+
+	keySchema = []byte("schema")
+)
+
+// BoltRepo is a Repository stored in a single bbolt file, so records
+// survive restarts. Values are JSON.
+type BoltRepo struct {
+	db  *bolt.DB
+	log *slog.Logger
+}
+
+// NewBoltRepo opens or creates the database at path. It fails rather than
+// waits when another process holds the file.
+func NewBoltRepo(path string, log *slog.Logger) (*BoltRepo, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketMeta, bucketAntarians, bucketAntarianIds, bucketBuilds, bucketAudit, bucketWebhooks, bucketSchedules} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		meta := tx.Bucket(bucketMeta)
+		if v := meta.Get(keySchema); v != nil {
+			if n := binary.BigEndian.Uint64(v); n > boltSchema {
+				return fmt.Errorf("schema version %d is newer than this server supports (%d)", n, boltSchema)
+			}
+		}
+		return meta.Put(keySchema, itob(boltSchema))
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open %s: %v", path, err)
+	}
+	return &BoltRepo{db: db, log: log}, nil
+}
+
+// Close releases the database file.
+func (r *BoltRepo) Close() error {
+	return r.db.Close()
+}
+
+// Ping checks that the database file is still open and readable.
+func (r *BoltRepo) Ping(ctx context.Context) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketMeta) == nil {
+			return fmt.Errorf("bucket %s is missing", bucketMeta)
+		}
+		return nil
+	})
+}
+
+func (r *BoltRepo) ListAntarians() (lib.Antarians, error) {
+	list := lib.Antarians{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketAntarians).ForEach(func(_, v []byte) error {
+			a, err := decodeAntarian(v)
+			if err != nil {
+				return err
+			}
+			list = append(list, a)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// EachAntarian reads eachBatch records per transaction and calls fn outside
+// it, so a slow consumer does not hold the database open.
+func (r *BoltRepo) EachAntarian(fn func(lib.Antarian) error) error {
+	var after []byte
+	for {
+		var batch lib.Antarians
+		err := r.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(bucketAntarians).Cursor()
+			k, v := c.First()
+			if after != nil {
+				if k, v = c.Seek(after); k != nil && string(k) == string(after) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil && len(batch) < eachBatch; k, v = c.Next() {
+				a, err := decodeAntarian(v)
+				if err != nil {
+					return err
+				}
+				batch = append(batch, a)
+				after = append(after[:0], k...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, a := range batch {
+			if err := fn(a); err != nil {
+				return err
+			}
+		}
+		if len(batch) < eachBatch {
+			return nil
+		}
+	}
+}
+
+func (r *BoltRepo) FindAntarian(id string) (lib.Antarian, error) {
+	var a lib.Antarian
+	err := r.db.View(func(tx *bolt.Tx) error {
+		seq := tx.Bucket(bucketAntarianIds).Get([]byte(id))
+		if seq == nil {
+			return ErrNotFound
+		}
+		var err error
+		a, err = decodeAntarian(tx.Bucket(bucketAntarians).Get(seq))
+		return err
+	})
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	return a, nil
+}
+
+func (r *BoltRepo) AntariansNamed(name string) (lib.Antarians, error) {
+	var list lib.Antarians
+	err := r.EachAntarian(func(a lib.Antarian) error {
+		if a.Name == name {
+			list = append(list, a)
+		}
+		return nil
+	})
+	return list, err
+}
+
+func (r *BoltRepo) NameSummaries(prefix string, labels lib.LabelSelector) ([]NameSummary, error) {
+	z := newSummarizer(prefix, labels)
+	err := r.EachAntarian(func(a lib.Antarian) error {
+		z.add(a)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return z.result(), nil
+}
+
+func (r *BoltRepo) CreateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	uuid, err := lib.NewUUID()
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	s.Id = uuid
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketAntarians)
+		if err := conflicts(b, s); err != nil {
+			return err
+		}
+		n, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := b.Put(itob(n), raw); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketAntarianIds).Put([]byte(s.Id), itob(n))
+	})
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	return s, nil
+}
+
+func (r *BoltRepo) UpdateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		seq := tx.Bucket(bucketAntarianIds).Get([]byte(s.Id))
+		if seq == nil {
+			return ErrNotFound
+		}
+		b := tx.Bucket(bucketAntarians)
+		if err := conflicts(b, s); err != nil {
+			return err
+		}
+		return b.Put(seq, raw)
+	})
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	return s, nil
+}
+
+// conflicts returns ErrConflict when another record in b than s itself has
+// the name, version and namespace of s.
+func conflicts(b *bolt.Bucket, s lib.Antarian) error {
+	return b.ForEach(func(_, v []byte) error {
+		o, err := decodeAntarian(v)
+		if err != nil {
+			return err
+		}
+		if o.Id != s.Id && o.Name == s.Name && o.Version == s.Version && o.NamespaceOrDefault() == s.NamespaceOrDefault() {
+			return ErrConflict
+		}
+		return nil
+	})
+}
+
+func (r *BoltRepo) DestroyAntarian(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		ids := tx.Bucket(bucketAntarianIds)
+		seq := ids.Get([]byte(id))
+		if seq == nil {
+			return ErrNotFound
+		}
+		if err := tx.Bucket(bucketAntarians).Delete(seq); err != nil {
+			return err
+		}
+		return ids.Delete([]byte(id))
+	})
+}
+
+func (r *BoltRepo) Purge() (antarians, builds int, err error) {
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		antarians = tx.Bucket(bucketAntarianIds).Stats().KeyN
+		builds = tx.Bucket(bucketBuilds).Stats().KeyN
+		for _, name := range [][]byte{bucketAntarians, bucketAntarianIds, bucketBuilds} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return antarians, builds, nil
+}
+
+func (r *BoltRepo) SaveBuild(b lib.Build) error {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBuilds).Put([]byte(b.Id), raw)
+	})
+}
+
+// FindBuild reports a record that cannot be read as missing, after logging
+// why.
+func (r *BoltRepo) FindBuild(id string) (lib.Build, bool) {
+	var b lib.Build
+	found := false
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketBuilds).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &b)
+	})
+	if err != nil {
+		r.log.Error("find build", "err", err, "build_id", id)
+		return lib.Build{}, false
+	}
+	return b, found
+}
+
+// eachBuild calls fn for every build of antarianId, or every build when it
+// is empty.
+func (r *BoltRepo) eachBuild(tx *bolt.Tx, antarianId string, fn func(k []byte, b lib.Build) error) error {
+	return tx.Bucket(bucketBuilds).ForEach(func(k, v []byte) error {
+		var b lib.Build
+		if err := json.Unmarshal(v, &b); err != nil {
+			return err
+		}
+		if antarianId != "" && b.AntarianId != antarianId {
+			return nil
+		}
+		return fn(k, b)
+	})
+}
+
+func (r *BoltRepo) ListBuilds(antarianId string) ([]lib.Build, error) {
+	list := []lib.Build{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return r.eachBuild(tx, antarianId, func(_ []byte, b lib.Build) error {
+			list = append(list, b)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Start.After(list[j].Start)
+	})
+	return list, nil
+}
+
+func (r *BoltRepo) LatestBuild(antarianId string) (lib.Build, bool, error) {
+	var latest lib.Build
+	found := false
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return r.eachBuild(tx, antarianId, func(_ []byte, b lib.Build) error {
+			if !found || b.Start.After(latest.Start) {
+				latest, found = b, true
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return lib.Build{}, false, err
+	}
+	return latest, found, nil
+}
+
+func (r *BoltRepo) PruneBuilds(cutoff time.Time) (int, error) {
+	pruned := 0
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		var stale [][]byte
+		err := r.eachBuild(tx, "", func(k []byte, b lib.Build) error {
+			if b.State.Done() && b.End.Before(cutoff) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// deleting while iterating skips keys, so delete afterwards
+		for _, k := range stale {
+			if err := tx.Bucket(bucketBuilds).Delete(k); err != nil {
+				return err
+			}
+		}
+		pruned = len(stale)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pruned, nil
+}
+
+func (r *BoltRepo) AppendAudit(e lib.AuditEntry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketAudit)
+		n, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(n), raw)
+	})
+}
+
+func (r *BoltRepo) ListAudit(q AuditQuery) ([]lib.AuditEntry, error) {
+	list := []lib.AuditEntry{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketAudit).ForEach(func(_, v []byte) error {
+			var e lib.AuditEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if q.Match(e) {
+				list = append(list, e)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *BoltRepo) CreateWebhook(h lib.Webhook) error {
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketWebhooks)
+		n, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(n), raw)
+	})
+}
+
+func (r *BoltRepo) ListWebhooks() ([]lib.Webhook, error) {
+	list := []lib.Webhook{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketWebhooks).ForEach(func(_, v []byte) error {
+			var h lib.Webhook
+			if err := json.Unmarshal(v, &h); err != nil {
+				return err
+			}
+			list = append(list, h)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// webhookKey finds the key of webhook id. There are few webhooks, so they
+// are not indexed.
+func webhookKey(tx *bolt.Tx, id string) ([]byte, lib.Webhook, error) {
+	c := tx.Bucket(bucketWebhooks).Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var h lib.Webhook
+		if err := json.Unmarshal(v, &h); err != nil {
+			return nil, lib.Webhook{}, err
+		}
+		if h.Id == id {
+			return k, h, nil
+		}
+	}
+	return nil, lib.Webhook{}, ErrNotFound
+}
+
+func (r *BoltRepo) FindWebhook(id string) (lib.Webhook, error) {
+	var h lib.Webhook
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		_, h, err = webhookKey(tx, id)
+		return err
+	})
+	return h, err
+}
+
+func (r *BoltRepo) DestroyWebhook(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		k, _, err := webhookKey(tx, id)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketWebhooks).Delete(k)
+	})
+}
+
+func (r *BoltRepo) CreateSchedule(s lib.Schedule) error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSchedules)
+		n, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(n), raw)
+	})
+}
+
+func (r *BoltRepo) ListSchedules() ([]lib.Schedule, error) {
+	list := []lib.Schedule{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSchedules).ForEach(func(_, v []byte) error {
+			var s lib.Schedule
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			list = append(list, s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// scheduleKey finds the key of schedule id. Like webhooks, schedules are
+// few and not indexed.
+func scheduleKey(tx *bolt.Tx, id string) ([]byte, lib.Schedule, error) {
+	c := tx.Bucket(bucketSchedules).Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var s lib.Schedule
+		if err := json.Unmarshal(v, &s); err != nil {
+			return nil, lib.Schedule{}, err
+		}
+		if s.Id == id {
+			return k, s, nil
+		}
+	}
+	return nil, lib.Schedule{}, ErrNotFound
+}
+
+func (r *BoltRepo) FindSchedule(id string) (lib.Schedule, error) {
+	var s lib.Schedule
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		_, s, err = scheduleKey(tx, id)
+		return err
+	})
+	return s, err
+}
+
+func (r *BoltRepo) UpdateSchedule(s lib.Schedule) error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		k, _, err := scheduleKey(tx, s.Id)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketSchedules).Put(k, raw)
+	})
+}
+
+func (r *BoltRepo) DestroySchedule(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		k, _, err := scheduleKey(tx, id)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketSchedules).Delete(k)
+	})
+}
+
+// decodeAntarian reads a stored Antarian. Records stored before Status
+// existed get theirs from Running and Finished.
+func decodeAntarian(v []byte) (lib.Antarian, error) {
+	var a lib.Antarian
+	if err := json.Unmarshal(v, &a); err != nil {
+		return a, err
+	}
+	if a.Status == "" {
+		a.Status = a.CurrentStatus()
+		a.Running, a.Finished = false, a.Status.Done()
+	}
+	return a, nil
+}
+
+// itob encodes n as a big-endian key, so keys sort numerically.
+func itob(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b
+}
+
+var _ Repository = (*BoltRepo)(nil)
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// BuildLogs serves the output of a build line by line: as plain text, or
+// with ?format=jsonl or an Accept of application/x-ndjson as one
+// lib.LogLine per line, with its stream and time. With ?follow=true the
+// output of a queued or running build is streamed until it finishes.
+func BuildLogs(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		buildId := mux.Vars(r)["buildId"]
+		q := r.URL.Query()
+		follow := false
+		if v := q.Get("follow"); v != "" {
+			var err error
+			if follow, err = strconv.ParseBool(v); err != nil {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("follow: %q is not a boolean", v))
+				return
+			}
+		}
+		jsonLines := strings.Contains(r.Header.Get("Accept"), ndjson)
+		switch format := q.Get("format"); format {
+		case "":
+		case "text":
+			jsonLines = false
+		case "jsonl":
+			jsonLines = true
+		default:
+			writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("format: %q is not text or jsonl", format))
+			return
+		}
+
+		if _, ok := d.repo(r.Context()).FindBuild(buildId); !ok {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Build with id of %s", buildId))
+			return
+		}
+
+		// watch before reading the build, so no line falls in between
+		var updates <-chan build.Progress
+		watching := false
+		if follow {
+			var stop func()
+			updates, stop, watching = d.Builds.Watch(buildId)
+			defer stop()
+		}
+		b, ok := d.Builds.Get(buildId)
+		if !ok {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Build with id of %s", buildId))
+			return
+		}
+
+		lw := &logLineWriter{w: w, rc: http.NewResponseController(w), json: jsonLines}
+		if jsonLines {
+			w.Header().Set("Content-Type", ndjson)
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		if watching {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+		}
+		w.WriteHeader(http.StatusOK)
+
+		log := requestLogger(d.Logger, r)
+		if err := storedLogLines(b, lw.after(lw.write)); err != nil {
+			log.Info("build log aborted", "err", err, "build_id", b.Id)
+			return
+		}
+		if !watching {
+			return
+		}
+		lw.rc.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case p, ok := <-updates:
+				if !ok {
+					// lines dropped for a slow reader are in the file
+					if final, found := d.Builds.Get(b.Id); found {
+						storedLogLines(final, lw.after(lw.write))
+					}
+					return
+				}
+				if p.Log == nil || p.Log.Seq <= lw.last {
+					continue
+				}
+				if err := lw.write(*p.Log); err != nil {
+					return
+				}
+				if err := lw.rc.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// logLineWriter writes log lines as text or JSON, remembering the last.
+type logLineWriter struct {
+	w    io.Writer
+	rc   *http.ResponseController
+	json bool
+	last int
+}
+
+func (lw *logLineWriter) write(l lib.LogLine) error {
+	lw.last = l.Seq
+	if lw.json {
+		return json.NewEncoder(lw.w).Encode(l)
+	}
+	_, err := io.WriteString(lw.w, l.Line+"\n")
+	return err
+}
+
+// after wraps fn to skip the lines already written.
+func (lw *logLineWriter) after(fn func(lib.LogLine) error) func(lib.LogLine) error {
+	return func(l lib.LogLine) error {
+		if l.Seq <= lw.last {
+			return nil
+		}
+		return fn(l)
+	}
+}
+
+// storedLogLines passes the lines of b's output written so far to fn.
+// Builds recorded before output was kept as lines give the lines of their
+// Log, without times.
+func storedLogLines(b lib.Build, fn func(lib.LogLine) error) error {
+	f, err := os.Open(b.LogLines)
+	if b.LogLines == "" || errors.Is(err, fs.ErrNotExist) {
+		if b.Log == "" {
+			return nil
+		}
+		for i, line := range strings.Split(strings.TrimSuffix(b.Log, "\n"), "\n") {
+			if err := fn(lib.LogLine{Seq: i + 1, Line: line}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	// a line of output is escaped in JSON, which may take six bytes a byte
+	sc.Buffer(make([]byte, 64<<10), 8*build.MaxLineSize)
+	for sc.Scan() {
+		var l lib.LogLine
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			// the build is still writing this line
+			return nil
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/storage"
+)
+
+// buildRecorder is the build.Store of the engine. Besides saving the build
+// records it moves each Antarian's Status along with its builds and keeps
+// its End in step with the latest one, and records the artifact a successful
+// build stored as the Antarian's own, as an upload would, storing its SBOM
+// beside it.
+//
+// The engine saves builds holding its lock, so the SBOM and the removal of
+// the artifact it replaces are left to a background worker, in the order
+// the builds were saved. wait returns once it has caught up.
+type buildRecorder struct {
+	Repository
+	store storage.Storage
+	log   *slog.Logger
+	// deps resolves the requires of the SBOMs; none are made without it
+	deps *Deps
+
+	mu      sync.Mutex
+	pending []func()
+	working sync.WaitGroup
+}
+
+func (r *buildRecorder) SaveBuild(b lib.Build) error {
+	if err := r.Repository.SaveBuild(b); err != nil {
+		return err
+	}
+	if b.State == lib.BuildQueued {
+		return nil
+	}
+	a, err := r.FindAntarian(b.AntarianId)
+	if err == ErrNotFound {
+		// deleted while it was building
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if st, ok := lib.BuildStatus(b.State); ok && !b.Start.IsZero() {
+		// builds canceled before they started leave the status alone
+		if err := a.SetStatus(st); err != nil {
+			r.log.Warn("antarian status not changed", "err", err, "antarian_id", a.Id, "build_id", b.Id)
+		}
+	}
+	if b.State.Done() {
+		a.End = b.End
+	}
+	previous := a.Artifact
+	if b.State == lib.BuildSucceeded && b.Artifact != "" {
+		a.Artifact, a.Size, a.Checksum = b.Artifact, b.Size, b.Checksum
+	}
+	if _, err := r.UpdateAntarian(a); err != nil {
+		return err
+	}
+	sbom := b.State == lib.BuildSucceeded && b.Artifact != "" && r.deps != nil
+	replaced := previous != "" && previous != a.Artifact
+	if !sbom && !replaced {
+		return nil
+	}
+	// a and b are copies, so the worker shares nothing with the engine
+	r.later(func() {
+		if sbom {
+			if err := storeSBOM(r.deps, a, b); err != nil {
+				r.log.Error("store sbom", "err", err, "antarian_id", a.Id, "build_id", b.Id)
+			}
+		}
+		if replaced {
+			for _, name := range append([]string{previous}, sidecars(previous)...) {
+				if err := r.store.Delete(context.Background(), a.Id, name); err != nil && !errors.Is(err, storage.ErrNotFound) {
+					r.log.Error("remove previous artifact", "err", err, "antarian_id", a.Id, "filename", name)
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// later queues fn for the background worker, starting it if it is idle.
+func (r *buildRecorder) later(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, fn)
+	if len(r.pending) == 1 {
+		r.working.Add(1)
+		go r.work()
+	}
+}
+
+// work runs the queued functions in turn until none are left.
+func (r *buildRecorder) work() {
+	defer r.working.Done()
+	r.mu.Lock()
+	for len(r.pending) > 0 {
+		fn := r.pending[0]
+		r.mu.Unlock()
+		fn()
+		r.mu.Lock()
+		r.pending = r.pending[1:]
+	}
+	r.mu.Unlock()
+}
+
+// wait blocks until the queued work is done.
+func (r *buildRecorder) wait() {
+	r.working.Wait()
+}
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/storage"
+)
+
+var buildEpoch = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testBuild(id, antarianId string, start time.Duration, state lib.BuildState) lib.Build {
+	b := lib.Build{
+		Id:         id,
+		AntarianId: antarianId,
+		Name:       "libfoo",
+		Version:    "1.0.0",
+		State:      state,
+		Start:      buildEpoch.Add(start),
+		ExitCode:   -1,
+		Priority:   5,
+		DependsOn:  []string{"b0"},
+		Worker:     "host/1",
+		Log:        "building\n",
+		LogFile:    "/var/lib/antares/builds/" + id + "/build.log",
+		LogLines:   "/var/lib/antares/builds/" + id + "/build.jsonl",
+	}
+	if state.Done() {
+		b.End = b.Start.Add(time.Minute)
+		b.ExitCode = 0
+		b.Artifacts = []string{"libfoo.tar.gz", "libfoo.tar.gz.sig"}
+		b.Artifact, b.Size, b.Checksum = "libfoo.tar.gz", 1024, "abc123"
+		b.Attempt = 2
+		b.Attempts = []lib.BuildAttempt{
+			{Attempt: 1, State: lib.BuildFailed, Start: b.Start, End: b.Start.Add(time.Second), ExitCode: 2, Error: "exit status 2"},
+			{Attempt: 2, State: state, Start: b.Start.Add(2 * time.Second), End: b.End},
+		}
+	} else {
+		b.Running = state == lib.BuildRunning
+	}
+	return b
+}
+
+// sameBuild compares builds as they are served, since a backend may hand
+// times back in another location.
+func sameBuild(t *testing.T, got, want lib.Build) {
+	t.Helper()
+	g, _ := json.Marshal(utcBuild(got))
+	w, _ := json.Marshal(utcBuild(want))
+	if string(g) != string(w) {
+		t.Errorf("build = %s\nwant %s", g, w)
+	}
+}
+
+func utcBuild(b lib.Build) lib.Build {
+	b.Start, b.End = b.Start.UTC(), b.End.UTC()
+	b.Attempts = append([]lib.BuildAttempt(nil), b.Attempts...)
+	for i := range b.Attempts {
+		b.Attempts[i].Start, b.Attempts[i].End = b.Attempts[i].Start.UTC(), b.Attempts[i].End.UTC()
+	}
+	return b
+}
+
+func buildIds(builds []lib.Build) []string {
+	ids := make([]string, len(builds))
+	for i, b := range builds {
+		ids[i] = b.Id
+	}
+	return ids
+}
+
+func TestBuildRoundTrip(t *testing.T) {
+	for name, repo := range repos(t) {
+		t.Run(name, func(t *testing.T) {
+			repo.Purge()
+			builds := []lib.Build{
+				testBuild("b1", "a1", 0, lib.BuildRunning),
+				testBuild("b2", "a1", time.Hour, lib.BuildQueued),
+				testBuild("b3", "a2", 2*time.Hour, lib.BuildFailed),
+			}
+			for _, b := range builds {
+				if err := repo.SaveBuild(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// saving again replaces the record
+			builds[0] = testBuild("b1", "a1", 0, lib.BuildSucceeded)
+			if err := repo.SaveBuild(builds[0]); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range builds {
+				got, ok := repo.FindBuild(want.Id)
+				if !ok {
+					t.Fatalf("build %s not found", want.Id)
+				}
+				sameBuild(t, got, want)
+			}
+			if _, ok := repo.FindBuild("missing"); ok {
+				t.Error("FindBuild found a build never saved")
+			}
+
+			tests := []struct {
+				antarianId string
+				want       []string
+			}{
+				{"a1", []string{"b2", "b1"}},
+				{"a2", []string{"b3"}},
+				{"", []string{"b3", "b2", "b1"}},
+				{"none", []string{}},
+			}
+			for _, tt := range tests {
+				list, err := repo.ListBuilds(tt.antarianId)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := buildIds(list); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+					t.Errorf("ListBuilds(%q) = %v, want %v newest first", tt.antarianId, got, tt.want)
+				}
+			}
+			if latest, ok, err := repo.LatestBuild("a1"); err != nil || !ok || latest.Id != "b2" {
+				t.Errorf("LatestBuild(a1) = %s, %v, %v; want b2", latest.Id, ok, err)
+			}
+			if _, ok, err := repo.LatestBuild("none"); err != nil || ok {
+				t.Errorf("LatestBuild(none) = %v, %v; want none", ok, err)
+			}
+
+			// b1 ended within the hour, b3 after; b2 never finished
+			pruned, err := repo.PruneBuilds(buildEpoch.Add(2 * time.Hour))
+			if err != nil || pruned != 1 {
+				t.Errorf("PruneBuilds = %d, %v; want 1", pruned, err)
+			}
+			list, _ := repo.ListBuilds("")
+			if got := strings.Join(buildIds(list), " "); got != "b3 b2" {
+				t.Errorf("after pruning the builds are %v, want [b3 b2]", got)
+			}
+		})
+	}
+}
+
+func TestBoltBuildsReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "antares.db")
+	repo, err := NewBoltRepo(path, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testBuild("b1", "a1", 0, lib.BuildSucceeded)
+	if err := repo.SaveBuild(want); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err = NewBoltRepo(path, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	got, ok := repo.FindBuild("b1")
+	if !ok {
+		t.Fatal("the build did not survive a restart")
+	}
+	sameBuild(t, got, want)
+	if list, err := repo.ListBuilds("a1"); err != nil || len(list) != 1 {
+		t.Errorf("ListBuilds(a1) after a restart = %d builds, %v", len(list), err)
+	}
+}
+
+// slowSBOMs is a Storage whose SBOM writes wait for release, and which
+// records the order of the SBOM writes and deletes.
+type slowSBOMs struct {
+	storage.Storage
+	release chan struct{}
+	mu      sync.Mutex
+	ops     []string
+}
+
+func (s *slowSBOMs) Put(ctx context.Context, id, name string, r io.Reader) (storage.Info, error) {
+	if strings.HasSuffix(name, lib.SBOMExt) {
+		<-s.release
+		s.record("put " + name)
+	}
+	return s.Storage.Put(ctx, id, name, r)
+}
+
+func (s *slowSBOMs) Delete(ctx context.Context, id, name string) error {
+	s.record("delete " + name)
+	return s.Storage.Delete(ctx, id, name)
+}
+
+func (s *slowSBOMs) record(op string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = append(s.ops, op)
+}
+
+func TestRecorderSBOMInBackground(t *testing.T) {
+	local, err := storage.NewLocal(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &slowSBOMs{Storage: local, release: make(chan struct{})}
+	d := newDeps(testLogger())
+	d.Storage = store
+	recorder := &buildRecorder{Repository: d.Repo, store: store, log: d.Logger, deps: d}
+	a, err := d.Repo.CreateAntarian(lib.Antarian{Name: "libfoo", Version: "1.0.0", Status: lib.StatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+	succeeded := func(id, artifact string) lib.Build {
+		b := testBuild(id, a.Id, 0, lib.BuildSucceeded)
+		b.Artifact = artifact
+		return b
+	}
+
+	// saving returns while the SBOM is still being written
+	saved := make(chan error)
+	go func() {
+		saved <- recorder.SaveBuild(succeeded("b1", "libfoo-1.tgz"))
+	}()
+	select {
+	case err := <-saved:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SaveBuild waited for the SBOM")
+	}
+	if got, _ := d.Repo.FindAntarian(a.Id); got.Artifact != "libfoo-1.tgz" {
+		t.Errorf("artifact = %q, want it recorded at once", got.Artifact)
+	}
+	// the next build replaces the artifact, and its clean up waits its turn
+	if err := recorder.SaveBuild(succeeded("b2", "libfoo-2.tgz")); err != nil {
+		t.Fatal(err)
+	}
+	close(store.release)
+	recorder.wait()
+
+	want := []string{
+		"put libfoo-1.tgz" + lib.SBOMExt,
+		"put libfoo-2.tgz" + lib.SBOMExt,
+		"delete libfoo-1.tgz",
+	}
+	for _, name := range sidecars("libfoo-1.tgz") {
+		want = append(want, "delete "+name)
+	}
+	if !reflect.DeepEqual(store.ops, want) {
+		t.Errorf("storage calls = %v\nwant %v", store.ops, want)
+	}
+	if _, err := local.Stat(context.Background(), a.Id, "libfoo-2.tgz"+lib.SBOMExt); err != nil {
+		t.Errorf("the SBOM of the current artifact: %v", err)
+	}
+	if _, err := local.Stat(context.Background(), a.Id, "libfoo-1.tgz"+lib.SBOMExt); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("the SBOM of the replaced artifact = %v, want it removed", err)
+	}
+}
+
+// TestBuildNamespaces checks that a build is only shown, canceled or logged
+// under the namespace of its Antarian.
+func TestBuildNamespaces(t *testing.T) {
+	_, ts := newTestServer(t)
+	builds := map[string]lib.Build{}
+	for _, ns := range []string{"team-a", "team-b"} {
+		var a lib.Antarian
+		if status := call(t, ts, "POST", "/v1/namespaces/"+ns+"/antarians", lib.Antarian{Name: "libfoo", Version: "1.0.0"}, &a); status != http.StatusCreated {
+			t.Fatalf("create in %s = %d", ns, status)
+		}
+		var b lib.Build
+		if status := call(t, ts, "POST", "/v1/namespaces/"+ns+"/antarians/"+a.Id+"/build", nil, &b); status != http.StatusAccepted {
+			t.Fatalf("build in %s = %d", ns, status)
+		}
+		builds[ns] = b
+	}
+	own, other := "/v1/namespaces/team-a/builds/"+builds["team-a"].Id, "/v1/namespaces/team-a/builds/"+builds["team-b"].Id
+
+	if status := call(t, ts, "GET", own, nil, nil); status != http.StatusOK {
+		t.Errorf("show own build = %d, want 200", status)
+	}
+	if status := call(t, ts, "GET", own+"/logs", nil, nil); status != http.StatusOK {
+		t.Errorf("own build logs = %d, want 200", status)
+	}
+	for _, tt := range []struct{ method, path string }{
+		{"GET", other},
+		{"GET", other + "/logs"},
+		{"GET", other + "/logs?follow=true"},
+		{"DELETE", other},
+		{"GET", "/v1/builds/" + builds["team-b"].Id},
+	} {
+		if status := call(t, ts, tt.method, tt.path, nil, nil); status != http.StatusNotFound {
+			t.Errorf("%s %s = %d, want 404", tt.method, tt.path, status)
+		}
+	}
+	var b lib.Build
+	call(t, ts, "GET", "/v1/namespaces/team-b/builds/"+builds["team-b"].Id, nil, &b)
+	if b.State == lib.BuildCanceled {
+		t.Error("another namespace canceled the build")
+	}
+}
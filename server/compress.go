@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressibleTypes are the media types worth compressing. Artifacts and
+// anything else already compressed are sent as they are.
+var compressibleTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"application/xml",
+	"application/yaml",
+	"application/problem+json",
+}
+
+// Compress encodes responses with gzip or deflate, whichever the client's
+// Accept-Encoding prefers, when their Content-Type is textual. Responses
+// that set their own Content-Encoding are left alone.
+func Compress() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, encoding: acceptedEncoding(r.Header.Get("Accept-Encoding"))}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptedEncoding picks gzip or deflate from an Accept-Encoding header, or
+// returns "" when the client accepts neither.
+func acceptedEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "*" {
+			name = "gzip"
+		}
+		if (name == "gzip" || name == "deflate") && q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") {
+		return true
+	}
+	for _, t := range compressibleTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter decides whether to compress once the handler's headers
+// are known, on the first WriteHeader or Write.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	decided  bool
+	enc      interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func (c *compressWriter) decide(code int) {
+	c.decided = true
+	h := c.Header()
+	if !compressible(h.Get("Content-Type")) || h.Get("Content-Encoding") != "" ||
+		code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		return
+	}
+	h.Add("Vary", "Accept-Encoding")
+	switch c.encoding {
+	case "gzip":
+		c.enc = gzip.NewWriter(c.ResponseWriter)
+	case "deflate":
+		c.enc = zlib.NewWriter(c.ResponseWriter)
+	default:
+		return
+	}
+	h.Set("Content-Encoding", c.encoding)
+	h.Del("Content-Length")
+	// a strong validator no longer matches the encoded bytes
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		h.Set("ETag", "W/"+etag)
+	}
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if !c.decided {
+		c.decide(code)
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.decided {
+		if c.Header().Get("Content-Type") == "" {
+			c.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.enc == nil {
+		return c.ResponseWriter.Write(b)
+	}
+	return c.enc.Write(b)
+}
+
+// FlushError sends what has been compressed so far, for streaming handlers.
+// http.ResponseController looks for this method before unwrapping, so it
+// flushes the encoder rather than only the connection.
+func (c *compressWriter) FlushError() error {
+	if c.enc != nil {
+		if err := c.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// Close writes the end of the compressed stream.
+func (c *compressWriter) Close() error {
+	if c.enc == nil {
+		return nil
+	}
+	return c.enc.Close()
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Hijack hands the connection to the handler, which is only possible
+// before anything was compressed.
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if c.enc != nil {
+		return nil, nil, errors.New("compress: response already started")
+	}
+	c.decided = true
+	return http.NewResponseController(c.ResponseWriter).Hijack()
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCompressFlush(t *testing.T) {
+	release := make(chan struct{})
+	h := Compress()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Error(err)
+		}
+		<-release
+	}))
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	// runs before ts.Close, which waits for the handler
+	defer close(release)
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if enc := resp.Header.Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", enc)
+	}
+
+	// the flushed event arrives while the handler is still running
+	line := make(chan string, 1)
+	go func() {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			line <- err.Error()
+			return
+		}
+		s, _ := bufio.NewReader(zr).ReadString('\n')
+		line <- s
+	}()
+	select {
+	case s := <-line:
+		if s != "data: first\n" {
+			t.Errorf("read %q, want the first event", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the flushed event was not sent")
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/xbcsmith/antares/config"
+)
+
+// corsExposed are the response headers browsers let cross-origin scripts
+// read.
+var corsExposed = []string{"ETag", "Link", "Location", "Retry-After", "X-Queue-Position", "X-Request-Id", "Deprecation"}
+
+// CORS lets browsers on cfg.CORSOrigins call the API. Preflight OPTIONS
+// requests are answered here, before routing and authentication, since
+// browsers send them without credentials. Requests from other origins are
+// served without CORS headers, so browsers refuse them.
+func CORS(cfg *config.Config) Middleware {
+	methods := strings.Join(cfg.CORSMethods, ", ")
+	headers := strings.Join(cfg.CORSHeaders, ", ")
+	exposed := strings.Join(corsExposed, ", ")
+	maxAge := strconv.Itoa(int(cfg.CORSMaxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+			if !allowedOrigin(cfg.CORSOrigins, origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Header().Set("Access-Control-Expose-Headers", exposed)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowedOrigin reports whether origin is one of origins, or origins
+// allows any with "*".
+func allowedOrigin(origins []string, origin string) bool {
+	for _, o := range origins {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
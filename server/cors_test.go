@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/xbcsmith/antares/config"
+)
+
+func TestCORS(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.Tokens = []string{"tok"}
+		c.CORSOrigins = []string{"https://ui.example.com/"}
+	})
+	request := func(method, origin string, header ...string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+"/v1/antarians", nil)
+		req.Header.Set("Origin", origin)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	preflight := []string{"Access-Control-Request-Method", "POST", "Access-Control-Request-Headers", "Authorization"}
+
+	// an allowed origin is echoed, and its preflight answered without a token
+	resp := request("OPTIONS", "https://ui.example.com", preflight...)
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "https://ui.example.com" {
+		t.Errorf("allowed preflight = %d, Allow-Origin %q", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	if resp.Header.Get("Access-Control-Allow-Methods") == "" || resp.Header.Get("Access-Control-Allow-Headers") == "" {
+		t.Errorf("allowed preflight headers = %v", resp.Header)
+	}
+	resp = request("GET", "https://UI.example.com", "Authorization", "Bearer tok")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != "https://UI.example.com" || resp.Header.Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("allowed request = %d, headers %v", resp.StatusCode, resp.Header)
+	}
+
+	// other origins get no CORS headers at all
+	for _, origin := range []string{"https://evil.example.com", "https://ui.example.com.evil.com", "null"} {
+		for _, resp := range []*http.Response{request("OPTIONS", origin, preflight...), request("GET", origin, "Authorization", "Bearer tok")} {
+			if v := resp.Header.Get("Access-Control-Allow-Origin"); v != "" {
+				t.Errorf("%s %s: Allow-Origin = %q, want none", resp.Request.Method, origin, v)
+			}
+			if v := resp.Header.Get("Access-Control-Allow-Methods"); v != "" {
+				t.Errorf("%s %s: Allow-Methods = %q, want none", resp.Request.Method, origin, v)
+			}
+		}
+	}
+}
+
+func TestAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		origins []string
+		origin  string
+		want    bool
+	}{
+		{[]string{"https://ui.example.com"}, "https://ui.example.com", true},
+		{[]string{"https://ui.example.com/"}, "https://ui.example.com", true},
+		{[]string{"https://ui.example.com"}, "http://ui.example.com", false},
+		{[]string{"https://ui.example.com"}, "https://ui.example.com:8443", false},
+		{[]string{"*"}, "https://anything.example.com", true},
+		{nil, "https://ui.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := allowedOrigin(tt.origins, tt.origin); got != tt.want {
+			t.Errorf("allowedOrigin(%v, %q) = %v, want %v", tt.origins, tt.origin, got, tt.want)
+		}
+	}
+}
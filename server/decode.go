@@ -0,0 +1,252 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// decodeError describes why a request body was rejected. Field is empty when
+// the problem is not tied to one field.
+type decodeError struct {
+	Status  int
+	Field   string
+	Offset  int64
+	Message string
+}
+
+func (e *decodeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s at offset %d", e.Message, e.Offset)
+	}
+	return fmt.Sprintf("%s: %s at offset %d", e.Field, e.Message, e.Offset)
+}
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// decodeJSON reads the request body, JSON or YAML by its Content-Type, into
+// v. The body is limited to
+// request.max_bytes and request.max_depth, and unless request.lenient is
+// set, unknown fields, duplicate keys and anything after the document are
+// rejected. Failures are returned as a *decodeError.
+func decodeJSON(d *Deps, r *http.Request, v interface{}) error {
+	limits := d.Config.Request
+	raw, err := ioutil.ReadAll(io.LimitReader(r.Body, limits.MaxBytes+1))
+	if err != nil {
+		return &decodeError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	if int64(len(raw)) > limits.MaxBytes {
+		return &decodeError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Offset:  limits.MaxBytes,
+			Message: fmt.Sprintf("body exceeds %d bytes", limits.MaxBytes),
+		}
+	}
+	if requestYAML(r) && len(bytes.TrimSpace(raw)) > 0 {
+		if raw, err = yamlToJSON(raw); err != nil {
+			return err
+		}
+	}
+	if err := scanJSON(raw, limits.MaxDepth, !limits.Lenient); err != nil {
+		return err
+	}
+
+	if !limits.Lenient {
+		// Types with their own UnmarshalJSON never see DisallowUnknownFields,
+		// so check the fields against a method-less copy of v first.
+		target, copied := plain(v)
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(target); err != nil {
+			return toDecodeError(err, dec.InputOffset())
+		}
+		if !copied {
+			return nil
+		}
+	}
+	// a decoder stops after the first document, which is all a lenient
+	// request is read for
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if err := dec.Decode(v); err != nil {
+		return toDecodeError(err, dec.InputOffset())
+	}
+	return nil
+}
+
+// validateUpdate is Antarian.Validate for a replacing before, the stored
+// record. A version stored before versions were checked may be kept.
+func validateUpdate(a, before lib.Antarian) error {
+	err := a.Validate()
+	var errs lib.ValidationErrors
+	if errors.As(err, &errs) && a.Version == before.Version {
+		return errs.Without("version")
+	}
+	return err
+}
+
+// writeDecodeError sends err, as returned by decodeJSON or a validation,
+// with a detail for each field of lib.ValidationErrors.
+func writeDecodeError(d *Deps, w http.ResponseWriter, r *http.Request, err error) {
+	var errs lib.ValidationErrors
+	if errors.As(err, &errs) {
+		requestLogger(d.Logger, r).Info("invalid request body", "err", err)
+		details := make([]fieldError, len(errs))
+		for i, ve := range errs {
+			details[i] = fieldError{Field: ve.Field, Message: ve.Message}
+		}
+		writeError(d, w, r, http.StatusUnprocessableEntity, err.Error(), details...)
+		return
+	}
+	var ve *lib.ValidationError
+	if errors.As(err, &ve) {
+		requestLogger(d.Logger, r).Info("invalid request body", "err", err)
+		writeError(d, w, r, http.StatusUnprocessableEntity, ve.Error(), fieldError{Field: ve.Field, Message: ve.Message})
+		return
+	}
+	de, ok := err.(*decodeError)
+	if !ok {
+		de = &decodeError{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+	}
+	requestLogger(d.Logger, r).Info("invalid request body", "err", de)
+	var details []fieldError
+	if de.Field != "" {
+		details = []fieldError{{Field: de.Field, Message: fmt.Sprintf("%s at offset %d", de.Message, de.Offset)}}
+	}
+	writeError(d, w, r, de.Status, de.Error(), details...)
+}
+
+// frame is an open object or array seen by scanJSON.
+type frame struct {
+	object  bool
+	wantKey bool
+	keys    map[string]bool
+}
+
+// scanJSON walks the document's tokens, enforcing maxDepth and, when strict,
+// rejecting duplicate keys and trailing data.
+func scanJSON(raw []byte, maxDepth int, strict bool) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	var stack []*frame
+	values := 0
+	for {
+		offset := tokenStart(raw, dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF && len(stack) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == io.EOF {
+			if values == 0 {
+				return &decodeError{Status: http.StatusUnprocessableEntity, Message: "empty body"}
+			}
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			return toDecodeError(err, int64(len(raw)))
+		}
+		if err != nil {
+			return toDecodeError(err, dec.InputOffset())
+		}
+		if len(stack) == 0 {
+			if values++; values > 1 {
+				if !strict {
+					return nil
+				}
+				return &decodeError{Status: http.StatusUnprocessableEntity, Offset: offset, Message: "unexpected data after the JSON document"}
+			}
+		}
+
+		var top *frame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if top != nil && top.object && top.wantKey {
+			if key, ok := tok.(string); ok {
+				if strict && top.keys[key] {
+					return &decodeError{Status: http.StatusUnprocessableEntity, Field: key, Offset: offset, Message: "duplicate key"}
+				}
+				top.keys[key] = true
+				top.wantKey = false
+				continue
+			}
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			if top != nil && top.object {
+				top.wantKey = true
+			}
+			if len(stack) >= maxDepth {
+				return &decodeError{Status: http.StatusUnprocessableEntity, Offset: offset, Message: fmt.Sprintf("nesting exceeds depth %d", maxDepth)}
+			}
+			stack = append(stack, &frame{object: tok == json.Delim('{'), wantKey: true, keys: map[string]bool{}})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		default:
+			if top != nil && top.object {
+				top.wantKey = true
+			}
+		}
+	}
+}
+
+// tokenStart returns the offset of the token after offset, past the
+// whitespace and separators the decoder has not consumed yet.
+func tokenStart(raw []byte, offset int64) int64 {
+	for offset < int64(len(raw)) && strings.IndexByte(" \t\r\n,:", raw[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// toDecodeError converts an encoding/json error. offset is used for errors
+// that do not carry their own.
+func toDecodeError(err error, offset int64) *decodeError {
+	de := &decodeError{Status: http.StatusUnprocessableEntity, Offset: offset, Message: err.Error()}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		de.Offset = syntaxErr.Offset
+		de.Message = syntaxErr.Error()
+	case errors.As(err, &typeErr):
+		de.Field = typeErr.Field
+		de.Offset = typeErr.Offset
+		de.Message = fmt.Sprintf("cannot use %s as %s", typeErr.Value, typeErr.Type)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		de.Field = strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		de.Message = "unknown field"
+	case err == io.ErrUnexpectedEOF:
+		de.Message = "unexpected end of JSON input"
+	}
+	return de
+}
+
+// plain returns a pointer to a zero struct with the same fields and tags as
+// *v but none of its methods, reporting whether it made one. v is returned
+// unchanged when it cannot be copied.
+func plain(v interface{}) (interface{}, bool) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return v, false
+	}
+	st := t.Elem()
+	fields := make([]reflect.StructField, st.NumField())
+	for i := range fields {
+		f := st.Field(i)
+		if f.PkgPath != "" || f.Anonymous {
+			return v, false
+		}
+		fields[i] = f
+	}
+	return reflect.New(reflect.StructOf(fields)).Interface(), true
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		lenient bool
+		status  int
+		field   string
+		message string
+		offset  int64
+		version string
+	}{
+		{"valid", `{"name":"libfoo","version":"1.2.3"}`, false, 0, "", "", 0, "1.2.3"},
+		{"typo", `{"name":"libfoo","verion":"1.2.3"}`, false, 422, "verion", "unknown field", 0, ""},
+		{"typo nested", `{"name":"libfoo","buildspec":{"comand":"make"}}`, false, 422, "comand", "unknown field", 0, ""},
+		{"typo lenient", `{"name":"libfoo","verion":"1.2.3"}`, true, 0, "", "", 0, ""},
+		{"number for a string", `{"name":"libfoo","version":123}`, false, 422, "version", "cannot use number as string", 30, ""},
+		{"string for a list", `{"name":"libfoo","requires":"libbar"}`, false, 422, "requires", "cannot use string as []string", 36, ""},
+		{"object for a string", `{"name":{"first":"lib"}}`, false, 422, "name", "cannot use object as string", 9, ""},
+		{"wrong type lenient", `{"name":"libfoo","version":123}`, true, 422, "version", "cannot use number as string", 0, ""},
+		{"duplicate key", `{"name":"libfoo","version":"1.0.0","version":"2.0.0"}`, false, 422, "version", "duplicate key", 35, ""},
+		{"duplicate nested key", `{"name":"libfoo","labels":{"team":"a","team":"b"}}`, false, 422, "team", "duplicate key", 38, ""},
+		{"same key in two objects", `{"name":"libfoo","labels":{"name":"a"},"annotations":{"name":"b"}}`, false, 0, "", "", 0, ""},
+		{"duplicate key lenient", `{"name":"libfoo","version":"1.0.0","version":"2.0.0"}`, true, 0, "", "", 0, "2.0.0"},
+		{"second document", `{"name":"libfoo"} {"name":"libbar"}`, false, 422, "", "unexpected data after the JSON document", 18, ""},
+		{"trailing garbage", `{"name":"libfoo"} garbage`, false, 422, "", "invalid character 'g' looking for beginning of value", 19, ""},
+		{"trailing whitespace", "{\"name\":\"libfoo\",\"version\":\"1.0.0\"}\n\n", false, 0, "", "", 0, "1.0.0"},
+		{"second document lenient", `{"name":"libfoo","version":"1.0.0"} {"version":"2.0.0"}`, true, 0, "", "", 0, "1.0.0"},
+		{"truncated", `{"name":"libfoo",`, false, 422, "", "unexpected end of JSON input", 17, ""},
+		{"empty", ``, false, 422, "", "empty body", 0, ""},
+		{"too deep", `{"labels":` + strings.Repeat("[", 40) + strings.Repeat("]", 40) + `}`, false, 422, "", "nesting exceeds depth 32", 41, ""},
+		{"too large", `{"name":"` + strings.Repeat("x", 2<<20) + `"}`, false, 413, "", "body exceeds 1048576 bytes", 1 << 20, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, _ := newCapture()
+			d := newDeps(log)
+			d.Config.Request.MaxBytes = 1 << 20
+			d.Config.Request.Lenient = tt.lenient
+			var a lib.Antarian
+			err := decodeJSON(d, httptest.NewRequest("POST", "/antarians", strings.NewReader(tt.body)), &a)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("decodeJSON error = %v", err)
+				}
+				if a.Version != tt.version {
+					t.Errorf("version = %q, want %q", a.Version, tt.version)
+				}
+				return
+			}
+			de, ok := err.(*decodeError)
+			if !ok {
+				t.Fatalf("decodeJSON error = %#v, want a *decodeError", err)
+			}
+			if de.Status != tt.status || de.Field != tt.field || de.Message != tt.message {
+				t.Errorf("error = %d %q %q, want %d %q %q", de.Status, de.Field, de.Message, tt.status, tt.field, tt.message)
+			}
+			if tt.offset != 0 && de.Offset != tt.offset {
+				t.Errorf("offset = %d, want %d", de.Offset, tt.offset)
+			}
+		})
+	}
+}
+
+func TestDecodeErrorResponse(t *testing.T) {
+	_, ts := newTestServer(t)
+	tests := []struct {
+		body   string
+		status int
+		detail string
+	}{
+		{`{"name":"libfoo","verion":"1.2.3"}`, 422, "verion"},
+		{`{"name":"libfoo","version":1}`, 422, "version"},
+		{`{"name":"libfoo","version":"1.0.0"}{}`, 422, ""},
+	}
+	for _, tt := range tests {
+		var apiErr APIError
+		if status := call(t, ts, "POST", "/v1/antarians", tt.body, &apiErr); status != tt.status {
+			t.Errorf("POST %s = %d, want %d", tt.body, status, tt.status)
+		}
+		if apiErr.Code != "invalid" || !strings.Contains(apiErr.Message, "at offset") {
+			t.Errorf("POST %s error = %+v, want an invalid error with the offset", tt.body, apiErr)
+		}
+		if tt.detail == "" {
+			continue
+		}
+		if len(apiErr.Details) != 1 || apiErr.Details[0].Field != tt.detail {
+			t.Errorf("POST %s details = %+v, want one for %s", tt.body, apiErr.Details, tt.detail)
+		}
+	}
+
+	// nothing was created by the rejected requests
+	var list []lib.Antarian
+	call(t, ts, "GET", "/v1/antarians?name=libfoo", nil, &list)
+	if len(list) != 0 {
+		t.Errorf("%d antarians created from rejected bodies", len(list))
+	}
+}
+
+func TestDecodeYAML(t *testing.T) {
+	log, _ := newCapture()
+	d := newDeps(log)
+	tests := []struct {
+		body  string
+		field string
+	}{
+		{"name: libfoo\nversion: 1.2.3\n", ""},
+		{"name: libfoo\nverion: 1.2.3\n", "verion"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/antarians", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/yaml")
+		var a lib.Antarian
+		err := decodeJSON(d, r, &a)
+		if tt.field == "" {
+			if err != nil || a.Version != "1.2.3" {
+				t.Errorf("decode %q = %+v, %v", tt.body, a, err)
+			}
+			continue
+		}
+		if de, ok := err.(*decodeError); !ok || de.Field != tt.field || de.Status != http.StatusUnprocessableEntity {
+			t.Errorf("decode %q error = %v, want an unknown %s", tt.body, err, tt.field)
+		}
+	}
+}
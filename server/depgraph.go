@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// dependencyNode is an Antarian in a dependency tree, with the Antarians
+// it requires or, in a reverse tree, those requiring it.
+type dependencyNode struct {
+	Id      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	// Requirement is the requires entry the node was resolved from, in a
+	// forward tree; Error tells why it resolved to no Antarian.
+	Requirement string `json:"requirement,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// Cycle marks an Antarian already on the path from the root, whose
+	// dependencies are not repeated.
+	Cycle bool              `json:"cycle,omitempty"`
+	Deps  []*dependencyNode `json:"deps,omitempty"`
+}
+
+// dependencyGraph answers AntarianDeps. It is Valid when no requirement
+// is Missing and there are no Cycles, each listed as the names around it.
+type dependencyGraph struct {
+	Reverse bool            `json:"reverse"`
+	Root    *dependencyNode `json:"root"`
+	Missing []string        `json:"missing,omitempty"`
+	Cycles  [][]string      `json:"cycles,omitempty"`
+	Valid   bool            `json:"valid"`
+}
+
+// AntarianDeps resolves the transitive dependency tree of an Antarian, each
+// requires entry to the latest version matching it, or with ?reverse=true
+// the tree of the Antarians requiring it. Missing requirements and cycles
+// are reported rather than refused. ?format=dot answers with the graph in
+// Graphviz DOT, edges pointing from an Antarian to the one it requires.
+func AntarianDeps(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		antarianId := mux.Vars(r)["antarianId"]
+		q := r.URL.Query()
+		reverse := false
+		if v := q.Get("reverse"); v != "" {
+			var err error
+			if reverse, err = strconv.ParseBool(v); err != nil {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("reverse: %q is not a boolean", v))
+				return
+			}
+		}
+		format := q.Get("format")
+		if format != "" && format != "json" && format != "dot" {
+			writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("format: %q is not json or dot", format))
+			return
+		}
+		a, err := d.repo(r.Context()).FindAntarian(antarianId)
+		if err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "find antarian", err)
+			return
+		}
+
+		g := &graphWalker{d: d, ctx: r.Context(), seen: map[string]bool{}, cycles: map[string]bool{}}
+		if reverse {
+			if err := g.requiredBy(); err != nil {
+				internalError(d, w, r, "resolve requires", err)
+				return
+			}
+		}
+		graph := dependencyGraph{Reverse: reverse}
+		if graph.Root, err = g.walk(a, nil); err != nil {
+			internalError(d, w, r, "resolve requires", err)
+			return
+		}
+		graph.Missing, graph.Cycles = g.missing, g.cycleList
+		graph.Valid = len(graph.Missing) == 0 && len(graph.Cycles) == 0
+		if format == "dot" {
+			w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(dependencyDOT(graph)); err != nil {
+				requestLogger(d.Logger, r).Error("write response", "err", err, "status", http.StatusOK)
+			}
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, graph)
+	}
+}
+
+// graphWalker builds the dependency tree of one request.
+type graphWalker struct {
+	d   *Deps
+	ctx context.Context
+	// reverse holds the Antarians requiring each Antarian, by id, for a
+	// reverse tree; it is nil for a forward one
+	reverse map[string]lib.Antarians
+	// seen holds the entries of missing
+	seen    map[string]bool
+	missing []string
+	// cycles holds the cycles found, keyed by their ids in a fixed rotation
+	cycles    map[string]bool
+	cycleList [][]string
+}
+
+// requiredBy resolves the requirements of every Antarian, to walk the
+// tree in reverse. Entries that resolve to nothing are skipped.
+func (g *graphWalker) requiredBy() error {
+	g.reverse = map[string]lib.Antarians{}
+	repo := g.d.repo(g.ctx)
+	var all lib.Antarians
+	if err := repo.EachAntarian(func(a lib.Antarian) error {
+		all = append(all, a)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, a := range all {
+		seen := map[string]bool{}
+		for _, req := range a.Requires {
+			dep, ok, err := resolveRequire(g.d, g.ctx, req)
+			if _, invalid := err.(*lib.ValidationError); invalid {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if ok && !seen[dep.Id] {
+				seen[dep.Id] = true
+				g.reverse[dep.Id] = append(g.reverse[dep.Id], a)
+			}
+		}
+	}
+	return nil
+}
+
+// walk returns the tree below a, reached through the Antarians on path.
+func (g *graphWalker) walk(a lib.Antarian, path []lib.Antarian) (*dependencyNode, error) {
+	n := &dependencyNode{Id: a.Id, Name: a.Name, Version: a.Version}
+	for i, p := range path {
+		if p.Id == a.Id {
+			n.Cycle = true
+			g.cycle(append(path[i:], a))
+			return n, nil
+		}
+	}
+	path = append(path[:len(path):len(path)], a)
+	if g.reverse != nil {
+		for _, dep := range g.reverse[a.Id] {
+			child, err := g.walk(dep, path)
+			if err != nil {
+				return nil, err
+			}
+			n.Deps = append(n.Deps, child)
+		}
+		return n, nil
+	}
+	for _, req := range a.Requires {
+		dep, ok, err := resolveRequire(g.d, g.ctx, req)
+		if v, invalid := err.(*lib.ValidationError); invalid {
+			n.Deps = append(n.Deps, g.unresolved(a, req, v.Message))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			n.Deps = append(n.Deps, g.unresolved(a, req, "matches no Antarian"))
+			continue
+		}
+		child, err := g.walk(dep, path)
+		if err != nil {
+			return nil, err
+		}
+		child.Requirement = req
+		n.Deps = append(n.Deps, child)
+	}
+	return n, nil
+}
+
+// unresolved records the requires entry req of a, which resolves to no
+// Antarian for reason, and returns its node.
+func (g *graphWalker) unresolved(a lib.Antarian, req, reason string) *dependencyNode {
+	msg := fmt.Sprintf("%s %s requires %q: %s", a.Name, a.Version, req, reason)
+	if !g.seen[msg] {
+		g.seen[msg] = true
+		g.missing = append(g.missing, msg)
+	}
+	name, _, _ := strings.Cut(strings.TrimSpace(req), " ")
+	return &dependencyNode{Name: name, Requirement: req, Error: reason}
+}
+
+// cycle records the cycle through the Antarians of path, whose first and
+// last are the same, once whichever of them the walk entered it by.
+func (g *graphWalker) cycle(path []lib.Antarian) {
+	ring := path[:len(path)-1]
+	ids := make([]string, len(ring))
+	start := 0
+	for i, p := range ring {
+		ids[i] = p.Id
+		if p.Id < ring[start].Id {
+			start = i
+		}
+	}
+	key := strings.Join(append(ids[start:], ids[:start]...), " ")
+	if g.cycles[key] {
+		return
+	}
+	g.cycles[key] = true
+	names := make([]string, len(path))
+	for i, p := range path {
+		names[i] = p.Name
+	}
+	g.cycleList = append(g.cycleList, names)
+}
+
+// dependencyDOT renders graph in Graphviz DOT. Edges point from an
+// Antarian to one it requires, in either direction of the tree; missing
+// requirements are dashed and edges closing a cycle red.
+func dependencyDOT(graph dependencyGraph) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "digraph %q {\n", graph.Root.Name+" "+graph.Root.Version)
+	nodes := map[string]bool{}
+	edges := map[string]bool{}
+	var visit func(n *dependencyNode)
+	node := func(n *dependencyNode) string {
+		id := n.Id
+		if id == "" {
+			id = "missing:" + n.Requirement
+		}
+		if !nodes[id] {
+			nodes[id] = true
+			if n.Id == "" {
+				fmt.Fprintf(&buf, "\t%q [label=%q, style=dashed];\n", id, n.Requirement)
+			} else {
+				fmt.Fprintf(&buf, "\t%q [label=%q];\n", id, n.Name+" "+n.Version)
+			}
+		}
+		return id
+	}
+	visit = func(n *dependencyNode) {
+		from := node(n)
+		for _, dep := range n.Deps {
+			to := node(dep)
+			if graph.Reverse {
+				from, to = to, from
+			}
+			if key := from + "\x00" + to; !edges[key] {
+				edges[key] = true
+				attrs := ""
+				if dep.Cycle {
+					attrs = " [color=red]"
+				} else if dep.Id == "" {
+					attrs = " [style=dashed]"
+				}
+				fmt.Fprintf(&buf, "\t%q -> %q%s;\n", from, to, attrs)
+			}
+			if graph.Reverse {
+				from, to = to, from
+			}
+			visit(dep)
+		}
+	}
+	visit(graph.Root)
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
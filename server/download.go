@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+var (
+	errBadSignature     = errors.New("invalid download signature")
+	errExpiredSignature = errors.New("download link has expired")
+)
+
+// downloadURL returns the link to filename of a, and when it expires. With
+// artifact_url_ttl set it is presigned by the store or, for stores that
+// cannot, a /files link signed with artifact_url_secret; otherwise a plain
+// /files link that needs a token like any other request.
+func downloadURL(ctx context.Context, d *Deps, a lib.Antarian, filename string) (string, *time.Time, error) {
+	path := "/files/" + url.PathEscape(a.Id) + "/" + url.PathEscape(filename)
+	ttl := d.Config.ArtifactURLTTL
+	if ttl == 0 {
+		return a.Uri + path, nil, nil
+	}
+	expires := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	u, err := d.Storage.SignedURL(ctx, a.Id, filename, ttl)
+	if err == nil {
+		return u, &expires, nil
+	}
+	if !errors.Is(err, errors.ErrUnsupported) {
+		return "", nil, err
+	}
+	if d.Config.ArtifactURLSecret == "" {
+		return a.Uri + path, nil, nil
+	}
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	q := url.Values{"expires": {exp}, "signature": {signDownload(d.Config.ArtifactURLSecret, path, exp)}}
+	return a.Uri + path + "?" + q.Encode(), &expires, nil
+}
+
+// signDownload returns the signature of a link to path valid until the
+// unix time expires.
+func signDownload(secret, path, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyDownload checks the signature of a request for a signed link.
+func verifyDownload(secret string, r *http.Request) error {
+	q := r.URL.Query()
+	exp := q.Get("expires")
+	sig, err := hex.DecodeString(q.Get("signature"))
+	if err != nil || secret == "" {
+		return errBadSignature
+	}
+	want, _ := hex.DecodeString(signDownload(secret, r.URL.EscapedPath(), exp))
+	if !hmac.Equal(sig, want) {
+		return errBadSignature
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return errBadSignature
+	}
+	if time.Now().After(time.Unix(unix, 0)) {
+		return errExpiredSignature
+	}
+	return nil
+}
+
+// signedOr admits requests carrying a signature made by downloadURL, and
+// passes the rest to auth. A bad or expired signature is answered with 403
+// rather than falling back to auth, so clients see why their link failed.
+func signedOr(d *Deps, auth Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		authed := next
+		if auth != nil {
+			authed = auth(next)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !r.URL.Query().Has("signature") {
+				authed.ServeHTTP(w, r)
+				return
+			}
+			if err := verifyDownload(d.Config.ArtifactURLSecret, r); err != nil {
+				writeError(d, w, r, http.StatusForbidden, err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+func TestSignedDownload(t *testing.T) {
+	const secret = "download secret"
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.Tokens = []string{"tok"}
+		c.ArtifactURLSecret = secret
+	})
+	auth := []string{"Authorization", "Bearer tok"}
+	links := map[string]*url.URL{}
+	for _, name := range []string{"libfoo", "libbar"} {
+		var a lib.Antarian
+		call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: name, Version: "1.0.0"}, &a, auth...)
+		if status := call(t, ts, "POST", "/v1/antarians/"+a.Id+"/artifact", name+" artifact", nil, append(auth, "Content-Type", "application/octet-stream")...); status != http.StatusCreated {
+			t.Fatalf("upload %s = %d", name, status)
+		}
+		var d lib.Download
+		call(t, ts, "GET", "/v1/antarians/"+a.Id+"/download", nil, &d, auth...)
+		u, err := url.Parse(d.Url)
+		if err != nil || d.Expires == nil || !u.Query().Has("signature") {
+			t.Fatalf("download url %q expiring %v, want a signed link", d.Url, d.Expires)
+		}
+		links[name] = u
+	}
+	get := func(path string, q url.Values) int {
+		resp, err := ts.Client().Get(ts.URL + path + "?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	foo := links["libfoo"]
+
+	if status := get(foo.EscapedPath(), foo.Query()); status != http.StatusOK {
+		t.Errorf("signed link = %d, want 200 without a token", status)
+	}
+
+	tampered := foo.Query()
+	sig := []byte(tampered.Get("signature"))
+	sig[0] ^= 1
+	tampered.Set("signature", string(sig))
+
+	extended := foo.Query()
+	extended.Set("expires", strconv.FormatInt(time.Now().Add(24*time.Hour).Unix(), 10))
+
+	exp := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	expired := url.Values{"expires": {exp}, "signature": {signDownload(secret, foo.EscapedPath(), exp)}}
+
+	tests := []struct {
+		name string
+		path string
+		q    url.Values
+	}{
+		{"tampered signature", foo.EscapedPath(), tampered},
+		{"extended expiry", foo.EscapedPath(), extended},
+		{"expired", foo.EscapedPath(), expired},
+		{"another artifact", links["libbar"].EscapedPath(), foo.Query()},
+		{"not hex", foo.EscapedPath(), url.Values{"expires": foo.Query()["expires"], "signature": {"zz"}}},
+	}
+	for _, tt := range tests {
+		if status := get(tt.path, tt.q); status != http.StatusForbidden {
+			t.Errorf("%s = %d, want 403", tt.name, status)
+		}
+	}
+	// without a signature the token is needed as before
+	if status := get(foo.EscapedPath(), nil); status != http.StatusUnauthorized {
+		t.Errorf("unsigned link = %d, want 401", status)
+	}
+}
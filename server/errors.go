@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// APIError is the JSON body of every error response. Code is a stable,
+// machine readable form of the status; Message is for people.
+type APIError struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []fieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// errorCodes maps the statuses the API uses to their codes.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusUnprocessableEntity:   "invalid",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusInternalServerError:   "internal",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// errorCode returns the code of status, falling back to the numeric status.
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	return http.StatusText(status)
+}
+
+// newAPIError returns the error body for status, tagged with the request id.
+func newAPIError(r *http.Request, status int, msg string, details ...fieldError) APIError {
+	return APIError{
+		Code:      errorCode(status),
+		Message:   msg,
+		Details:   details,
+		RequestID: RequestID(r.Context()),
+	}
+}
+
+// writeError answers with status and an APIError carrying msg.
+func writeError(d *Deps, w http.ResponseWriter, r *http.Request, status int, msg string, details ...fieldError) {
+	writeJSON(d, w, r, status, newAPIError(r, status, msg, details...))
+}
+
+// writeErrorBody is writeError for callers without Deps, such as
+// middleware that runs before them.
+func writeErrorBody(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(newAPIError(r, status, msg))
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// etagHeaders are the response headers that describe a collection beyond
+// the page in the body, so they count towards its ETag.
+var etagHeaders = []string{"X-Total-Count", "Link"}
+
+// writeCacheable is writeJSON for a 200 response with an ETag: a hash of
+// the encoded body and the etagHeaders already set. A request whose
+// If-None-Match names the same tag gets 304 Not Modified and no body, so
+// polling clients only download what changed.
+func writeCacheable(d *Deps, w http.ResponseWriter, r *http.Request, v interface{}) {
+	contentType, body, err := encodeBody(r, v)
+	if err != nil {
+		internalError(d, w, r, "encode response", err)
+		return
+	}
+	h := sha256.New()
+	h.Write([]byte(contentType + "\n"))
+	h.Write(body)
+	for _, name := range etagHeaders {
+		for _, value := range w.Header().Values(name) {
+			h.Write([]byte("\n" + name + ": " + value))
+		}
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Accept")
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		requestLogger(d.Logger, r).Error("write response", "err", err)
+	}
+}
+
+// etagMatch reports whether an If-None-Match header names etag, comparing
+// weakly as RFC 9110 requires: W/"x" matches "x".
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
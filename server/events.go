@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+const (
+	// eventBuffer is how many events a subscriber may fall behind by
+	// before it is dropped.
+	eventBuffer = 64
+	// eventHistory is how many of the latest events are kept for Since.
+	eventHistory = 256
+)
+
+// EventHub fans the lifecycle events of Antarians and builds out to its
+// subscribers. Events are numbered in the order they are published, and
+// the latest are retained so a subscriber that reconnects can catch up.
+type EventHub struct {
+	mu      sync.Mutex
+	seq     uint64
+	subs    map[chan Notification]struct{}
+	history []Notification
+}
+
+// Notification is a published event together with the Antarian it is
+// about, so subscribers can filter build events by name and namespace.
+type Notification struct {
+	Event     lib.Event
+	Name      string
+	Namespace string
+}
+
+// NewEventHub returns a hub without subscribers.
+func NewEventHub() *EventHub {
+	return &EventHub{subs: map[chan Notification]struct{}{}}
+}
+
+// Publish numbers and timestamps ev and sends it to every subscriber
+// without blocking. A subscriber whose buffer is full is dropped: its
+// channel is closed, so it knows it has missed events.
+func (h *EventHub) Publish(ev lib.Event, a lib.Antarian) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev.Id = strconv.FormatUint(h.seq, 10)
+	ev.Time = time.Now().UTC()
+	n := Notification{Event: ev, Name: a.Name, Namespace: a.NamespaceOrDefault()}
+	if len(h.history) == eventHistory {
+		copy(h.history, h.history[1:])
+		h.history = h.history[:eventHistory-1]
+	}
+	h.history = append(h.history, n)
+	for ch := range h.subs {
+		select {
+		case ch <- n:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on
+// and a function that ends the subscription.
+func (h *EventHub) Subscribe() (<-chan Notification, func()) {
+	ch := make(chan Notification, eventBuffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Since returns the retained events published after the one numbered
+// after, oldest first. Older events than the hub retains are lost.
+func (h *EventHub) Since(after uint64) []Notification {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := sort.Search(len(h.history), func(i int) bool { return eventSeq(h.history[i]) > after })
+	return append([]Notification(nil), h.history[i:]...)
+}
+
+// eventSeq is the number Publish gave the event of n.
+func eventSeq(n Notification) uint64 {
+	seq, _ := strconv.ParseUint(n.Event.Id, 10, 64)
+	return seq
+}
+
+// follow calls fn for every event published to hub until ctx is done.
+// When fn falls so far behind that the hub drops it, follow warns and
+// subscribes again; events published in between are missed.
+func (h *EventHub) follow(ctx context.Context, log *slog.Logger, fn func(Notification)) {
+	for {
+		events, stop := h.Subscribe()
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				stop()
+				return
+			case n, ok := <-events:
+				if !ok {
+					log.Warn("event subscriber fell behind, events were missed")
+					open = false
+					continue
+				}
+				fn(n)
+			}
+		}
+	}
+}
+
+// EventFilter selects notifications by the name and namespace of their
+// Antarian and by event type. An empty list matches everything.
+type EventFilter struct {
+	Names      []string `json:"names"`
+	Namespaces []string `json:"namespaces"`
+	Types      []string `json:"types"`
+}
+
+// Match reports whether n passes the filter.
+func (f EventFilter) Match(n Notification) bool {
+	return matchAny(f.Names, n.Name) && matchAny(f.Namespaces, n.Namespace) && matchAny(f.Types, n.Event.Type)
+}
+
+func matchAny(list []string, s string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// eventRepo publishes an event to a hub for every change made through a
+// Repository, whichever API made it. Build records are published when they
+// start and finish.
+type eventRepo struct {
+	Repository
+	hub *EventHub
+}
+
+// withEvents returns repo wrapped so every change is published to hub.
+func withEvents(repo Repository, hub *EventHub) Repository {
+	return &eventRepo{Repository: repo, hub: hub}
+}
+
+func (r *eventRepo) CreateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	a, err := r.Repository.CreateAntarian(s)
+	if err == nil {
+		r.hub.Publish(lib.Event{Type: lib.EventAntarianCreated, Antarian: &a}, a)
+	}
+	return a, err
+}
+
+func (r *eventRepo) UpdateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	a, err := r.Repository.UpdateAntarian(s)
+	if err == nil {
+		r.hub.Publish(lib.Event{Type: lib.EventAntarianUpdated, Antarian: &a}, a)
+	}
+	return a, err
+}
+
+func (r *eventRepo) DestroyAntarian(id string) error {
+	a, err := r.Repository.FindAntarian(id)
+	if err != nil {
+		return err
+	}
+	if err := r.Repository.DestroyAntarian(id); err != nil {
+		return err
+	}
+	r.hub.Publish(lib.Event{Type: lib.EventAntarianDeleted, Antarian: &a}, a)
+	return nil
+}
+
+func (r *eventRepo) SaveBuild(b lib.Build) error {
+	if err := r.Repository.SaveBuild(b); err != nil {
+		return err
+	}
+	var typ string
+	switch {
+	case b.State.Done():
+		typ = lib.EventBuildFinished
+	case b.State == lib.BuildRunning:
+		typ = lib.EventBuildStarted
+	default:
+		return nil
+	}
+	a, err := r.Repository.FindAntarian(b.AntarianId)
+	if err != nil {
+		// the Antarian may be gone by the time its build finishes
+		a = lib.Antarian{Id: b.AntarianId, Name: b.Name}
+	}
+	r.hub.Publish(lib.Event{Type: typ, Build: &b}, a)
+	return nil
+}
+
+// Close closes the wrapped repository if it holds resources.
+func (r *eventRepo) Close() error {
+	return closeRepository(r.Repository)
+}
+
+// Ping checks the wrapped repository.
+func (r *eventRepo) Ping(ctx context.Context) error {
+	return pingRepository(ctx, r.Repository)
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/storage"
+)
+
+// artifactTypes are the content types of artifact extensions that mime
+// does not know.
+var artifactTypes = map[string]string{
+	".tgz": "application/gzip",
+	".gz":  "application/gzip",
+	".tar": "application/x-tar",
+	".sig": "text/plain; charset=utf-8",
+}
+
+// ArtifactFile serves a stored artifact, the target of the links made by
+// AntarianDownload, for GET and HEAD. Range and conditional requests are
+// answered as http.ServeContent does, so interrupted downloads can resume,
+// and missing files with 404. An uploaded artifact carries its sha256 as
+// its ETag and in the Repr-Digest and X-Checksum-Sha256 headers.
+func ArtifactFile(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		antarianId, filename := vars["antarianId"], vars["filename"]
+		f, info, err := d.Storage.Get(r.Context(), antarianId, filename)
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidName) {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find file %s of Antarian %s", filename, antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "open artifact", err)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", artifactType(filename))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		if a, err := d.repo(r.Context()).FindAntarian(antarianId); err == nil {
+			if sum := artifactChecksum(a, filename); sum != "" {
+				setChecksumHeaders(w.Header(), sum)
+			}
+		}
+		if d.Metrics != nil {
+			cw := &countingWriter{ResponseWriter: w}
+			defer func() { d.Metrics.ArtifactBytes.Add(float64(cw.n)) }()
+			w = cw
+		}
+		http.ServeContent(w, r, filename, info.ModTime, f)
+	}
+}
+
+// setChecksumHeaders describes content with the hex sha256 sum. The ETag
+// lets clients resume a download with If-Range knowing the file has not
+// changed since.
+func setChecksumHeaders(h http.Header, sum string) {
+	h.Set("ETag", `"`+sum+`"`)
+	h.Set("X-Checksum-Sha256", sum)
+	if b, err := hex.DecodeString(sum); err == nil {
+		h.Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(b)+":")
+	}
+}
+
+// artifactType returns the content type of an artifact by its extension.
+func artifactType(filename string) string {
+	if f, ok := lib.FormatOf(filename); ok {
+		return f.ContentType()
+	}
+	ext := strings.ToLower(path.Ext(filename))
+	if t, ok := artifactTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// countingWriter counts the body bytes written through it.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/storage"
+)
+
+// gcReport is the outcome of an artifact garbage collection run.
+type gcReport struct {
+	// Orphans are stored files whose Antarian no longer exists.
+	Orphans     []storage.Info `json:"orphans"`
+	OrphanBytes int64          `json:"orphan_bytes"`
+	// Dangling are Antarians naming an artifact file that is not stored.
+	Dangling []danglingRef `json:"dangling"`
+	// Expired are Antarians past the retention policy, which are deleted
+	// with their files.
+	Expired      []expiredRef `json:"expired"`
+	ExpiredBytes int64        `json:"expired_bytes"`
+	// Recent counts files skipped because they are inside the grace window.
+	Recent         int   `json:"recent"`
+	Deleted        int   `json:"deleted"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+}
+
+type danglingRef struct {
+	AntarianId string `json:"antarian_id"`
+	Filename   string `json:"filename"`
+}
+
+type expiredRef struct {
+	AntarianId string `json:"antarian_id"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	// Reason is "age" or "versions", the rule that expired it.
+	Reason string `json:"reason"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// AdminGC reconciles artifact storage with the repository and reports
+// orphaned files, dangling references and the Antarians expired by the
+// retention policy. It is a dry run unless ?delete=true, which removes the
+// orphans and expired Antarians.
+func AdminGC(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		del := false
+		if v := r.URL.Query().Get("delete"); v != "" {
+			var err error
+			if del, err = strconv.ParseBool(v); err != nil {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("delete: %q is not a boolean", v))
+				return
+			}
+		}
+		report, err := collectGarbage(r.Context(), d, del)
+		if del {
+			e := requestAudit(r, lib.AuditArtifactGC)
+			e.Before = fmt.Sprintf("%d orphans, %d bytes, %d expired, %d bytes", len(report.Orphans), report.OrphanBytes,
+				len(report.Expired), report.ExpiredBytes)
+			e.After = fmt.Sprintf("%d deleted, %d bytes reclaimed", report.Deleted, report.ReclaimedBytes)
+			audit(r.Context(), d, e)
+		}
+		if err != nil {
+			requestLogger(d.Logger, r).Error("artifact gc", "err", err, "deleted", report.Deleted)
+			writeError(d, w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, report)
+	}
+}
+
+// collectGarbage cross-references every stored file with the repository
+// and applies the retention policy. Files modified within the configured
+// grace period are left alone, as their Antarian may not be visible yet.
+func collectGarbage(ctx context.Context, d *Deps, del bool) (gcReport, error) {
+	report := gcReport{Orphans: []storage.Info{}, Dangling: []danglingRef{}, Expired: []expiredRef{}}
+	// list the files before reading the repository, so an Antarian created
+	// in between is seen rather than its file being taken for an orphan
+	files, err := d.Storage.List(ctx, "")
+	if err != nil {
+		return report, err
+	}
+	known := map[string]bool{}
+	antarians, err := d.repo(ctx).ListAntarians()
+	if err != nil {
+		return report, err
+	}
+	for _, a := range antarians {
+		known[a.Id] = true
+	}
+	stored := map[string]int64{}
+	for _, f := range files {
+		stored[f.Id] += f.Size
+	}
+	expired := expire(antarians, d.Config.ArtifactRetention, d.Config.ArtifactKeepVersions, time.Now())
+	for i := range expired {
+		expired[i].ref.Bytes = stored[expired[i].Id]
+		report.Expired = append(report.Expired, expired[i].ref)
+		report.ExpiredBytes += expired[i].ref.Bytes
+	}
+
+	cutoff := time.Now().Add(-d.Config.ArtifactGCGrace)
+	for _, f := range files {
+		if known[f.Id] {
+			continue
+		}
+		if f.ModTime.After(cutoff) {
+			report.Recent++
+			continue
+		}
+		report.Orphans = append(report.Orphans, f)
+		report.OrphanBytes += f.Size
+	}
+
+	for _, a := range antarians {
+		// an Antarian nothing was uploaded for references no file
+		var names []string
+		if a.Artifact != "" {
+			names = append(names, a.Artifact)
+		}
+		for _, v := range a.Variants {
+			if v.Artifact != "" {
+				names = append(names, v.Artifact)
+			}
+		}
+		for _, name := range names {
+			_, err := d.Storage.Stat(ctx, a.Id, name)
+			switch {
+			case err == nil:
+			case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalidName):
+				report.Dangling = append(report.Dangling, danglingRef{AntarianId: a.Id, Filename: name})
+			default:
+				return report, err
+			}
+		}
+	}
+
+	if del {
+		for _, f := range report.Orphans {
+			if err := d.Storage.Delete(ctx, f.Id, f.Name); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return report, err
+			}
+			report.Deleted++
+			report.ReclaimedBytes += f.Size
+			d.Metrics.reclaimed("orphan", f.Size)
+		}
+		for _, x := range expired {
+			if err := d.Repo.DestroyAntarian(x.Id); err != nil && err != ErrNotFound {
+				return report, err
+			}
+			audit(ctx, d, lib.AuditEntry{Actor: "retention", Action: lib.AuditAntarianDelete,
+				Namespace: x.NamespaceOrDefault(), AntarianId: x.Id, Before: auditSummary(x.Antarian)})
+			if err := deleteArtifacts(ctx, d, x.Id); err != nil {
+				return report, err
+			}
+			report.Deleted++
+			report.ReclaimedBytes += x.ref.Bytes
+			d.Metrics.reclaimed("expired", x.ref.Bytes)
+		}
+	}
+	d.Logger.Info("artifact gc", "orphans", len(report.Orphans), "orphan_bytes", report.OrphanBytes,
+		"dangling", len(report.Dangling), "expired", len(report.Expired), "expired_bytes", report.ExpiredBytes,
+		"recent", report.Recent, "deleted", report.Deleted, "reclaimed_bytes", report.ReclaimedBytes)
+	return report, nil
+}
+
+// expiredAntarian is an Antarian past the retention policy.
+type expiredAntarian struct {
+	lib.Antarian
+	ref expiredRef
+}
+
+// expire returns the Antarians created before now less maxAge, and those
+// beyond the keep newest versions of their name in their namespace. Zero
+// disables either rule. The seeded AntarianMain never expires.
+func expire(antarians lib.Antarians, maxAge time.Duration, keep int, now time.Time) []expiredAntarian {
+	antarians = antarians.Filter(func(a lib.Antarian) bool { return a.Name != seedName })
+	reasons := map[string]string{}
+	if maxAge > 0 {
+		cutoff := now.Add(-maxAge)
+		for _, a := range antarians {
+			if a.Start.Before(cutoff) {
+				reasons[a.Id] = "age"
+			}
+		}
+	}
+	if keep > 0 {
+		byName := map[[2]string]lib.Antarians{}
+		for _, a := range antarians {
+			k := [2]string{a.NamespaceOrDefault(), a.Name}
+			byName[k] = append(byName[k], a)
+		}
+		for _, versions := range byName {
+			versions.SortBy(lib.Descending(lib.ByVersion), lib.Descending(lib.ByStart))
+			for _, a := range versions[min(keep, len(versions)):] {
+				if reasons[a.Id] == "" {
+					reasons[a.Id] = "versions"
+				}
+			}
+		}
+	}
+
+	var expired []expiredAntarian
+	for _, a := range antarians {
+		if reason := reasons[a.Id]; reason != "" {
+			expired = append(expired, expiredAntarian{Antarian: a, ref: expiredRef{
+				AntarianId: a.Id, Namespace: a.NamespaceOrDefault(), Name: a.Name, Version: a.Version, Reason: reason,
+			}})
+		}
+	}
+	return expired
+}
+
+// runGC collects garbage every interval until ctx is done, deleting what
+// it finds unless artifact_gc_dry_run is set. It returns immediately when
+// interval is zero.
+func runGC(ctx context.Context, d *Deps, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+		if _, err := collectGarbage(ctx, d, !d.Config.ArtifactGCDryRun); err != nil && ctx.Err() == nil {
+			d.Logger.Error("artifact gc", "err", err)
+		}
+	}
+}
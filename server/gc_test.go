@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+func TestGCGrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		grace   time.Duration
+		orphans int
+		recent  int
+		kept    int
+	}{
+		{"outside the grace window", 0, 1, 0, 1},
+		{"inside the grace window", time.Hour, 0, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ts := newTestServer(t, func(c *config.Config) {
+				c.AdminTokens = []string{"adm"}
+				c.ArtifactGCGrace = tt.grace
+			})
+			d := s.Deps()
+			var a lib.Antarian
+			call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "libfoo", Version: "1.0.0"}, &a)
+			if status := call(t, ts, "POST", "/v1/antarians/"+a.Id+"/artifact", "artifact", nil, "Content-Type", "application/octet-stream"); status != http.StatusCreated {
+				t.Fatalf("upload = %d", status)
+			}
+			// a file no Antarian owns
+			if _, err := d.Storage.Put(context.Background(), "gone", "libgone.tar.gz", strings.NewReader("orphaned")); err != nil {
+				t.Fatal(err)
+			}
+
+			var dry gcReport
+			call(t, ts, "POST", "/v1/admin/gc", nil, &dry, "Authorization", "Bearer adm")
+			if len(dry.Orphans) != tt.orphans || dry.Recent != tt.recent || dry.Deleted != 0 {
+				t.Errorf("dry run = %+v, want %d orphans and %d recent", dry, tt.orphans, tt.recent)
+			}
+			if tt.orphans > 0 && (dry.Orphans[0].Id != "gone" || dry.OrphanBytes != int64(len("orphaned"))) {
+				t.Errorf("orphans = %+v, %d bytes", dry.Orphans, dry.OrphanBytes)
+			}
+
+			var res gcReport
+			call(t, ts, "POST", "/v1/admin/gc?delete=true", nil, &res, "Authorization", "Bearer adm")
+			if res.Deleted != tt.orphans || res.ReclaimedBytes != dry.OrphanBytes {
+				t.Errorf("delete = %d files, %d bytes, want %d, %d", res.Deleted, res.ReclaimedBytes, tt.orphans, dry.OrphanBytes)
+			}
+			if n := files(t, d.Config.ArtifactDir); n != tt.kept {
+				t.Errorf("%d files on disk, want %d", n, tt.kept)
+			}
+		})
+	}
+}
+
+// TestGCConcurrentUploads runs collections with ?delete=true while uploads
+// are in flight, including files stored before their Antarian is visible,
+// and checks that none of them is taken for an orphan.
+func TestGCConcurrentUploads(t *testing.T) {
+	s, ts := newTestServer(t, func(c *config.Config) {
+		c.AdminTokens = []string{"adm"}
+	})
+	d := s.Deps()
+	const uploaders, uploads = 4, 10
+
+	done := make(chan struct{})
+	var gcs sync.WaitGroup
+	var mu sync.Mutex
+	var deleted, runs int
+	gcs.Add(1)
+	go func() {
+		defer gcs.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			var res gcReport
+			if status := call(t, ts, "POST", "/v1/admin/gc?delete=true", nil, &res, "Authorization", "Bearer adm"); status != http.StatusOK {
+				t.Errorf("gc = %d", status)
+				return
+			}
+			mu.Lock()
+			deleted += res.Deleted + len(res.Orphans)
+			runs++
+			mu.Unlock()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	ids := make(chan string, uploaders*uploads)
+	for u := 0; u < uploaders; u++ {
+		wg.Add(1)
+		go func(u int) {
+			defer wg.Done()
+			for i := 0; i < uploads; i++ {
+				var a lib.Antarian
+				call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: fmt.Sprintf("lib%d", u), Version: fmt.Sprintf("1.0.%d", i)}, &a)
+				if status := call(t, ts, "POST", "/v1/antarians/"+a.Id+"/artifact", "artifact", nil, "Content-Type", "application/octet-stream"); status != http.StatusCreated {
+					t.Errorf("upload = %d", status)
+				}
+				ids <- a.Id
+				// written ahead of a record that is not committed yet
+				pending := fmt.Sprintf("pending-%d-%d", u, i)
+				if _, err := d.Storage.Put(context.Background(), pending, "artifact", strings.NewReader("pending")); err != nil {
+					t.Error(err)
+				}
+			}
+		}(u)
+	}
+	wg.Wait()
+	// at least one collection sees every file
+	for {
+		mu.Lock()
+		n := runs
+		mu.Unlock()
+		if n > 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(done)
+	gcs.Wait()
+	close(ids)
+
+	if deleted != 0 {
+		t.Errorf("%d files collected during uploads", deleted)
+	}
+	for id := range ids {
+		if status := call(t, ts, "GET", "/v1/antarians/"+id+"/download", nil, nil); status != http.StatusOK {
+			t.Errorf("download %s after gc = %d", id, status)
+		}
+	}
+	if n := files(t, d.Config.ArtifactDir); n != 2*uploaders*uploads {
+		t.Errorf("%d files on disk, want %d", n, 2*uploaders*uploads)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-48 * time.Hour)
+	antarians := lib.Antarians{
+		{Id: "main", Name: seedName, Start: old},
+		{Id: "a1", Name: "libfoo", Version: "1.0.0", Start: old},
+		{Id: "a2", Name: "libfoo", Version: "2.0.0", Start: now},
+		{Id: "a3", Name: "libfoo", Version: "3.0.0", Start: now},
+		{Id: "b1", Name: "libfoo", Version: "1.0.0", Namespace: "team", Start: now},
+	}
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		keep   int
+		want   map[string]string
+	}{
+		{"disabled", 0, 0, map[string]string{}},
+		{"age", 24 * time.Hour, 0, map[string]string{"a1": "age"}},
+		{"versions", 0, 2, map[string]string{"a1": "versions"}},
+		{"versions per namespace", 0, 1, map[string]string{"a1": "versions", "a2": "versions"}},
+		{"age first", 24 * time.Hour, 1, map[string]string{"a1": "age", "a2": "versions"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			for _, x := range expire(antarians, tt.maxAge, tt.keep, now) {
+				got[x.Id] = x.ref.Reason
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expire = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGCKeepsSeed(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.AdminTokens = []string{"adm"}
+		c.ArtifactRetention = time.Nanosecond
+		c.ArtifactKeepVersions = 1
+	})
+	var a lib.Antarian
+	call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "libfoo", Version: "1.0.0"}, &a)
+	time.Sleep(time.Millisecond)
+
+	var res gcReport
+	call(t, ts, "POST", "/v1/admin/gc?delete=true", nil, &res, "Authorization", "Bearer adm")
+	if len(res.Expired) != 1 || res.Expired[0].AntarianId != a.Id {
+		t.Errorf("expired = %+v, want only %s", res.Expired, a.Id)
+	}
+	var left lib.Antarians
+	call(t, ts, "GET", "/v1/antarians", nil, &left)
+	if len(left) != 1 || left[0].Name != seedName {
+		t.Errorf("after gc %+v remain, want only %s", left, seedName)
+	}
+}
+
+func TestGCDangling(t *testing.T) {
+	s, ts := newTestServer(t, func(c *config.Config) {
+		c.AdminTokens = []string{"adm"}
+	})
+	d := s.Deps()
+	upload := func(id, query string) {
+		if status := call(t, ts, "POST", "/v1/antarians/"+id+"/artifact"+query, "artifact", nil, "Content-Type", "application/octet-stream"); status != http.StatusCreated {
+			t.Fatalf("upload = %d", status)
+		}
+	}
+	var never, intact, lost, variant lib.Antarian
+	call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "libnever", Version: "1.0.0"}, &never)
+	call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "libintact", Version: "1.0.0"}, &intact)
+	call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "liblost", Version: "1.0.0"}, &lost)
+	call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "libvariant", Version: "1.0.0", OS: "linux", Arch: "amd64"}, &variant)
+	upload(intact.Id, "")
+	upload(lost.Id, "")
+	upload(variant.Id, "")
+	upload(variant.Id, "?platform=linux/arm64")
+
+	lostFile, _ := d.Repo.FindAntarian(lost.Id)
+	if err := d.Storage.Delete(context.Background(), lost.Id, lostFile.Artifact); err != nil {
+		t.Fatal(err)
+	}
+	withVariant, _ := d.Repo.FindAntarian(variant.Id)
+	if len(withVariant.Variants) != 1 {
+		t.Fatalf("variants = %+v", withVariant.Variants)
+	}
+	if err := d.Storage.Delete(context.Background(), variant.Id, withVariant.Variants[0].Artifact); err != nil {
+		t.Fatal(err)
+	}
+
+	var res gcReport
+	call(t, ts, "POST", "/v1/admin/gc", nil, &res, "Authorization", "Bearer adm")
+	want := []danglingRef{
+		{AntarianId: lost.Id, Filename: lostFile.Artifact},
+		{AntarianId: variant.Id, Filename: withVariant.Variants[0].Artifact},
+	}
+	got := map[danglingRef]bool{}
+	for _, ref := range res.Dangling {
+		got[ref] = true
+	}
+	if len(res.Dangling) != len(want) || !got[want[0]] || !got[want[1]] {
+		t.Errorf("dangling = %+v, want %+v", res.Dangling, want)
+	}
+}
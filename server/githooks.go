@@ -0,0 +1,210 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// gitPush is a push or tag push, as GitHub and GitLab describe it.
+type gitPush struct {
+	Provider string `json:"provider"`
+	// Repository is the full path of the repository, e.g. org/repo.
+	Repository string `json:"repository"`
+	Ref        string `json:"ref"`
+	Commit     string `json:"commit"`
+	Deleted    bool   `json:"deleted,omitempty"`
+}
+
+// gitHookResult answers GitHook with the builds a push started.
+type gitHookResult struct {
+	gitPush
+	Builds []lib.Build `json:"builds"`
+}
+
+// GitHook receives the push events of GitHub and GitLab, verified with the
+// git_hooks secrets, and starts a build for every rule matching the pushed
+// repository and ref. Pushes deleting a ref and other events start none.
+func GitHook(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, d.Config.Request.MaxBytes))
+		if err != nil {
+			writeError(d, w, r, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		cfg := d.Config.GitHooks
+		var push *gitPush
+		switch {
+		case r.Header.Get("X-GitHub-Event") != "":
+			if cfg.GitHubSecret == "" {
+				writeError(d, w, r, http.StatusForbidden, "GitHub deliveries are not accepted")
+				return
+			}
+			if !hmac.Equal([]byte(r.Header.Get("X-Hub-Signature-256")), []byte(signWebhook(cfg.GitHubSecret, body))) {
+				writeError(d, w, r, http.StatusUnauthorized, "X-Hub-Signature-256 does not match the body")
+				return
+			}
+			if r.Header.Get("X-GitHub-Event") == "push" {
+				push, err = parseGitHubPush(body)
+			}
+		case r.Header.Get("X-Gitlab-Event") != "":
+			if cfg.GitLabToken == "" {
+				writeError(d, w, r, http.StatusForbidden, "GitLab deliveries are not accepted")
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(cfg.GitLabToken)) != 1 {
+				writeError(d, w, r, http.StatusUnauthorized, "X-Gitlab-Token is not the configured token")
+				return
+			}
+			switch r.Header.Get("X-Gitlab-Event") {
+			case "Push Hook", "Tag Push Hook":
+				push, err = parseGitLabPush(body)
+			}
+		default:
+			writeError(d, w, r, http.StatusBadRequest, "not a GitHub or GitLab delivery")
+			return
+		}
+		if err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		log := requestLogger(d.Logger, r)
+		if push == nil {
+			// pings and events other than pushes
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		result := gitHookResult{gitPush: *push, Builds: []lib.Build{}}
+		if push.Deleted {
+			writeJSON(d, w, r, http.StatusOK, result)
+			return
+		}
+		for _, rule := range cfg.Rules {
+			if !gitHookMatches(rule, push) {
+				continue
+			}
+			a, err := gitHookAntarian(d, rule)
+			if err == ErrNotFound {
+				log.Warn("git hook rule matches no Antarian", "repository", push.Repository, "ref", push.Ref, "antarian_id", rule.AntarianId, "name", rule.Name)
+				continue
+			}
+			if err != nil {
+				internalError(d, w, r, "find antarian", err)
+				return
+			}
+			b, _, err := d.Builds.Start(a, rule.Priority)
+			if err == build.ErrQueueFull || err == build.ErrShutdown {
+				// the provider redelivers failed deliveries on request
+				w.Header().Set("Retry-After", "30")
+				writeError(d, w, r, http.StatusServiceUnavailable, fmt.Sprintf("%v: %d builds started", err, len(result.Builds)))
+				return
+			}
+			if err == build.ErrArchived {
+				log.Warn("git hook rule matches an archived Antarian", "repository", push.Repository, "ref", push.Ref, "antarian_id", a.Id)
+				continue
+			}
+			if err != nil {
+				internalError(d, w, r, "start build", err)
+				return
+			}
+			log.Info("git push queued build", "repository", push.Repository, "ref", push.Ref, "commit", push.Commit, "antarian_id", a.Id, "build_id", b.Id)
+			e := requestAudit(r, lib.AuditBuildTrigger)
+			e.Actor = push.Provider
+			e.Namespace, e.AntarianId, e.BuildId = a.Namespace, a.Id, b.Id
+			e.After = fmt.Sprintf("%s %s %s", push.Repository, push.Ref, push.Commit)
+			audit(r.Context(), d, e)
+			result.Builds = append(result.Builds, b)
+		}
+		status := http.StatusOK
+		if len(result.Builds) > 0 {
+			status = http.StatusAccepted
+		}
+		writeJSON(d, w, r, status, result)
+	}
+}
+
+// gitHookMatches reports whether rule applies to push p.
+func gitHookMatches(rule config.GitHookRule, p *gitPush) bool {
+	if !strings.EqualFold(rule.Repository, p.Repository) {
+		return false
+	}
+	if rule.Ref == "" {
+		return true
+	}
+	ok, _ := path.Match(rule.Ref, p.Ref)
+	return ok
+}
+
+// gitHookAntarian returns the Antarian rule builds, ErrNotFound when there
+// is none.
+func gitHookAntarian(d *Deps, rule config.GitHookRule) (lib.Antarian, error) {
+	if rule.AntarianId != "" {
+		return d.Repo.FindAntarian(rule.AntarianId)
+	}
+	ns := rule.Namespace
+	if ns == "" {
+		ns = lib.DefaultNamespace
+	}
+	candidates, err := (&namespacedRepo{Repository: d.Repo, ns: ns}).AntariansNamed(rule.Name)
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	a, ok := resolveLatest(candidates, latestQuery{IncludePrerelease: true}, nil)
+	if !ok {
+		return lib.Antarian{}, ErrNotFound
+	}
+	return a, nil
+}
+
+// zeroCommit is the commit a deleted ref points to.
+const zeroCommit = "0000000000000000000000000000000000000000"
+
+func parseGitHubPush(body []byte) (*gitPush, error) {
+	var payload struct {
+		Ref        string `json:"ref"`
+		After      string `json:"after"`
+		Deleted    bool   `json:"deleted"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return &gitPush{
+		Provider:   "github",
+		Repository: payload.Repository.FullName,
+		Ref:        payload.Ref,
+		Commit:     payload.After,
+		Deleted:    payload.Deleted || payload.After == zeroCommit,
+	}, nil
+}
+
+func parseGitLabPush(body []byte) (*gitPush, error) {
+	var payload struct {
+		Ref     string `json:"ref"`
+		After   string `json:"after"`
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return &gitPush{
+		Provider:   "gitlab",
+		Repository: payload.Project.PathWithNamespace,
+		Ref:        payload.Ref,
+		Commit:     payload.After,
+		Deleted:    payload.After == zeroCommit,
+	}, nil
+}
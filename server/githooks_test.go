@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+func TestGitHookSignature(t *testing.T) {
+	const secret, token = "github secret", "gitlab token"
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.GitHooks.GitHubSecret = secret
+		c.GitHooks.GitLabToken = token
+		c.GitHooks.Rules = []config.GitHookRule{{Repository: "org/libfoo", Name: "libfoo"}}
+	})
+	if status := call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "libfoo", Version: "1.0.0"}, nil); status != http.StatusCreated {
+		t.Fatalf("create = %d", status)
+	}
+
+	github := []byte(`{"ref":"refs/heads/main","after":"0a1b2c3d","repository":{"full_name":"org/libfoo"}}`)
+	gitlab := []byte(`{"ref":"refs/heads/main","after":"0a1b2c3d","project":{"path_with_namespace":"org/libfoo"}}`)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(github)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name   string
+		body   []byte
+		header []string
+		status int
+	}{
+		{"github unsigned", github, []string{"X-GitHub-Event", "push"}, http.StatusUnauthorized},
+		{"github wrong signature", github, []string{"X-GitHub-Event", "push", "X-Hub-Signature-256", "sha256=" + hex.EncodeToString(make([]byte, 32))}, http.StatusUnauthorized},
+		{"github signature of another body", append([]byte(" "), github...), []string{"X-GitHub-Event", "push", "X-Hub-Signature-256", signature}, http.StatusUnauthorized},
+		{"github unprefixed signature", github, []string{"X-GitHub-Event", "push", "X-Hub-Signature-256", signature[len("sha256="):]}, http.StatusUnauthorized},
+		{"github signed", github, []string{"X-GitHub-Event", "push", "X-Hub-Signature-256", signature}, http.StatusAccepted},
+		{"github ping", github, []string{"X-GitHub-Event", "ping", "X-Hub-Signature-256", signature}, http.StatusNoContent},
+		{"gitlab without token", gitlab, []string{"X-Gitlab-Event", "Push Hook"}, http.StatusUnauthorized},
+		{"gitlab wrong token", gitlab, []string{"X-Gitlab-Event", "Push Hook", "X-Gitlab-Token", "guess"}, http.StatusUnauthorized},
+		{"gitlab token", gitlab, []string{"X-Gitlab-Event", "Push Hook", "X-Gitlab-Token", token}, http.StatusAccepted},
+		{"neither", github, nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", ts.URL+"/v1/hooks/git", bytes.NewReader(tt.body))
+		for i := 0; i < len(tt.header); i += 2 {
+			req.Header.Set(tt.header[i], tt.header[i+1])
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res gitHookResult
+		json.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s = %d, want %d", tt.name, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status == http.StatusAccepted && (len(res.Builds) != 1 || res.Repository != "org/libfoo" || res.Commit != "0a1b2c3d") {
+			t.Errorf("%s = %+v, want one build of org/libfoo at 0a1b2c3d", tt.name, res)
+		}
+	}
+}
+
+func TestGitHookUnconfigured(t *testing.T) {
+	_, ts := newTestServer(t)
+	for _, event := range []string{"X-GitHub-Event", "X-Gitlab-Event"} {
+		if status := call(t, ts, "POST", "/v1/hooks/git", "{}", nil, event, "push"); status != http.StatusForbidden {
+			t.Errorf("%s without a secret = %d, want 403", event, status)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// graphqlRequest is the body of a GraphQL POST.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// GraphQL answers GraphQL queries over the Antarians, their dependencies
+// and their builds, so a client can fetch a tree of them in one request.
+// Queries come as a JSON POST body or in the query parameter of a GET.
+// Errors in the query are reported in the errors of a 200 response, as
+// GraphQL clients expect.
+func GraphQL(d *Deps) http.HandlerFunc {
+	schema, err := graphqlSchema(d)
+	if err != nil {
+		// the schema is fixed, so this is a programming error
+		panic(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req graphqlRequest
+		if r.Method == http.MethodGet {
+			req.Query = r.URL.Query().Get("query")
+			req.OperationName = r.URL.Query().Get("operationName")
+		} else if err := decodeJSON(d, r, &req); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			writeError(d, w, r, http.StatusBadRequest, "query: must not be empty")
+			return
+		}
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        r.Context(),
+		})
+		writeJSON(d, w, r, http.StatusOK, result)
+	}
+}
+
+// graphqlSchema builds the schema served by GraphQL. Resolvers read d.repo
+// of the request, so they see its namespace.
+func graphqlSchema(d *Deps) (graphql.Schema, error) {
+	build := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Build",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"antarianId": &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":       &graphql.Field{Type: graphql.String},
+			"version":    &graphql.Field{Type: graphql.String},
+			"state":      &graphql.Field{Type: graphql.String},
+			"start":      &graphql.Field{Type: graphql.DateTime},
+			"end":        &graphql.Field{Type: graphql.DateTime},
+			"running":    &graphql.Field{Type: graphql.Boolean},
+			"exitCode":   &graphql.Field{Type: graphql.Int},
+			"error":      &graphql.Field{Type: graphql.String},
+			"log":        &graphql.Field{Type: graphql.String},
+			"worker":     &graphql.Field{Type: graphql.String},
+			"artifact":   &graphql.Field{Type: graphql.String},
+			"checksum":   &graphql.Field{Type: graphql.String},
+			"attempt":    &graphql.Field{Type: graphql.Int},
+			"priority":   &graphql.Field{Type: graphql.Int},
+			"dependsOn":  &graphql.Field{Type: graphql.NewList(graphql.ID)},
+		},
+	})
+
+	antarian := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Antarian",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"namespace": &graphql.Field{Type: graphql.String},
+			"name":      &graphql.Field{Type: graphql.String},
+			"version":   &graphql.Field{Type: graphql.String},
+			"release":   &graphql.Field{Type: graphql.String},
+			"commit":    &graphql.Field{Type: graphql.String},
+			"uri":       &graphql.Field{Type: graphql.String},
+			"running":   &graphql.Field{Type: graphql.Boolean},
+			"finished":  &graphql.Field{Type: graphql.Boolean},
+			"status":    &graphql.Field{Type: graphql.String},
+			"start":     &graphql.Field{Type: graphql.DateTime},
+			"end":       &graphql.Field{Type: graphql.DateTime},
+			"baseUrl":   &graphql.Field{Type: graphql.String},
+			"requires":  &graphql.Field{Type: graphql.NewList(graphql.String)},
+		},
+	})
+	antarian.AddFieldConfig("dependencies", &graphql.Field{
+		Type:        graphql.NewList(antarian),
+		Description: "The Antarians named in requires, each the newest release matching its constraint, else the newest prerelease, if any.",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return resolveRequires(d, p.Context, p.Source.(lib.Antarian).Requires)
+		},
+	})
+	antarian.AddFieldConfig("builds", &graphql.Field{
+		Type: graphql.NewList(build),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return d.repo(p.Context).ListBuilds(p.Source.(lib.Antarian).Id)
+		},
+	})
+	antarian.AddFieldConfig("latestBuild", &graphql.Field{
+		Type: build,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			b, ok, err := d.repo(p.Context).LatestBuild(p.Source.(lib.Antarian).Id)
+			if err != nil || !ok {
+				return nil, err
+			}
+			return b, nil
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"antarians": &graphql.Field{
+				Type: graphql.NewList(antarian),
+				Args: graphql.FieldConfigArgument{
+					"name":   &graphql.ArgumentConfig{Type: graphql.String},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int},
+					"offset": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var list lib.Antarians
+					var err error
+					if name, ok := p.Args["name"].(string); ok {
+						list, err = d.repo(p.Context).AntariansNamed(name)
+					} else {
+						list, err = d.repo(p.Context).ListAntarians()
+					}
+					if err != nil {
+						return nil, err
+					}
+					limit, _ := p.Args["limit"].(int)
+					offset, _ := p.Args["offset"].(int)
+					if limit < 0 || offset < 0 {
+						return nil, fmt.Errorf("limit and offset must not be negative")
+					}
+					start, end := page(len(list), limit, offset)
+					return list[start:end], nil
+				},
+			},
+			"antarian": &graphql.Field{
+				Type: antarian,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					a, err := d.repo(p.Context).FindAntarian(p.Args["id"].(string))
+					if err == ErrNotFound {
+						return nil, nil
+					}
+					return a, err
+				},
+			},
+			"build": &graphql.Field{
+				Type: build,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					b, ok := d.repo(p.Context).FindBuild(p.Args["id"].(string))
+					if !ok {
+						return nil, nil
+					}
+					return b, nil
+				},
+			},
+			"builds": &graphql.Field{
+				Type: graphql.NewList(build),
+				Args: graphql.FieldConfigArgument{
+					"antarianId": &graphql.ArgumentConfig{Type: graphql.ID},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, _ := p.Args["antarianId"].(string)
+					return d.repo(p.Context).ListBuilds(id)
+				},
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// resolveRequires finds the Antarians named by requires. Entries nothing
+// matches are left out.
+func resolveRequires(d *Deps, ctx context.Context, requires []string) (lib.Antarians, error) {
+	var deps lib.Antarians
+	for _, req := range requires {
+		latest, ok, err := resolveRequire(d, ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			deps = append(deps, latest)
+		}
+	}
+	return deps, nil
+}
+
+// resolveRequire finds the Antarian a requires entry names, as parsed by
+// lib.ParseRequirement, among those of the request's namespace; ok is
+// false when none matches. An entry that does not parse is a
+// *lib.ValidationError.
+func resolveRequire(d *Deps, ctx context.Context, entry string) (lib.Antarian, bool, error) {
+	req, err := lib.ParseRequirement(entry)
+	if err != nil {
+		return lib.Antarian{}, false, &lib.ValidationError{Field: "requires", Message: err.Error()}
+	}
+	candidates, err := d.repo(ctx).AntariansNamed(req.Name)
+	if err != nil {
+		return lib.Antarian{}, false, err
+	}
+	best, ok := req.Resolve(candidates)
+	return best, ok, nil
+}
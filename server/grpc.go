@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// watchInterval is how often WatchBuild polls the engine for changes.
+const watchInterval = 250 * time.Millisecond
+
+// NewGRPCServer returns a gRPC server exposing the Antares service on top of
+// the same repository and build engine as the REST handlers. When tokens or
+// JWT verification are configured every call must carry a token as
+// "authorization: Bearer <token>" metadata. Calls act on the default
+// namespace. opts are passed on to grpc.NewServer, e.g. for credentials.
+func NewGRPCServer(d *Deps, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptor(d)),
+		grpc.ChainStreamInterceptor(streamInterceptor(d)),
+	}, opts...)
+	s := grpc.NewServer(opts...)
+	rpc.RegisterAntaresServer(s, &grpcService{d: d})
+	return s
+}
+
+type grpcService struct {
+	rpc.UnimplementedAntaresServer
+	d *Deps
+}
+
+func (s *grpcService) CreateAntarian(ctx context.Context, req *rpc.CreateAntarianRequest) (*rpc.Antarian, error) {
+	// the same intake as POST /antarians, so both APIs fill in the
+	// server-side fields identically
+	in := rpc.ToAntarian(req.GetAntarian())
+	release, err := releaseOptions(s.d, ctx, in.Name)
+	if err != nil {
+		s.d.Logger.Error("create antarian", "err", err, "protocol", "grpc")
+		return nil, status.Error(codes.Internal, "create antarian failed")
+	}
+	antarian, err := lib.NewAntarianFromRequest(in.CreateRequest(), s.d.Config.BaseURL(), release)
+	if _, invalid := err.(*lib.ValidationError); invalid {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.d.Logger.Error("create antarian", "err", err, "protocol", "grpc")
+		return nil, status.Error(codes.Internal, "create antarian failed")
+	}
+	if err := antarian.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	a, err := s.d.repo(ctx).CreateAntarian(antarian)
+	if err == ErrConflict {
+		return nil, status.Errorf(codes.AlreadyExists, "%s %s already exists", antarian.Name, antarian.Version)
+	}
+	if err != nil {
+		s.d.Logger.Error("create antarian", "err", err, "protocol", "grpc")
+		return nil, status.Error(codes.Internal, "create antarian failed")
+	}
+	s.d.Logger.Info("created antarian", "antarian_id", a.Id, "name", a.Name, "protocol", "grpc")
+	e := callAudit(ctx, lib.AuditAntarianCreate)
+	e.AntarianId, e.After = a.Id, auditSummary(a)
+	audit(ctx, s.d, e)
+	return rpc.FromAntarian(a), nil
+}
+
+func (s *grpcService) GetAntarian(ctx context.Context, req *rpc.GetAntarianRequest) (*rpc.Antarian, error) {
+	a, err := s.d.repo(ctx).FindAntarian(req.GetId())
+	if err != nil {
+		return nil, findError(s.d, err, req.GetId())
+	}
+	return rpc.FromAntarian(a), nil
+}
+
+func (s *grpcService) ListAntarians(req *rpc.ListAntariansRequest, stream rpc.Antares_ListAntariansServer) error {
+	list, err := s.d.repo(stream.Context()).ListAntarians()
+	if err != nil {
+		s.d.Logger.Error("list antarians", "err", err, "protocol", "grpc")
+		return status.Error(codes.Internal, "list antarians failed")
+	}
+	for _, a := range list {
+		if err := stream.Send(rpc.FromAntarian(a)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *grpcService) TriggerBuild(ctx context.Context, req *rpc.TriggerBuildRequest) (*rpc.TriggerBuildResponse, error) {
+	a, err := s.d.repo(ctx).FindAntarian(req.GetAntarianId())
+	if err != nil {
+		return nil, findError(s.d, err, req.GetAntarianId())
+	}
+	b, position, err := s.d.Builds.Start(a, 0)
+	switch {
+	case err == build.ErrQueueFull:
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case err == build.ErrShutdown:
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err == build.ErrArchived:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		s.d.Logger.Error("start build", "err", err, "antarian_id", a.Id, "protocol", "grpc")
+		return nil, status.Error(codes.Internal, "start build failed")
+	}
+	e := callAudit(ctx, lib.AuditBuildTrigger)
+	e.AntarianId, e.BuildId = a.Id, b.Id
+	audit(ctx, s.d, e)
+	return &rpc.TriggerBuildResponse{Build: rpc.FromBuild(b), QueuePosition: int32(position)}, nil
+}
+
+func (s *grpcService) WatchBuild(req *rpc.WatchBuildRequest, stream rpc.Antares_WatchBuildServer) error {
+	b, ok := findBuild(stream.Context(), s.d, req.GetBuildId())
+	if !ok {
+		return status.Errorf(codes.NotFound, "Could not find Build with id of %s", req.GetBuildId())
+	}
+	if err := stream.Send(rpc.FromBuild(b)); err != nil {
+		return err
+	}
+
+	tick := time.NewTicker(watchInterval)
+	defer tick.Stop()
+	for !b.State.Done() {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-tick.C:
+		}
+		next, ok := s.d.Builds.Get(b.Id)
+		if !ok {
+			// pruned while we were watching
+			return status.Errorf(codes.NotFound, "Could not find Build with id of %s", b.Id)
+		}
+		if next.State == b.State {
+			continue
+		}
+		b = next
+		if err := stream.Send(rpc.FromBuild(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findError maps a FindAntarian failure to a gRPC status.
+func findError(d *Deps, err error, id string) error {
+	if err == ErrNotFound {
+		return status.Errorf(codes.NotFound, "Could not find Antarian with id of %s", id)
+	}
+	d.Logger.Error("find antarian", "err", err, "antarian_id", id, "protocol", "grpc")
+	return status.Error(codes.Internal, "find antarian failed")
+}
+
+func unaryInterceptor(d *Deps) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		var resp interface{}
+		ctx, err := authorize(ctx, d)
+		if err == nil {
+			err = checkPermission(ctx, info.FullMethod)
+		}
+		if err == nil {
+			err = checkRateLimit(ctx, d, info.FullMethod)
+		}
+		if err == nil {
+			resp, err = handler(withNamespace(ctx, lib.DefaultNamespace), req)
+		}
+		logCall(d, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func streamInterceptor(d *Deps) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, err := authorize(ss.Context(), d)
+		if err == nil {
+			err = checkPermission(ctx, info.FullMethod)
+		}
+		if err == nil {
+			err = handler(srv, &authorizedStream{ServerStream: ss, ctx: withNamespace(ctx, lib.DefaultNamespace)})
+		}
+		logCall(d, info.FullMethod, start, err)
+		return err
+	}
+}
+
+// authorize authenticates the bearer token in the call metadata like the
+// REST API does, returning ctx with the caller for PrincipalFrom. With no
+// tokens or JWT verification configured the API is open, though a valid
+// admin token is still recorded for the methods checkPermission reserves
+// to admins.
+func authorize(ctx context.Context, d *Deps) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if p, err := authenticate(ctx, d, v); err == nil {
+			return withPrincipal(ctx, p), nil
+		}
+	}
+	if !authRequired(d) {
+		return ctx, nil
+	}
+	return ctx, errUnauthenticated
+}
+
+// errUnauthenticated answers calls without a valid bearer token.
+var errUnauthenticated = status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+
+// authorizedStream carries the context of an authorized call.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func logCall(d *Deps, method string, start time.Time, err error) {
+	d.Logger.Info("rpc", "method", method, "code", status.Code(err).String(), "duration", time.Since(start))
+}
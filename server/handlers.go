@@ -1,109 +1,763 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/gorilla/mux"
-    "github.com/xbcsmith/antares/lib"
-	"io"
-	"io/ioutil"
 	"net/http"
-    "time"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/storage"
+)
+
+const (
+	ndjson = "application/x-ndjson"
+	// streamFlushEvery is how many records AntarianStream writes between
+	// flushes.
+	streamFlushEvery = 100
 )
 
-func Index(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintln(w, "Antares!")
+func Index(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Antares!")
+	}
+}
+
+// AntarianIndex lists Antarians in creation order, or as ordered by sort,
+// keeping those matching the filters of parseListQuery. A page is selected
+// with limit and either offset or after, the id of the last Antarian of the
+// previous page. X-Total-Count carries the number of matches and Link
+// headers point at the next and previous pages while there are any. With
+// ?envelope=true the body is an antarianPage carrying the same metadata
+// instead of a bare list.
+func AntarianIndex(d *Deps) http.HandlerFunc {
+	stream := AntarianStream(d)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), ndjson) {
+			stream(w, r)
+			return
+		}
+		limit, offset, err := parsePage(r)
+		if err != nil {
+			writeError(d, w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		envelope := false
+		if v := r.URL.Query().Get("envelope"); v != "" {
+			if envelope, err = strconv.ParseBool(v); err != nil {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("envelope: %q is not a boolean", v))
+				return
+			}
+		}
+		q, err := parseListQuery(r)
+		if err != nil {
+			writeError(d, w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		after := r.URL.Query().Get("after")
+		if after != "" && offset > 0 {
+			writeError(d, w, r, http.StatusBadRequest, "after and offset cannot be used together")
+			return
+		}
+		list, err := d.repo(r.Context()).ListAntarians()
+		if err != nil {
+			internalError(d, w, r, "list antarians", err)
+			return
+		}
+		list = q.apply(list)
+		if after != "" {
+			offset = -1
+			for i, a := range list {
+				if a.Id == after {
+					offset = i + 1
+					break
+				}
+			}
+			if offset < 0 {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("after: no matching Antarian has the id %s", after))
+				return
+			}
+		}
+		start, end := page(len(list), limit, offset)
+		p := antarianPage{Items: list[start:end], Total: len(list)}
+		if end < len(list) && end > start {
+			next := r.URL.Query()
+			next.Del("offset")
+			next.Set("after", list[end-1].Id)
+			p.Next = r.URL.Path + "?" + next.Encode()
+		}
+		if start > 0 {
+			prev := r.URL.Query()
+			prev.Del("after")
+			// without a limit the previous page is everything before
+			prevOffset := 0
+			if limit > 0 {
+				prevOffset = max(start-limit, 0)
+			}
+			prev.Set("offset", strconv.Itoa(prevOffset))
+			p.Prev = r.URL.Path + "?" + prev.Encode()
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(p.Total))
+		if p.Next != "" {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, p.Next))
+		}
+		if p.Prev != "" {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="prev"`, p.Prev))
+		}
+		if envelope {
+			writeCacheable(d, w, r, p)
+			return
+		}
+		writeCacheable(d, w, r, p.Items)
+	}
+}
+
+// antarianPage is a page of AntarianIndex with its pagination metadata.
+// Next and Prev are the paths of the adjacent pages, empty at either end.
+type antarianPage struct {
+	Items lib.Antarians `json:"items"`
+	Total int           `json:"total"`
+	Next  string        `json:"next,omitempty"`
+	Prev  string        `json:"prev,omitempty"`
+}
+
+// AntarianStream writes the index as newline-delimited JSON, one Antarian
+// per line, flushing every streamFlushEvery records. It keeps the Antarians
+// matching the filters of parseListQuery and honors limit and offset like
+// AntarianIndex; records are sent as they are read unless sort asks for an
+// order, which needs the whole collection first. after is not supported.
+// It stops as soon as the client goes away.
+func AntarianStream(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err := parsePage(r)
+		if err != nil {
+			writeError(d, w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		q, err := parseListQuery(r)
+		if err != nil {
+			writeError(d, w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if r.URL.Query().Get("after") != "" {
+			writeError(d, w, r, http.StatusBadRequest, "after: not supported by the stream, use offset")
+			return
+		}
+		repo := d.repo(r.Context())
+		each := repo.EachAntarian
+		if len(q.Sort) > 0 {
+			list, err := repo.ListAntarians()
+			if err != nil {
+				internalError(d, w, r, "list antarians", err)
+				return
+			}
+			list = q.apply(list)
+			each = func(fn func(lib.Antarian) error) error {
+				for _, a := range list {
+					if err := fn(a); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		}
+
+		w.Header().Set("Content-Type", ndjson)
+		w.WriteHeader(http.StatusOK)
+
+		rc := http.NewResponseController(w)
+		enc := json.NewEncoder(w)
+		skipped, n := 0, 0
+		err = each(func(a lib.Antarian) error {
+			if err := r.Context().Err(); err != nil {
+				return err
+			}
+			if !q.match(a) {
+				return nil
+			}
+			if skipped < offset {
+				skipped++
+				return nil
+			}
+			if err := enc.Encode(a); err != nil {
+				return err
+			}
+			if n++; limit > 0 && n == limit {
+				return errStop
+			}
+			if n%streamFlushEvery == 0 {
+				return rc.Flush()
+			}
+			return nil
+		})
+		if err != nil && err != errStop {
+			requestLogger(d.Logger, r).Info("antarian stream aborted", "err", err, "sent", n)
+			return
+		}
+		rc.Flush()
+	}
+}
+
+func AntarianShow(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		antarianId := vars["antarianId"]
+		s, err := d.repo(r.Context()).FindAntarian(antarianId)
+		if err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "find antarian", err)
+			return
+		}
+		writeCacheable(d, w, r, s)
+	}
+}
+
+// AntarianBuild queues a build of an Antarian, answering 200 with the
+// queued build. It is the original GET trigger; BuildCreate is its POST
+// successor.
+func AntarianBuild(d *Deps) http.HandlerFunc {
+	return queueBuild(d, http.StatusOK)
+}
+
+// BuildCreate queues a build of an Antarian and answers 202 with the
+// queued build, whose progress is at the Location given.
+func BuildCreate(d *Deps) http.HandlerFunc {
+	return queueBuild(d, http.StatusAccepted)
+}
+
+// buildRequest is the optional body of BuildCreate.
+type buildRequest struct {
+	// Priority orders the build in the queue, higher first; 0 when unset.
+	Priority int `json:"priority"`
+	// Requires also builds the Antarians the Antarian requires, directly
+	// or through others, each before those requiring it.
+	Requires bool `json:"requires"`
+}
+
+// queueBuild hands the build to the engine's queue, answering status. The
+// build runs on a worker, never in the request; a full queue is answered
+// with 429 and an archived Antarian with 409. With the requirements, the
+// answer is the Antarian's build, whose depends_on lists the builds it
+// waits for.
+func queueBuild(d *Deps, status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		antarianId := vars["antarianId"]
+		var req buildRequest
+		if r.ContentLength != 0 {
+			if err := decodeJSON(d, r, &req); err != nil {
+				writeDecodeError(d, w, r, err)
+				return
+			}
+			if err := lib.ValidatePriority(req.Priority); err != nil {
+				writeDecodeError(d, w, r, err)
+				return
+			}
+		}
+		s, err := d.repo(r.Context()).FindAntarian(antarianId)
+		if err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "find antarian", err)
+			return
+		}
+
+		nodes := []build.Node{{Antarian: s}}
+		if req.Requires {
+			if nodes, err = buildGraph(d, r.Context(), s); err != nil {
+				if _, ok := err.(*lib.ValidationError); ok {
+					writeDecodeError(d, w, r, err)
+				} else {
+					internalError(d, w, r, "resolve requires", err)
+				}
+				return
+			}
+		}
+
+		builds, position, err := d.Builds.StartGraph(nodes, req.Priority)
+		if err == build.ErrQueueFull || err == build.ErrShutdown {
+			stats := d.Builds.Stats()
+			requestLogger(d.Logger, r).Warn("build rejected", "err", err, "antarian_id", antarianId, "pending", stats.Pending)
+			w.Header().Set("Retry-After", "30")
+			writeError(d, w, r, http.StatusTooManyRequests, fmt.Sprintf("%v: %d builds pending", err, stats.Pending))
+			return
+		}
+		if err == build.ErrArchived {
+			writeError(d, w, r, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			requestLogger(d.Logger, r).Error("start build", "err", err, "antarian_id", antarianId)
+			writeError(d, w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		for i, b := range builds {
+			e := requestAudit(r, lib.AuditBuildTrigger)
+			e.AntarianId, e.BuildId = nodes[i].Antarian.Id, b.Id
+			audit(r.Context(), d, e)
+		}
+		b := builds[len(builds)-1]
+		// /builds/{id} sits beside /antarians under the same prefix
+		w.Header().Set("Location", path.Join(path.Dir(path.Dir(path.Dir(r.URL.Path))), "builds", b.Id))
+		w.Header().Set("X-Queue-Position", strconv.Itoa(position))
+		writeJSON(d, w, r, status, b)
+	}
+}
+
+// findBuild returns the engine's current copy of the build with id, but only
+// if its Antarian is one the caller can see: the engine itself knows nothing
+// of namespaces.
+func findBuild(ctx context.Context, d *Deps, id string) (lib.Build, bool) {
+	if _, ok := d.repo(ctx).FindBuild(id); !ok {
+		return lib.Build{}, false
+	}
+	return d.Builds.Get(id)
+}
+
+func BuildShow(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		buildId := mux.Vars(r)["buildId"]
+		b, ok := findBuild(r.Context(), d, buildId)
+		if !ok {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Build with id of %s", buildId))
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, b)
+	}
 }
 
-func AntarianIndex(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(antarians); err != nil {
-		panic(err)
+// BuildCancel cancels a queued or running build. A queued build is
+// canceled at once and answered with 200; a running one is killed, and
+// answered with 202 while it stops, freeing its worker. Finished builds
+// are 409.
+func BuildCancel(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		buildId := mux.Vars(r)["buildId"]
+		b, ok := findBuild(r.Context(), d, buildId)
+		if !ok {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Build with id of %s", buildId))
+			return
+		}
+		switch err := d.Builds.Cancel(buildId); err {
+		case nil:
+		case build.ErrNotFound:
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Build with id of %s", buildId))
+			return
+		case build.ErrFinished:
+			writeError(d, w, r, http.StatusConflict, fmt.Sprintf("Build %s has already finished", buildId))
+			return
+		default:
+			internalError(d, w, r, "cancel build", err)
+			return
+		}
+		requestLogger(d.Logger, r).Info("build canceled", "build_id", buildId, "antarian_id", b.AntarianId, "state", b.State)
+		e := requestAudit(r, lib.AuditBuildCancel)
+		e.AntarianId, e.BuildId, e.Before = b.AntarianId, b.Id, string(b.State)
+		audit(r.Context(), d, e)
+
+		status := http.StatusOK
+		if current, ok := d.Builds.Get(buildId); ok {
+			b = current
+		}
+		if !b.State.Done() {
+			status = http.StatusAccepted
+		}
+		writeJSON(d, w, r, status, b)
 	}
 }
 
-func AntarianShow(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	antarianId := vars["antarianId"]
-    //fmt.Fprintln(w, "Antarian show:", antarianId)
-    s := RepoFindAntarian(antarianId)
-    w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-    w.WriteHeader(http.StatusOK)
-    if err := json.NewEncoder(w).Encode(s); err != nil {
-        panic(err)
-    }
+// BuildIndex lists every build, newest first, paginated with limit and
+// offset. X-Total-Count carries the number of builds before pagination.
+func BuildIndex(d *Deps) http.HandlerFunc {
+	return listBuilds(d, func(r *http.Request) string { return "" })
+}
+
+// AntarianBuilds lists the build history of an Antarian like BuildIndex.
+// The history outlives the Antarian.
+func AntarianBuilds(d *Deps) http.HandlerFunc {
+	return listBuilds(d, func(r *http.Request) string { return mux.Vars(r)["antarianId"] })
+}
+
+// listBuilds serves a page of the builds of the Antarian named by
+// antarianId, or of all builds when it returns "".
+func listBuilds(d *Deps, antarianId func(r *http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err := parsePage(r)
+		if err != nil {
+			writeError(d, w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		list, err := d.repo(r.Context()).ListBuilds(antarianId(r))
+		if err != nil {
+			internalError(d, w, r, "list builds", err)
+			return
+		}
+		start, end := page(len(list), limit, offset)
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(list)))
+		writeJSON(d, w, r, http.StatusOK, list[start:end])
+	}
 }
 
-func AntarianBuild(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
+// AntarianNames lists one summary per Antarian name, optionally only names
+// starting with ?prefix= and only Antarians matching the label selectors,
+// paginated with limit and offset. X-Total-Count carries the number of names
+// before pagination.
+func AntarianNames(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err := parsePage(r)
+		if err != nil {
+			writeError(d, w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		labels, err := parseLabels(r)
+		if err != nil {
+			writeError(d, w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		names, err := d.repo(r.Context()).NameSummaries(r.URL.Query().Get("prefix"), labels)
+		if err != nil {
+			internalError(d, w, r, "summarize names", err)
+			return
+		}
+		start, end := page(len(names), limit, offset)
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(names)))
+		writeCacheable(d, w, r, names[start:end])
+	}
+}
 
-    type Build struct {
-        Id      string      `json:"id"`
-        Name    string      `json:"name"`
-        Version string      `json:"version"`
-        Start   time.Time   `json:"start"`
-        Running bool        `json:"running"`
-    }
+func AntarianDownload(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		antarianId := vars["antarianId"]
+		s, err := d.repo(r.Context()).FindAntarian(antarianId)
+		if err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "find antarian", err)
+			return
+		}
 
-    antarianId := vars["antarianId"]
-    //fmt.Fprintln(w, "Antarian show:", antarianId)
-    s := RepoFindAntarian(antarianId)
+		v, ok := platformArtifact(d, w, r, s)
+		if !ok {
+			return
+		}
+		filename := v.Artifact
+		download := &lib.Download{Id: s.Id, Name: s.Name, Version: s.Version, Platform: variantPlatform(v), Size: v.Size, Checksum: v.Checksum}
+		download.Url, download.Expires, err = downloadURL(r.Context(), d, s, filename)
+		if errors.Is(err, storage.ErrNotFound) {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Antarian %s has no artifact %s", antarianId, filename))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "sign download url", err)
+			return
+		}
+		e := requestAudit(r, lib.AuditAntarianDownload)
+		e.AntarianId = s.Id
+		audit(r.Context(), d, e)
+		writeJSON(d, w, r, http.StatusOK, download)
+	}
+}
 
-    build := &Build{s.Id,s.Name,s.Version,time.Now(),true}
+// AntarianUpdate replaces an Antarian with the request body. Fields left
+// out of the body are cleared.
+func AntarianUpdate(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		antarianId := mux.Vars(r)["antarianId"]
+		var antarian lib.Antarian
+		if err := decodeJSON(d, r, &antarian); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		updateAntarian(d, w, r, antarianId, antarian)
+	}
+}
 
+// AntarianPatch changes only the fields present in the request body.
+func AntarianPatch(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		antarianId := mux.Vars(r)["antarianId"]
+		antarian, err := d.repo(r.Context()).FindAntarian(antarianId)
+		if err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "find antarian", err)
+			return
+		}
+		// decoding writes into slices, maps and pointers in place, so work
+		// on a copy sharing none with the stored record; labels and
+		// annotations given are merged into those stored
+		antarian = antarian.DeepCopy()
+		if err := decodeJSON(d, r, &antarian); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		updateAntarian(d, w, r, antarianId, antarian)
+	}
+}
 
-    w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+func updateAntarian(d *Deps, w http.ResponseWriter, r *http.Request, antarianId string, antarian lib.Antarian) {
+	if antarian.Id == "" {
+		antarian.Id = antarianId
+	}
+	// a missing record is reported by UpdateAntarian below
+	before, _ := d.repo(r.Context()).FindAntarian(antarianId)
+	if err := validateUpdate(antarian, before); err != nil {
+		writeDecodeError(d, w, r, err)
+		return
+	}
+	if antarian.Id != antarianId {
+		writeError(d, w, r, http.StatusUnprocessableEntity, "id does not match the url",
+			fieldError{Field: "id", Message: fmt.Sprintf("must be %s", antarianId)})
+		return
+	}
+	if ns, ok := NamespaceFrom(r.Context()); ok && antarian.Namespace != "" && antarian.Namespace != ns {
+		writeError(d, w, r, http.StatusUnprocessableEntity, "namespace does not match the url",
+			fieldError{Field: "namespace", Message: fmt.Sprintf("must be %s", ns)})
+		return
+	}
+	// the artifact is only changed by uploading another
+	antarian.Artifact, antarian.Size, antarian.Checksum = before.Artifact, before.Size, before.Checksum
+	antarian.Variants = before.Variants
+	if err := requestStatus(&antarian, before); err != nil {
+		writeDecodeError(d, w, r, err)
+		return
+	}
+	// a request that changes nothing is neither written nor audited
+	changes := lib.Diff(before, antarian)
+	if len(changes) == 0 {
+		writeJSON(d, w, r, http.StatusOK, before)
+		return
+	}
+	s, err := d.repo(r.Context()).UpdateAntarian(antarian)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+		return
+	case ErrConflict:
+		writeError(d, w, r, http.StatusConflict, fmt.Sprintf("%s %s already exists", antarian.Name, antarian.Version))
+		return
+	default:
+		internalError(d, w, r, "update antarian", err)
+		return
+	}
+	requestLogger(d.Logger, r).Info("updated antarian", "antarian_id", s.Id, "name", s.Name)
+	e := requestAudit(r, lib.AuditAntarianUpdate)
+	e.AntarianId, e.Before, e.After, e.Changes = s.Id, auditSummary(before), auditSummary(s), changes
+	audit(r.Context(), d, e)
+	writeJSON(d, w, r, http.StatusOK, s)
+}
 
-    w.WriteHeader(http.StatusOK)
-    if err := json.NewEncoder(w).Encode(build); err != nil {
-        panic(err)
-    }
+// requestStatus gives a, the body of an update, the status of before, the
+// stored record, unless the body asks for another. The status moves with
+// the builds, so a request may only archive an Antarian or return an
+// archived one to pending. Running and Finished in the body are ignored.
+func requestStatus(a *lib.Antarian, before lib.Antarian) error {
+	want := a.Status
+	a.Status, a.Running, a.Finished = before.CurrentStatus(), before.Running, before.Finished
+	if want == "" || want == a.Status {
+		return nil
+	}
+	if want.Valid() && want != lib.StatusArchived && want != lib.StatusPending {
+		return &lib.ValidationError{Field: "status", Message: fmt.Sprintf("%s is set by builds; only %s or %s may be requested", want, lib.StatusArchived, lib.StatusPending)}
+	}
+	if err := a.SetStatus(want); err != nil {
+		return &lib.ValidationError{Field: "status", Message: err.Error()}
+	}
+	return nil
 }
 
-func AntarianDownload(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	antarianId := vars["antarianId"]
-    //fmt.Fprintln(w, "Antarian show:", antarianId)
-    s := RepoFindAntarian(antarianId)
+// AntarianDelete removes an Antarian and, unless ?remove_artifacts=false,
+// its stored artifact files. Its build history is kept.
+func AntarianDelete(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		antarianId := mux.Vars(r)["antarianId"]
+		removeArtifacts := true
+		if v := r.URL.Query().Get("remove_artifacts"); v != "" {
+			var err error
+			if removeArtifacts, err = strconv.ParseBool(v); err != nil {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("remove_artifacts: %q is not a boolean", v))
+				return
+			}
+		}
+
+		s, err := d.repo(r.Context()).FindAntarian(antarianId)
+		if err == nil {
+			err = d.repo(r.Context()).DestroyAntarian(antarianId)
+		}
+		if err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s to delete", antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "delete antarian", err)
+			return
+		}
+		log := requestLogger(d.Logger, r)
+		log.Info("deleted antarian", "antarian_id", antarianId, "name", s.Name)
+		e := requestAudit(r, lib.AuditAntarianDelete)
+		e.AntarianId, e.Before = antarianId, auditSummary(s)
+		audit(r.Context(), d, e)
 
-    type Download struct {
-        Id      string      `json:"id"`
-        Name    string      `json:"name"`
-        Version string      `json:"version"`
-        Url     string      `json:"url"`
-    }
+		if removeArtifacts {
+			// the record is gone either way; leftovers are found by /admin/gc
+			if err := deleteArtifacts(r.Context(), d, antarianId); err != nil {
+				log.Error("remove artifacts", "err", err, "antarian_id", antarianId)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
 
-    dlurl := s.Uri + "/files/" + antarianId + "/" + s.Filename()
-    download := &Download{s.Id, s.Name, s.Version, dlurl}
-    w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-    w.WriteHeader(http.StatusOK)
-    if err := json.NewEncoder(w).Encode(download); err != nil {
-        panic(err)
-    }
+// deleteArtifacts removes every file stored under antarianId.
+func deleteArtifacts(ctx context.Context, d *Deps, antarianId string) error {
+	files, err := d.Storage.List(ctx, antarianId)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := d.Storage.Delete(ctx, f.Id, f.Name); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func AntarianCreate(w http.ResponseWriter, r *http.Request) {
-	var antarian  lib.Antarian
-	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+// releaseOptions returns how the release of a new Antarian named name is
+// made, as the release config says. The counter scheme numbers it after
+// the highest numeric release of the name.
+func releaseOptions(d *Deps, ctx context.Context, name string) (lib.ReleaseOptions, error) {
+	opts := lib.ReleaseOptions{Scheme: lib.ReleaseScheme(d.Config.Release.Scheme), Layout: d.Config.Release.Layout}
+	if opts.Scheme != lib.ReleaseCounter {
+		return opts, nil
+	}
+	named, err := d.repo(ctx).AntariansNamed(name)
 	if err != nil {
-		panic(err)
+		return opts, err
+	}
+	for _, a := range named {
+		if n, err := strconv.Atoi(a.Release); err == nil && n > opts.Counter {
+			opts.Counter = n
+		}
 	}
-	if err := r.Body.Close(); err != nil {
-		panic(err)
+	opts.Counter++
+	return opts, nil
+}
+
+// AntarianCreate creates an Antarian from the fields of the body its
+// creator chooses, those of a lib.CreateRequest. Any others, such as id or
+// status, are accepted and ignored, so a record read back can be posted.
+func AntarianCreate(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body lib.Antarian
+		if err := decodeJSON(d, r, &body); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		release, err := releaseOptions(d, r.Context(), body.Name)
+		if err != nil {
+			internalError(d, w, r, "create antarian", err)
+			return
+		}
+		antarian, err := lib.NewAntarianFromRequest(body.CreateRequest(), d.Config.BaseURL(), release)
+		if _, invalid := err.(*lib.ValidationError); invalid {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "create antarian", err)
+			return
+		}
+		if err := antarian.Validate(); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		if err := r.Body.Close(); err != nil {
+			requestLogger(d.Logger, r).Warn("close request body", "err", err)
+		}
+
+		s, err := d.repo(r.Context()).CreateAntarian(antarian)
+		switch err {
+		case nil:
+		case ErrConflict:
+			writeError(d, w, r, http.StatusConflict, fmt.Sprintf("%s %s already exists", antarian.Name, antarian.Version))
+			return
+		default:
+			internalError(d, w, r, "create antarian", err)
+			return
+		}
+		requestLogger(d.Logger, r).Info("created antarian", "antarian_id", s.Id, "name", s.Name)
+		e := requestAudit(r, lib.AuditAntarianCreate)
+		e.AntarianId, e.After = s.Id, auditSummary(s)
+		audit(r.Context(), d, e)
+		writeJSON(d, w, r, http.StatusCreated, s)
 	}
-	if err := json.Unmarshal(body, &antarian); err != nil {
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		w.WriteHeader(422) // unprocessable entity
-		if err := json.NewEncoder(w).Encode(err); err != nil {
-			panic(err)
+}
+
+// parsePage reads the limit and offset query parameters. A zero limit means
+// no limit.
+func parsePage(r *http.Request) (limit, offset int, err error) {
+	for name, p := range map[string]*int{"limit": &limit, "offset": &offset} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%s: %q is not a non-negative integer", name, v)
 		}
+		*p = n
 	}
+	return limit, offset, nil
+}
 
-	s := RepoCreateAntarian(antarian)
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(s); err != nil {
-		panic(err)
+// page returns the [offset, offset+limit) window of a collection of n items.
+func page(n, limit, offset int) (start, end int) {
+	if offset > n {
+		offset = n
+	}
+	end = n
+	if limit > 0 && offset+limit < n {
+		end = offset + limit
 	}
+	return offset, end
+}
+
+// writeJSON sends v with the given status, as JSON unless the request's
+// Accept header prefers YAML or XML. A value that cannot be encoded is
+// answered with a 500 instead.
+func writeJSON(d *Deps, w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	contentType, body, err := encodeBody(r, v)
+	if err != nil {
+		requestLogger(d.Logger, r).Error("encode response", "err", err, "status", status)
+		writeErrorBody(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		requestLogger(d.Logger, r).Error("write response", "err", err, "status", status)
+	}
+}
+
+// internalError logs err and answers 500 without exposing it to the client.
+func internalError(d *Deps, w http.ResponseWriter, r *http.Request, msg string, err error) {
+	requestLogger(d.Logger, r).Error(msg, "err", err)
+	writeError(d, w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 }
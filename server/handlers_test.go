@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// newTestServer starts the full handler of an Instance, configured by the
+// defaults, scratch directories and configure, behind httptest.
+func newTestServer(t *testing.T, configure ...func(*config.Config)) (*Instance, *httptest.Server) {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(nil)
+	cfg := config.Default()
+	cfg.URL = "http://" + ts.Listener.Addr().String()
+	cfg.LogLevel = "error"
+	cfg.ArtifactDir = t.TempDir()
+	cfg.Build.WorkDir = t.TempDir()
+	cfg.Build.Command = "true"
+	for _, fn := range configure {
+		fn(cfg)
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Config.Handler = s.Handler()
+	ts.Start()
+	t.Cleanup(func() {
+		ts.Close()
+		s.Shutdown(context.Background())
+	})
+	return s, ts
+}
+
+// call sends body, JSON encoded unless it is a string, and decodes the
+// response into out when out is not nil. It returns the status.
+func call(t *testing.T, ts *httptest.Server, method, path string, body, out interface{}, header ...string) int {
+	t.Helper()
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = bytes.NewBufferString(b)
+	default:
+		raw, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAntarianCreateConflict(t *testing.T) {
+	_, ts := newTestServer(t)
+	body := `{"name":"libfoo","version":"1.0.0","baseurl":"http://example.com/libfoo","requires":[]}`
+	if status := call(t, ts, "POST", "/v1/antarians", body, nil); status != http.StatusCreated {
+		t.Fatalf("first create = %d, want 201", status)
+	}
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	if status := call(t, ts, "POST", "/v1/antarians", body, &apiErr); status != http.StatusConflict || apiErr.Code != "conflict" {
+		t.Errorf("second create = %d %q, want 409 conflict", status, apiErr.Code)
+	}
+	// the same name and version may exist in another namespace
+	if status := call(t, ts, "POST", "/v1/namespaces/team/antarians", body, nil); status != http.StatusCreated {
+		t.Errorf("create in another namespace = %d, want 201", status)
+	}
+}
+
+func TestAntarianIndexPages(t *testing.T) {
+	_, ts := newTestServer(t)
+	for i := 0; i < 5; i++ {
+		call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "libfoo", Version: fmt.Sprintf("1.0.%d", i)}, nil)
+	}
+	var all lib.Antarians
+	call(t, ts, "GET", "/v1/antarians?name=libfoo", nil, &all)
+	if len(all) != 5 {
+		t.Fatalf("%d antarians, want 5", len(all))
+	}
+	versions := func(list lib.Antarians) []string {
+		var vs []string
+		for _, a := range list {
+			vs = append(vs, a.Version)
+		}
+		return vs
+	}
+
+	tests := []struct {
+		query    string
+		versions []string
+		next     string
+		prev     string
+	}{
+		{"limit=2", []string{"1.0.0", "1.0.1"}, "after=" + all[1].Id + "&limit=2&name=libfoo", ""},
+		{"limit=2&offset=2", []string{"1.0.2", "1.0.3"}, "after=" + all[3].Id + "&limit=2&name=libfoo", "limit=2&name=libfoo&offset=0"},
+		{"limit=2&after=" + all[3].Id, []string{"1.0.4"}, "", "limit=2&name=libfoo&offset=2"},
+		{"limit=3&offset=1", []string{"1.0.1", "1.0.2", "1.0.3"}, "after=" + all[3].Id + "&limit=3&name=libfoo", "limit=3&name=libfoo&offset=0"},
+		{"", []string{"1.0.0", "1.0.1", "1.0.2", "1.0.3", "1.0.4"}, "", ""},
+		{"offset=3", []string{"1.0.3", "1.0.4"}, "", "envelope=true&name=libfoo&offset=0"},
+		{"limit=0&offset=3", []string{"1.0.3", "1.0.4"}, "", "limit=0&name=libfoo&offset=0"},
+	}
+	for _, tt := range tests {
+		query := "name=libfoo"
+		if tt.query != "" {
+			query += "&" + tt.query
+		}
+		var p antarianPage
+		if status := call(t, ts, "GET", "/v1/antarians?envelope=true&"+query, nil, &p); status != http.StatusOK {
+			t.Fatalf("GET ?%s = %d", query, status)
+		}
+		want := func(q string) string {
+			if q == "" {
+				return ""
+			}
+			return "/v1/antarians?" + strings.Replace(q, "limit", "envelope=true&limit", 1)
+		}
+		if !reflect.DeepEqual(versions(p.Items), tt.versions) || p.Total != 5 || p.Next != want(tt.next) || p.Prev != want(tt.prev) {
+			t.Errorf("GET ?%s = %v total %d next %q prev %q\nwant %v total 5 next %q prev %q",
+				query, versions(p.Items), p.Total, p.Next, p.Prev, tt.versions, want(tt.next), want(tt.prev))
+		}
+
+		// without the envelope the same page is a bare list
+		var list lib.Antarians
+		call(t, ts, "GET", "/v1/antarians?"+query, nil, &list)
+		if !reflect.DeepEqual(versions(list), tt.versions) {
+			t.Errorf("GET ?%s = %v, want %v", query, versions(list), tt.versions)
+		}
+	}
+
+	// following next walks every page once
+	var walked []string
+	for next := "/v1/antarians?envelope=true&limit=2&name=libfoo"; next != ""; {
+		var p antarianPage
+		call(t, ts, "GET", next, nil, &p)
+		walked = append(walked, versions(p.Items)...)
+		next = p.Next
+	}
+	if !reflect.DeepEqual(walked, versions(all)) {
+		t.Errorf("walked %v, want %v", walked, versions(all))
+	}
+
+	if status := call(t, ts, "GET", "/v1/antarians?envelope=maybe", nil, nil); status != http.StatusBadRequest {
+		t.Errorf("envelope=maybe = %d, want 400", status)
+	}
+}
+
+// TestAntarianStreamFilters checks that the NDJSON stream, by its own path
+// and by Accept on the index, returns what the JSON index does.
+func TestAntarianStreamFilters(t *testing.T) {
+	_, ts := newTestServer(t)
+	infra := map[string]string{"team": "infra"}
+	for _, a := range []lib.Antarian{
+		{Name: "libfoo", Version: "1.0.0", Labels: infra},
+		{Name: "libfoo", Version: "2.0.0"},
+		{Name: "libbar", Version: "1.0.0", Labels: infra},
+		{Name: "libbaz", Version: "3.0.0", Labels: infra},
+	} {
+		if status := call(t, ts, "POST", "/v1/antarians", a, nil); status != http.StatusCreated {
+			t.Fatalf("create %s = %d", a.Name, status)
+		}
+	}
+	stream := func(path, accept string) (int, []string) {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		req.Header.Set("Accept", accept)
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var ids []string
+		dec := json.NewDecoder(resp.Body)
+		for resp.StatusCode == http.StatusOK {
+			var a lib.Antarian
+			if err := dec.Decode(&a); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("GET %s: %v", path, err)
+			}
+			ids = append(ids, a.Id)
+		}
+		return resp.StatusCode, ids
+	}
+
+	for _, query := range []string{
+		"name=libfoo",
+		"version=1.0.0",
+		"sort=-name",
+		"name=libfoo&sort=-version&limit=1",
+		"limit=2&offset=1",
+		"name=libnone",
+		// label selectors narrow the stream as they do the index
+		"label=team%3Dinfra",
+		"label=%21team",
+		"label=team%3Dinfra&label=team%21%3Dops&name=libfoo",
+		"label=team%3Dinfra&sort=-name&limit=2&offset=1",
+	} {
+		var list lib.Antarians
+		call(t, ts, "GET", "/v1/antarians?"+query, nil, &list)
+		var want []string
+		for _, a := range list {
+			want = append(want, a.Id)
+		}
+		for _, path := range []string{"/v1/antarians/stream?" + query, "/v1/antarians?" + query} {
+			if status, got := stream(path, ndjson); status != http.StatusOK || !reflect.DeepEqual(got, want) {
+				t.Errorf("GET %s = %d %v, want %v", path, status, got, want)
+			}
+		}
+	}
+	for _, query := range []string{"status=bogus", "label=%3D%3D", "sort=size", "limit=-1", "after=x"} {
+		if status, _ := stream("/v1/antarians/stream?"+query, ndjson); status != http.StatusBadRequest {
+			t.Errorf("GET /v1/antarians/stream?%s = %d, want 400", query, status)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// healthTimeout bounds the health checks, so a hung database cannot hang
+// the probe as well.
+const healthTimeout = 2 * time.Second
+
+const (
+	healthOK   = "ok"
+	healthFail = "fail"
+)
+
+// healthReport is the body of /healthz and /readyz. Status is "fail" when
+// any check failed. Failures are described without internal details; those
+// are logged.
+type healthReport struct {
+	Status     string        `json:"status"`
+	Repository repoHealth    `json:"repository"`
+	Builds     buildsHealth  `json:"builds"`
+	Storage    storageHealth `json:"storage"`
+}
+
+type repoHealth struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Backend string `json:"backend"`
+}
+
+type buildsHealth struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Workers   int    `json:"workers"`
+	Active    int    `json:"active"`
+	Pending   int    `json:"pending"`
+	QueueSize int    `json:"queue_size"`
+}
+
+type storageHealth struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	FreeBytes  uint64 `json:"free_bytes,omitempty"`
+	TotalBytes uint64 `json:"total_bytes,omitempty"`
+}
+
+// pinger is implemented by repositories whose backing store can become
+// unreachable.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// pingRepository checks that repo can still reach its data.
+func pingRepository(ctx context.Context, repo Repository) error {
+	if p, ok := repo.(pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Healthz reports the health checks for a liveness probe. It answers 200
+// whatever they find: a server that can answer is alive, and restarting it
+// would not bring back its database.
+func Healthz(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(d, w, r, http.StatusOK, checkHealth(d, r))
+	}
+}
+
+// Readyz reports the health checks for a readiness probe, answering 503
+// unless every one passed.
+func Readyz(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checkHealth(d, r)
+		status := http.StatusOK
+		if report.Status != healthOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(d, w, r, status, report)
+	}
+}
+
+// checkHealth checks that the repository answers, that the build queue has
+// room and that the artifact filesystem has at least artifact_min_free
+// bytes left.
+func checkHealth(d *Deps, r *http.Request) healthReport {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+	log := requestLogger(d.Logger, r)
+	report := healthReport{Status: healthOK}
+	fail := func(status *string) {
+		*status = healthFail
+		report.Status = healthFail
+	}
+
+	report.Repository = repoHealth{Status: healthOK, Backend: d.Config.Backend}
+	if err := pingRepository(ctx, d.Repo); err != nil {
+		log.Warn("repository health check failed", "err", err)
+		report.Repository.Error = "repository is unreachable"
+		fail(&report.Repository.Status)
+	}
+
+	stats := d.Builds.Stats()
+	report.Builds = buildsHealth{
+		Status:    healthOK,
+		Workers:   stats.Workers,
+		Active:    stats.Active,
+		Pending:   stats.Pending,
+		QueueSize: stats.QueueSize,
+	}
+	if stats.Pending >= stats.QueueSize {
+		report.Builds.Error = "build queue is full"
+		fail(&report.Builds.Status)
+	}
+
+	report.Storage = storageHealth{Status: healthOK}
+	if sp, ok := d.Storage.(interface {
+		Space() (free, total uint64, err error)
+	}); ok {
+		free, total, err := sp.Space()
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+		case err != nil:
+			log.Warn("storage health check failed", "err", err)
+			report.Storage.Error = "artifact filesystem cannot be read"
+			fail(&report.Storage.Status)
+		default:
+			report.Storage.FreeBytes, report.Storage.TotalBytes = free, total
+			if min := d.Config.ArtifactMinFree; min > 0 && free < uint64(min) {
+				report.Storage.Error = fmt.Sprintf("less than %d bytes free", min)
+				fail(&report.Storage.Status)
+			}
+		}
+	}
+	return report
+}
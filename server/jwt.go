@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xbcsmith/antares/config"
+)
+
+// jwtVerifier checks the signature and standard claims of JWTs and reads
+// the caller's roles from them.
+type jwtVerifier struct {
+	secret     []byte
+	key        interface{}
+	rolesClaim string
+	parser     *jwt.Parser
+}
+
+// newJWTVerifier returns the verifier described by cfg, or nil when
+// neither a secret nor a public key is configured.
+func newJWTVerifier(cfg config.JWT) (*jwtVerifier, error) {
+	if cfg.Secret == "" && cfg.PublicKeyFile == "" {
+		return nil, nil
+	}
+	v := &jwtVerifier{rolesClaim: cfg.RolesClaim}
+	var methods []string
+	if cfg.Secret != "" {
+		v.secret = []byte(cfg.Secret)
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	if cfg.PublicKeyFile != "" {
+		raw, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("jwt public key: %v", err)
+		}
+		if v.key, err = jwt.ParseRSAPublicKeyFromPEM(raw); err != nil {
+			return nil, fmt.Errorf("jwt public key %s: %v", cfg.PublicKeyFile, err)
+		}
+		methods = append(methods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512")
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods)}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+	return v, nil
+}
+
+// verify returns the caller named by token. Expired and not yet valid
+// tokens are rejected.
+func (v *jwtVerifier) verify(ctx context.Context, token string) (Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			return v.secret, nil
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return v.key, nil
+		}
+		return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+	})
+	if err != nil {
+		return Principal{}, err
+	}
+	sub, _ := claims.GetSubject()
+	roles, err := stringList(claims[v.rolesClaim])
+	if err != nil {
+		return Principal{}, fmt.Errorf("claim %s: %v", v.rolesClaim, err)
+	}
+	return Principal{Subject: sub, Roles: roles}, nil
+}
+
+// stringList reads a claim holding a space separated string or a list of
+// strings.
+func stringList(claim interface{}) ([]string, error) {
+	switch c := claim.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.Fields(c), nil
+	case []interface{}:
+		list := make([]string, 0, len(c))
+		for _, item := range c {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a string", item)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("must be a string or a list of strings")
+}
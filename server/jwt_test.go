@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xbcsmith/antares/config"
+)
+
+const jwtSecret = "0123456789abcdef0123456789abcdef"
+
+// signed returns claims signed with key by method, expiring in an hour
+// unless claims say otherwise.
+func signed(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWTVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(keyFile, pub, 0644); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	v, err := newJWTVerifier(config.JWT{Secret: jwtSecret, PublicKeyFile: keyFile, Issuer: "https://id.example.com", Audience: "antares", RolesClaim: "roles"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "alice", "iss": "https://id.example.com", "aud": "antares", "roles": []string{"read", "write"}}
+	}
+	with := func(k string, val interface{}) jwt.MapClaims {
+		c := valid()
+		if val == nil {
+			delete(c, k)
+		} else {
+			c[k] = val
+		}
+		return c
+	}
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"hmac", signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), valid()), true},
+		{"rsa", signed(t, jwt.SigningMethodRS256, key, valid()), true},
+		{"rsa pss", signed(t, jwt.SigningMethodPS256, key, valid()), true},
+		{"bad hmac signature", signed(t, jwt.SigningMethodHS256, []byte("another secret entirely"), valid()), false},
+		{"bad rsa signature", signed(t, jwt.SigningMethodRS256, other, valid()), false},
+		{"tampered", signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), valid()) + "x", false},
+		{"expired", signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), with("exp", time.Now().Add(-time.Minute).Unix())), false},
+		{"not yet valid", signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), with("nbf", time.Now().Add(time.Hour).Unix())), false},
+		{"alg none", none, false},
+		// the public key used as an HMAC secret
+		{"alg confusion", signed(t, jwt.SigningMethodHS256, pub, valid()), false},
+		{"unlisted alg", signed(t, jwt.SigningMethodES256, ecKey, valid()), false},
+		{"wrong issuer", signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), with("iss", "https://evil.example.com")), false},
+		{"no issuer", signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), with("iss", nil)), false},
+		{"wrong audience", signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), with("aud", "other")), false},
+		{"no audience", signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), with("aud", nil)), false},
+		{"roles not strings", signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), with("roles", []int{1})), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.verify(context.Background(), tt.token)
+			if tt.ok != (err == nil) {
+				t.Fatalf("verify = %+v, %v; want ok %v", p, err, tt.ok)
+			}
+			if tt.ok && (p.Subject != "alice" || !reflect.DeepEqual(p.Roles, []string{"read", "write"})) {
+				t.Errorf("principal = %+v", p)
+			}
+		})
+	}
+
+	// a space separated roles claim is read as a list
+	p, err := v.verify(context.Background(), signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), with("roles", "read admin")))
+	if err != nil || !reflect.DeepEqual(p.Roles, []string{"read", "admin"}) {
+		t.Errorf("roles = %v, %v", p.Roles, err)
+	}
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.JWT.Secret = jwtSecret
+	})
+	good := signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), jwt.MapClaims{"sub": "alice", "roles": "read"})
+	expired := signed(t, jwt.SigningMethodHS256, []byte(jwtSecret), jwt.MapClaims{"sub": "alice", "roles": "read", "exp": time.Now().Add(-time.Minute).Unix()})
+	forged := signed(t, jwt.SigningMethodHS256, []byte("not the secret"), jwt.MapClaims{"sub": "alice", "roles": "read"})
+
+	if status := call(t, ts, "GET", "/v1/antarians", nil, nil, "Authorization", "Bearer "+good); status != http.StatusOK {
+		t.Errorf("valid token = %d, want 200", status)
+	}
+	for name, token := range map[string]string{"expired": expired, "forged": forged} {
+		if status := call(t, ts, "GET", "/v1/antarians", nil, nil, "Authorization", "Bearer "+token); status != http.StatusUnauthorized {
+			t.Errorf("%s token = %d, want 401", name, status)
+		}
+	}
+}
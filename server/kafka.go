@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// kafkaPublisher publishes the events of a hub to Kafka. Messages are
+// keyed by the Antarian's id and partitioned by hash of the key, so the
+// events of one Antarian are consumed in the order they happened. Writes
+// are asynchronous; failures are logged.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+	cfg    config.Kafka
+	log    *slog.Logger
+}
+
+func newKafkaPublisher(cfg config.Kafka, log *slog.Logger) *kafkaPublisher {
+	log = log.With("subscriber", "kafka")
+	return &kafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Async:        true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					log.Error("publish events", "err", err, "messages", len(messages))
+				}
+			},
+		},
+		cfg: cfg,
+		log: log,
+	}
+}
+
+// topic returns the topic of events of type typ, or "" when they are not
+// published.
+func (p *kafkaPublisher) topic(typ string) string {
+	if topic, ok := p.cfg.Topics[typ]; ok {
+		return topic
+	}
+	return p.cfg.Topic
+}
+
+// encode serializes ev in the configured format, returning its content
+// type too.
+func (p *kafkaPublisher) encode(ev lib.Event) (string, []byte, error) {
+	if p.cfg.Format == "avro" {
+		body, err := encodeEventAvro(ev)
+		return "avro/binary", body, err
+	}
+	body, err := json.Marshal(ev)
+	return "application/json", body, err
+}
+
+// run publishes the events of hub until ctx is done.
+func (p *kafkaPublisher) run(ctx context.Context, hub *EventHub) {
+	hub.follow(ctx, p.log, func(n Notification) {
+		topic := p.topic(n.Event.Type)
+		if topic == "" {
+			return
+		}
+		contentType, body, err := p.encode(n.Event)
+		if err != nil {
+			p.log.Error("encode event", "err", err, "event_id", n.Event.Id)
+			return
+		}
+		err = p.writer.WriteMessages(ctx, kafka.Message{
+			Topic: topic,
+			Key:   []byte(eventAntarianId(n.Event)),
+			Value: body,
+			Headers: []kafka.Header{
+				{Key: "antares-event", Value: []byte(n.Event.Type)},
+				{Key: "content-type", Value: []byte(contentType)},
+			},
+			Time: n.Event.Time,
+		})
+		if err != nil {
+			p.log.Error("publish event", "err", err, "event_id", n.Event.Id, "topic", topic)
+		}
+	})
+}
+
+// Close sends what is buffered and disconnects.
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+// eventAntarianId returns the id of the Antarian ev is about.
+func eventAntarianId(ev lib.Event) string {
+	switch {
+	case ev.Antarian != nil:
+		return ev.Antarian.Id
+	case ev.Build != nil:
+		return ev.Build.AntarianId
+	}
+	return ""
+}
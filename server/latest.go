@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// latestQuery holds the modifiers accepted by AntarianLatest.
+type latestQuery struct {
+	// State is the state the Antarian's most recent build must be in.
+	State lib.BuildState
+	// Channel is the first prerelease identifier, e.g. "beta" for
+	// 2.0.0-beta.1. "stable" selects releases only.
+	Channel    string
+	Release    string
+	Constraint *lib.Constraint
+	// IncludePrerelease admits prereleases, which are skipped by default
+	// unless a non-stable Channel asks for them.
+	IncludePrerelease bool
+}
+
+// AntarianLatest resolves the newest version of the named Antarian. Versions
+// are ordered by semantic version with the newest Start breaking ties;
+// versions that do not parse rank below those that do.
+func AntarianLatest(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		q, err := parseLatestQuery(r)
+		if err != nil {
+			writeError(d, w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		candidates, err := d.repo(r.Context()).AntariansNamed(name)
+		if err != nil {
+			internalError(d, w, r, "find antarians by name", err)
+			return
+		}
+		if len(candidates) == 0 {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("no Antarian is named %s", name))
+			return
+		}
+		latest, ok := resolveLatest(candidates, q, func(id string) lib.BuildState {
+			b, _, err := d.repo(r.Context()).LatestBuild(id)
+			if err != nil {
+				// treated as never built, so a state filter skips it
+				requestLogger(d.Logger, r).Error("find latest build", "err", err, "antarian_id", id)
+			}
+			return b.State
+		})
+		if !ok {
+			writeError(d, w, r, http.StatusNotFound,
+				fmt.Sprintf("%s has %d versions but none matches the constraints", name, len(candidates)))
+			return
+		}
+		writeCacheable(d, w, r, latest)
+	}
+}
+
+// AntarianVersions lists every version of the named Antarian, newest first
+// as AntarianLatest orders them.
+func AntarianVersions(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		list, err := d.repo(r.Context()).AntariansNamed(name)
+		if err != nil {
+			internalError(d, w, r, "find antarians by name", err)
+			return
+		}
+		if len(list) == 0 {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("no Antarian is named %s", name))
+			return
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			return lib.Newer(list[i], list[j])
+		})
+		writeCacheable(d, w, r, list)
+	}
+}
+
+// AntarianVersion finds the Antarian with a name and version, the version
+// given exactly as it was created.
+func AntarianVersion(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		name, version := vars["name"], vars["version"]
+		list, err := d.repo(r.Context()).AntariansNamed(name)
+		if err != nil {
+			internalError(d, w, r, "find antarians by name", err)
+			return
+		}
+		for _, a := range list {
+			if a.Version == version {
+				writeCacheable(d, w, r, a)
+				return
+			}
+		}
+		writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("no Antarian is named %s with version %s", name, version))
+	}
+}
+
+func parseLatestQuery(r *http.Request) (latestQuery, error) {
+	v := r.URL.Query()
+	q := latestQuery{
+		State:   lib.BuildState(v.Get("state")),
+		Channel: v.Get("channel"),
+		Release: v.Get("release"),
+	}
+	if s := v.Get("constraint"); s != "" {
+		c, err := lib.ParseConstraint(s)
+		if err != nil {
+			return q, err
+		}
+		q.Constraint = &c
+	}
+	if s := v.Get("include_prerelease"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("include_prerelease: %q is not a boolean", s)
+		}
+		q.IncludePrerelease = b
+	}
+	return q, nil
+}
+
+// resolveLatest picks the winning candidate. state reports the state of an
+// Antarian's most recent build.
+func resolveLatest(candidates lib.Antarians, q latestQuery, state func(id string) lib.BuildState) (lib.Antarian, bool) {
+	var matches lib.Antarians
+	for _, a := range candidates {
+		v, err := lib.ParseVersion(a.Version)
+		semver := err == nil
+		if !semver && (q.Constraint != nil || q.Channel != "") {
+			continue
+		}
+		if semver && !channelMatches(v, q) {
+			continue
+		}
+		if q.Constraint != nil && !q.Constraint.Check(v) {
+			continue
+		}
+		if q.Release != "" && a.Release != q.Release {
+			continue
+		}
+		if q.State != "" && state(a.Id) != q.State {
+			continue
+		}
+		matches = append(matches, a)
+	}
+	if len(matches) == 0 {
+		return lib.Antarian{}, false
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return lib.Newer(matches[i], matches[j])
+	})
+	return matches[0], true
+}
+
+func channelMatches(v lib.Version, q latestQuery) bool {
+	switch q.Channel {
+	case "":
+		return q.IncludePrerelease || !v.Prerelease()
+	case "stable":
+		return !v.Prerelease()
+	}
+	return v.Prerelease() && v.Pre[0] == q.Channel
+}
+
+// newerRelease is lib.Newer, except that a release always wins over a
+// prerelease.
+func newerRelease(a, b lib.Antarian) bool {
+	if ap, bp := prerelease(a), prerelease(b); ap != bp {
+		return !ap
+	}
+	return lib.Newer(a, b)
+}
+
+func prerelease(a lib.Antarian) bool {
+	v, err := lib.ParseVersion(a.Version)
+	return err == nil && v.Prerelease()
+}
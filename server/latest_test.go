@@ -0,0 +1,110 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+func TestResolveLatest(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	candidates := lib.Antarians{
+		{Id: "a1", Version: "1.0.0", Release: "1", Start: t0},
+		{Id: "a2", Version: "2.0.0", Release: "1", Start: t0},
+		{Id: "a3", Version: "2.0.0", Release: "2", Start: t0.Add(time.Minute)},
+		{Id: "a4", Version: "2.1.0-beta.1", Start: t0.Add(2 * time.Minute)},
+		{Id: "a5", Version: "2.1.0-rc.1", Start: t0.Add(time.Minute)},
+		{Id: "a6", Version: "1.5.0", Start: t0.Add(3 * time.Minute)},
+		{Id: "a7", Version: "nightly", Start: t0.Add(time.Hour)},
+	}
+	states := map[string]lib.BuildState{"a1": lib.BuildSucceeded, "a2": lib.BuildFailed, "a6": lib.BuildSucceeded}
+	state := func(id string) lib.BuildState { return states[id] }
+
+	constraint := func(s string) *lib.Constraint {
+		c, err := lib.ParseConstraint(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &c
+	}
+	tests := []struct {
+		name string
+		q    latestQuery
+		want string
+	}{
+		{"newest release, start breaks the tie", latestQuery{}, "a3"},
+		{"prereleases included", latestQuery{IncludePrerelease: true}, "a5"},
+		{"channel", latestQuery{Channel: "beta"}, "a4"},
+		{"stable channel", latestQuery{Channel: "stable", IncludePrerelease: true}, "a3"},
+		{"release", latestQuery{Release: "1"}, "a2"},
+		{"constraint", latestQuery{Constraint: constraint("^1.0")}, "a6"},
+		{"constraint excludes", latestQuery{Constraint: constraint("<1.5.0")}, "a1"},
+		{"succeeded", latestQuery{State: lib.BuildSucceeded}, "a6"},
+		{"succeeded and constraint", latestQuery{State: lib.BuildSucceeded, Constraint: constraint("~1.0")}, "a1"},
+		{"nothing matches", latestQuery{Constraint: constraint("^3.0")}, ""},
+		{"unknown channel", latestQuery{Channel: "alpha"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := resolveLatest(candidates, tt.q, state)
+			if ok != (tt.want != "") || got.Id != tt.want {
+				t.Errorf("resolveLatest = %q %v, want %q", got.Id, ok, tt.want)
+			}
+		})
+	}
+
+	// versions that do not parse only win when nothing else is left
+	got, _ := resolveLatest(lib.Antarians{candidates[6], {Id: "b1", Version: "0.0.1", Start: t0}}, latestQuery{}, state)
+	if got.Id != "b1" {
+		t.Errorf("resolveLatest = %s, want the semantic version over a newer unparsed one", got.Id)
+	}
+	got, _ = resolveLatest(lib.Antarians{candidates[6], {Id: "b2", Version: "snapshot", Start: t0}}, latestQuery{}, state)
+	if got.Id != "a7" {
+		t.Errorf("resolveLatest = %s, want the newest start among unparsed versions", got.Id)
+	}
+}
+
+func TestAntarianLatest(t *testing.T) {
+	_, ts := newTestServer(t)
+	ids := map[string]string{}
+	for _, v := range []string{"1.0.0", "2.0.0", "2.1.0-beta.1"} {
+		var a lib.Antarian
+		call(t, ts, "POST", "/v1/antarians", lib.Antarian{Name: "libfoo", Version: v}, &a)
+		ids[v] = a.Id
+	}
+	var b lib.Build
+	call(t, ts, "POST", "/v1/antarians/"+ids["1.0.0"]+"/build", nil, &b)
+	waitBuild(t, ts, b.Id)
+
+	tests := []struct {
+		path    string
+		status  int
+		version string
+		message string
+	}{
+		{"/libfoo/latest", 200, "2.0.0", ""},
+		{"/libfoo/latest?include_prerelease=true", 200, "2.1.0-beta.1", ""},
+		{"/libfoo/latest?channel=beta", 200, "2.1.0-beta.1", ""},
+		{"/libfoo/latest?constraint=^1.0", 200, "1.0.0", ""},
+		{"/libfoo/latest?state=succeeded", 200, "1.0.0", ""},
+		{"/libfoo/latest?constraint=^3.0", 404, "", "none matches"},
+		{"/libbar/latest", 404, "", "no Antarian is named libbar"},
+		{"/libfoo/latest?constraint=bogus", 400, "", "constraint"},
+		{"/libfoo/latest?include_prerelease=maybe", 400, "", "include_prerelease"},
+	}
+	for _, tt := range tests {
+		if tt.status == 200 {
+			var a lib.Antarian
+			if status := call(t, ts, "GET", "/v1/antarians/name"+tt.path, nil, &a); status != 200 || a.Version != tt.version {
+				t.Errorf("GET %s = %d %s, want %s", tt.path, status, a.Version, tt.version)
+			}
+			continue
+		}
+		var apiErr APIError
+		if status := call(t, ts, "GET", "/v1/antarians/name"+tt.path, nil, &apiErr); status != tt.status || !strings.Contains(apiErr.Message, tt.message) {
+			t.Errorf("GET %s = %d %q, want %d mentioning %q", tt.path, status, apiErr.Message, tt.status, tt.message)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xbcsmith/antares/config"
+)
+
+// listen opens the listener for addr. A socket handed over by systemd socket
+// activation takes precedence: the one named name in LISTEN_FDNAMES, or for
+// "http" the first socket not named "grpc" or "redirect". Otherwise
+// "unix://" addresses get a unix socket with the given mode and anything
+// else a TCP listener.
+func listen(name, addr string, mode os.FileMode) (net.Listener, error) {
+	activated, err := activationListeners()
+	if err != nil {
+		return nil, err
+	}
+	if l, ok := activated[name]; ok {
+		return l, nil
+	}
+	if config.IsUnixAddr(addr) {
+		return listenUnix(strings.TrimPrefix(addr, "unix://"), mode)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnix listens on path, first removing a socket left behind by a
+// previous run. A socket another process is still serving is not touched.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("listen unix %s: file exists and is not a socket", path)
+		}
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("listen unix %s: socket is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+var (
+	activationOnce sync.Once
+	activated      map[string]net.Listener
+	activationErr  error
+)
+
+// activationListeners collects the sockets passed by systemd, keyed by
+// "http", "grpc" and "redirect". The LISTEN_* variables are cleared
+// afterwards so build commands do not inherit them.
+func activationListeners() (map[string]net.Listener, error) {
+	activationOnce.Do(func() {
+		defer func() {
+			os.Unsetenv("LISTEN_PID")
+			os.Unsetenv("LISTEN_FDS")
+			os.Unsetenv("LISTEN_FDNAMES")
+		}()
+		if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+			return
+		}
+		n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil || n < 1 {
+			return
+		}
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		activated = map[string]net.Listener{}
+		for i := 0; i < n; i++ {
+			// activated sockets start at fd 3
+			f := os.NewFile(uintptr(3+i), "LISTEN_FD_"+strconv.Itoa(3+i))
+			l, err := net.FileListener(f)
+			f.Close()
+			if err != nil {
+				activationErr = fmt.Errorf("systemd socket %d: %v", 3+i, err)
+				return
+			}
+			name := "http"
+			if i < len(names) && (names[i] == "grpc" || names[i] == "redirect") {
+				name = names[i]
+			}
+			if _, taken := activated[name]; taken {
+				l.Close()
+				continue
+			}
+			activated[name] = l
+		}
+	})
+	return activated, activationErr
+}
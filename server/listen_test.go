@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// unixClient dials the socket at path whatever the request's host.
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+// socketDir is a short temporary directory; t.TempDir can exceed the
+// 108 bytes a socket path may have.
+func socketDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "antares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestUnixSocketRoundTrip(t *testing.T) {
+	sock := filepath.Join(socketDir(t), "antares.sock")
+	cfg := testConfig(t)
+	cfg.Addr = "unix://" + sock
+	cfg.URL = "https://antares.example.com/"
+	cfg.SocketMode = "0600"
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want a socket with 0600", fi.Mode())
+	}
+
+	client := unixClient(sock)
+	raw, _ := json.Marshal(lib.Antarian{Name: "libfoo", Version: "1.2.3"})
+	resp, err := client.Post("http://antares/v1/antarians", "application/json", bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created lib.Antarian
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || created.Id == "" {
+		t.Fatalf("create over the socket = %d %+v", resp.StatusCode, created)
+	}
+
+	resp, err = client.Get("http://antares/v1/antarians/" + created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shown lib.Antarian
+	json.NewDecoder(resp.Body).Decode(&shown)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || shown.Id != created.Id || shown.Version != "1.2.3" {
+		t.Errorf("show over the socket = %d %+v", resp.StatusCode, shown)
+	}
+	// urls are built from the external url, not the socket
+	if shown.Uri != "https://antares.example.com" {
+		t.Errorf("uri = %q, want the external url", shown.Uri)
+	}
+}
+
+func TestListenUnixStale(t *testing.T) {
+	dir := socketDir(t)
+	sock := filepath.Join(dir, "antares.sock")
+
+	// a socket left behind by a crashed run is replaced
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	l, err := listenUnix(sock, 0660)
+	if err != nil {
+		t.Fatalf("listen over a stale socket: %v", err)
+	}
+
+	// one that is still served is not
+	if _, err := listenUnix(sock, 0660); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("listen on a socket in use = %v", err)
+	}
+	l.Close()
+
+	// nor is a file that is not a socket
+	plain := filepath.Join(dir, "plain")
+	os.WriteFile(plain, []byte("data"), 0644)
+	if _, err := listenUnix(plain, 0660); err == nil {
+		t.Error("listen replaced a regular file")
+	}
+	if data, _ := os.ReadFile(plain); string(data) != "data" {
+		t.Errorf("the regular file now holds %q", data)
+	}
+}
@@ -1,23 +1,129 @@
 package server
 
 import (
-	"log"
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"time"
+
+	"github.com/xbcsmith/antares/config"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	routeKey
+	principalKey
+	namespaceKey
 )
 
-func Logger(inner http.Handler, name string) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+// NewLogger builds the server logger described by cfg. The returned LevelVar
+// changes the level of the running logger.
+func NewLogger(cfg *config.Config, w io.Writer) (*slog.Logger, *slog.LevelVar) {
+	level := new(slog.LevelVar)
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		level.Set(slog.LevelInfo)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts)), level
+	}
+	return slog.New(slog.NewTextHandler(w, opts)), level
+}
+
+// RequestID returns the id assigned to the request by the router.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// RouteName returns the name of the route serving the request.
+func RouteName(ctx context.Context) string {
+	name, _ := ctx.Value(routeKey).(string)
+	return name
+}
+
+// requestLogger returns log annotated with the request id and route name.
+func requestLogger(log *slog.Logger, r *http.Request) *slog.Logger {
+	ctx := r.Context()
+	return log.With("request_id", RequestID(ctx), "route", RouteName(ctx))
+}
+
+// statusRecorder remembers the status code written by the inner handler
+// and counts the body bytes.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Hijack hands the connection to the handler, e.g. for a WebSocket, and
+// records the switch of protocols as the status.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(s.ResponseWriter).Hijack()
+	if err == nil && s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Logging logs every request once the inner handler returns. A request that
+// panics is logged with status 500 before the panic continues outwards.
+func Logging(log *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
 
-		inner.ServeHTTP(w, r)
+			defer func() {
+				p := recover()
+				status := rec.status
+				if p != nil {
+					status = http.StatusInternalServerError
+				} else if status == 0 {
+					status = http.StatusOK
+				}
+				log.LogAttrs(r.Context(), slog.LevelInfo, "request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("uri", r.RequestURI),
+					slog.String("route", RouteName(r.Context())),
+					slog.Int("status", status),
+					slog.Int64("bytes", rec.bytes),
+					slog.Duration("duration", time.Since(start)),
+					slog.String("remote", r.RemoteAddr),
+					slog.String("request_id", RequestID(r.Context())),
+				)
+				if p != nil {
+					panic(p)
+				}
+			}()
 
-		log.Printf(
-			"%s\t%s\t%s\t%s",
-			r.Method,
-			r.RequestURI,
-			name,
-			time.Since(start),
-		)
-	})
+			next.ServeHTTP(rec, r)
+		})
+	}
 }
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/xbcsmith/antares/config"
+)
+
+// captureHandler keeps every record logged through it.
+type captureHandler struct {
+	mu      *sync.Mutex
+	records *[]slog.Record
+	attrs   []slog.Attr
+}
+
+func newCapture() (*slog.Logger, *captureHandler) {
+	h := &captureHandler{mu: &sync.Mutex{}, records: &[]slog.Record{}}
+	return slog.New(h), h
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs...)
+	h.mu.Lock()
+	*h.records = append(*h.records, r)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &c
+}
+
+func (h *captureHandler) WithGroup(string) slog.Handler { return h }
+
+// find returns the attributes of the first record with message msg.
+func (h *captureHandler) find(msg string) (map[string]slog.Value, slog.Level, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range *h.records {
+		if r.Message != msg {
+			continue
+		}
+		attrs := map[string]slog.Value{}
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		return attrs, r.Level, true
+	}
+	return nil, 0, false
+}
+
+// newDeps returns the Deps of a bare router logging to log.
+func newDeps(log *slog.Logger) *Deps {
+	return &Deps{Config: config.Default(), Repo: NewMemoryRepo(log), Logger: log}
+}
+
+func TestRequestLogging(t *testing.T) {
+	log, capture := newCapture()
+	d := newDeps(log)
+	router := NewRouter(d, Routes{
+		{Name: "Teapot", Method: "GET", Pattern: "/teapot", HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}},
+		{Name: "Broken", Method: "GET", Pattern: "/broken", HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			internalError(d, w, r, "load thing", errors.New("disk on fire"))
+		}},
+	})
+	for _, path := range []string{"/teapot", "/broken"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Request-Id", "req"+path)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		msg   string
+		level slog.Level
+		want  map[string]string
+	}{
+		{"request", slog.LevelInfo, map[string]string{"route": "Teapot", "status": "418", "method": "GET", "request_id": "req/teapot"}},
+		{"load thing", slog.LevelError, map[string]string{"route": "Broken", "request_id": "req/broken", "err": "disk on fire"}},
+	}
+	for _, tt := range tests {
+		attrs, level, ok := capture.find(tt.msg)
+		if !ok {
+			t.Errorf("no %q record", tt.msg)
+			continue
+		}
+		if level != tt.level {
+			t.Errorf("%q logged at %v, want %v", tt.msg, level, tt.level)
+		}
+		for k, v := range tt.want {
+			if got := attrs[k].String(); got != v {
+				t.Errorf("%q %s = %q, want %q", tt.msg, k, got, v)
+			}
+		}
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := config.Default()
+	cfg.LogFormat, cfg.LogLevel = "json", "info"
+	log, level := NewLogger(cfg, &buf)
+
+	log.Debug("hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("debug record written at info: %s", buf.String())
+	}
+	// the level changes while the logger runs
+	level.Set(slog.LevelDebug)
+	log.Debug("shown", "antarian_id", "a1")
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("json format wrote %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "shown" || record["antarian_id"] != "a1" || record["level"] != "DEBUG" {
+		t.Errorf("record = %v", record)
+	}
+
+	buf.Reset()
+	cfg.LogFormat, cfg.LogLevel = "text", "nonsense"
+	log, _ = NewLogger(cfg, &buf)
+	log.Debug("hidden")
+	log.Info("shown")
+	if got := buf.String(); bytes.Contains(buf.Bytes(), []byte("hidden")) || !bytes.Contains(buf.Bytes(), []byte("msg=shown")) {
+		t.Errorf("an unknown level should default to info in text, got %q", got)
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// Metrics holds the Prometheus collectors of one server. Each server has
+// its own registry, so several can run in one process.
+type Metrics struct {
+	Registry *prometheus.Registry
+	// ArtifactBytes counts the bytes of artifact files sent to clients.
+	ArtifactBytes prometheus.Counter
+	// GCDeleted and GCReclaimedBytes count what garbage collection
+	// deleted, by kind: "orphan" files or "expired" Antarians.
+	GCDeleted        *prometheus.CounterVec
+	GCReclaimedBytes *prometheus.CounterVec
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewMetrics registers the request, repository, build and runtime metrics
+// of the server described by d. The repository and build figures are read
+// from d at scrape time.
+func NewMetrics(d *Deps) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		ArtifactBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "antares_artifact_bytes_served_total",
+			Help: "Bytes of artifact files sent to clients.",
+		}),
+		GCDeleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "antares_gc_deleted_total",
+			Help: "Orphaned files and expired Antarians deleted by garbage collection.",
+		}, []string{"kind"}),
+		GCReclaimedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "antares_gc_reclaimed_bytes_total",
+			Help: "Bytes of artifact storage reclaimed by garbage collection.",
+		}, []string{"kind"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "antares_http_requests_total",
+			Help: "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "antares_http_request_duration_seconds",
+			Help:    "Time to serve HTTP requests by route and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+	}
+	m.Registry.MustRegister(
+		m.ArtifactBytes,
+		m.GCDeleted,
+		m.GCReclaimedBytes,
+		m.requests,
+		m.duration,
+		&serverCollector{d: d},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// reclaimed counts one deletion of kind by garbage collection. It does
+// nothing on a nil Metrics.
+func (m *Metrics) reclaimed(kind string, bytes int64) {
+	if m == nil {
+		return
+	}
+	m.GCDeleted.WithLabelValues(kind).Inc()
+	m.GCReclaimedBytes.WithLabelValues(kind).Add(float64(bytes))
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// instrument counts and times the requests served by route. A request that
+// panics is counted as a 500 before the panic continues outwards.
+func (m *Metrics) instrument(route string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+
+			defer func() {
+				p := recover()
+				status := rec.status
+				if p != nil {
+					status = http.StatusInternalServerError
+				} else if status == 0 {
+					status = http.StatusOK
+				}
+				m.requests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+				m.duration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+				if p != nil {
+					panic(p)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+var (
+	antariansDesc = prometheus.NewDesc("antares_antarians",
+		"Antarians in the repository.", nil, nil)
+	buildsStartedDesc = prometheus.NewDesc("antares_builds_started_total",
+		"Builds taken off the queue by a worker.", nil, nil)
+	buildsFinishedDesc = prometheus.NewDesc("antares_builds_finished_total",
+		"Builds that ran to an end, by final state.", []string{"state"}, nil)
+	buildsRetriedDesc = prometheus.NewDesc("antares_builds_retried_total",
+		"Failed build attempts run again.", nil, nil)
+	buildsActiveDesc = prometheus.NewDesc("antares_builds_active",
+		"Builds running now.", nil, nil)
+	buildsPendingDesc = prometheus.NewDesc("antares_builds_pending",
+		"Builds waiting for a worker.", nil, nil)
+)
+
+// serverCollector reports the repository size and build engine counters.
+type serverCollector struct {
+	d *Deps
+}
+
+func (c *serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{antariansDesc, buildsStartedDesc, buildsFinishedDesc, buildsRetriedDesc, buildsActiveDesc, buildsPendingDesc} {
+		ch <- desc
+	}
+}
+
+func (c *serverCollector) Collect(ch chan<- prometheus.Metric) {
+	n := 0
+	err := c.d.Repo.EachAntarian(func(lib.Antarian) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		c.d.Logger.Error("count antarians for metrics", "err", err)
+		ch <- prometheus.NewInvalidMetric(antariansDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(antariansDesc, prometheus.GaugeValue, float64(n))
+	}
+
+	stats := c.d.Builds.Stats()
+	ch <- prometheus.MustNewConstMetric(buildsStartedDesc, prometheus.CounterValue, float64(stats.Started))
+	for state, v := range map[lib.BuildState]int64{
+		lib.BuildSucceeded: stats.Succeeded,
+		lib.BuildFailed:    stats.Failed,
+		lib.BuildCanceled:  stats.Canceled,
+	} {
+		ch <- prometheus.MustNewConstMetric(buildsFinishedDesc, prometheus.CounterValue, float64(v), string(state))
+	}
+	ch <- prometheus.MustNewConstMetric(buildsRetriedDesc, prometheus.CounterValue, float64(stats.Retried))
+	ch <- prometheus.MustNewConstMetric(buildsActiveDesc, prometheus.GaugeValue, float64(stats.Active))
+	ch <- prometheus.MustNewConstMetric(buildsPendingDesc, prometheus.GaugeValue, float64(stats.Pending))
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// Middleware wraps a handler with extra behaviour.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in mws so that mws[0] is the outermost layer.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		if mws[i] != nil {
+			h = mws[i](h)
+		}
+	}
+	return h
+}
+
+// stack returns the middleware for route, outermost first:
+//
+//  1. request annotation (request id, route name)
+//  2. tracing, which continues the caller's trace
+//  3. recovery, so panics anywhere below become a 500
+//  4. logging, which sees the final status of everything below
+//  5. metrics, when d.Metrics is set
+//  6. d.Middleware, the global extensions
+//  7. d.Auth, skipped for public routes and signed requests to Signed
+//     routes, then the route's Permission and rate limit
+//  8. the namespace of Namespaced routes and the deprecation headers of
+//     legacy routes
+//  9. route.Middleware
+func stack(d *Deps, route Route) []Middleware {
+	mws := []Middleware{
+		annotate(route.Name),
+		traceRequest(route),
+		Recovery(d.Logger),
+		Logging(d.Logger),
+	}
+	if d.Metrics != nil {
+		mws = append(mws, d.Metrics.instrument(route.Name))
+	}
+	mws = append(mws, d.Middleware...)
+	if !public(d, route) {
+		if route.Signed {
+			mws = append(mws, signedOr(d, d.Auth))
+		} else {
+			mws = append(mws, d.Auth)
+		}
+	}
+	if route.Permission != "" {
+		mws = append(mws, requirePermission(d, route.Permission))
+	}
+	if route.RateLimited && d.limiter != nil {
+		mws = append(mws, rateLimit(d))
+	}
+	if route.Namespaced {
+		mws = append(mws, inNamespace(d))
+	}
+	if route.Deprecated != "" || route.Successor != "" {
+		mws = append(mws, deprecation(route.Deprecated, route.Successor))
+	}
+	return append(mws, route.Middleware...)
+}
+
+// deprecation points clients of a legacy route at its successor, using the
+// Deprecation header and a successor-version link: the same path under
+// prefix, or successor filled in with the request's path variables.
+func deprecation(prefix, successor string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			target := r.URL.EscapedPath()
+			if successor != "" {
+				vars := mux.Vars(r)
+				target = pathVar.ReplaceAllStringFunc(successor, func(v string) string {
+					return url.PathEscape(vars[pathVar.FindStringSubmatch(v)[1]])
+				})
+			}
+			w.Header().Set("Deprecation", "true")
+			w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, prefix, target))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// annotate assigns each request an id, honouring an incoming X-Request-Id,
+// and records the route name for the other middleware.
+func annotate(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Request-Id")
+			if id == "" {
+				id, _ = lib.NewUUID()
+			}
+			w.Header().Set("X-Request-Id", id)
+			ctx := context.WithValue(r.Context(), requestIDKey, id)
+			ctx = context.WithValue(ctx, routeKey, name)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Recovery turns a panic in any inner handler into a JSON 500 response,
+// logging the panic value and stack. A response already under way is left
+// as it is.
+func Recovery(log *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				requestLogger(log, r).Error("panic serving request", "panic", p, "stack", string(debug.Stack()))
+				if rec.status == 0 {
+					// nothing was sent yet, so the client can still get an error body
+					rec.Header().Del("Content-Length")
+					writeErrorBody(rec, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tracer records the order in which named middleware and handlers run.
+type tracer struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (tr *tracer) mark(name string) {
+	tr.mu.Lock()
+	tr.calls = append(tr.calls, name)
+	tr.mu.Unlock()
+}
+
+func (tr *tracer) middleware(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tr.mark(name)
+			next.ServeHTTP(w, r)
+			tr.mark("/" + name)
+		})
+	}
+}
+
+func (tr *tracer) String() string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return strings.Join(tr.calls, " ")
+}
+
+func TestChain(t *testing.T) {
+	tr := &tracer{}
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { tr.mark("handler") }),
+		tr.middleware("a"), nil, tr.middleware("b"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got, want := tr.String(), "a b handler /b /a"; got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+}
+
+func TestStackOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		route Route
+		want  string
+	}{
+		{"authenticated", Route{Name: "Private"}, "global auth route handler /route /auth /global"},
+		{"public", Route{Name: "Open", Public: true}, "global route handler /route /global"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &tracer{}
+			log, capture := newCapture()
+			d := newDeps(log)
+			d.Middleware = []Middleware{tr.middleware("global")}
+			d.Auth = tr.middleware("auth")
+			route := tt.route
+			route.Method, route.Pattern = "GET", "/thing"
+			route.Middleware = []Middleware{tr.middleware("route")}
+			route.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+				tr.mark("handler")
+				w.WriteHeader(http.StatusAccepted)
+			}
+			router := NewRouter(d, Routes{route})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/thing", nil))
+			if got := tr.String(); got != tt.want {
+				t.Errorf("calls = %q, want %q", got, tt.want)
+			}
+			// logging, outside them all, saw the status the handler wrote
+			attrs, _, ok := capture.find("request")
+			if !ok || attrs["status"].Int64() != http.StatusAccepted {
+				t.Errorf("request log = %v, want status 202", attrs)
+			}
+		})
+	}
+}
+
+func TestRecoveryInAuth(t *testing.T) {
+	log, capture := newCapture()
+	d := newDeps(log)
+	d.Auth = func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("token store unavailable")
+		})
+	}
+	handled := false
+	router := NewRouter(d, Routes{{Name: "Private", Method: "GET", Pattern: "/thing", HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+		handled = true
+	}}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/thing", nil))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Header().Get("Content-Type"), "json") {
+		t.Errorf("response = %d %s, want a JSON 500", w.Code, w.Header().Get("Content-Type"))
+	}
+	if handled {
+		t.Error("the handler ran after auth panicked")
+	}
+	attrs, _, ok := capture.find("panic serving request")
+	if !ok || attrs["panic"].String() != "token store unavailable" || attrs["route"].String() != "Private" {
+		t.Errorf("panic log = %v", attrs)
+	}
+	if attrs, _, ok := capture.find("request"); !ok || attrs["status"].Int64() != http.StatusInternalServerError {
+		t.Errorf("request log = %v, want status 500", attrs)
+	}
+}
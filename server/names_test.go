@@ -0,0 +1,143 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+func TestNameSummaries(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	infra := map[string]string{"team": "infra"}
+	seed := []lib.Antarian{
+		{Name: "libfoo", Version: "1.0.0", Start: t0, Labels: infra},
+		{Name: "libfoo", Version: "2.0.0", Start: t0.Add(time.Minute), Running: true, Status: lib.StatusBuilding},
+		{Name: "libfoo", Version: "2.1.0-rc.1", Start: t0.Add(2 * time.Minute), Running: true, Status: lib.StatusBuilding, Labels: infra},
+		{Name: "libfab", Version: "0.1.0-beta.1", Start: t0, Labels: infra},
+		{Name: "libbar", Version: "3.0.0", Start: t0.Add(time.Hour)},
+		{Name: "other", Version: "1.0.0", Start: t0},
+	}
+	for name, repo := range repos(t) {
+		t.Run(name, func(t *testing.T) {
+			repo.Purge()
+			ids := map[string]string{}
+			for _, a := range seed {
+				created, err := repo.CreateAntarian(a)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids[a.Name+"@"+a.Version] = created.Id
+			}
+			selector := func(s string) lib.LabelSelector {
+				sel, err := lib.ParseLabelSelector(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return sel
+			}
+			tests := []struct {
+				name   string
+				prefix string
+				labels lib.LabelSelector
+				want   []NameSummary
+			}{
+				{"all", "", nil, []NameSummary{
+					{Name: "libbar", Versions: 1, LatestVersion: "3.0.0", LatestId: ids["libbar@3.0.0"], NewestStart: t0.Add(time.Hour)},
+					{Name: "libfab", Versions: 1, LatestVersion: "0.1.0-beta.1", LatestId: ids["libfab@0.1.0-beta.1"], NewestStart: t0},
+					// the release wins over a newer prerelease
+					{Name: "libfoo", Versions: 3, LatestVersion: "2.0.0", LatestId: ids["libfoo@2.0.0"], NewestStart: t0.Add(2 * time.Minute), Running: 2},
+					{Name: "other", Versions: 1, LatestVersion: "1.0.0", LatestId: ids["other@1.0.0"], NewestStart: t0},
+				}},
+				{"prefix", "libf", nil, []NameSummary{
+					{Name: "libfab", Versions: 1, LatestVersion: "0.1.0-beta.1", LatestId: ids["libfab@0.1.0-beta.1"], NewestStart: t0},
+					{Name: "libfoo", Versions: 3, LatestVersion: "2.0.0", LatestId: ids["libfoo@2.0.0"], NewestStart: t0.Add(2 * time.Minute), Running: 2},
+				}},
+				{"labels", "", selector("team=infra"), []NameSummary{
+					{Name: "libfab", Versions: 1, LatestVersion: "0.1.0-beta.1", LatestId: ids["libfab@0.1.0-beta.1"], NewestStart: t0},
+					{Name: "libfoo", Versions: 2, LatestVersion: "1.0.0", LatestId: ids["libfoo@1.0.0"], NewestStart: t0.Add(2 * time.Minute), Running: 1},
+				}},
+				{"prefix and labels", "libfo", selector("team=infra"), []NameSummary{
+					{Name: "libfoo", Versions: 2, LatestVersion: "1.0.0", LatestId: ids["libfoo@1.0.0"], NewestStart: t0.Add(2 * time.Minute), Running: 1},
+				}},
+				{"no label", "", selector("!team"), []NameSummary{
+					{Name: "libbar", Versions: 1, LatestVersion: "3.0.0", LatestId: ids["libbar@3.0.0"], NewestStart: t0.Add(time.Hour)},
+					{Name: "libfoo", Versions: 1, LatestVersion: "2.0.0", LatestId: ids["libfoo@2.0.0"], NewestStart: t0.Add(time.Minute), Running: 1},
+					{Name: "other", Versions: 1, LatestVersion: "1.0.0", LatestId: ids["other@1.0.0"], NewestStart: t0},
+				}},
+				{"nothing", "zzz", nil, []NameSummary{}},
+			}
+			for _, tt := range tests {
+				got, err := repo.NameSummaries(tt.prefix, tt.labels)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := range got {
+					got[i].NewestStart = got[i].NewestStart.UTC()
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: NameSummaries = %+v\nwant %+v", tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAntarianNames(t *testing.T) {
+	_, ts := newTestServer(t)
+	for _, a := range []lib.Antarian{
+		{Name: "libfoo", Version: "1.0.0", Labels: map[string]string{"team": "infra"}},
+		{Name: "libfoo", Version: "2.0.0"},
+		{Name: "libbar", Version: "1.0.0", Labels: map[string]string{"team": "infra"}},
+		{Name: "libbaz", Version: "1.0.0"},
+	} {
+		if status := call(t, ts, "POST", "/v1/antarians", a, nil); status != http.StatusCreated {
+			t.Fatalf("create %s = %d", a.Name, status)
+		}
+	}
+	tests := []struct {
+		query string
+		names []string
+		total string
+	}{
+		{"?prefix=lib", []string{"libbar", "libbaz", "libfoo"}, "3"},
+		{"?prefix=lib&limit=2", []string{"libbar", "libbaz"}, "3"},
+		{"?prefix=lib&limit=2&offset=2", []string{"libfoo"}, "3"},
+		{"?label=team%3Dinfra", []string{"libbar", "libfoo"}, "2"},
+		{"?prefix=libf&label=team%3Dinfra", []string{"libfoo"}, "1"},
+		{"?label=team%3Dinfra&limit=1&offset=1", []string{"libfoo"}, "2"},
+	}
+	for _, tt := range tests {
+		resp, err := ts.Client().Get(ts.URL + "/v1/antarians/names" + tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("X-Total-Count"); got != tt.total {
+			t.Errorf("GET %s X-Total-Count = %s, want %s", tt.query, got, tt.total)
+		}
+		var list []NameSummary
+		call(t, ts, "GET", "/v1/antarians/names"+tt.query, nil, &list)
+		var names []string
+		for _, s := range list {
+			names = append(names, s.Name)
+		}
+		if !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("GET %s = %v, want %v", tt.query, names, tt.names)
+		}
+	}
+	// only Antarians with the label count toward the summary
+	var list []NameSummary
+	call(t, ts, "GET", "/v1/antarians/names?prefix=libfoo&label=team%3Dinfra", nil, &list)
+	if len(list) != 1 || list[0].Versions != 1 || list[0].LatestVersion != "1.0.0" {
+		t.Errorf("labelled summary = %+v, want one version, 1.0.0", list)
+	}
+
+	var apiErr APIError
+	if status := call(t, ts, "GET", "/v1/antarians/names?label=%3D%3D", nil, &apiErr); status != http.StatusBadRequest || !strings.HasPrefix(apiErr.Message, "label:") {
+		t.Errorf("bad selector = %d %q, want 400", status, apiErr.Message)
+	}
+}
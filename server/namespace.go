@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// namespacePattern is what namespace names must look like: a DNS label,
+// so they are safe in paths and match the namespaces of other tools.
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// Namespaced returns copies of the Namespaced routes among routes under
+// /namespaces/{namespace}, each serving the namespace named in its path.
+func Namespaced(routes Routes) Routes {
+	var out Routes
+	for _, route := range routes {
+		if route.Namespaced {
+			route.Pattern = "/namespaces/{namespace}" + route.Pattern
+			if route.Successor != "" {
+				route.Successor = "/namespaces/{namespace}" + route.Successor
+			}
+			out = append(out, route)
+		}
+	}
+	return out
+}
+
+// NamespaceFrom returns the namespace a request is confined to. ok is
+// false for routes that see every namespace, such as the admin routes.
+func NamespaceFrom(ctx context.Context) (ns string, ok bool) {
+	ns, ok = ctx.Value(namespaceKey).(string)
+	return ns, ok
+}
+
+func withNamespace(ctx context.Context, ns string) context.Context {
+	return context.WithValue(ctx, namespaceKey, ns)
+}
+
+// inNamespace confines a request to the namespace in its path, or to
+// lib.DefaultNamespace on paths without one.
+func inNamespace(d *Deps) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ns, ok := mux.Vars(r)["namespace"]
+			if !ok {
+				ns = lib.DefaultNamespace
+			}
+			if !namespacePattern.MatchString(ns) {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("namespace: %q must be lower case letters, digits and dashes", ns))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withNamespace(r.Context(), ns)))
+		})
+	}
+}
+
+// namespacedRepo shows the Antarians of one namespace, and their builds,
+// as if they were the whole repository. Records elsewhere are reported
+// missing. The audit log, Purge and PruneBuilds are not confined.
+type namespacedRepo struct {
+	Repository
+	ns string
+}
+
+func (r *namespacedRepo) owns(a lib.Antarian) bool {
+	return a.NamespaceOrDefault() == r.ns
+}
+
+func (r *namespacedRepo) ListAntarians() (lib.Antarians, error) {
+	all, err := r.Repository.ListAntarians()
+	if err != nil {
+		return nil, err
+	}
+	return r.filter(all), nil
+}
+
+func (r *namespacedRepo) filter(all lib.Antarians) lib.Antarians {
+	list := lib.Antarians{}
+	for _, a := range all {
+		if r.owns(a) {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+func (r *namespacedRepo) EachAntarian(fn func(lib.Antarian) error) error {
+	return r.Repository.EachAntarian(func(a lib.Antarian) error {
+		if !r.owns(a) {
+			return nil
+		}
+		return fn(a)
+	})
+}
+
+func (r *namespacedRepo) FindAntarian(id string) (lib.Antarian, error) {
+	a, err := r.Repository.FindAntarian(id)
+	if err == nil && !r.owns(a) {
+		return lib.Antarian{}, ErrNotFound
+	}
+	return a, err
+}
+
+func (r *namespacedRepo) AntariansNamed(name string) (lib.Antarians, error) {
+	all, err := r.Repository.AntariansNamed(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.filter(all), nil
+}
+
+func (r *namespacedRepo) NameSummaries(prefix string, labels lib.LabelSelector) ([]NameSummary, error) {
+	z := newSummarizer(prefix, labels)
+	err := r.EachAntarian(func(a lib.Antarian) error {
+		z.add(a)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return z.result(), nil
+}
+
+func (r *namespacedRepo) CreateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	s.Namespace = r.ns
+	return r.Repository.CreateAntarian(s)
+}
+
+// UpdateAntarian cannot move an Antarian to another namespace.
+func (r *namespacedRepo) UpdateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	if _, err := r.FindAntarian(s.Id); err != nil {
+		return lib.Antarian{}, err
+	}
+	s.Namespace = r.ns
+	return r.Repository.UpdateAntarian(s)
+}
+
+func (r *namespacedRepo) DestroyAntarian(id string) error {
+	if _, err := r.FindAntarian(id); err != nil {
+		return err
+	}
+	return r.Repository.DestroyAntarian(id)
+}
+
+func (r *namespacedRepo) FindBuild(id string) (lib.Build, bool) {
+	b, ok := r.Repository.FindBuild(id)
+	if !ok {
+		return b, false
+	}
+	if _, err := r.FindAntarian(b.AntarianId); err != nil {
+		return lib.Build{}, false
+	}
+	return b, true
+}
+
+func (r *namespacedRepo) ListBuilds(antarianId string) ([]lib.Build, error) {
+	if antarianId != "" {
+		if _, err := r.FindAntarian(antarianId); err == ErrNotFound {
+			return []lib.Build{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return r.Repository.ListBuilds(antarianId)
+	}
+	ids := map[string]bool{}
+	err := r.EachAntarian(func(a lib.Antarian) error {
+		ids[a.Id] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	all, err := r.Repository.ListBuilds("")
+	if err != nil {
+		return nil, err
+	}
+	list := []lib.Build{}
+	for _, b := range all {
+		if ids[b.AntarianId] {
+			list = append(list, b)
+		}
+	}
+	return list, nil
+}
+
+func (r *namespacedRepo) LatestBuild(antarianId string) (lib.Build, bool, error) {
+	if _, err := r.FindAntarian(antarianId); err == ErrNotFound {
+		return lib.Build{}, false, nil
+	} else if err != nil {
+		return lib.Build{}, false, err
+	}
+	return r.Repository.LatestBuild(antarianId)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+	"github.com/xbcsmith/antares/config"
+)
+
+// natsPublisher publishes the events of a hub to NATS, one message per
+// event with the lib.Event as its JSON body and its type in the
+// Antares-Event header.
+type natsPublisher struct {
+	conn *nats.Conn
+	cfg  config.NATS
+	log  *slog.Logger
+}
+
+// newNATSPublisher connects to cfg.URL. A server that cannot be reached
+// yet is retried in the background, so it does not stop Antares starting;
+// events published while disconnected are buffered by the client.
+func newNATSPublisher(cfg config.NATS, log *slog.Logger) (*natsPublisher, error) {
+	log = log.With("subscriber", "nats")
+	opts := []nats.Option{
+		nats.Name("antares"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Warn("disconnected from nats", "err", err)
+			}
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			log.Info("connected to nats", "server", c.ConnectedUrlRedacted())
+		}),
+	}
+	if cfg.CredsFile != "" {
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	}
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &natsPublisher{conn: conn, cfg: cfg, log: log}, nil
+}
+
+// subject returns the subject of events of type typ, or "" when they are
+// not published.
+func (p *natsPublisher) subject(typ string) string {
+	if subject, ok := p.cfg.Subjects[typ]; ok {
+		return subject
+	}
+	if p.cfg.SubjectPrefix == "" {
+		return ""
+	}
+	return p.cfg.SubjectPrefix + "." + typ
+}
+
+// run publishes the events of hub until ctx is done.
+func (p *natsPublisher) run(ctx context.Context, hub *EventHub) {
+	hub.follow(ctx, p.log, func(n Notification) {
+		subject := p.subject(n.Event.Type)
+		if subject == "" {
+			return
+		}
+		body, err := json.Marshal(n.Event)
+		if err != nil {
+			p.log.Error("encode event", "err", err, "event_id", n.Event.Id)
+			return
+		}
+		msg := nats.NewMsg(subject)
+		msg.Data = body
+		msg.Header.Set("Antares-Event", n.Event.Type)
+		if err := p.conn.PublishMsg(msg); err != nil {
+			p.log.Error("publish event", "err", err, "event_id", n.Event.Id, "subject", subject)
+		}
+	})
+}
+
+// Close sends what is buffered and disconnects.
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The media types a response can be written in, besides JSON.
+const (
+	mediaJSON = "application/json"
+	mediaYAML = "application/yaml"
+	mediaXML  = "application/xml"
+)
+
+// mediaAliases maps the other names clients use for YAML and XML.
+var mediaAliases = map[string]string{
+	"application/x-yaml": mediaYAML,
+	"text/yaml":          mediaYAML,
+	"text/x-yaml":        mediaYAML,
+	"text/xml":           mediaXML,
+}
+
+// responseType picks JSON, YAML or XML by the request's Accept header,
+// defaulting to JSON when the client has no preference among them.
+func responseType(r *http.Request) string {
+	best, bestQ := mediaJSON, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if alias, ok := mediaAliases[mediaType]; ok {
+			mediaType = alias
+		}
+		if mediaType != mediaJSON && mediaType != mediaYAML && mediaType != mediaXML {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// encodeBody marshals v in the format the client of r asked for and
+// returns the body with its Content-Type. YAML and XML use the names and
+// field order of the JSON encoding, so the three formats agree.
+func encodeBody(r *http.Request, v interface{}) (string, []byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return "", nil, err
+	}
+	mediaType := responseType(r)
+	if mediaType == mediaJSON {
+		return "application/json; charset=UTF-8", buf.Bytes(), nil
+	}
+	// JSON is YAML, so the node tree keeps the JSON field order
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		return "", nil, err
+	}
+	buf.Reset()
+	if mediaType == mediaYAML {
+		plainStyle(&doc)
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return "", nil, err
+		}
+		return "application/yaml; charset=UTF-8", buf.Bytes(), nil
+	}
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := encodeXML(enc, "response", doc.Content[0]); err != nil {
+		return "", nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return "", nil, err
+	}
+	buf.WriteByte('\n')
+	return "application/xml; charset=UTF-8", buf.Bytes(), nil
+}
+
+// plainStyle drops the flow and quoting styles of a tree parsed from JSON,
+// so it is written as block YAML.
+func plainStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		plainStyle(c)
+	}
+}
+
+// encodeXML writes n as the element name. Objects become child elements
+// named after their keys, or <entry key="..."> where the key is not a valid
+// XML name, and arrays become <item> elements. null is an empty element.
+func encodeXML(enc *xml.Encoder, name string, n *yaml.Node) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !xmlName(name) {
+		start = xml.StartElement{
+			Name: xml.Name{Local: "entry"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+		}
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if err := encodeXML(enc, n.Content[i].Value, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case yaml.SequenceNode:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, c := range n.Content {
+			if err := encodeXML(enc, "item", c); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case yaml.ScalarNode:
+		value := n.Value
+		if n.Tag == "!!null" {
+			value = ""
+		}
+		return enc.EncodeElement(value, start)
+	}
+	return fmt.Errorf("cannot encode %v node as XML", n.Kind)
+}
+
+// xmlName reports whether s can be used as an element name as it is.
+func xmlName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, c := range s {
+		letter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || !(c == '-' || c == '.' || (c >= '0' && c <= '9'))) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestYAML reports whether the body of r is YAML.
+func requestYAML(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	if alias, ok := mediaAliases[mediaType]; ok {
+		mediaType = alias
+	}
+	return mediaType == mediaYAML
+}
+
+// yamlToJSON converts a YAML request body to JSON, so it is checked and
+// decoded exactly like a JSON one. Offsets in later errors refer to the
+// converted document.
+func yamlToJSON(raw []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, &decodeError{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, &decodeError{Status: http.StatusUnprocessableEntity, Message: fmt.Sprintf("cannot convert YAML to JSON: %v", err)}
+	}
+	return out, nil
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/xbcsmith/antares/config"
+)
+
+// oidcTimeout bounds each request to the provider for its discovery
+// document and signing keys.
+const oidcTimeout = 10 * time.Second
+
+// oidcVerifier checks tokens issued by an OpenID Connect provider and maps
+// the caller's groups to roles.
+type oidcVerifier struct {
+	verifier    *oidc.IDTokenVerifier
+	groupsClaim string
+	groupRoles  map[string]string
+}
+
+// newOIDCVerifier fetches the discovery document of the provider described
+// by cfg. The signing keys are fetched when first needed and again when a
+// token names a key not seen before.
+func newOIDCVerifier(cfg config.OIDC) (*oidcVerifier, error) {
+	// the provider keeps this context for fetching keys, so it must not
+	// be cancelled
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: oidcTimeout})
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("oidc provider %s: %v", cfg.IssuerURL, err)
+	}
+	return &oidcVerifier{
+		verifier: provider.Verifier(&oidc.Config{
+			ClientID:          cfg.ClientID,
+			SkipClientIDCheck: cfg.ClientID == "",
+		}),
+		groupsClaim: cfg.GroupsClaim,
+		groupRoles:  cfg.GroupRoles,
+	}, nil
+}
+
+func (v *oidcVerifier) verify(ctx context.Context, token string) (Principal, error) {
+	t, err := v.verifier.Verify(ctx, token)
+	if err != nil {
+		return Principal{}, err
+	}
+	var claims map[string]interface{}
+	if err := t.Claims(&claims); err != nil {
+		return Principal{}, err
+	}
+	groups, err := stringList(claims[v.groupsClaim])
+	if err != nil {
+		return Principal{}, fmt.Errorf("claim %s: %v", v.groupsClaim, err)
+	}
+	p := Principal{Subject: t.Subject}
+	for _, group := range groups {
+		if role, ok := v.groupRoles[group]; ok {
+			p.Roles = append(p.Roles, role)
+		}
+	}
+	return p, nil
+}
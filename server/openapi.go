@@ -0,0 +1,329 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// apiDoc describes the parts of a route the Routes table does not: its
+// query parameters and the types of its request and response bodies.
+type apiDoc struct {
+	Summary string
+	Query   []string
+	// Request and Response are zero values of the body types; nil means
+	// no body.
+	Request  interface{}
+	Response interface{}
+	// ContentType of the response, when it is not JSON.
+	ContentType string
+	// Status of a successful response; zero means 200.
+	Status int
+}
+
+// apiDocs are keyed by route name. Routes without one are still described,
+// but without bodies.
+var apiDocs = map[string]apiDoc{
+	"Index":                   {Summary: "Greet the caller", ContentType: "text/plain"},
+	"AntarianIndex":           {Summary: "List Antarians", Query: []string{"limit", "offset", "after", "name", "version", "running", "finished", "status", "label", "sort", "envelope"}, Response: lib.Antarians{}},
+	"AntarianStream":          {Summary: "Stream Antarians as newline-delimited JSON", Query: []string{"limit", "offset", "name", "version", "running", "finished", "status", "label", "sort"}, Response: lib.Antarian{}, ContentType: ndjson},
+	"AntarianNames":           {Summary: "Summarize Antarians by name", Query: []string{"prefix", "label", "limit", "offset"}, Response: []NameSummary{}},
+	"AntarianSearch":          {Summary: "Search Antarians", Query: []string{"q", "limit", "offset"}, Response: lib.Antarians{}},
+	"AntarianLatest":          {Summary: "Find the latest version of a name", Query: []string{"constraint", "state", "channel", "release", "include_prerelease"}, Response: lib.Antarian{}},
+	"AntarianVersions":        {Summary: "List every version of a name", Response: lib.Antarians{}},
+	"AntarianVersion":         {Summary: "Find an Antarian by name and version", Response: lib.Antarian{}},
+	"AntarianShow":            {Summary: "Show an Antarian", Response: lib.Antarian{}},
+	"AntarianBuild":           {Summary: "Queue a build of an Antarian (legacy GET trigger)", Response: lib.Build{}},
+	"AntarianDeps":            {Summary: "Show the dependency tree of an Antarian", Query: []string{"reverse", "format"}, Response: dependencyGraph{}},
+	"BuildCreate":             {Summary: "Queue a build of an Antarian", Request: buildRequest{}, Response: lib.Build{}, Status: http.StatusAccepted},
+	"AntarianArtifactUpload":  {Summary: "Upload the artifact of an Antarian", Query: []string{"filename", "platform"}, Response: lib.Artifact{}, Status: http.StatusCreated},
+	"AntarianArtifactVerify":  {Summary: "Re-hash an Antarian's artifact and compare it with its checksum", Query: []string{"platform"}, Response: lib.ArtifactCheck{}},
+	"AntarianSBOM":            {Summary: "Get the CycloneDX SBOM of the build that made an Antarian's artifact", Response: lib.SBOM{}},
+	"AntarianSignatureVerify": {Summary: "Check the signature of an Antarian's artifact against the server's public keys", Query: []string{"platform"}, Response: lib.SignatureCheck{}},
+	"AntarianBuildEvents":     {Summary: "Follow a build as server-sent events", Query: []string{"build_id"}, ContentType: "text/event-stream"},
+	"BuildShow":               {Summary: "Show a build", Response: lib.Build{}},
+	"BuildCancel":             {Summary: "Cancel a queued or running build", Response: lib.Build{}},
+	"BuildLogs":               {Summary: "Show or follow the output of a build as text or JSON lines", Query: []string{"follow", "format"}, ContentType: "text/plain"},
+	"AntarianBuilds":          {Summary: "List the builds of an Antarian", Query: []string{"limit", "offset"}, Response: []lib.Build{}},
+	"BuildIndex":              {Summary: "List builds", Query: []string{"limit", "offset"}, Response: []lib.Build{}},
+	"AntarianDownload":        {Summary: "Get the download link of an Antarian's artifact", Query: []string{"platform"}, Response: lib.Download{}},
+	"DebugVars":               {Summary: "Show the expvar variables", Response: map[string]interface{}{}},
+	"AuditIndex":              {Summary: "List audit entries", Query: []string{"since", "until", "action", "actor", "resource_id"}, Response: []lib.AuditEntry{}},
+	"AntarianUpdate":          {Summary: "Replace an Antarian", Request: lib.Antarian{}, Response: lib.Antarian{}},
+	"AntarianPatch":           {Summary: "Change some fields of an Antarian", Request: lib.Antarian{}, Response: lib.Antarian{}},
+	"AntarianDelete":          {Summary: "Delete an Antarian", Query: []string{"remove_artifacts"}, Status: http.StatusNoContent},
+	"AdminPurge":              {Summary: "Delete every Antarian and build", Query: []string{"keep_artifacts"}, Response: purgeResult{}},
+	"AdminGC":                 {Summary: "Collect orphaned artifacts", Query: []string{"delete"}, Response: gcReport{}},
+	"AntarianCreate":          {Summary: "Create an Antarian", Request: lib.Antarian{}, Response: lib.Antarian{}, Status: http.StatusCreated},
+	"GraphQLQuery":            {Summary: "Run a GraphQL query", Query: []string{"query", "operationName"}, Response: map[string]interface{}{}},
+	"GraphQL":                 {Summary: "Run a GraphQL query", Request: graphqlRequest{}, Response: map[string]interface{}{}},
+	"EventStream":             {Summary: "Follow change events as a text/event-stream", Query: []string{"name", "types", "last_event_id", "follow"}, Response: lib.Event{}},
+	"Websocket":               {Summary: "Receive change events over a WebSocket", Query: []string{"name", "namespace", "types"}, Response: lib.Event{}, Status: http.StatusSwitchingProtocols},
+	"WebhookIndex":            {Summary: "List webhooks", Response: []lib.Webhook{}},
+	"WebhookCreate":           {Summary: "Register a webhook", Request: webhookRequest{}, Response: lib.Webhook{}, Status: http.StatusCreated},
+	"WebhookShow":             {Summary: "Show a webhook", Response: lib.Webhook{}},
+	"WebhookDelete":           {Summary: "Remove a webhook", Status: http.StatusNoContent},
+	"WebhookDeliveries":       {Summary: "List the recent deliveries to a webhook", Response: []lib.WebhookDelivery{}},
+	"AgentRegister":           {Summary: "Register a build agent", Request: agentRequest{}, Response: lib.Agent{}, Status: http.StatusCreated},
+	"AgentIndex":              {Summary: "List build agents", Response: []lib.Agent{}},
+	"AgentHeartbeat":          {Summary: "Keep a build agent online and list its canceled builds", Response: lib.AgentHeartbeat{}},
+	"AgentLease":              {Summary: "Lease the next queued build to an agent", Response: lib.AgentLease{}},
+	"AgentBuildLogs":          {Summary: "Append output lines of a leased build", Request: []lib.LogLine{}, Response: lib.AgentHeartbeat{}},
+	"AgentBuildArtifact":      {Summary: "Upload an artifact of a leased build", Query: []string{"filename", "platform"}, Response: lib.Artifact{}, Status: http.StatusCreated},
+	"AgentBuildReport":        {Summary: "Report a retry or the end of a leased build", Request: lib.Build{}, Response: lib.Build{}},
+	"ScheduleIndex":           {Summary: "List build schedules", Query: []string{"antarian_id"}, Response: []lib.Schedule{}},
+	"ScheduleCreate":          {Summary: "Schedule builds of an Antarian", Request: scheduleRequest{}, Response: lib.Schedule{}, Status: http.StatusCreated},
+	"ScheduleShow":            {Summary: "Show a build schedule", Response: lib.Schedule{}},
+	"ScheduleUpdate":          {Summary: "Change a build schedule", Request: scheduleRequest{}, Response: lib.Schedule{}},
+	"ScheduleDelete":          {Summary: "Remove a build schedule", Status: http.StatusNoContent},
+	"GitHook":                 {Summary: "Build the Antarians mapped to a GitHub or GitLab push", Response: gitHookResult{}, Status: http.StatusAccepted},
+	"ArtifactFileHead":        {Summary: "Show the size and checksum of an artifact", Query: []string{"expires", "signature"}},
+	"ArtifactFile":            {Summary: "Download an artifact", Query: []string{"expires", "signature"}, ContentType: "application/octet-stream"},
+	"Healthz":                 {Summary: "Check liveness", Response: healthReport{}},
+	"Readyz":                  {Summary: "Check readiness", Response: healthReport{}},
+	"Metrics":                 {Summary: "Scrape Prometheus metrics", ContentType: "text/plain"},
+}
+
+// queryTypes are the schema types of query parameters that are not
+// strings.
+var queryTypes = map[string]map[string]interface{}{
+	"limit":              {"type": "integer", "minimum": 0},
+	"offset":             {"type": "integer", "minimum": 0},
+	"running":            {"type": "boolean"},
+	"finished":           {"type": "boolean"},
+	"reverse":            {"type": "boolean"},
+	"include_prerelease": {"type": "boolean"},
+	"remove_artifacts":   {"type": "boolean"},
+	"keep_artifacts":     {"type": "boolean"},
+	"delete":             {"type": "boolean"},
+	"since":              {"type": "string", "format": "date-time"},
+	"until":              {"type": "string", "format": "date-time"},
+}
+
+//go:embed docs.html
+var docsPage []byte
+
+// DocRoutes returns /openapi.json, an OpenAPI 3 description of routes, and
+// /docs, a Swagger UI page for it. Deprecated aliases and moved routes are
+// left out of the description.
+func DocRoutes(d *Deps, routes Routes) Routes {
+	spec, err := json.MarshalIndent(OpenAPI(d, routes), "", "  ")
+	if err != nil {
+		// every schema is built from maps, slices and strings
+		panic(err)
+	}
+	return Routes{
+		Route{
+			Name:    "OpenAPI",
+			Method:  "GET",
+			Pattern: "/openapi.json",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+				w.Write(spec)
+			},
+			Public: true,
+		},
+		Route{
+			Name:    "Docs",
+			Method:  "GET",
+			Pattern: "/docs",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+				w.Write(docsPage)
+			},
+			Public: true,
+		},
+	}
+}
+
+// pathVar matches the variables of a mux pattern, with an optional regexp.
+var pathVar = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// OpenAPI describes routes as an OpenAPI 3.0 document, with body schemas
+// derived from the types in apiDocs.
+func OpenAPI(d *Deps, routes Routes) map[string]interface{} {
+	g := &schemaGen{schemas: map[string]interface{}{}}
+	paths := map[string]map[string]interface{}{}
+	for _, route := range routes {
+		if route.Deprecated != "" || route.Successor != "" {
+			continue
+		}
+		path := pathVar.ReplaceAllString(route.Pattern, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		id := route.Name
+		if strings.Contains(route.Pattern, "/namespaces/{namespace}") {
+			id += "InNamespace"
+		}
+		paths[path][strings.ToLower(route.Method)] = g.operation(d, route, id)
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Antares API",
+			"version": strings.TrimPrefix(CurrentAPI, "/"),
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func (g *schemaGen) operation(d *Deps, route Route, id string) map[string]interface{} {
+	doc := apiDocs[route.Name]
+	op := map[string]interface{}{"operationId": id}
+	if doc.Summary != "" {
+		op["summary"] = doc.Summary
+	}
+	var params []interface{}
+	for _, m := range pathVar.FindAllStringSubmatch(route.Pattern, -1) {
+		params = append(params, map[string]interface{}{
+			"name": m[1], "in": "path", "required": true,
+			"schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, name := range doc.Query {
+		schema, ok := queryTypes[name]
+		if !ok {
+			schema = map[string]interface{}{"type": "string"}
+		}
+		params = append(params, map[string]interface{}{"name": name, "in": "query", "schema": schema})
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+	if doc.Request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  g.content(doc.Request, mediaJSON, mediaYAML),
+		}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if status != http.StatusNoContent {
+		switch {
+		case doc.ContentType != "":
+			success["content"] = g.content(doc.Response, doc.ContentType)
+		case doc.Response != nil:
+			success["content"] = g.content(doc.Response, mediaJSON, mediaYAML, mediaXML)
+		}
+	}
+	errorBody := map[string]interface{}{
+		"description": "Error",
+		"content":     g.content(APIError{}, mediaJSON, mediaYAML, mediaXML),
+	}
+	op["responses"] = map[string]interface{}{
+		strconv.Itoa(status): success,
+		"default":            errorBody,
+	}
+	if !public(d, route) && (d.Auth != nil || route.Permission == PermissionAdmin) {
+		op["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+	}
+	return op
+}
+
+// content is the content map of a body of type v in each of the media
+// types. A nil v is plain text.
+func (g *schemaGen) content(v interface{}, types ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "string"}
+	if v != nil {
+		schema = g.schema(reflect.TypeOf(v))
+	}
+	out := map[string]interface{}{}
+	for _, t := range types {
+		out[t] = map[string]interface{}{"schema": schema}
+	}
+	return out
+}
+
+// schemaGen builds JSON schemas from Go types, collecting named structs in
+// schemas and referring to them by name.
+type schemaGen struct {
+	schemas map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // guards against recursive types
+			g.schemas[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	// interfaces and anything else take any value
+	return map[string]interface{}{}
+}
+
+// structSchema describes the JSON encoding of the struct type t.
+func (g *schemaGen) structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := g.schema(f.Type)
+		if opts == "string" {
+			s = map[string]interface{}{"type": "string"}
+		}
+		props[name] = s
+	}
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+// schemaName names the component of t, capitalized since unexported
+// response types are part of the API all the same.
+func schemaName(t reflect.Type) string {
+	r := []rune(t.Name())
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
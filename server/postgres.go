@@ -0,0 +1,623 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// pgMigrations are applied in order; a database is at version n once the
+// first n have run. Never edit one that has shipped, append a new one.
+var pgMigrations = [][]string{
+	{
+		`CREATE TABLE antarians (
+			seq bigserial PRIMARY KEY,
+			id text NOT NULL UNIQUE,
+			name text NOT NULL,
+			version text NOT NULL,
+			data jsonb NOT NULL
+		)`,
+		`CREATE INDEX antarians_name ON antarians (name)`,
+		`CREATE TABLE builds (
+			id text PRIMARY KEY,
+			antarian_id text NOT NULL,
+			start_time timestamptz NOT NULL,
+			end_time timestamptz NOT NULL,
+			done boolean NOT NULL,
+			data jsonb NOT NULL
+		)`,
+		`CREATE INDEX builds_antarian_id ON builds (antarian_id)`,
+		`CREATE TABLE audit (
+			seq bigserial PRIMARY KEY,
+			time timestamptz NOT NULL,
+			action text NOT NULL,
+			data jsonb NOT NULL
+		)`,
+		`CREATE INDEX audit_time ON audit (time)`,
+	},
+	{
+		`ALTER TABLE antarians ADD COLUMN namespace text NOT NULL DEFAULT 'default'`,
+		`UPDATE antarians SET namespace = data->>'namespace' WHERE coalesce(data->>'namespace', '') <> ''`,
+		`CREATE INDEX antarians_namespace_name ON antarians (namespace, name)`,
+	},
+	{
+		`CREATE TABLE webhooks (
+			seq bigserial PRIMARY KEY,
+			id text NOT NULL UNIQUE,
+			data jsonb NOT NULL
+		)`,
+	},
+	{
+		`CREATE TABLE schedules (
+			seq bigserial PRIMARY KEY,
+			id text NOT NULL UNIQUE,
+			data jsonb NOT NULL
+		)`,
+	},
+	{
+		// fails on a database already holding duplicates, which must be
+		// renamed or removed by hand before upgrading
+		`CREATE UNIQUE INDEX antarians_namespace_name_version ON antarians (namespace, name, version)`,
+		`DROP INDEX antarians_namespace_name`,
+	},
+}
+
+// pgUniqueViolation is the SQLSTATE of an insert or update breaking a
+// unique index.
+const pgUniqueViolation = "23505"
+
+// pgMigrateLock is the advisory lock held while migrating, so instances
+// starting together do not migrate the same database twice.
+const pgMigrateLock = 0x616e7461
+
+// PostgresRepo is a Repository in a PostgreSQL database, which several
+// servers can share. Records are stored as JSON next to the columns they
+// are queried by.
+type PostgresRepo struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+// NewPostgresRepo connects to the database described by cfg and brings its
+// schema up to date.
+func NewPostgresRepo(cfg config.Postgres, log *slog.Logger) (*PostgresRepo, error) {
+	db, err := sql.Open("pgx", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to postgres: %v", err)
+	}
+	r := &PostgresRepo{db: db, log: log}
+	if err := r.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate postgres schema: %v", err)
+	}
+	return r, nil
+}
+
+// migrate applies the migrations the database has not seen yet.
+func (r *PostgresRepo) migrate(ctx context.Context) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, pgMigrateLock); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		applied timestamptz NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT coalesce(max(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	if current > len(pgMigrations) {
+		return fmt.Errorf("schema version %d is newer than this server supports (%d)", current, len(pgMigrations))
+	}
+	for v := current + 1; v <= len(pgMigrations); v++ {
+		for _, stmt := range pgMigrations[v-1] {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("version %d: %v", v, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, v); err != nil {
+			return err
+		}
+		r.log.Info("migrated postgres schema", "version", v)
+	}
+	return tx.Commit()
+}
+
+// Close closes the connection pool.
+func (r *PostgresRepo) Close() error {
+	return r.db.Close()
+}
+
+// Ping checks that the database can be reached.
+func (r *PostgresRepo) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// queryAntarians runs a query selecting the data column of antarians.
+func (r *PostgresRepo) queryAntarians(query string, args ...interface{}) (lib.Antarians, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := lib.Antarians{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		a, err := decodeAntarian(raw)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (r *PostgresRepo) ListAntarians() (lib.Antarians, error) {
+	return r.queryAntarians(`SELECT data FROM antarians ORDER BY seq`)
+}
+
+// EachAntarian reads eachBatch records per query and calls fn between
+// queries, so a slow consumer does not hold a connection.
+func (r *PostgresRepo) EachAntarian(fn func(lib.Antarian) error) error {
+	var after int64
+	for {
+		rows, err := r.db.Query(`SELECT seq, data FROM antarians WHERE seq > $1 ORDER BY seq LIMIT $2`, after, eachBatch)
+		if err != nil {
+			return err
+		}
+		var batch lib.Antarians
+		for rows.Next() {
+			var raw []byte
+			if err := rows.Scan(&after, &raw); err != nil {
+				rows.Close()
+				return err
+			}
+			a, err := decodeAntarian(raw)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, a)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, a := range batch {
+			if err := fn(a); err != nil {
+				return err
+			}
+		}
+		if len(batch) < eachBatch {
+			return nil
+		}
+	}
+}
+
+func (r *PostgresRepo) FindAntarian(id string) (lib.Antarian, error) {
+	var raw []byte
+	err := r.db.QueryRow(`SELECT data FROM antarians WHERE id = $1`, id).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return lib.Antarian{}, ErrNotFound
+	}
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	return decodeAntarian(raw)
+}
+
+func (r *PostgresRepo) AntariansNamed(name string) (lib.Antarians, error) {
+	return r.queryAntarians(`SELECT data FROM antarians WHERE name = $1 ORDER BY seq`, name)
+}
+
+func (r *PostgresRepo) NameSummaries(prefix string, labels lib.LabelSelector) ([]NameSummary, error) {
+	z := newSummarizer(prefix, labels)
+	err := r.EachAntarian(func(a lib.Antarian) error {
+		z.add(a)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return z.result(), nil
+}
+
+func (r *PostgresRepo) CreateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	uuid, err := lib.NewUUID()
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	s.Id = uuid
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	_, err = r.db.Exec(`INSERT INTO antarians (id, namespace, name, version, data) VALUES ($1, $2, $3, $4, $5)`,
+		s.Id, s.NamespaceOrDefault(), s.Name, s.Version, raw)
+	if err != nil {
+		return lib.Antarian{}, pgConflict(err)
+	}
+	return s, nil
+}
+
+func (r *PostgresRepo) UpdateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	defer tx.Rollback()
+	var seq int64
+	err = tx.QueryRow(`SELECT seq FROM antarians WHERE id = $1 FOR UPDATE`, s.Id).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return lib.Antarian{}, ErrNotFound
+	}
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	var conflict bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM antarians WHERE namespace = $1 AND name = $2 AND version = $3 AND id <> $4)`,
+		s.NamespaceOrDefault(), s.Name, s.Version, s.Id).Scan(&conflict)
+	if err != nil {
+		return lib.Antarian{}, err
+	}
+	if conflict {
+		return lib.Antarian{}, ErrConflict
+	}
+	_, err = tx.Exec(`UPDATE antarians SET namespace = $1, name = $2, version = $3, data = $4 WHERE seq = $5`,
+		s.NamespaceOrDefault(), s.Name, s.Version, raw, seq)
+	if err != nil {
+		return lib.Antarian{}, pgConflict(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return lib.Antarian{}, err
+	}
+	return s, nil
+}
+
+// pgConflict returns ErrConflict for a unique violation, which on the
+// antarians table can only be a duplicate name and version, and err
+// otherwise.
+func pgConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *PostgresRepo) DestroyAntarian(id string) error {
+	res, err := r.db.Exec(`DELETE FROM antarians WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresRepo) Purge() (antarians, builds int, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	counts := make([]int, 2)
+	for i, table := range []string{"antarians", "builds"} {
+		res, err := tx.Exec(`DELETE FROM ` + table)
+		if err != nil {
+			return 0, 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, 0, err
+		}
+		counts[i] = int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return counts[0], counts[1], nil
+}
+
+func (r *PostgresRepo) SaveBuild(b lib.Build) error {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO builds (id, antarian_id, start_time, end_time, done, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET start_time = $3, end_time = $4, done = $5, data = $6`,
+		b.Id, b.AntarianId, b.Start, b.End, b.State.Done(), raw)
+	return err
+}
+
+// FindBuild reports a record that cannot be read as missing, after logging
+// why.
+func (r *PostgresRepo) FindBuild(id string) (lib.Build, bool) {
+	var raw []byte
+	err := r.db.QueryRow(`SELECT data FROM builds WHERE id = $1`, id).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return lib.Build{}, false
+	}
+	var b lib.Build
+	if err == nil {
+		err = json.Unmarshal(raw, &b)
+	}
+	if err != nil {
+		r.log.Error("find build", "err", err, "build_id", id)
+		return lib.Build{}, false
+	}
+	return b, true
+}
+
+// queryBuilds lists the builds of antarianId, or all builds when it is
+// empty, newest first, up to limit when it is positive.
+func (r *PostgresRepo) queryBuilds(antarianId string, limit int) ([]lib.Build, error) {
+	query := `SELECT data FROM builds WHERE ($1 = '' OR antarian_id = $1) ORDER BY start_time DESC`
+	args := []interface{}{antarianId}
+	if limit > 0 {
+		query += ` LIMIT $2`
+		args = append(args, limit)
+	}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []lib.Build{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var b lib.Build
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, err
+		}
+		list = append(list, b)
+	}
+	return list, rows.Err()
+}
+
+func (r *PostgresRepo) ListBuilds(antarianId string) ([]lib.Build, error) {
+	return r.queryBuilds(antarianId, 0)
+}
+
+func (r *PostgresRepo) LatestBuild(antarianId string) (lib.Build, bool, error) {
+	list, err := r.queryBuilds(antarianId, 1)
+	if err != nil || len(list) == 0 {
+		return lib.Build{}, false, err
+	}
+	return list[0], true, nil
+}
+
+func (r *PostgresRepo) PruneBuilds(cutoff time.Time) (int, error) {
+	res, err := r.db.Exec(`DELETE FROM builds WHERE done AND end_time < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (r *PostgresRepo) AppendAudit(e lib.AuditEntry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO audit (time, action, data) VALUES ($1, $2, $3)`, e.Time, e.Action, raw)
+	return err
+}
+
+func (r *PostgresRepo) ListAudit(q AuditQuery) ([]lib.AuditEntry, error) {
+	query := `SELECT data FROM audit WHERE true`
+	var args []interface{}
+	if !q.Since.IsZero() {
+		args = append(args, q.Since)
+		query += fmt.Sprintf(` AND time >= $%d`, len(args))
+	}
+	if !q.Until.IsZero() {
+		args = append(args, q.Until)
+		query += fmt.Sprintf(` AND time < $%d`, len(args))
+	}
+	if q.Action != "" {
+		args = append(args, q.Action)
+		query += fmt.Sprintf(` AND action = $%d`, len(args))
+	}
+	if q.Actor != "" {
+		args = append(args, q.Actor)
+		query += fmt.Sprintf(` AND data->>'actor' = $%d`, len(args))
+	}
+	if q.Resource != "" {
+		args = append(args, q.Resource)
+		query += fmt.Sprintf(` AND (data->>'antarian_id' = $%d OR data->>'build_id' = $%d)`, len(args), len(args))
+	}
+	rows, err := r.db.Query(query+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []lib.AuditEntry{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var e lib.AuditEntry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+func (r *PostgresRepo) CreateWebhook(h lib.Webhook) error {
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO webhooks (id, data) VALUES ($1, $2)`, h.Id, raw)
+	return err
+}
+
+func (r *PostgresRepo) ListWebhooks() ([]lib.Webhook, error) {
+	rows, err := r.db.Query(`SELECT data FROM webhooks ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []lib.Webhook{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var h lib.Webhook
+		if err := json.Unmarshal(raw, &h); err != nil {
+			return nil, err
+		}
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
+
+func (r *PostgresRepo) FindWebhook(id string) (lib.Webhook, error) {
+	var raw []byte
+	err := r.db.QueryRow(`SELECT data FROM webhooks WHERE id = $1`, id).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return lib.Webhook{}, ErrNotFound
+	}
+	if err != nil {
+		return lib.Webhook{}, err
+	}
+	var h lib.Webhook
+	err = json.Unmarshal(raw, &h)
+	return h, err
+}
+
+func (r *PostgresRepo) DestroyWebhook(id string) error {
+	res, err := r.db.Exec(`DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresRepo) CreateSchedule(s lib.Schedule) error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO schedules (id, data) VALUES ($1, $2)`, s.Id, raw)
+	return err
+}
+
+func (r *PostgresRepo) ListSchedules() ([]lib.Schedule, error) {
+	rows, err := r.db.Query(`SELECT data FROM schedules ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []lib.Schedule{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var s lib.Schedule
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+func (r *PostgresRepo) FindSchedule(id string) (lib.Schedule, error) {
+	var raw []byte
+	err := r.db.QueryRow(`SELECT data FROM schedules WHERE id = $1`, id).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return lib.Schedule{}, ErrNotFound
+	}
+	if err != nil {
+		return lib.Schedule{}, err
+	}
+	var s lib.Schedule
+	err = json.Unmarshal(raw, &s)
+	return s, err
+}
+
+func (r *PostgresRepo) UpdateSchedule(s lib.Schedule) error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`UPDATE schedules SET data = $2 WHERE id = $1`, s.Id, raw)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresRepo) DestroySchedule(id string) error {
+	res, err := r.db.Exec(`DELETE FROM schedules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+var _ Repository = (*PostgresRepo)(nil)
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// listQuery selects and orders the Antarians returned by AntarianIndex.
+type listQuery struct {
+	Name     string
+	Version  string
+	Running  *bool
+	Finished *bool
+	Status   lib.Status
+	Labels   lib.LabelSelector
+	Sort     []sortKey
+}
+
+// sortKey orders by one field, descending when Desc is set.
+type sortKey struct {
+	Field string
+	Desc  bool
+}
+
+// sortFields compare two Antarians by the named field.
+var sortFields = map[string]func(a, b lib.Antarian) int{
+	"id":      func(a, b lib.Antarian) int { return strings.Compare(a.Id, b.Id) },
+	"name":    lib.ByName,
+	"version": lib.ByVersion,
+	"release": func(a, b lib.Antarian) int { return strings.Compare(a.Release, b.Release) },
+	"start":   lib.ByStart,
+	"end":     func(a, b lib.Antarian) int { return a.End.Compare(b.End) },
+}
+
+// parseListQuery reads the name, version, running, finished, status, label
+// and sort query parameters. Each label is a lib.LabelSelector, and an
+// Antarian must match them all. sort is a comma separated list of fields,
+// each prefixed with - to sort descending.
+func parseListQuery(r *http.Request) (listQuery, error) {
+	v := r.URL.Query()
+	q := listQuery{Name: v.Get("name"), Version: v.Get("version"), Status: lib.Status(v.Get("status"))}
+	if q.Status != "" && !q.Status.Valid() {
+		return q, fmt.Errorf("status: %q is not one of %v", q.Status, lib.Statuses)
+	}
+	for name, p := range map[string]**bool{"running": &q.Running, "finished": &q.Finished} {
+		s := v.Get(name)
+		if s == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("%s: %q is not a boolean", name, s)
+		}
+		*p = &b
+	}
+	labels, err := parseLabels(r)
+	if err != nil {
+		return q, err
+	}
+	q.Labels = labels
+	if s := v.Get("sort"); s != "" {
+		for _, f := range strings.Split(s, ",") {
+			k := sortKey{Field: strings.TrimSpace(f)}
+			if strings.HasPrefix(k.Field, "-") {
+				k.Field, k.Desc = k.Field[1:], true
+			}
+			if _, ok := sortFields[k.Field]; !ok {
+				return q, fmt.Errorf("sort: %q is not a sortable field", f)
+			}
+			q.Sort = append(q.Sort, k)
+		}
+	}
+	return q, nil
+}
+
+// parseLabels joins the label query parameters into one selector.
+func parseLabels(r *http.Request) (lib.LabelSelector, error) {
+	var labels lib.LabelSelector
+	for _, s := range r.URL.Query()["label"] {
+		sel, err := lib.ParseLabelSelector(s)
+		if err != nil {
+			return nil, fmt.Errorf("label: %v", err)
+		}
+		labels = append(labels, sel...)
+	}
+	return labels, nil
+}
+
+// match reports whether a passes every filter of q.
+func (q listQuery) match(a lib.Antarian) bool {
+	switch {
+	case q.Name != "" && a.Name != q.Name:
+		return false
+	case q.Version != "" && a.Version != q.Version:
+		return false
+	case q.Running != nil && a.Running != *q.Running:
+		return false
+	case q.Finished != nil && a.Finished != *q.Finished:
+		return false
+	case q.Status != "" && a.CurrentStatus() != q.Status:
+		return false
+	case !q.Labels.Matches(a.Labels):
+		return false
+	}
+	return true
+}
+
+// apply filters list and sorts what is left. Ties keep creation order.
+func (q listQuery) apply(list lib.Antarians) lib.Antarians {
+	out := list.Filter(q.match)
+	cmps := make([]func(a, b lib.Antarian) int, len(q.Sort))
+	for i, k := range q.Sort {
+		cmps[i] = sortFields[k.Field]
+		if k.Desc {
+			cmps[i] = lib.Descending(cmps[i])
+		}
+	}
+	out.SortBy(cmps...)
+	return out
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// maxBuckets is the number of clients tracked before the buckets of idle
+// ones are dropped.
+const maxBuckets = 10000
+
+// rateLimiter keeps a token bucket per client. Each bucket holds up to
+// burst tokens and refills at rate tokens per second; a request takes one.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns the limiter described by cfg, or nil when rate
+// limiting is disabled.
+func newRateLimiter(cfg config.RateLimit) *rateLimiter {
+	if cfg.Rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: cfg.Rate, burst: float64(cfg.Burst), buckets: map[string]*bucket{}}
+}
+
+// take spends a token of client. When the bucket is empty it returns false
+// and how long until the next token.
+func (l *rateLimiter) take(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have refilled, which behave exactly like
+// new ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// rateLimit answers 429 with a Retry-After header to clients that have
+// used up their bucket. Callers are told apart by principalActor, and
+// anonymous ones by IP address.
+func rateLimit(d *Deps) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := rateLimitClient(r.Context(), r.Header.Get("Authorization"), r.RemoteAddr)
+			if ok, wait := d.limiter.take(client, time.Now()); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(d, w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitedMethods are the gRPC methods that share the rate limit of the
+// RateLimited routes.
+var rateLimitedMethods = map[string]bool{
+	rpc.Antares_CreateAntarian_FullMethodName: true,
+	rpc.Antares_TriggerBuild_FullMethodName:   true,
+}
+
+// checkRateLimit is rateLimit for the gRPC call method.
+func checkRateLimit(ctx context.Context, d *Deps, method string) error {
+	if d.limiter == nil || !rateLimitedMethods[method] {
+		return nil
+	}
+	authorization, addr := "", ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			authorization = v[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	if ok, wait := d.limiter.take(rateLimitClient(ctx, authorization, addr), time.Now()); !ok {
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %v", wait.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// rateLimitClient names the bucket of a caller.
+func rateLimitClient(ctx context.Context, authorization, addr string) string {
+	if a := principalActor(ctx, authorization); a != "anonymous" {
+		return a
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return "ip:" + host
+	}
+	return "ip:" + addr
+}
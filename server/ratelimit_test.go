@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	l := newRateLimiter(config.RateLimit{Rate: 2, Burst: 3})
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.take("a", now); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	ok, wait := l.take("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("take past the burst = %v, wait %v; want refused for 500ms", ok, wait)
+	}
+	// another client has its own bucket
+	if ok, _ := l.take("b", now); !ok {
+		t.Error("b refused for a's requests")
+	}
+	// a token comes back every 1/rate seconds
+	if ok, _ := l.take("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("a refused after a token refilled")
+	}
+	if ok, _ := l.take("a", now.Add(500*time.Millisecond)); ok {
+		t.Error("a admitted twice for one refilled token")
+	}
+
+	if newRateLimiter(config.RateLimit{Burst: 3}) != nil {
+		t.Error("a zero rate does not disable the limiter")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	_, ts := newTestServer(t, func(c *config.Config) {
+		c.Tokens = []string{"alice", "bob"}
+		c.RateLimit = config.RateLimit{Rate: 0.5, Burst: 2}
+	})
+	create := func(token string, i int) *http.Response {
+		t.Helper()
+		raw, _ := json.Marshal(lib.Antarian{Name: "lib" + token, Version: fmt.Sprintf("1.0.%d", i)})
+		req, _ := http.NewRequest("POST", ts.URL+"/v1/antarians", bytes.NewReader(raw))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	for i := 0; i < 2; i++ {
+		if resp := create("alice", i); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("request %d of the burst = %d", i+1, resp.StatusCode)
+		}
+	}
+	resp := create("alice", 2)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "2" {
+		t.Errorf("past the burst = %d, Retry-After %q; want 429 after 2s", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	// bob is tracked apart from alice
+	if resp := create("bob", 0); resp.StatusCode != http.StatusCreated {
+		t.Errorf("bob = %d, want 201", resp.StatusCode)
+	}
+	// reads are not limited
+	for i := 0; i < 3; i++ {
+		if status := call(t, ts, "GET", "/v1/antarians", nil, nil, "Authorization", "Bearer alice"); status != http.StatusOK {
+			t.Errorf("list = %d, want 200", status)
+		}
+	}
+}
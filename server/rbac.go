@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/xbcsmith/antares/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Permission is the level of access a route requires.
+type Permission string
+
+const (
+	// PermissionRead allows listing and showing Antarians and builds.
+	PermissionRead Permission = "read"
+	// PermissionWrite allows creating, changing, building and deleting
+	// Antarians.
+	PermissionWrite Permission = "write"
+	// PermissionAdmin allows the /admin endpoints.
+	PermissionAdmin Permission = "admin"
+)
+
+// Roles known to the server, as listed in config.Roles. Each grants its own
+// permission and those of the roles before it; other roles grant nothing.
+const (
+	RoleRead  = "read"
+	RoleWrite = "write"
+	RoleAdmin = "admin"
+)
+
+var roleGrants = map[string][]Permission{
+	RoleRead:  {PermissionRead},
+	RoleWrite: {PermissionRead, PermissionWrite},
+	RoleAdmin: {PermissionRead, PermissionWrite, PermissionAdmin},
+}
+
+// Can reports whether any of p's roles grants perm.
+func (p Principal) Can(perm Permission) bool {
+	if perm == "" {
+		return true
+	}
+	for _, role := range p.Roles {
+		for _, granted := range roleGrants[role] {
+			if granted == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requirePermission answers 403 to callers whose roles do not grant perm.
+// Servers without authentication admit everyone, except to admin routes,
+// which still need an admin token.
+func requirePermission(d *Deps, perm Permission) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFrom(r.Context())
+			if !ok && perm == PermissionAdmin {
+				var err error
+				if p, err = authenticate(r.Context(), d, r.Header.Get("Authorization")); err != nil {
+					unauthorized(d, w, r, err)
+					return
+				}
+				r = r.WithContext(withPrincipal(r.Context(), p))
+				ok = true
+			}
+			if ok && !p.Can(perm) {
+				writeError(d, w, r, http.StatusForbidden, fmt.Sprintf("%s permission required", perm))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// methodPermissions are the permissions required by the gRPC methods.
+var methodPermissions = map[string]Permission{
+	rpc.Antares_CreateAntarian_FullMethodName: PermissionWrite,
+	rpc.Antares_GetAntarian_FullMethodName:    PermissionRead,
+	rpc.Antares_ListAntarians_FullMethodName:  PermissionRead,
+	rpc.Antares_TriggerBuild_FullMethodName:   PermissionWrite,
+	rpc.Antares_WatchBuild_FullMethodName:     PermissionRead,
+}
+
+// checkPermission is requirePermission for the gRPC call method. Methods
+// missing from methodPermissions need admin, and so an authenticated
+// caller, even on an open server.
+func checkPermission(ctx context.Context, method string) error {
+	perm, known := methodPermissions[method]
+	if !known {
+		perm = PermissionAdmin
+	}
+	p, ok := PrincipalFrom(ctx)
+	if !ok && perm == PermissionAdmin {
+		return errUnauthenticated
+	}
+	if ok && !p.Can(perm) {
+		return status.Errorf(codes.PermissionDenied, "%s permission required", perm)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcClient serves the gRPC API of s on a loopback port and returns a
+// client for it.
+func grpcClient(t *testing.T, s *Instance) rpc.AntaresClient {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := NewGRPCServer(s.Deps())
+	go gs.Serve(l)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.NewClient("passthrough:///"+l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return rpc.NewAntaresClient(conn)
+}
+
+func bearer(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestRequirePermission(t *testing.T) {
+	for _, open := range []bool{false, true} {
+		_, ts := newTestServer(t, func(c *config.Config) {
+			c.AdminTokens = []string{"adm"}
+			if !open {
+				c.Tokens = []string{"wr"}
+				c.ReadTokens = []string{"rd"}
+			}
+		})
+		tests := []struct {
+			method, path, token string
+			status              int
+		}{
+			{"GET", "/v1/admin/audit", "", http.StatusUnauthorized},
+			{"GET", "/v1/admin/audit", "bogus", http.StatusUnauthorized},
+			{"GET", "/v1/admin/audit", "adm", http.StatusOK},
+		}
+		if !open {
+			tests = append(tests, []struct {
+				method, path, token string
+				status              int
+			}{
+				{"GET", "/v1/antarians", "", http.StatusUnauthorized},
+				{"GET", "/v1/antarians", "rd", http.StatusOK},
+				{"POST", "/v1/antarians", "rd", http.StatusForbidden},
+				{"GET", "/v1/admin/audit", "rd", http.StatusForbidden},
+				{"GET", "/v1/admin/audit", "wr", http.StatusForbidden},
+			}...)
+		}
+		for _, tt := range tests {
+			var header []string
+			if tt.token != "" {
+				header = []string{"Authorization", "Bearer " + tt.token}
+			}
+			var body interface{}
+			if tt.method == "POST" {
+				body = map[string]string{"name": "libfoo", "version": "1.0.0"}
+			}
+			if status := call(t, ts, tt.method, tt.path, body, nil, header...); status != tt.status {
+				t.Errorf("open %v: %s %s with %q = %d, want %d", open, tt.method, tt.path, tt.token, status, tt.status)
+			}
+		}
+	}
+}
+
+func TestCheckPermission(t *testing.T) {
+	reader := withPrincipal(context.Background(), Principal{Subject: "r", Roles: []string{RoleRead}})
+	admin := withPrincipal(context.Background(), Principal{Subject: "a", Roles: []string{RoleAdmin}})
+	const unmapped = "/antares.Antares/Purge"
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		code   codes.Code
+	}{
+		{"anonymous read on an open server", context.Background(), rpc.Antares_GetAntarian_FullMethodName, codes.OK},
+		{"anonymous unmapped", context.Background(), unmapped, codes.Unauthenticated},
+		{"reader write", reader, rpc.Antares_CreateAntarian_FullMethodName, codes.PermissionDenied},
+		{"reader unmapped", reader, unmapped, codes.PermissionDenied},
+		{"admin unmapped", admin, unmapped, codes.OK},
+	}
+	for _, tt := range tests {
+		if got := status.Code(checkPermission(tt.ctx, tt.method)); got != tt.code {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.code)
+		}
+	}
+}
+
+func TestGRPCPermissions(t *testing.T) {
+	s, _ := newTestServer(t, func(c *config.Config) {
+		c.AdminTokens = []string{"adm"}
+		c.Tokens = []string{"wr"}
+		c.ReadTokens = []string{"rd"}
+	})
+	client := grpcClient(t, s)
+	create := &rpc.CreateAntarianRequest{Antarian: &rpc.Antarian{Name: "libfoo", Version: "1.0.0"}}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"anonymous", context.Background(), codes.Unauthenticated},
+		{"bad token", bearer("bogus"), codes.Unauthenticated},
+		{"reader", bearer("rd"), codes.PermissionDenied},
+		{"writer", bearer("wr"), codes.OK},
+	}
+	for _, tt := range tests {
+		if _, err := client.CreateAntarian(tt.ctx, create); status.Code(err) != tt.code {
+			t.Errorf("%s: CreateAntarian = %v, want %v", tt.name, err, tt.code)
+		}
+	}
+	if _, err := client.GetAntarian(bearer("rd"), &rpc.GetAntarianRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("reader GetAntarian = %v, want NotFound", err)
+	}
+}
+
+// TestGRPCAdminOnOpenServer calls a method no role is mapped to through the
+// interceptor of a server without tokens: it still needs an admin.
+func TestGRPCAdminOnOpenServer(t *testing.T) {
+	s, _ := newTestServer(t, func(c *config.Config) {
+		c.AdminTokens = []string{"adm"}
+	})
+	intercept := unaryInterceptor(s.Deps())
+	info := &grpc.UnaryServerInfo{FullMethod: "/antares.Antares/Purge"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "purged", nil }
+	incoming := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"anonymous", context.Background(), codes.Unauthenticated},
+		{"bad token", incoming("bogus"), codes.Unauthenticated},
+		{"admin", incoming("adm"), codes.OK},
+	}
+	for _, tt := range tests {
+		if _, err := intercept(tt.ctx, nil, info, handler); status.Code(err) != tt.code {
+			t.Errorf("%s = %v, want %v", tt.name, err, tt.code)
+		}
+	}
+	// the mapped methods stay open
+	if _, err := intercept(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: rpc.Antares_ListAntarians_FullMethodName}, handler); err != nil {
+		t.Errorf("anonymous ListAntarians = %v", err)
+	}
+}
@@ -1,47 +1,373 @@
 package server
 
 import (
-	"fmt"
-	"os"
+	"log/slog"
+	"sort"
+	"sync"
 	"time"
-    "github.com/xbcsmith/antares/lib"
+
+	"github.com/xbcsmith/antares/lib"
 )
 
-var antarians lib.Antarians
+// MemoryRepo is the default Repository. It keeps everything in memory, so
+// nothing survives a restart.
+type MemoryRepo struct {
+	// mu guards antarians and its indexes, which all point at the same
+	// records. Records are deep copied in and out, so no caller shares
+	// their slices or maps.
+	mu        sync.RWMutex
+	antarians []*lib.Antarian
+	byId      map[string]*lib.Antarian
+	byName    map[string][]*lib.Antarian
+	log       *slog.Logger
+
+	// builds are written by the build workers, so they need their own lock
+	buildMu    sync.Mutex
+	builds     map[string]lib.Build
+	byAntarian map[string][]string
+
+	// audit is append-only
+	auditMu sync.Mutex
+	audit   []lib.AuditEntry
 
-// Give us some seed data
-func init() {
-	h, _ := os.Hostname()
-	currentUri := `http://` + h + `:8080`
-	RepoCreateAntarian(lib.Antarian{Name: "AntarianMain", Uri: currentUri, Running: true, Start: time.Now()})
+	webhookMu sync.Mutex
+	webhooks  []lib.Webhook
+
+	scheduleMu sync.Mutex
+	schedules  []lib.Schedule
 }
 
-func RepoFindAntarian(id string) lib.Antarian {
-	for _, s := range antarians {
-		if s.Id == id {
-			return s
+// NewMemoryRepo returns an empty in-memory repository.
+func NewMemoryRepo(log *slog.Logger) *MemoryRepo {
+	return &MemoryRepo{
+		byId:       map[string]*lib.Antarian{},
+		byName:     map[string][]*lib.Antarian{},
+		log:        log,
+		builds:     map[string]lib.Build{},
+		byAntarian: map[string][]string{},
+	}
+}
+
+func (r *MemoryRepo) ListAntarians() (lib.Antarians, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make(lib.Antarians, len(r.antarians))
+	for i, s := range r.antarians {
+		list[i] = s.DeepCopy()
+	}
+	return list, nil
+}
+
+// EachAntarian does not hold the lock while fn runs, so a slow consumer
+// does not block writers.
+func (r *MemoryRepo) EachAntarian(fn func(lib.Antarian) error) error {
+	for i := 0; ; i++ {
+		r.mu.RLock()
+		if i >= len(r.antarians) {
+			r.mu.RUnlock()
+			return nil
 		}
+		s := r.antarians[i].DeepCopy()
+		r.mu.RUnlock()
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *MemoryRepo) FindAntarian(id string) (lib.Antarian, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if s, ok := r.byId[id]; ok {
+		return s.DeepCopy(), nil
+	}
+	return lib.Antarian{}, ErrNotFound
+}
+
+func (r *MemoryRepo) NameSummaries(prefix string, labels lib.LabelSelector) ([]NameSummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	z := newSummarizer(prefix, labels)
+	for _, s := range r.antarians {
+		z.add(*s)
+	}
+	return z.result(), nil
+}
+
+func (r *MemoryRepo) AntariansNamed(name string) (lib.Antarians, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var list lib.Antarians
+	for _, s := range r.byName[name] {
+		list = append(list, s.DeepCopy())
 	}
-	// return empty Antarian if not found
-	return lib.Antarian{}
+	return list, nil
 }
 
-func RepoCreateAntarian(s lib.Antarian) lib.Antarian {
-    uuid, err := lib.NewUUID()
-    if err != nil {
-        fmt.Printf("error: %v\n", err)
-    }
+func (r *MemoryRepo) CreateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	uuid, err := lib.NewUUID()
+	if err != nil {
+		return lib.Antarian{}, err
+	}
 	s.Id = uuid
-	antarians = append(antarians, s)
-	return s
+	stored := s.DeepCopy()
+	p := &stored
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, o := range r.byName[s.Name] {
+		if o.Version == s.Version && o.NamespaceOrDefault() == s.NamespaceOrDefault() {
+			return lib.Antarian{}, ErrConflict
+		}
+	}
+	r.antarians = append(r.antarians, p)
+	r.byId[s.Id] = p
+	r.byName[s.Name] = append(r.byName[s.Name], p)
+	return s, nil
+}
+
+func (r *MemoryRepo) UpdateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.byId[s.Id]
+	if !ok {
+		return lib.Antarian{}, ErrNotFound
+	}
+	for _, o := range r.byName[s.Name] {
+		if o != p && o.Version == s.Version && o.NamespaceOrDefault() == s.NamespaceOrDefault() {
+			return lib.Antarian{}, ErrConflict
+		}
+	}
+	if p.Name != s.Name {
+		r.byName[p.Name] = without(r.byName[p.Name], p)
+		if len(r.byName[p.Name]) == 0 {
+			delete(r.byName, p.Name)
+		}
+		r.byName[s.Name] = append(r.byName[s.Name], p)
+	}
+	*p = s.DeepCopy()
+	return s, nil
+}
+
+func (r *MemoryRepo) DestroyAntarian(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.byId[id]
+	if !ok {
+		return ErrNotFound
+	}
+	r.antarians = without(r.antarians, p)
+	delete(r.byId, id)
+	r.byName[p.Name] = without(r.byName[p.Name], p)
+	if len(r.byName[p.Name]) == 0 {
+		delete(r.byName, p.Name)
+	}
+	return nil
+}
+
+// without removes p from list, keeping the order of the rest.
+func without(list []*lib.Antarian, p *lib.Antarian) []*lib.Antarian {
+	for i, o := range list {
+		if o == p {
+			copy(list[i:], list[i+1:])
+			list[len(list)-1] = nil
+			return list[:len(list)-1]
+		}
+	}
+	return list
+}
+
+func (r *MemoryRepo) Purge() (antarians, builds int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buildMu.Lock()
+	defer r.buildMu.Unlock()
+	antarians, builds = len(r.antarians), len(r.builds)
+	r.antarians = nil
+	r.byId = map[string]*lib.Antarian{}
+	r.byName = map[string][]*lib.Antarian{}
+	r.builds = map[string]lib.Build{}
+	r.byAntarian = map[string][]string{}
+	return antarians, builds, nil
+}
+
+func (r *MemoryRepo) SaveBuild(b lib.Build) error {
+	r.buildMu.Lock()
+	defer r.buildMu.Unlock()
+	if _, ok := r.builds[b.Id]; !ok {
+		r.byAntarian[b.AntarianId] = append(r.byAntarian[b.AntarianId], b.Id)
+	}
+	r.builds[b.Id] = b
+	return nil
+}
+
+func (r *MemoryRepo) FindBuild(id string) (lib.Build, bool) {
+	r.buildMu.Lock()
+	defer r.buildMu.Unlock()
+	b, ok := r.builds[id]
+	return b, ok
+}
+
+func (r *MemoryRepo) ListBuilds(antarianId string) ([]lib.Build, error) {
+	r.buildMu.Lock()
+	defer r.buildMu.Unlock()
+	list := []lib.Build{}
+	if antarianId == "" {
+		list = make([]lib.Build, 0, len(r.builds))
+		for _, b := range r.builds {
+			list = append(list, b)
+		}
+	} else {
+		for _, id := range r.byAntarian[antarianId] {
+			list = append(list, r.builds[id])
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Start.After(list[j].Start)
+	})
+	return list, nil
+}
+
+func (r *MemoryRepo) LatestBuild(antarianId string) (lib.Build, bool, error) {
+	r.buildMu.Lock()
+	defer r.buildMu.Unlock()
+	var latest lib.Build
+	found := false
+	for _, id := range r.byAntarian[antarianId] {
+		if b := r.builds[id]; !found || b.Start.After(latest.Start) {
+			latest, found = b, true
+		}
+	}
+	return latest, found, nil
+}
+
+func (r *MemoryRepo) PruneBuilds(cutoff time.Time) (int, error) {
+	r.buildMu.Lock()
+	defer r.buildMu.Unlock()
+	pruned := 0
+	for id, b := range r.builds {
+		if !b.State.Done() || !b.End.Before(cutoff) {
+			continue
+		}
+		delete(r.builds, id)
+		ids := r.byAntarian[b.AntarianId]
+		for i, bid := range ids {
+			if bid == id {
+				ids = append(ids[:i], ids[i+1:]...)
+				break
+			}
+		}
+		if len(ids) == 0 {
+			delete(r.byAntarian, b.AntarianId)
+		} else {
+			r.byAntarian[b.AntarianId] = ids
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+func (r *MemoryRepo) AppendAudit(e lib.AuditEntry) error {
+	r.auditMu.Lock()
+	defer r.auditMu.Unlock()
+	r.audit = append(r.audit, e)
+	return nil
+}
+
+func (r *MemoryRepo) ListAudit(q AuditQuery) ([]lib.AuditEntry, error) {
+	r.auditMu.Lock()
+	defer r.auditMu.Unlock()
+	list := []lib.AuditEntry{}
+	for _, e := range r.audit {
+		if q.Match(e) {
+			list = append(list, e)
+		}
+	}
+	return list, nil
+}
+
+func (r *MemoryRepo) CreateWebhook(h lib.Webhook) error {
+	r.webhookMu.Lock()
+	defer r.webhookMu.Unlock()
+	h.Events = append([]string(nil), h.Events...)
+	r.webhooks = append(r.webhooks, h)
+	return nil
+}
+
+func (r *MemoryRepo) ListWebhooks() ([]lib.Webhook, error) {
+	r.webhookMu.Lock()
+	defer r.webhookMu.Unlock()
+	return append([]lib.Webhook{}, r.webhooks...), nil
 }
 
-func RepoDestroyAntarian(id string) error {
-	for i, s := range antarians {
+func (r *MemoryRepo) FindWebhook(id string) (lib.Webhook, error) {
+	r.webhookMu.Lock()
+	defer r.webhookMu.Unlock()
+	for _, h := range r.webhooks {
+		if h.Id == id {
+			return h, nil
+		}
+	}
+	return lib.Webhook{}, ErrNotFound
+}
+
+func (r *MemoryRepo) DestroyWebhook(id string) error {
+	r.webhookMu.Lock()
+	defer r.webhookMu.Unlock()
+	for i, h := range r.webhooks {
+		if h.Id == id {
+			r.webhooks = append(r.webhooks[:i], r.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryRepo) CreateSchedule(s lib.Schedule) error {
+	r.scheduleMu.Lock()
+	defer r.scheduleMu.Unlock()
+	r.schedules = append(r.schedules, s)
+	return nil
+}
+
+func (r *MemoryRepo) ListSchedules() ([]lib.Schedule, error) {
+	r.scheduleMu.Lock()
+	defer r.scheduleMu.Unlock()
+	return append([]lib.Schedule{}, r.schedules...), nil
+}
+
+func (r *MemoryRepo) FindSchedule(id string) (lib.Schedule, error) {
+	r.scheduleMu.Lock()
+	defer r.scheduleMu.Unlock()
+	for _, s := range r.schedules {
+		if s.Id == id {
+			return s, nil
+		}
+	}
+	return lib.Schedule{}, ErrNotFound
+}
+
+func (r *MemoryRepo) UpdateSchedule(s lib.Schedule) error {
+	r.scheduleMu.Lock()
+	defer r.scheduleMu.Unlock()
+	for i := range r.schedules {
+		if r.schedules[i].Id == s.Id {
+			r.schedules[i] = s
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryRepo) DestroySchedule(id string) error {
+	r.scheduleMu.Lock()
+	defer r.scheduleMu.Unlock()
+	for i, s := range r.schedules {
 		if s.Id == id {
-			antarians = append(antarians[:i], antarians[i+1:]...)
+			r.schedules = append(r.schedules[:i], r.schedules[i+1:]...)
 			return nil
 		}
 	}
-	return fmt.Errorf("Could not find Antarian with id of %s to delete", id)
+	return ErrNotFound
 }
+
+var _ Repository = (*MemoryRepo)(nil)
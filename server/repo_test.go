@@ -0,0 +1,79 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// repos returns an empty instance of each Repository that runs without an
+// external service, and of PostgresRepo when ANTARES_TEST_POSTGRES_DSN
+// names a database the tests may wipe.
+func repos(t *testing.T) map[string]Repository {
+	t.Helper()
+	bolt, err := NewBoltRepo(filepath.Join(t.TempDir(), "antares.db"), testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+	list := map[string]Repository{
+		"memory": NewMemoryRepo(testLogger()),
+		"bolt":   bolt,
+	}
+	if dsn := os.Getenv("ANTARES_TEST_POSTGRES_DSN"); dsn != "" {
+		pg, err := NewPostgresRepo(config.Postgres{DSN: dsn}, testLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pg.Close() })
+		list["postgres"] = pg
+	}
+	return list
+}
+
+func TestCreateAntarianConflict(t *testing.T) {
+	tests := []struct {
+		name    string
+		second  lib.Antarian
+		wantErr error
+	}{
+		{"same name and version", lib.Antarian{Name: "libfoo", Version: "1.0.0"}, ErrConflict},
+		{"same in the default namespace", lib.Antarian{Name: "libfoo", Version: "1.0.0", Namespace: lib.DefaultNamespace}, ErrConflict},
+		{"another version", lib.Antarian{Name: "libfoo", Version: "2.0.0"}, nil},
+		{"another name", lib.Antarian{Name: "libbar", Version: "1.0.0"}, nil},
+		{"another namespace", lib.Antarian{Name: "libfoo", Version: "1.0.0", Namespace: "team"}, nil},
+	}
+	for name, repo := range repos(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				repo.Purge()
+				if _, err := repo.CreateAntarian(lib.Antarian{Name: "libfoo", Version: "1.0.0"}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := repo.CreateAntarian(tt.second); err != tt.wantErr {
+					t.Fatalf("second CreateAntarian error = %v, want %v", err, tt.wantErr)
+				}
+				list, err := repo.ListAntarians()
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := 2
+				if tt.wantErr != nil {
+					want = 1
+				}
+				if len(list) != want {
+					t.Errorf("stored %d Antarians, want %d", len(list), want)
+				}
+			})
+		}
+	}
+}
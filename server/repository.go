@@ -0,0 +1,210 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+var (
+	// ErrNotFound is returned when no Antarian has the requested id.
+	ErrNotFound = errors.New("antarian not found")
+	// ErrConflict is returned when a change would give an Antarian the name
+	// and version of another one in the same namespace.
+	ErrConflict = errors.New("antarian name and version already exist")
+)
+
+// Repository stores Antarians, their build records and the audit log. The
+// handlers only talk to this interface, so a backend is chosen by passing a
+// different implementation in Deps.
+type Repository interface {
+	ListAntarians() (lib.Antarians, error)
+	// EachAntarian calls fn for every Antarian in turn, stopping at the
+	// first error, which it returns. Implementations must not load the
+	// whole collection at once.
+	EachAntarian(fn func(lib.Antarian) error) error
+	// FindAntarian returns ErrNotFound when id does not exist.
+	FindAntarian(id string) (lib.Antarian, error)
+	// AntariansNamed returns every version of the Antarian called name.
+	AntariansNamed(name string) (lib.Antarians, error)
+	// NameSummaries returns one summary per distinct name starting with
+	// prefix, sorted by name, counting only the Antarians labels selects.
+	NameSummaries(prefix string, labels lib.LabelSelector) ([]NameSummary, error)
+	// CreateAntarian stores s under a new id and returns it. It returns
+	// ErrConflict when s has the name and version of another Antarian in
+	// its namespace.
+	CreateAntarian(s lib.Antarian) (lib.Antarian, error)
+	// UpdateAntarian replaces the Antarian with the same id as s. It
+	// returns ErrNotFound or ErrConflict.
+	UpdateAntarian(s lib.Antarian) (lib.Antarian, error)
+	// DestroyAntarian returns ErrNotFound when id does not exist.
+	DestroyAntarian(id string) error
+	// Purge removes every Antarian and build record in one step, returning
+	// how many of each were removed. The audit log is kept.
+	Purge() (antarians, builds int, err error)
+
+	// SaveBuild and FindBuild persist the records of the build engine.
+	build.Store
+	// ListBuilds returns the builds of one Antarian, or all builds when
+	// antarianId is empty, newest first.
+	ListBuilds(antarianId string) ([]lib.Build, error)
+	// LatestBuild returns the most recently started build of an Antarian.
+	LatestBuild(antarianId string) (lib.Build, bool, error)
+	// PruneBuilds removes finished builds that ended before cutoff and
+	// returns how many were removed.
+	PruneBuilds(cutoff time.Time) (int, error)
+
+	// CreateWebhook stores h, which has its id already. Webhooks are kept
+	// by Purge.
+	CreateWebhook(h lib.Webhook) error
+	// ListWebhooks returns every webhook, oldest first.
+	ListWebhooks() ([]lib.Webhook, error)
+	// FindWebhook returns ErrNotFound when id does not exist.
+	FindWebhook(id string) (lib.Webhook, error)
+	// DestroyWebhook returns ErrNotFound when id does not exist.
+	DestroyWebhook(id string) error
+
+	// CreateSchedule stores s, which has its id already. Schedules are
+	// kept by Purge.
+	CreateSchedule(s lib.Schedule) error
+	// ListSchedules returns every schedule, oldest first.
+	ListSchedules() ([]lib.Schedule, error)
+	// FindSchedule returns ErrNotFound when id does not exist.
+	FindSchedule(id string) (lib.Schedule, error)
+	// UpdateSchedule replaces the schedule with the same id as s. It
+	// returns ErrNotFound when there is none.
+	UpdateSchedule(s lib.Schedule) error
+	// DestroySchedule returns ErrNotFound when id does not exist.
+	DestroySchedule(id string) error
+
+	// AppendAudit records e. Entries cannot be changed or removed once
+	// written.
+	AppendAudit(e lib.AuditEntry) error
+	// ListAudit returns the entries matching q, oldest first.
+	ListAudit(q AuditQuery) ([]lib.AuditEntry, error)
+}
+
+// seed gives an empty repository the AntarianMain record describing this
+// server. A persistent repository keeps the record across restarts, so if
+// the server has since moved its Uri is brought up to date instead.
+func seed(repo Repository, cfg *config.Config) error {
+	empty := true
+	err := repo.EachAntarian(func(lib.Antarian) error {
+		empty = false
+		return errStop
+	})
+	if err != nil && err != errStop {
+		return err
+	}
+	if empty {
+		_, err = repo.CreateAntarian(lib.Antarian{Name: seedName, Uri: cfg.BaseURL(), Status: lib.StatusPending, Start: time.Now()})
+		return err
+	}
+	main, err := repo.AntariansNamed(seedName)
+	if err != nil {
+		return err
+	}
+	for _, a := range main {
+		if a.Uri == cfg.BaseURL() {
+			continue
+		}
+		a.Uri = cfg.BaseURL()
+		if _, err := repo.UpdateAntarian(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedName names the record seed creates.
+const seedName = "AntarianMain"
+
+// errStop ends an EachAntarian walk early.
+var errStop = errors.New("stop")
+
+// NameSummary describes all versions of one Antarian name.
+type NameSummary struct {
+	Name          string    `json:"name"`
+	Versions      int       `json:"versions"`
+	LatestVersion string    `json:"latest_version"`
+	LatestId      string    `json:"latest_id"`
+	NewestStart   time.Time `json:"newest_start"`
+	Running       int       `json:"running"`
+}
+
+// summarizer builds NameSummaries in a single pass. The latest version is
+// the newest release, or the newest prerelease if there is none.
+type summarizer struct {
+	prefix string
+	labels lib.LabelSelector
+	byName map[string]*NameSummary
+	latest map[string]lib.Antarian
+}
+
+func newSummarizer(prefix string, labels lib.LabelSelector) *summarizer {
+	return &summarizer{prefix: prefix, labels: labels, byName: map[string]*NameSummary{}, latest: map[string]lib.Antarian{}}
+}
+
+func (z *summarizer) add(s lib.Antarian) {
+	if !strings.HasPrefix(s.Name, z.prefix) || !z.labels.Matches(s.Labels) {
+		return
+	}
+	sum, ok := z.byName[s.Name]
+	if !ok {
+		sum = &NameSummary{Name: s.Name}
+		z.byName[s.Name] = sum
+	}
+	sum.Versions++
+	if s.Running {
+		sum.Running++
+	}
+	if s.Start.After(sum.NewestStart) {
+		sum.NewestStart = s.Start
+	}
+	if l, ok := z.latest[s.Name]; !ok || newerRelease(s, l) {
+		z.latest[s.Name] = s
+	}
+}
+
+func (z *summarizer) result() []NameSummary {
+	list := make([]NameSummary, 0, len(z.byName))
+	for name, sum := range z.byName {
+		sum.LatestVersion = z.latest[name].Version
+		sum.LatestId = z.latest[name].Id
+		list = append(list, *sum)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// AuditQuery selects audit entries. Zero fields match everything.
+type AuditQuery struct {
+	Since  time.Time
+	Until  time.Time
+	Action string
+	Actor  string
+	// Resource matches entries about the Antarian or build with this id.
+	Resource string
+}
+
+// Match reports whether e is selected by q.
+func (q AuditQuery) Match(e lib.AuditEntry) bool {
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Time.Before(q.Until) {
+		return false
+	}
+	if q.Actor != "" && e.Actor != q.Actor {
+		return false
+	}
+	if q.Resource != "" && e.AntarianId != q.Resource && e.BuildId != q.Resource {
+		return false
+	}
+	return q.Action == "" || e.Action == q.Action
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// buildGraph orders a and the Antarians it requires, directly or through
+// others, for Engine.StartGraph: each after the ones it requires, a last.
+// An Antarian required along several paths is built once. It fails with a
+// *lib.ValidationError when a requirement matches no Antarian or the
+// requirements form a cycle.
+func buildGraph(d *Deps, ctx context.Context, a lib.Antarian) ([]build.Node, error) {
+	var nodes []build.Node
+	// index holds the node of each Antarian added, by id
+	index := map[string]int{}
+	// path holds the Antarians being visited, outermost first
+	var path []lib.Antarian
+	var visit func(a lib.Antarian) (int, error)
+	visit = func(a lib.Antarian) (int, error) {
+		if i, ok := index[a.Id]; ok {
+			return i, nil
+		}
+		for i, p := range path {
+			if p.Id == a.Id {
+				names := []string{}
+				for _, p := range path[i:] {
+					names = append(names, p.Name)
+				}
+				return 0, &lib.ValidationError{Field: "requires", Message: "requirements form a cycle: " + strings.Join(append(names, a.Name), " -> ")}
+			}
+		}
+		path = append(path, a)
+		defer func() { path = path[:len(path)-1] }()
+
+		var requires []int
+		for _, req := range a.Requires {
+			dep, ok, err := resolveRequire(d, ctx, req)
+			if v, invalid := err.(*lib.ValidationError); invalid {
+				return 0, &lib.ValidationError{Field: "requires", Message: fmt.Sprintf("%s requires %q: %s", a.Name, req, v.Message)}
+			}
+			if err != nil {
+				return 0, err
+			}
+			if !ok {
+				return 0, &lib.ValidationError{Field: "requires", Message: fmt.Sprintf("%s requires %q, which matches no Antarian", a.Name, req)}
+			}
+			k, err := visit(dep)
+			if err != nil {
+				return 0, err
+			}
+			if !containsInt(requires, k) {
+				requires = append(requires, k)
+			}
+		}
+		nodes = append(nodes, build.Node{Antarian: a, Requires: requires})
+		index[a.Id] = len(nodes) - 1
+		return len(nodes) - 1, nil
+	}
+	if _, err := visit(a); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// pruneBuilds drops finished build records older than retention from repo
+// once an hour until ctx is done. It returns immediately when retention is
+// zero.
+func pruneBuilds(ctx context.Context, repo Repository, retention time.Duration, log *slog.Logger) {
+	if retention <= 0 {
+		return
+	}
+	tick := time.NewTicker(time.Hour)
+	defer tick.Stop()
+	for {
+		n, err := repo.PruneBuilds(time.Now().Add(-retention))
+		if err != nil {
+			log.Error("prune build records", "err", err)
+		} else if n > 0 {
+			log.Info("pruned build records", "count", n, "retention", retention)
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -1,25 +1,87 @@
 package server
 
 import (
-	"github.com/gorilla/mux"
+	"crypto"
+	"log/slog"
 	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/storage"
 )
 
-func NewRouter() *mux.Router {
+// Deps are the dependencies shared by the handlers.
+type Deps struct {
+	Config  *config.Config
+	Repo    Repository
+	Logger  *slog.Logger
+	Storage storage.Storage
+	Builds  *build.Engine
+	// Search answers /antarians/search. It must see every change to Repo.
+	Search *SearchIndex
+	// Events receives every change to Repo, for /ws and /events.
+	Events *EventHub
+	// Metrics instruments every route and is served at /metrics. Nil
+	// disables both.
+	Metrics *Metrics
+	// Auth authenticates requests to every route that is not Public. Nil
+	// leaves the API open.
+	Auth Middleware
+	// Middleware is applied to every route, inside logging and outside auth.
+	Middleware []Middleware
+
+	// verifiers check bearer tokens that are JWTs, in order; with none
+	// only static tokens are accepted.
+	verifiers []tokenVerifier
+	// signingKeys check the signatures of artifacts.
+	signingKeys []crypto.PublicKey
+	// limiter throttles the RateLimited routes; nil disables it.
+	limiter *rateLimiter
+	// webhooks delivers Events to the registered webhooks.
+	webhooks *webhookDispatcher
+	// schedules queues the builds of the schedules as they fall due.
+	schedules *scheduler
+}
+
+// NewRouter returns a router serving routes. Pass VersionedRoutes(d) for
+// the standard API, or DefaultRoutes(d) for it without a version prefix,
+// append to it, or pick a subset. The result is a plain
+// *mux.Router: more routes can be added with RegisterRoute and router-wide
+// middleware with its Use method, and it can be mounted under another mux.
+func NewRouter(d *Deps, routes Routes) *mux.Router {
 
 	router := mux.NewRouter().StrictSlash(true)
 	for _, route := range routes {
-		var handler http.Handler
+		RegisterRoute(router, d, route)
+	}
+	// unmatched requests are logged like any other
+	router.NotFoundHandler = Chain(errorHandler(d, http.StatusNotFound),
+		stack(d, Route{Name: "NotFound", Public: true})...)
+	router.MethodNotAllowedHandler = Chain(errorHandler(d, http.StatusMethodNotAllowed),
+		stack(d, Route{Name: "MethodNotAllowed", Public: true})...)
 
-		handler = route.HandlerFunc
-		handler = Logger(handler, route.Name)
+	return router
+}
 
-		router.
-			Methods(route.Method).
-			Path(route.Pattern).
-			Name(route.Name).
-			Handler(handler)
+// errorHandler answers every request with status and its standard text.
+func errorHandler(d *Deps, status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeError(d, w, r, status, http.StatusText(status))
 	}
+}
 
-	return router
+// RegisterRoute adds route to router wrapped in the same middleware stack as
+// the routes passed to NewRouter.
+func RegisterRoute(router *mux.Router, d *Deps, route Route) *mux.Route {
+	var handler http.Handler
+
+	handler = route.HandlerFunc
+	handler = Chain(handler, stack(d, route)...)
+
+	return router.
+		Methods(route.Method).
+		Path(route.Pattern).
+		Name(route.Name).
+		Handler(handler)
 }
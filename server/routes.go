@@ -1,51 +1,558 @@
 package server
 
-import "net/http"
+import (
+	"expvar"
+	"net/http"
+)
 
 type Route struct {
 	Name        string
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
+	// Middleware wraps this route only, inside the global stack.
+	Middleware []Middleware
+	// Public routes skip authentication.
+	Public bool
+	// Permission is what the caller's roles must grant to use the route.
+	// Empty requires nothing beyond authentication.
+	Permission Permission
+	// Namespaced routes act on the Antarians of one namespace: the one in
+	// their {namespace} path variable, or lib.DefaultNamespace.
+	Namespaced bool
+	// RateLimited routes count against the caller's rate limit, when
+	// rate_limit is configured.
+	RateLimited bool
+	// Signed routes also admit requests carrying a valid download
+	// signature in place of a token.
+	Signed bool
+	// Deprecated marks a legacy alias and names the prefix of the API
+	// version that replaces it, e.g. "/v1".
+	Deprecated string
+	// Successor marks a route moved to another path within its version and
+	// is the pattern of the route replacing it, sharing its variables.
+	// Such routes are answered as Deprecated ones and not documented.
+	Successor string
 }
 
 type Routes []Route
 
-var routes = Routes{
-	Route{
-		"Index",
-		"GET",
-		"/",
-		Index,
-	},
-	Route{
-		"AntarianIndex",
-		"GET",
-		"/antarians",
-		AntarianIndex,
-	},
-	Route{
-		"AntarianShow",
-		"GET",
-		"/antarians/{antarianId}",
-		AntarianShow,
-	},
-    Route{
-		"AntarianBuild",
-		"GET",
-		"/antarians/{antarianId}/build",
-		AntarianBuild,
-	},
-	Route{
-		"AntarianDownload",
-		"GET",
-		"/antarians/{antarianId}/download",
-		AntarianDownload,
-	},
-	Route{
-		"AntarianCreate",
-		"POST",
-		"/antarians",
-		AntarianCreate,
-	},
+// CurrentAPI is the path prefix of the newest API version.
+const CurrentAPI = "/v1"
+
+// VersionedRoutes returns every version of the API side by side, each
+// under its own prefix, together with the original unprefixed paths as
+// deprecated aliases of v1, the unversioned FileRoutes and ProbeRoutes and
+// the DocRoutes describing them all. A new version is added by appending
+// its routes with Prefixed; versions may share handlers. Each version
+// serves its Namespaced routes both as they are, for the default namespace,
+// and under /namespaces/{namespace}.
+func VersionedRoutes(d *Deps) Routes {
+	v1 := DefaultRoutes(d)
+	// aliases first, so mux's named route lookup finds the v1 route
+	routes := Deprecated(CurrentAPI, v1)
+	routes = append(routes, Prefixed("/v1", Namespaced(v1))...)
+	routes = append(routes, Prefixed("/v1", v1)...)
+	routes = append(routes, FileRoutes(d)...)
+	routes = append(routes, ProbeRoutes(d)...)
+	return append(routes, DocRoutes(d, routes)...)
+}
+
+// FileRoutes returns the routes serving artifacts. They are not
+// versioned, as download links point at them.
+func FileRoutes(d *Deps) Routes {
+	return Routes{
+		Route{
+			Name:        "ArtifactFile",
+			Method:      "GET",
+			Pattern:     "/files/{antarianId}/{filename}",
+			HandlerFunc: ArtifactFile(d),
+			Permission:  PermissionRead,
+			Signed:      true,
+		},
+		Route{
+			Name:        "ArtifactFileHead",
+			Method:      "HEAD",
+			Pattern:     "/files/{antarianId}/{filename}",
+			HandlerFunc: ArtifactFile(d),
+			Permission:  PermissionRead,
+			Signed:      true,
+		},
+	}
+}
+
+// ProbeRoutes returns the health endpoints and, when d.Metrics is set, the
+// metrics endpoint. They are not versioned and need no authentication, so
+// orchestrators and scrapers can always reach them.
+func ProbeRoutes(d *Deps) Routes {
+	routes := Routes{
+		Route{
+			Name:        "Healthz",
+			Method:      "GET",
+			Pattern:     "/healthz",
+			HandlerFunc: Healthz(d),
+			Public:      true,
+		},
+		Route{
+			Name:        "Readyz",
+			Method:      "GET",
+			Pattern:     "/readyz",
+			HandlerFunc: Readyz(d),
+			Public:      true,
+		},
+	}
+	if d.Metrics != nil {
+		routes = append(routes, Route{
+			Name:        "Metrics",
+			Method:      "GET",
+			Pattern:     "/metrics",
+			HandlerFunc: d.Metrics.Handler().ServeHTTP,
+			Public:      true,
+		})
+	}
+	return routes
+}
+
+// Prefixed returns a copy of routes with prefix prepended to each pattern.
+func Prefixed(prefix string, routes Routes) Routes {
+	out := make(Routes, len(routes))
+	for i, route := range routes {
+		route.Pattern = prefix + route.Pattern
+		if route.Successor != "" {
+			route.Successor = prefix + route.Successor
+		}
+		out[i] = route
+	}
+	return out
+}
+
+// Deprecated returns a copy of routes marked as superseded by the same
+// paths under successor.
+func Deprecated(successor string, routes Routes) Routes {
+	out := make(Routes, len(routes))
+	for i, route := range routes {
+		route.Deprecated = successor
+		out[i] = route
+	}
+	return out
+}
+
+// DefaultRoutes returns the standard Antares API bound to d.
+func DefaultRoutes(d *Deps) Routes {
+	return Routes{
+		Route{
+			Name:        "Index",
+			Method:      "GET",
+			Pattern:     "/",
+			HandlerFunc: Index(d),
+			Permission:  PermissionRead,
+		},
+		Route{
+			Name:        "AntarianIndex",
+			Method:      "GET",
+			Pattern:     "/antarians",
+			HandlerFunc: AntarianIndex(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianStream",
+			Method:      "GET",
+			Pattern:     "/antarians/stream",
+			HandlerFunc: AntarianStream(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianNames",
+			Method:      "GET",
+			Pattern:     "/antarians/names",
+			HandlerFunc: AntarianNames(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianSearch",
+			Method:      "GET",
+			Pattern:     "/antarians/search",
+			HandlerFunc: AntarianSearch(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianLatest",
+			Method:      "GET",
+			Pattern:     "/antarians/name/{name}/latest",
+			HandlerFunc: AntarianLatest(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianLatestByName",
+			Method:      "GET",
+			Pattern:     "/antarians/byname/{name}/latest",
+			HandlerFunc: AntarianLatest(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+			Successor:   "/antarians/name/{name}/latest",
+		},
+		Route{
+			Name:        "AntarianVersions",
+			Method:      "GET",
+			Pattern:     "/antarians/byname/{name}",
+			HandlerFunc: AntarianVersions(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianVersion",
+			Method:      "GET",
+			Pattern:     "/antarians/byname/{name}/{version}",
+			HandlerFunc: AntarianVersion(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianShow",
+			Method:      "GET",
+			Pattern:     "/antarians/{antarianId}",
+			HandlerFunc: AntarianShow(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianBuild",
+			Method:      "GET",
+			Pattern:     "/antarians/{antarianId}/build",
+			HandlerFunc: AntarianBuild(d),
+			Permission:  PermissionWrite,
+			Namespaced:  true,
+			RateLimited: true,
+		},
+		Route{
+			Name:        "BuildCreate",
+			Method:      "POST",
+			Pattern:     "/antarians/{antarianId}/build",
+			HandlerFunc: BuildCreate(d),
+			Permission:  PermissionWrite,
+			Namespaced:  true,
+			RateLimited: true,
+		},
+		Route{
+			Name:        "AntarianArtifactUpload",
+			Method:      "POST",
+			Pattern:     "/antarians/{antarianId}/artifact",
+			HandlerFunc: AntarianArtifactUpload(d),
+			Permission:  PermissionWrite,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianArtifactVerify",
+			Method:      "GET",
+			Pattern:     "/antarians/{antarianId}/artifact/verify",
+			HandlerFunc: AntarianArtifactVerify(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+			RateLimited: true,
+		},
+		Route{
+			Name:        "AntarianSBOM",
+			Method:      "GET",
+			Pattern:     "/antarians/{antarianId}/sbom",
+			HandlerFunc: AntarianSBOM(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianSignatureVerify",
+			Method:      "GET",
+			Pattern:     "/antarians/{antarianId}/artifact/signature",
+			HandlerFunc: AntarianSignatureVerify(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+			RateLimited: true,
+		},
+		Route{
+			Name:        "AntarianBuildEvents",
+			Method:      "GET",
+			Pattern:     "/antarians/{antarianId}/build/events",
+			HandlerFunc: AntarianBuildEvents(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "BuildShow",
+			Method:      "GET",
+			Pattern:     "/builds/{buildId}",
+			HandlerFunc: BuildShow(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "BuildCancel",
+			Method:      "DELETE",
+			Pattern:     "/builds/{buildId}",
+			HandlerFunc: BuildCancel(d),
+			Permission:  PermissionWrite,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "BuildLogs",
+			Method:      "GET",
+			Pattern:     "/builds/{buildId}/logs",
+			HandlerFunc: BuildLogs(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianBuilds",
+			Method:      "GET",
+			Pattern:     "/antarians/{antarianId}/builds",
+			HandlerFunc: AntarianBuilds(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianDeps",
+			Method:      "GET",
+			Pattern:     "/antarians/{antarianId}/deps",
+			HandlerFunc: AntarianDeps(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "BuildIndex",
+			Method:      "GET",
+			Pattern:     "/builds",
+			HandlerFunc: BuildIndex(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianDownload",
+			Method:      "GET",
+			Pattern:     "/antarians/{antarianId}/download",
+			HandlerFunc: AntarianDownload(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "DebugVars",
+			Method:      "GET",
+			Pattern:     "/debug/vars",
+			HandlerFunc: expvar.Handler().ServeHTTP,
+			Permission:  PermissionRead,
+		},
+		Route{
+			Name:        "AuditIndex",
+			Method:      "GET",
+			Pattern:     "/admin/audit",
+			HandlerFunc: AuditIndex(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "AntarianUpdate",
+			Method:      "PUT",
+			Pattern:     "/antarians/{antarianId}",
+			HandlerFunc: AntarianUpdate(d),
+			Permission:  PermissionWrite,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianPatch",
+			Method:      "PATCH",
+			Pattern:     "/antarians/{antarianId}",
+			HandlerFunc: AntarianPatch(d),
+			Permission:  PermissionWrite,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AntarianDelete",
+			Method:      "DELETE",
+			Pattern:     "/antarians/{antarianId}",
+			HandlerFunc: AntarianDelete(d),
+			Permission:  PermissionWrite,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "AdminPurge",
+			Method:      "DELETE",
+			Pattern:     "/admin/antarians",
+			HandlerFunc: AdminPurge(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "AdminGC",
+			Method:      "POST",
+			Pattern:     "/admin/gc",
+			HandlerFunc: AdminGC(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "WebhookIndex",
+			Method:      "GET",
+			Pattern:     "/webhooks",
+			HandlerFunc: WebhookIndex(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "WebhookCreate",
+			Method:      "POST",
+			Pattern:     "/webhooks",
+			HandlerFunc: WebhookCreate(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "WebhookShow",
+			Method:      "GET",
+			Pattern:     "/webhooks/{webhookId}",
+			HandlerFunc: WebhookShow(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "WebhookDelete",
+			Method:      "DELETE",
+			Pattern:     "/webhooks/{webhookId}",
+			HandlerFunc: WebhookDelete(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "WebhookDeliveries",
+			Method:      "GET",
+			Pattern:     "/webhooks/{webhookId}/deliveries",
+			HandlerFunc: WebhookDeliveries(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "AgentRegister",
+			Method:      "POST",
+			Pattern:     "/agents",
+			HandlerFunc: AgentRegister(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "AgentIndex",
+			Method:      "GET",
+			Pattern:     "/agents",
+			HandlerFunc: AgentIndex(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "AgentHeartbeat",
+			Method:      "POST",
+			Pattern:     "/agents/{agentId}/heartbeat",
+			HandlerFunc: AgentHeartbeat(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "AgentLease",
+			Method:      "POST",
+			Pattern:     "/agents/{agentId}/lease",
+			HandlerFunc: AgentLease(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "AgentBuildLogs",
+			Method:      "POST",
+			Pattern:     "/agents/{agentId}/builds/{buildId}/logs",
+			HandlerFunc: AgentBuildLogs(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "AgentBuildArtifact",
+			Method:      "POST",
+			Pattern:     "/agents/{agentId}/builds/{buildId}/artifacts",
+			HandlerFunc: AgentBuildArtifact(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "AgentBuildReport",
+			Method:      "PUT",
+			Pattern:     "/agents/{agentId}/builds/{buildId}",
+			HandlerFunc: AgentBuildReport(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "ScheduleIndex",
+			Method:      "GET",
+			Pattern:     "/schedules",
+			HandlerFunc: ScheduleIndex(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "ScheduleCreate",
+			Method:      "POST",
+			Pattern:     "/schedules",
+			HandlerFunc: ScheduleCreate(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "ScheduleShow",
+			Method:      "GET",
+			Pattern:     "/schedules/{scheduleId}",
+			HandlerFunc: ScheduleShow(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "ScheduleUpdate",
+			Method:      "PUT",
+			Pattern:     "/schedules/{scheduleId}",
+			HandlerFunc: ScheduleUpdate(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "ScheduleDelete",
+			Method:      "DELETE",
+			Pattern:     "/schedules/{scheduleId}",
+			HandlerFunc: ScheduleDelete(d),
+			Permission:  PermissionAdmin,
+		},
+		Route{
+			Name:        "GitHook",
+			Method:      "POST",
+			Pattern:     "/hooks/git",
+			HandlerFunc: GitHook(d),
+			Public:      true,
+		},
+		Route{
+			Name:        "GraphQLQuery",
+			Method:      "GET",
+			Pattern:     "/graphql",
+			HandlerFunc: GraphQL(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "GraphQL",
+			Method:      "POST",
+			Pattern:     "/graphql",
+			HandlerFunc: GraphQL(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "EventStream",
+			Method:      "GET",
+			Pattern:     "/events",
+			HandlerFunc: EventStream(d),
+			Permission:  PermissionRead,
+			Namespaced:  true,
+		},
+		Route{
+			Name:        "Websocket",
+			Method:      "GET",
+			Pattern:     "/ws",
+			HandlerFunc: Websocket(d),
+			Permission:  PermissionRead,
+		},
+		Route{
+			Name:        "AntarianCreate",
+			Method:      "POST",
+			Pattern:     "/antarians",
+			HandlerFunc: AntarianCreate(d),
+			Permission:  PermissionWrite,
+			Namespaced:  true,
+			RateLimited: true,
+		},
+	}
 }
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+var patternVar = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// examplePath fills in the variables of a route pattern.
+func examplePath(pattern string) string {
+	return patternVar.ReplaceAllStringFunc(pattern, func(v string) string {
+		if v == "{namespace}" {
+			return "team"
+		}
+		return "x1"
+	})
+}
+
+func TestEveryRouteDocumented(t *testing.T) {
+	s, _ := newTestServer(t)
+	// the documentation does not describe itself
+	docs := map[string]bool{}
+	for _, route := range DocRoutes(s.Deps(), nil) {
+		docs[route.Name] = true
+	}
+	named := map[string]bool{}
+	for _, route := range VersionedRoutes(s.Deps()) {
+		named[route.Name] = true
+		// moved routes are documented under their successor
+		if docs[route.Name] || route.Successor != "" {
+			continue
+		}
+		if _, ok := apiDocs[route.Name]; !ok {
+			t.Errorf("route %s (%s %s) has no apiDocs entry", route.Name, route.Method, route.Pattern)
+		}
+	}
+	for name := range apiDocs {
+		if !named[name] {
+			t.Errorf("apiDocs entry %s has no route", name)
+		}
+	}
+}
+
+func TestEveryPathRouted(t *testing.T) {
+	s, _ := newTestServer(t)
+	routes := VersionedRoutes(s.Deps())
+	router := NewRouter(s.Deps(), routes)
+	for _, route := range routes {
+		path := examplePath(route.Pattern)
+		req := httptest.NewRequest(route.Method, path, nil)
+		var match mux.RouteMatch
+		if !router.Match(req, &match) || match.Route == nil {
+			t.Errorf("%s %s is not routed", route.Method, path)
+			continue
+		}
+		if got := match.Route.GetName(); got != route.Name {
+			t.Errorf("%s %s is routed to %s, want %s", route.Method, path, got, route.Name)
+		}
+	}
+}
+
+func TestRouterSubset(t *testing.T) {
+	log, _ := newCapture()
+	d := newDeps(log)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	router := NewRouter(d, Routes{{Name: "Healthz", Method: "GET", Pattern: "/healthz", HandlerFunc: ok, Public: true}})
+	// an extension registered afterwards gets the same middleware
+	RegisterRoute(router, d, Route{Name: "Extra", Method: "POST", Pattern: "/extra", HandlerFunc: ok, Public: true})
+
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/healthz", http.StatusNoContent},
+		{"POST", "/extra", http.StatusNoContent},
+		{"GET", "/extra", http.StatusMethodNotAllowed},
+		{"GET", "/v1/antarians", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.status)
+		}
+		if w.Header().Get("X-Request-Id") == "" {
+			t.Errorf("%s %s missed the middleware stack", tt.method, tt.path)
+		}
+	}
+
+	// the router mounts under another mux
+	outer := http.NewServeMux()
+	outer.Handle("/", router)
+	w := httptest.NewRecorder()
+	outer.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("mounted GET /healthz = %d, want 204", w.Code)
+	}
+}
+
+func TestMovedRoute(t *testing.T) {
+	_, ts := newTestServer(t)
+	if status := call(t, ts, "POST", "/v1/antarians", map[string]string{"name": "libfoo", "version": "1.0.0"}, nil); status != http.StatusCreated {
+		t.Fatalf("create = %d", status)
+	}
+	tests := []struct {
+		path      string
+		successor string
+	}{
+		{"/v1/antarians/byname/libfoo/latest", "/v1/antarians/name/libfoo/latest"},
+		{"/antarians/byname/libfoo/latest", "/v1/antarians/name/libfoo/latest"},
+		{"/v1/namespaces/default/antarians/byname/libfoo/latest", "/v1/namespaces/default/antarians/name/libfoo/latest"},
+	}
+	for _, tt := range tests {
+		resp, err := ts.Client().Get(ts.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s = %d", tt.path, resp.StatusCode)
+		}
+		link := `<` + tt.successor + `>; rel="successor-version"`
+		if resp.Header.Get("Deprecation") != "true" || resp.Header.Get("Link") != link {
+			t.Errorf("GET %s Deprecation %q Link %q, want %s", tt.path, resp.Header.Get("Deprecation"), resp.Header.Get("Link"), link)
+		}
+	}
+
+	// the successor is current, and the only one described
+	resp, err := ts.Client().Get(ts.URL + "/v1/antarians/name/libfoo/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Deprecation") != "" {
+		t.Errorf("GET the successor = %d, Deprecation %q", resp.StatusCode, resp.Header.Get("Deprecation"))
+	}
+	var spec struct {
+		Paths map[string]interface{} `json:"paths"`
+	}
+	call(t, ts, "GET", "/openapi.json", nil, &spec)
+	if _, ok := spec.Paths["/v1/antarians/byname/{name}/latest"]; ok {
+		t.Error("the moved route is described")
+	}
+	if _, ok := spec.Paths["/v1/antarians/name/{name}/latest"]; !ok {
+		t.Error("the successor is not described")
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/storage"
+)
+
+// makeSBOM returns the SBOM of build b of a: its requires resolved
+// transitively, in a's namespace, as they are now, and the environment
+// it ran in.
+func makeSBOM(d *Deps, a lib.Antarian, b lib.Build) ([]byte, error) {
+	ctx := withNamespace(context.Background(), a.NamespaceOrDefault())
+	sbom, err := lib.NewSBOM(a, b, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{a.Id: true}
+	var add func(from lib.Antarian) error
+	add = func(from lib.Antarian) error {
+		for _, req := range from.Requires {
+			dep, ok, err := resolveRequire(d, ctx, req)
+			if v, invalid := err.(*lib.ValidationError); invalid {
+				sbom.AddUnresolved(fmt.Sprintf("%s %s requires %q", from.Name, from.Version, req), v.Message)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !ok {
+				sbom.AddUnresolved(fmt.Sprintf("%s %s requires %q", from.Name, from.Version, req), "matches no Antarian")
+				continue
+			}
+			sbom.AddDependency(from.Id, dep)
+			if !seen[dep.Id] {
+				seen[dep.Id] = true
+				if err := add(dep); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := add(a); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(sbom, "", "  ")
+}
+
+// storeSBOM stores the SBOM of the successful build b of a beside the
+// artifact it made.
+func storeSBOM(d *Deps, a lib.Antarian, b lib.Build) error {
+	data, err := makeSBOM(d, a, b)
+	if err != nil {
+		return err
+	}
+	_, err = d.Storage.Put(context.Background(), a.Id, b.Artifact+lib.SBOMExt, bytes.NewReader(data))
+	return err
+}
+
+// AntarianSBOM serves the CycloneDX SBOM of the build that made the
+// artifact of an Antarian. Uploaded artifacts have none, so are 404, as is
+// a build's artifact for the moment between the build finishing and its
+// SBOM being stored.
+func AntarianSBOM(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		antarianId := mux.Vars(r)["antarianId"]
+		a, err := d.repo(r.Context()).FindAntarian(antarianId)
+		if err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "find antarian", err)
+			return
+		}
+		noSBOM := fmt.Sprintf("Antarian %s has no SBOM; successful builds make one", antarianId)
+		if a.Artifact == "" {
+			writeError(d, w, r, http.StatusNotFound, noSBOM)
+			return
+		}
+		f, info, err := d.Storage.Get(r.Context(), a.Id, a.Artifact+lib.SBOMExt)
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidName) {
+			writeError(d, w, r, http.StatusNotFound, noSBOM)
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "open sbom", err)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", lib.SBOMContentType)
+		http.ServeContent(w, r, info.Name, info.ModTime, f)
+	}
+}
@@ -0,0 +1,312 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// maxScheduleWait bounds the scheduler's sleep, so it sees the changes made
+// by other servers sharing the repository.
+const maxScheduleWait = time.Minute
+
+// scheduleRequest is the body of ScheduleCreate and ScheduleUpdate.
+type scheduleRequest struct {
+	AntarianId string            `json:"antarian_id"`
+	Cron       string            `json:"cron"`
+	Timezone   string            `json:"timezone"`
+	Overlap    lib.OverlapPolicy `json:"overlap"`
+	Priority   int               `json:"priority"`
+	// Enabled is true when not given.
+	Enabled *bool `json:"enabled"`
+}
+
+// apply sets the fields of s given by req and works out when s is next
+// due, answering 422 itself when it cannot.
+func (req scheduleRequest) apply(d *Deps, w http.ResponseWriter, r *http.Request, s *lib.Schedule) bool {
+	s.AntarianId, s.Cron, s.Timezone = req.AntarianId, req.Cron, req.Timezone
+	s.Overlap, s.Priority = req.Overlap, req.Priority
+	s.Enabled = req.Enabled == nil || *req.Enabled
+	if err := s.Validate(); err != nil {
+		writeDecodeError(d, w, r, err)
+		return false
+	}
+	if _, err := d.repo(r.Context()).FindAntarian(s.AntarianId); err == ErrNotFound {
+		writeDecodeError(d, w, r, &lib.ValidationError{Field: "antarian_id", Message: fmt.Sprintf("no Antarian has the id %s", s.AntarianId)})
+		return false
+	} else if err != nil {
+		internalError(d, w, r, "find antarian", err)
+		return false
+	}
+	s.NextRun = time.Time{}
+	if s.Enabled {
+		s.NextRun = s.Next(time.Now())
+	}
+	return true
+}
+
+// ScheduleIndex lists the schedules, of one Antarian with ?antarian_id=.
+func ScheduleIndex(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := d.repo(r.Context()).ListSchedules()
+		if err != nil {
+			internalError(d, w, r, "list schedules", err)
+			return
+		}
+		if id := r.URL.Query().Get("antarian_id"); id != "" {
+			filtered := []lib.Schedule{}
+			for _, s := range list {
+				if s.AntarianId == id {
+					filtered = append(filtered, s)
+				}
+			}
+			list = filtered
+		}
+		writeJSON(d, w, r, http.StatusOK, list)
+	}
+}
+
+// ScheduleCreate attaches a cron schedule to an Antarian.
+func ScheduleCreate(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req scheduleRequest
+		if err := decodeJSON(d, r, &req); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		id, err := lib.NewUUID()
+		if err != nil {
+			internalError(d, w, r, "create schedule", err)
+			return
+		}
+		s := lib.Schedule{Id: id, Created: time.Now().UTC()}
+		if !req.apply(d, w, r, &s) {
+			return
+		}
+		if err := d.repo(r.Context()).CreateSchedule(s); err != nil {
+			internalError(d, w, r, "create schedule", err)
+			return
+		}
+		d.schedules.wake()
+		requestLogger(d.Logger, r).Info("created schedule", "schedule_id", s.Id, "antarian_id", s.AntarianId, "cron", s.Cron, "next_run", s.NextRun)
+		e := requestAudit(r, lib.AuditScheduleCreate)
+		e.AntarianId = s.AntarianId
+		e.After = s.Id + " " + s.Cron
+		audit(r.Context(), d, e)
+		writeJSON(d, w, r, http.StatusCreated, s)
+	}
+}
+
+// ScheduleShow shows a schedule with its last and next runs.
+func ScheduleShow(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, ok := findSchedule(d, w, r)
+		if !ok {
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, s)
+	}
+}
+
+// ScheduleUpdate replaces the settings of a schedule, keeping its record of
+// the last run.
+func ScheduleUpdate(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req scheduleRequest
+		if err := decodeJSON(d, r, &req); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		// the scheduler must not write back a schedule read before this
+		d.schedules.mu.Lock()
+		defer d.schedules.mu.Unlock()
+		s, ok := findSchedule(d, w, r)
+		if !ok {
+			return
+		}
+		before := s.Id + " " + s.Cron
+		if !req.apply(d, w, r, &s) {
+			return
+		}
+		if err := d.repo(r.Context()).UpdateSchedule(s); err != nil {
+			internalError(d, w, r, "update schedule", err)
+			return
+		}
+		d.schedules.wake()
+		requestLogger(d.Logger, r).Info("updated schedule", "schedule_id", s.Id, "cron", s.Cron, "enabled", s.Enabled, "next_run", s.NextRun)
+		e := requestAudit(r, lib.AuditScheduleUpdate)
+		e.AntarianId = s.AntarianId
+		e.Before, e.After = before, s.Id+" "+s.Cron
+		audit(r.Context(), d, e)
+		writeJSON(d, w, r, http.StatusOK, s)
+	}
+}
+
+// ScheduleDelete removes a schedule. Builds it started are left alone.
+func ScheduleDelete(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d.schedules.mu.Lock()
+		defer d.schedules.mu.Unlock()
+		s, ok := findSchedule(d, w, r)
+		if !ok {
+			return
+		}
+		if err := d.repo(r.Context()).DestroySchedule(s.Id); err != nil && err != ErrNotFound {
+			internalError(d, w, r, "delete schedule", err)
+			return
+		}
+		requestLogger(d.Logger, r).Info("deleted schedule", "schedule_id", s.Id, "antarian_id", s.AntarianId)
+		e := requestAudit(r, lib.AuditScheduleDelete)
+		e.AntarianId = s.AntarianId
+		e.Before = s.Id + " " + s.Cron
+		audit(r.Context(), d, e)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// findSchedule looks up the schedule in the path, answering 404 or 500
+// itself when it cannot.
+func findSchedule(d *Deps, w http.ResponseWriter, r *http.Request) (lib.Schedule, bool) {
+	id := mux.Vars(r)["scheduleId"]
+	s, err := d.repo(r.Context()).FindSchedule(id)
+	if err == ErrNotFound {
+		writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Schedule with id of %s", id))
+		return lib.Schedule{}, false
+	}
+	if err != nil {
+		internalError(d, w, r, "find schedule", err)
+		return lib.Schedule{}, false
+	}
+	return s, true
+}
+
+// scheduler queues the builds of the schedules as they fall due. A
+// schedule due while the server was down is run once when it is back.
+type scheduler struct {
+	repo   Repository
+	builds *build.Engine
+	log    *slog.Logger
+	// mu is held while schedules are read and written back, by the
+	// scheduler and by the API
+	mu     sync.Mutex
+	wakeCh chan struct{}
+}
+
+func newScheduler(repo Repository, builds *build.Engine, log *slog.Logger) *scheduler {
+	return &scheduler{repo: repo, builds: builds, log: log, wakeCh: make(chan struct{}, 1)}
+}
+
+// wake has the scheduler look at the schedules again, after one changed.
+func (sc *scheduler) wake() {
+	select {
+	case sc.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// run starts the builds of the schedules due until ctx is done.
+func (sc *scheduler) run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-sc.wakeCh:
+		}
+		timer.Reset(sc.tick(time.Now()))
+	}
+}
+
+// tick runs the schedules due at now and returns how long to wait for the
+// next one.
+func (sc *scheduler) tick(now time.Time) time.Duration {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	list, err := sc.repo.ListSchedules()
+	if err != nil {
+		sc.log.Error("list schedules", "err", err)
+		return maxScheduleWait
+	}
+	wait := maxScheduleWait
+	for _, s := range list {
+		if !s.Enabled || s.NextRun.IsZero() {
+			continue
+		}
+		if !s.NextRun.After(now) {
+			sc.fire(&s, now)
+			if err := sc.repo.UpdateSchedule(s); err != nil && err != ErrNotFound {
+				sc.log.Error("update schedule", "err", err, "schedule_id", s.Id)
+			}
+		}
+		if s.Enabled && !s.NextRun.IsZero() && s.NextRun.Sub(now) < wait {
+			wait = s.NextRun.Sub(now)
+		}
+	}
+	return wait
+}
+
+// fire queues the build of schedule s, due at now, unless its overlap
+// policy holds it back, and records the outcome in s.
+func (sc *scheduler) fire(s *lib.Schedule, now time.Time) {
+	log := sc.log.With("schedule_id", s.Id, "antarian_id", s.AntarianId)
+	s.LastRun, s.LastError = now.UTC(), ""
+	s.NextRun = s.Next(now)
+
+	a, err := sc.repo.FindAntarian(s.AntarianId)
+	if err == ErrNotFound {
+		s.Enabled, s.NextRun = false, time.Time{}
+		s.LastError = "the Antarian no longer exists"
+		log.Warn("schedule disabled", "reason", s.LastError)
+		return
+	}
+	if err != nil {
+		s.LastError = err.Error()
+		log.Error("find antarian", "err", err)
+		return
+	}
+	if s.Overlap == lib.OverlapSkip && s.LastBuildId != "" {
+		if b, ok := sc.builds.Get(s.LastBuildId); ok && !b.State.Done() {
+			s.LastError = fmt.Sprintf("skipped: build %s is %s", b.Id, b.State)
+			log.Info("scheduled build skipped", "build_id", b.Id, "state", b.State, "next_run", s.NextRun)
+			return
+		}
+	}
+	b, _, err := sc.builds.Start(a, s.Priority)
+	if err != nil {
+		s.LastError = err.Error()
+		log.Warn("scheduled build rejected", "err", err, "next_run", s.NextRun)
+		return
+	}
+	s.LastBuildId = b.Id
+	log.Info("scheduled build queued", "build_id", b.Id, "next_run", s.NextRun)
+	sc.audit(lib.AuditEntry{
+		Actor:      "scheduler",
+		Action:     lib.AuditBuildTrigger,
+		Namespace:  a.Namespace,
+		AntarianId: a.Id,
+		BuildId:    b.Id,
+		After:      "schedule " + s.Id,
+	})
+}
+
+// audit writes e, as audit does for requests.
+func (sc *scheduler) audit(e lib.AuditEntry) {
+	id, err := lib.NewUUID()
+	if err != nil {
+		sc.log.Error("generate audit id", "err", err, "action", e.Action)
+	}
+	e.Id = id
+	e.Time = time.Now()
+	if err := sc.repo.AppendAudit(e); err != nil {
+		sc.log.Error("write audit entry", "err", err, "action", e.Action, "antarian_id", e.AntarianId, "build_id", e.BuildId)
+	}
+}
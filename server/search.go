@@ -0,0 +1,319 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/xbcsmith/antares/lib"
+)
+
+// searchFields are the Antarian fields covered by the search index.
+var searchFields = []string{"name", "version", "release", "requires"}
+
+// SearchIndex is an inverted index from the terms of each searchable field
+// to the ids of the Antarians containing them. It only sees changes made
+// through this process, so servers sharing a database each keep their own.
+type SearchIndex struct {
+	mu sync.RWMutex
+	// postings maps field + "\x00" + term to a set of ids
+	postings map[string]map[string]struct{}
+	// keys remembers the postings of each id so it can be removed
+	keys map[string][]string
+}
+
+// NewSearchIndex returns an empty index.
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{postings: map[string]map[string]struct{}{}, keys: map[string][]string{}}
+}
+
+// Add indexes a, replacing whatever was indexed under its id.
+func (x *SearchIndex) Add(a lib.Antarian) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(a.Id)
+	values := map[string][]string{
+		"name":     {a.Name},
+		"version":  {a.Version},
+		"release":  {a.Release},
+		"requires": a.Requires,
+	}
+	var keys []string
+	for field, vs := range values {
+		for _, v := range vs {
+			for _, term := range searchTerms(v) {
+				key := field + "\x00" + term
+				ids, ok := x.postings[key]
+				if !ok {
+					ids = map[string]struct{}{}
+					x.postings[key] = ids
+				}
+				if _, dup := ids[a.Id]; !dup {
+					ids[a.Id] = struct{}{}
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	x.keys[a.Id] = keys
+}
+
+// Remove drops id from the index.
+func (x *SearchIndex) Remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+func (x *SearchIndex) remove(id string) {
+	for _, key := range x.keys[id] {
+		delete(x.postings[key], id)
+		if len(x.postings[key]) == 0 {
+			delete(x.postings, key)
+		}
+	}
+	delete(x.keys, id)
+}
+
+// Reset empties the index.
+func (x *SearchIndex) Reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.postings = map[string]map[string]struct{}{}
+	x.keys = map[string][]string{}
+}
+
+// Search returns the ids of the Antarians matching every word of q. A word
+// is matched against all searchable fields, or only one when written as
+// field:word; a trailing * matches any term with that prefix.
+func (x *SearchIndex) Search(q string) ([]string, error) {
+	words := strings.Fields(q)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("q: must not be empty")
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var result map[string]struct{}
+	for _, w := range words {
+		fields := searchFields
+		if i := strings.IndexByte(w, ':'); i > 0 {
+			field := strings.ToLower(w[:i])
+			if !isSearchField(field) {
+				return nil, fmt.Errorf("q: %q is not one of %s", field, strings.Join(searchFields, ", "))
+			}
+			fields, w = []string{field}, w[i+1:]
+		}
+		matches := x.match(fields, w)
+		if result == nil {
+			result = matches
+			continue
+		}
+		for id := range result {
+			if _, ok := matches[id]; !ok {
+				delete(result, id)
+			}
+		}
+	}
+	ids := make([]string, 0, len(result))
+	for id := range result {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func isSearchField(field string) bool {
+	for _, f := range searchFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the ids having word in any of fields. Words are normalized
+// like indexed values; a word that splits into several terms must match
+// them all.
+func (x *SearchIndex) match(fields []string, word string) map[string]struct{} {
+	found := map[string]struct{}{}
+	if prefix, ok := strings.CutSuffix(word, "*"); ok {
+		prefix = strings.ToLower(prefix)
+		for _, field := range fields {
+			for id := range x.prefixed(field, prefix) {
+				found[id] = struct{}{}
+			}
+		}
+		return found
+	}
+	terms := searchTerms(word)
+	if len(terms) == 0 {
+		return found
+	}
+	for _, field := range fields {
+		var hits map[string]struct{}
+		for _, term := range terms {
+			ids := x.postings[field+"\x00"+term]
+			if hits == nil {
+				hits = map[string]struct{}{}
+				for id := range ids {
+					hits[id] = struct{}{}
+				}
+				continue
+			}
+			for id := range hits {
+				if _, ok := ids[id]; !ok {
+					delete(hits, id)
+				}
+			}
+		}
+		for id := range hits {
+			found[id] = struct{}{}
+		}
+	}
+	return found
+}
+
+// prefixed collects the ids of every term of field starting with prefix.
+func (x *SearchIndex) prefixed(field, prefix string) map[string]struct{} {
+	ids := map[string]struct{}{}
+	for key, set := range x.postings {
+		if strings.HasPrefix(key, field+"\x00"+prefix) {
+			for id := range set {
+				ids[id] = struct{}{}
+			}
+		}
+	}
+	return ids
+}
+
+// searchTerms lowercases v and returns it whole followed by its words, so
+// "libfoo-devel" matches "libfoo-devel", "libfoo" and "devel". Dots are
+// kept within words, so versions stay whole.
+func searchTerms(v string) []string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == "" {
+		return nil
+	}
+	terms := []string{v}
+	words := strings.FieldsFunc(v, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.'
+	})
+	if len(words) > 1 {
+		terms = append(terms, words...)
+	}
+	return terms
+}
+
+// indexedRepo keeps a SearchIndex in step with the Antarians of a
+// Repository.
+type indexedRepo struct {
+	Repository
+	index *SearchIndex
+}
+
+// withSearchIndex fills index from repo and returns repo wrapped so every
+// later change is applied to index as well.
+func withSearchIndex(repo Repository, index *SearchIndex) (Repository, error) {
+	err := repo.EachAntarian(func(a lib.Antarian) error {
+		index.Add(a)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &indexedRepo{Repository: repo, index: index}, nil
+}
+
+func (r *indexedRepo) CreateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	a, err := r.Repository.CreateAntarian(s)
+	if err == nil {
+		r.index.Add(a)
+	}
+	return a, err
+}
+
+func (r *indexedRepo) UpdateAntarian(s lib.Antarian) (lib.Antarian, error) {
+	a, err := r.Repository.UpdateAntarian(s)
+	if err == nil {
+		r.index.Add(a)
+	}
+	return a, err
+}
+
+func (r *indexedRepo) DestroyAntarian(id string) error {
+	err := r.Repository.DestroyAntarian(id)
+	if err == nil {
+		r.index.Remove(id)
+	}
+	return err
+}
+
+func (r *indexedRepo) Purge() (antarians, builds int, err error) {
+	antarians, builds, err = r.Repository.Purge()
+	if err == nil {
+		r.index.Reset()
+	}
+	return antarians, builds, err
+}
+
+// Close closes the wrapped repository if it holds resources.
+func (r *indexedRepo) Close() error {
+	return closeRepository(r.Repository)
+}
+
+// Ping checks the wrapped repository.
+func (r *indexedRepo) Ping(ctx context.Context) error {
+	return pingRepository(ctx, r.Repository)
+}
+
+// AntarianSearch lists the Antarians matching ?q=, oldest first, paginated
+// with limit and offset. See SearchIndex.Search for the query syntax.
+func AntarianSearch(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err := parsePage(r)
+		if err != nil {
+			writeError(d, w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		index := d.Search
+		if index == nil {
+			// embedders that build Deps by hand get a throwaway index
+			index = NewSearchIndex()
+			if err := d.repo(r.Context()).EachAntarian(func(a lib.Antarian) error { index.Add(a); return nil }); err != nil {
+				internalError(d, w, r, "build search index", err)
+				return
+			}
+		}
+		ids, err := index.Search(r.URL.Query().Get("q"))
+		if err != nil {
+			writeError(d, w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		list := make(lib.Antarians, 0, len(ids))
+		for _, id := range ids {
+			a, err := d.repo(r.Context()).FindAntarian(id)
+			if err == ErrNotFound {
+				// deleted since it was matched
+				continue
+			}
+			if err != nil {
+				internalError(d, w, r, "find antarian", err)
+				return
+			}
+			list = append(list, a)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if !list[i].Start.Equal(list[j].Start) {
+				return list[i].Start.Before(list[j].Start)
+			}
+			return list[i].Id < list[j].Id
+		})
+		start, end := page(len(list), limit, offset)
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(list)))
+		writeCacheable(d, w, r, list[start:end])
+	}
+}
@@ -1,11 +1,550 @@
 package server
 
 import (
-    "log"
-    "net/http"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/xbcsmith/antares/build"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/storage"
+	"github.com/xbcsmith/antares/telemetry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-func Server() {
-    router := NewRouter()
-    log.Fatal(http.ListenAndServe(":8080", router))
+// ErrStarted is returned by Start on an Instance that was already started
+// or shut down.
+var ErrStarted = errors.New("server: already started")
+
+// Instance is an Antares server that can be embedded in another program or
+// started and stopped by tests. Create it with New, then Start it; Shutdown
+// stops it.
+type Instance struct {
+	deps    *Deps
+	handler http.Handler
+	http    *http.Server
+	grpc    *grpc.Server
+	// redirect sends plain HTTP clients to the TLS server
+	redirect *http.Server
+	// stopTracing flushes and stops the trace exporter
+	stopTracing func(context.Context) error
+	// publishers send events to the configured message brokers
+	publishers []publisher
+	// recorder finishes the work of saved builds after they are saved
+	recorder *buildRecorder
+
+	mu       sync.Mutex
+	httpLis  net.Listener
+	grpcLis  net.Listener
+	stop     context.CancelFunc
+	shutdown bool
+	done     chan struct{}
+	err      error
+	errOnce  sync.Once
+	stopOnce sync.Once
+}
+
+// New builds the server described by cfg without binding any listeners.
+func New(cfg *config.Config) (_ *Instance, err error) {
+	// undo what was set up, latest first, when a later step fails
+	var cleanup []func()
+	defer func() {
+		if err != nil {
+			for i := len(cleanup) - 1; i >= 0; i-- {
+				cleanup[i]()
+			}
+		}
+	}()
+	logger, _ := NewLogger(cfg, os.Stderr)
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	store, err := newStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	signer, signingKeys, err := newSigning(cfg.Signing)
+	if err != nil {
+		return nil, err
+	}
+	executor := &build.Executor{
+		Command:    cfg.Build.Command,
+		Shell:      cfg.Build.Shell,
+		Runtime:    cfg.Build.Runtime,
+		DockerHost: cfg.Build.DockerHost,
+		WorkDir:    cfg.Build.WorkDir,
+		Timeout:    cfg.Build.Timeout,
+		Artifacts:  store,
+		Signer:     signer,
+	}
+	repo, err := newRepository(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	// repo is wrapped below; closing the outermost wrapper closes it
+	cleanup = append(cleanup, func() { closeRepository(repo) })
+	if err := seed(repo, cfg); err != nil {
+		return nil, fmt.Errorf("seed repository: %v", err)
+	}
+	search := NewSearchIndex()
+	indexed, err := withSearchIndex(repo, search)
+	if err != nil {
+		return nil, fmt.Errorf("build search index: %v", err)
+	}
+	repo = indexed
+	events := NewEventHub()
+	repo = withEvents(repo, events)
+	if cfg.AuditFile != "" {
+		logged, err := withAuditFile(repo, cfg.AuditFile)
+		if err != nil {
+			return nil, fmt.Errorf("open audit file: %v", err)
+		}
+		repo = logged
+	}
+	verifiers, err := newVerifiers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	stopTracing, err := telemetry.Setup(context.Background(), cfg.Tracing, "antares")
+	if err != nil {
+		return nil, err
+	}
+	cleanup = append(cleanup, func() { stopTracing(context.Background()) })
+	recorder := &buildRecorder{Repository: repo, store: store, log: logger}
+	d := &Deps{
+		Config:  cfg,
+		Repo:    repo,
+		Logger:  logger,
+		Storage: store,
+		Search:  search,
+		Events:  events,
+		Builds: build.NewEngine(executor, build.Options{
+			Workers:          cfg.Build.Workers,
+			QueueSize:        cfg.Build.QueueSize,
+			Serialize:        cfg.Build.Serialize,
+			CancelOnShutdown: cfg.Build.CancelOnShutdown,
+			RetryDelay:       cfg.Build.RetryDelay,
+			AgentTimeout:     cfg.Build.AgentTimeout,
+			NamespaceLimit:   cfg.Build.NamespaceLimit,
+			PriorityAging:    cfg.Build.PriorityAging,
+		}, recorder, logger),
+		verifiers:   verifiers,
+		signingKeys: signingKeys,
+		limiter:     newRateLimiter(cfg.RateLimit),
+		webhooks:    newWebhookDispatcher(repo, cfg.Webhooks, logger),
+	}
+	recorder.deps = d
+	// the engine's workers are already running
+	cleanup = append(cleanup, func() {
+		d.Builds.Shutdown(context.Background())
+		recorder.wait()
+	})
+	d.schedules = newScheduler(repo, d.Builds, logger)
+	d.Metrics = NewMetrics(d)
+	if authRequired(d) {
+		d.Auth = Authenticate(d)
+	}
+	publishStats(d)
+
+	var handler http.Handler = NewRouter(d, VersionedRoutes(d))
+	if cfg.HTTP.Compress {
+		handler = Compress()(handler)
+	}
+	if len(cfg.CORSOrigins) > 0 {
+		handler = CORS(cfg)(handler)
+	}
+	s := &Instance{
+		deps:        d,
+		handler:     handler,
+		recorder:    recorder,
+		done:        make(chan struct{}),
+		stopTracing: stopTracing,
+	}
+	if cfg.NATS.URL != "" {
+		p, err := newNATSPublisher(cfg.NATS, logger)
+		if err != nil {
+			return nil, fmt.Errorf("connect to nats: %v", err)
+		}
+		s.publishers = append(s.publishers, p)
+	}
+	if len(cfg.Kafka.Brokers) > 0 {
+		s.publishers = append(s.publishers, newKafkaPublisher(cfg.Kafka, logger))
+	}
+	s.http = &http.Server{Handler: s.handler, TLSConfig: tlsConfig}
+	NewServerConfig(cfg).apply(s.http)
+	if cfg.GRPCAddr != "" {
+		var opts []grpc.ServerOption
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		s.grpc = NewGRPCServer(d, opts...)
+	}
+	if cfg.TLS.RedirectAddr != "" {
+		s.redirect = &http.Server{
+			Addr:              cfg.TLS.RedirectAddr,
+			Handler:           redirectHandler(cfg.BaseURL()),
+			ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+			IdleTimeout:       cfg.HTTP.IdleTimeout,
+		}
+	}
+	return s, nil
+}
+
+// Deps returns the dependencies shared by the handlers.
+func (s *Instance) Deps() *Deps {
+	return s.deps
+}
+
+// Handler returns the REST API, for mounting under an existing mux.
+func (s *Instance) Handler() http.Handler {
+	return s.handler
+}
+
+// HTTPServer returns the underlying http.Server so its timeouts and hooks
+// can be adjusted before Start.
+func (s *Instance) HTTPServer() *http.Server {
+	return s.http
+}
+
+// Start binds the configured listeners and serves in the background. It
+// returns once the server is accepting connections; listening on port 0
+// picks a free port, reported by Addr. Cancelling ctx shuts the server
+// down as Shutdown would, without a deadline.
+func (s *Instance) Start(ctx context.Context) error {
+	cfg, log := s.deps.Config, s.deps.Logger
+	s.mu.Lock()
+	started, shutdown := s.stop != nil, s.shutdown
+	s.mu.Unlock()
+	if started || shutdown {
+		return ErrStarted
+	}
+	httpLis, err := listen("http", s.http.Addr, cfg.SocketFileMode())
+	if err != nil {
+		return err
+	}
+	var grpcLis, redirectLis net.Listener
+	if s.grpc != nil {
+		if grpcLis, err = listen("grpc", cfg.GRPCAddr, cfg.SocketFileMode()); err != nil {
+			httpLis.Close()
+			return err
+		}
+	}
+	if s.redirect != nil {
+		if redirectLis, err = listen("redirect", s.redirect.Addr, cfg.SocketFileMode()); err != nil {
+			httpLis.Close()
+			if grpcLis != nil {
+				grpcLis.Close()
+			}
+			return err
+		}
+	}
+
+	runCtx, stop := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.httpLis, s.grpcLis, s.stop = httpLis, grpcLis, stop
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		log.Info("listening", "addr", httpLis.Addr().String(), "tls", s.http.TLSConfig != nil)
+		serve := s.http.Serve
+		if s.http.TLSConfig != nil {
+			// the certificate is already in TLSConfig
+			serve = func(l net.Listener) error { return s.http.ServeTLS(l, "", "") }
+		}
+		if err := serve(httpLis); err != nil && err != http.ErrServerClosed {
+			s.fail(err)
+		}
+	}()
+	if redirectLis != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Info("listening for https redirects", "addr", redirectLis.Addr().String())
+			if err := s.redirect.Serve(redirectLis); err != nil && err != http.ErrServerClosed {
+				s.fail(err)
+			}
+		}()
+	}
+	if grpcLis != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Info("listening grpc", "addr", grpcLis.Addr().String())
+			if err := s.grpc.Serve(grpcLis); err != nil && err != grpc.ErrServerStopped {
+				s.fail(err)
+			}
+		}()
+	}
+	go pruneBuilds(runCtx, s.deps.Repo, cfg.Build.Retention, log)
+	go runGC(runCtx, s.deps, cfg.ArtifactGCInterval)
+	go s.deps.webhooks.run(runCtx, s.deps.Events)
+	go s.deps.schedules.run(runCtx)
+	for _, p := range s.publishers {
+		go p.run(runCtx, s.deps.Events)
+	}
+	go func() {
+		wg.Wait()
+		close(s.done)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Shutdown(context.Background())
+		case <-runCtx.Done():
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the REST API is listening on, or "" before
+// Start.
+func (s *Instance) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.httpLis == nil {
+		return ""
+	}
+	return s.httpLis.Addr().String()
+}
+
+// GRPCAddr returns the address the gRPC API is listening on, or "" when it
+// is disabled or not started.
+func (s *Instance) GRPCAddr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.grpcLis == nil {
+		return ""
+	}
+	return s.grpcLis.Addr().String()
+}
+
+// Wait blocks until the server has stopped and returns the error that
+// stopped it, or nil after Shutdown.
+func (s *Instance) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// Shutdown stops accepting connections, waits for in-flight requests and
+// builds, and returns once everything has stopped or ctx expires. When ctx
+// expires remaining connections are closed and running builds cancelled.
+// Later calls wait for the first to finish.
+func (s *Instance) Shutdown(ctx context.Context) error {
+	var err error
+	s.stopOnce.Do(func() {
+		s.mu.Lock()
+		stop := s.stop
+		s.shutdown = true
+		s.mu.Unlock()
+		if stop == nil {
+			// never started
+			close(s.done)
+			err = s.stopBuilds(ctx)
+			if cerr := closeRepository(s.deps.Repo); cerr != nil && err == nil {
+				err = cerr
+			}
+			s.closePublishers()
+			s.stopTracing(ctx)
+			return
+		}
+		stop()
+
+		if s.grpc != nil {
+			stopped := make(chan struct{})
+			go func() {
+				s.grpc.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				s.grpc.Stop()
+			}
+		}
+		if herr := s.http.Shutdown(ctx); herr != nil {
+			s.http.Close()
+			err = herr
+		}
+		if s.redirect != nil {
+			if rerr := s.redirect.Shutdown(ctx); rerr != nil {
+				s.redirect.Close()
+			}
+		}
+		if berr := s.stopBuilds(ctx); berr != nil && err == nil {
+			err = berr
+		}
+		<-s.done
+		// builds have stopped saving, so the repository can go
+		if cerr := closeRepository(s.deps.Repo); cerr != nil && err == nil {
+			err = cerr
+		}
+		s.closePublishers()
+		if terr := s.stopTracing(ctx); terr != nil {
+			s.deps.Logger.Warn("flush traces", "err", terr)
+		}
+	})
+	return err
+}
+
+// stopBuilds shuts the build engine down and waits for the recorder to
+// finish with the builds it saved.
+func (s *Instance) stopBuilds(ctx context.Context) error {
+	err := s.deps.Builds.Shutdown(ctx)
+	s.recorder.wait()
+	return err
+}
+
+// publisher sends the events of a hub to a message broker.
+type publisher interface {
+	run(ctx context.Context, hub *EventHub)
+	// Close sends what is buffered and disconnects.
+	Close() error
+}
+
+// closePublishers disconnects from the message brokers.
+func (s *Instance) closePublishers() {
+	for _, p := range s.publishers {
+		if err := p.Close(); err != nil {
+			s.deps.Logger.Warn("close event publisher", "err", err)
+		}
+	}
+}
+
+// newRepository opens the backend selected by cfg.Backend.
+func newRepository(cfg *config.Config, log *slog.Logger) (Repository, error) {
+	switch cfg.Backend {
+	case "bolt":
+		return NewBoltRepo(cfg.DBPath, log)
+	case "postgres":
+		return NewPostgresRepo(cfg.Postgres, log)
+	}
+	return NewMemoryRepo(log), nil
+}
+
+// newStorage opens the artifact store selected by cfg.ArtifactStore.
+func newStorage(cfg *config.Config) (storage.Storage, error) {
+	if cfg.ArtifactStore == "s3" {
+		return storage.NewS3(storage.S3Config(cfg.S3))
+	}
+	return storage.NewLocal(cfg.ArtifactDir, cfg.ArtifactFsync)
+}
+
+// closeRepository releases repo if it holds resources.
+func closeRepository(repo Repository) error {
+	if c, ok := repo.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// fail records the first serve error and stops the rest of the server.
+func (s *Instance) fail(err error) {
+	s.errOnce.Do(func() {
+		s.err = err
+		s.deps.Logger.Error("server stopped", "err", err)
+		go s.Shutdown(context.Background())
+	})
+}
+
+// ServerConfig holds the listen address and limits of the REST API's
+// http.Server.
+type ServerConfig struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+}
+
+// NewServerConfig returns the ServerConfig described by cfg.
+func NewServerConfig(cfg *config.Config) ServerConfig {
+	return ServerConfig{
+		Addr:              cfg.ListenAddr(),
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+		MaxHeaderBytes:    cfg.HTTP.MaxHeaderBytes,
+	}
+}
+
+func (sc ServerConfig) apply(s *http.Server) {
+	s.Addr = sc.Addr
+	s.ReadTimeout = sc.ReadTimeout
+	s.ReadHeaderTimeout = sc.ReadHeaderTimeout
+	s.WriteTimeout = sc.WriteTimeout
+	s.IdleTimeout = sc.IdleTimeout
+	s.MaxHeaderBytes = sc.MaxHeaderBytes
+}
+
+// Server runs the standard API described by cfg until it fails or the
+// process receives SIGINT or SIGTERM.
+func Server(cfg *config.Config) {
+	ServeWithConfig(cfg, NewServerConfig(cfg))
+}
+
+// ServeWithConfig is Server with the http.Server settings taken from sc
+// rather than cfg.
+func ServeWithConfig(cfg *config.Config, sc ServerConfig) {
+	s, err := New(cfg)
+	if err != nil {
+		fatal(cfg, "create server", err)
+	}
+	sc.apply(s.HTTPServer())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	if err := s.Start(context.Background()); err != nil {
+		fatal(cfg, "start server", err)
+	}
+	go func() {
+		sig := <-sigs
+		log := s.deps.Logger
+		log.Info("shutting down", "signal", sig.String(), "timeout", cfg.HTTP.ShutdownTimeout)
+		// a second signal stops waiting for connections and builds
+		ctx, cancel := context.WithCancel(context.Background())
+		if cfg.HTTP.ShutdownTimeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+		}
+		defer cancel()
+		go func() {
+			select {
+			case <-sigs:
+				log.Warn("forcing shutdown")
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		if err := s.Shutdown(ctx); err != nil {
+			log.Error("shutdown", "err", err)
+		}
+	}()
+	err = s.Wait()
+	// the listeners close first; wait for builds and the repository too,
+	// including after a failure, whose Shutdown is still running
+	s.Shutdown(context.Background())
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func fatal(cfg *config.Config, msg string, err error) {
+	logger, _ := NewLogger(cfg, os.Stderr)
+	logger.Error(msg, "err", err)
+	os.Exit(1)
 }
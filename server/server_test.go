@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/config"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Addr = "127.0.0.1:0"
+	cfg.LogLevel = "error"
+	cfg.ArtifactDir = t.TempDir()
+	cfg.Build.WorkDir = t.TempDir()
+	return cfg
+}
+
+func TestInstanceLifecycle(t *testing.T) {
+	s, err := New(testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := s.Addr(); addr != "" {
+		t.Errorf("Addr before Start = %q", addr)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	addr := s.Addr()
+	if addr == "" || addr == "127.0.0.1:0" {
+		t.Fatalf("Addr = %q, want the bound port", addr)
+	}
+	resp, err := http.Get("http://" + addr + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz = %d", resp.StatusCode)
+	}
+	if err := s.Start(context.Background()); err != ErrStarted {
+		t.Errorf("second Start = %v, want ErrStarted", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Errorf("Wait after Shutdown = %v", err)
+	}
+	if _, err := http.Get("http://" + addr + "/healthz"); err == nil {
+		t.Error("the server still answers after Shutdown")
+	}
+	if err := s.Start(context.Background()); err != ErrStarted {
+		t.Errorf("Start after Shutdown = %v, want ErrStarted", err)
+	}
+}
+
+func TestInstanceContext(t *testing.T) {
+	s, err := New(testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	done := make(chan error)
+	go func() { done <- s.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Wait = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("cancelling the Start context did not stop the server")
+	}
+}
+
+func TestInstanceNeverStarted(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Backend, cfg.DBPath = "bolt", filepath.Join(t.TempDir(), "antares.db")
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Errorf("Wait = %v", err)
+	}
+	// the database is closed, so it opens again at once
+	repo, err := NewBoltRepo(cfg.DBPath, testLogger())
+	if err != nil {
+		t.Fatalf("reopen after Shutdown: %v", err)
+	}
+	repo.Close()
+}
+
+func TestNewCleansUp(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Backend, cfg.DBPath = "bolt", filepath.Join(t.TempDir(), "antares.db")
+	// fails after the repository is open and the engine running
+	cfg.NATS.URL = "nats://127.0.0.1:4222"
+	cfg.NATS.CredsFile = filepath.Join(t.TempDir(), "missing.creds")
+	before := runtime.NumGoroutine()
+	if _, err := New(cfg); err == nil {
+		t.Fatal("New succeeded without the nats credentials")
+	}
+	// the build workers have exited
+	for deadline := time.Now().Add(2 * time.Second); runtime.NumGoroutine() > before; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Errorf("%d goroutines left running by the failed New", runtime.NumGoroutine()-before)
+			break
+		}
+	}
+	repo, err := NewBoltRepo(cfg.DBPath, testLogger())
+	if err != nil {
+		t.Fatalf("the failed New left the database open: %v", err)
+	}
+	repo.Close()
+}
+
+// TestInstanceServeFailure follows ServeWithConfig after a listener fails:
+// Wait reports the failure, and the Shutdown after it returns only once the
+// repository is closed.
+func TestInstanceServeFailure(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Backend, cfg.DBPath = "bolt", filepath.Join(t.TempDir(), "antares.db")
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.httpLis.Close()
+	s.mu.Unlock()
+
+	if err := s.Wait(); err == nil {
+		t.Fatal("Wait = nil after the listener failed")
+	}
+	s.Shutdown(context.Background())
+	repo, err := NewBoltRepo(cfg.DBPath, testLogger())
+	if err != nil {
+		t.Fatalf("the database is still open after Shutdown: %v", err)
+	}
+	repo.Close()
+}
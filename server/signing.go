@@ -0,0 +1,107 @@
+package server
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+	"github.com/xbcsmith/antares/storage"
+)
+
+// maxSignatureSize bounds the detached signatures read back from storage.
+const maxSignatureSize = 4 << 10
+
+// newSigning returns the key builds sign their artifacts with, nil when
+// none is configured, and the public keys signatures are checked against:
+// those configured and that of the signing key.
+func newSigning(cfg config.Signing) (crypto.Signer, []crypto.PublicKey, error) {
+	var signer crypto.Signer
+	var keys []crypto.PublicKey
+	if cfg.Key != "" {
+		var err error
+		if signer, err = lib.LoadSigningKey(cfg.Key); err != nil {
+			return nil, nil, fmt.Errorf("signing.key: %v", err)
+		}
+		keys = append(keys, signer.Public())
+	}
+	for i, path := range cfg.PublicKeys {
+		key, err := lib.LoadPublicKey(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("signing.public_keys[%d]: %v", i, err)
+		}
+		keys = append(keys, key)
+	}
+	return signer, keys, nil
+}
+
+// AntarianSignatureVerify checks the detached signature stored beside the
+// artifact of an Antarian, chosen by platform as for AntarianDownload,
+// against the server's public keys, naming the one that verifies it. A
+// missing signature is reported as invalid; an Antarian without an
+// artifact is 404, and a server without keys 409.
+func AntarianSignatureVerify(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		antarianId := mux.Vars(r)["antarianId"]
+		a, err := d.repo(r.Context()).FindAntarian(antarianId)
+		if err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+			return
+		}
+		if err != nil {
+			internalError(d, w, r, "find antarian", err)
+			return
+		}
+		v, ok := platformArtifact(d, w, r, a)
+		if !ok {
+			return
+		}
+		if v.Checksum == "" {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Antarian %s has no uploaded artifact", antarianId))
+			return
+		}
+		if len(d.signingKeys) == 0 {
+			writeError(d, w, r, http.StatusConflict, "no signing keys are configured")
+			return
+		}
+
+		check := lib.SignatureCheck{Id: a.Id, Filename: v.Artifact, Platform: variantPlatform(v),
+			Signature: v.Artifact + lib.SignatureExt, Checksum: v.Checksum}
+		sig, err := readSignature(r, d, a.Id, check.Signature)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			check.Error = "the artifact is not signed"
+		case err != nil:
+			check.Error = err.Error()
+		default:
+			for _, key := range d.signingKeys {
+				if lib.VerifyChecksum(key, v.Checksum, sig) {
+					check.Valid, check.KeyId = true, lib.KeyId(key)
+					break
+				}
+			}
+			if !check.Valid {
+				check.Error = "no configured key verifies the signature"
+			}
+		}
+		if !check.Valid {
+			requestLogger(d.Logger, r).Warn("artifact signature failed verification", "antarian_id", a.Id,
+				"filename", v.Artifact, "err", check.Error)
+		}
+		writeJSON(d, w, r, http.StatusOK, check)
+	}
+}
+
+// readSignature reads the signature filename of the Antarian id.
+func readSignature(r *http.Request, d *Deps, id, filename string) ([]byte, error) {
+	f, _, err := d.Storage.Get(r.Context(), id, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, maxSignatureSize))
+}
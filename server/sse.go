@@ -0,0 +1,275 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment, so
+// proxies do not time the connection out.
+const sseKeepAlive = 15 * time.Second
+
+// Build event types sent by AntarianBuildEvents.
+const (
+	buildEventQueued    = "queued"
+	buildEventStarted   = "started"
+	buildEventStep      = "step"
+	buildEventCompleted = "completed"
+	buildEventFailed    = "failed"
+)
+
+// buildStep is the data of a step event: one line of build output.
+type buildStep struct {
+	BuildId string `json:"build_id"`
+	Line    string `json:"line"`
+}
+
+// AntarianBuildEvents follows a build of an Antarian as a text/event-stream.
+// It sends the build record in a queued, started, completed or failed event
+// as it changes state, with a step event for every line of output while
+// it runs, and ends after the final event. The build is ?build_id= or, by
+// default, the Antarian's most recent one; a build that already finished
+// gets just its final event.
+func AntarianBuildEvents(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		antarianId := mux.Vars(r)["antarianId"]
+		repo := d.repo(r.Context())
+		if _, err := repo.FindAntarian(antarianId); err == ErrNotFound {
+			writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Antarian with id of %s", antarianId))
+			return
+		} else if err != nil {
+			internalError(d, w, r, "find antarian", err)
+			return
+		}
+		var b lib.Build
+		if buildId := r.URL.Query().Get("build_id"); buildId != "" {
+			found, ok := repo.FindBuild(buildId)
+			if !ok || found.AntarianId != antarianId {
+				writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Build with id of %s", buildId))
+				return
+			}
+			b = found
+		} else {
+			latest, ok, err := repo.LatestBuild(antarianId)
+			if err != nil {
+				internalError(d, w, r, "find latest build", err)
+				return
+			}
+			if !ok {
+				writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Antarian %s has not been built", antarianId))
+				return
+			}
+			b = latest
+		}
+
+		// watch before reading the state, so no change falls in between
+		updates, stop, watching := d.Builds.Watch(b.Id)
+		defer stop()
+		if current, ok := d.Builds.Get(b.Id); ok {
+			b = current
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		s := &sseWriter{w: w, rc: http.NewResponseController(w)}
+
+		var sent lib.BuildState
+		sendState := func(b lib.Build) error {
+			if b.State == sent {
+				return nil
+			}
+			sent = b.State
+			return s.send(buildEventType(b.State), b)
+		}
+		if err := sendState(b); err != nil || !watching || b.State.Done() {
+			return
+		}
+
+		tick := time.NewTicker(sseKeepAlive)
+		defer tick.Stop()
+		for {
+			var err error
+			select {
+			case <-r.Context().Done():
+				return
+			case <-tick.C:
+				err = s.comment("keep-alive")
+			case p, ok := <-updates:
+				if !ok {
+					// the final record may have been dropped for a slow reader
+					if final, found := d.Builds.Get(b.Id); found {
+						sendState(final)
+					}
+					return
+				}
+				if p.Log != nil {
+					err = s.send(buildEventStep, buildStep{BuildId: b.Id, Line: p.Log.Line})
+				} else {
+					err = sendState(p.Build)
+				}
+			}
+			if err != nil {
+				requestLogger(d.Logger, r).Info("build event stream aborted", "err", err, "build_id", b.Id)
+				return
+			}
+		}
+	}
+}
+
+// EventStream sends the change events of the request's namespace as a
+// text/event-stream, each a lib.Event with its hub number as the SSE id.
+// The comma separated name and types parameters filter them. Given
+// ?last_event_id= or a Last-Event-ID header, the retained events after
+// that one are sent first. Without ?follow=true the stream ends there,
+// replaying every retained event when no id was given; with it, new events
+// follow until the client goes away. A client too slow to keep up is
+// disconnected and should reconnect with the id of the last event it saw.
+func EventStream(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := EventFilter{
+			Names: splitList(q.Get("name")),
+			Types: splitList(q.Get("types")),
+		}
+		if ns, ok := NamespaceFrom(r.Context()); ok {
+			filter.Namespaces = []string{ns}
+		}
+		lastId := q.Get("last_event_id")
+		if lastId == "" {
+			lastId = r.Header.Get("Last-Event-ID")
+		}
+		var after uint64
+		if lastId != "" {
+			var err error
+			if after, err = strconv.ParseUint(lastId, 10, 64); err != nil {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("last_event_id: %q is not an event id", lastId))
+				return
+			}
+		}
+		follow := false
+		if v := q.Get("follow"); v != "" {
+			var err error
+			if follow, err = strconv.ParseBool(v); err != nil {
+				writeError(d, w, r, http.StatusBadRequest, fmt.Sprintf("follow: %q is not a boolean", v))
+				return
+			}
+		}
+
+		// subscribe before reading the history, so no event falls in between
+		var events <-chan Notification
+		if follow {
+			var unsubscribe func()
+			events, unsubscribe = d.Events.Subscribe()
+			defer unsubscribe()
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		s := &sseWriter{w: w, rc: http.NewResponseController(w)}
+		log := requestLogger(d.Logger, r)
+		// the client waits for the headers before it starts reading
+		if err := s.rc.Flush(); err != nil {
+			log.Info("event stream aborted", "err", err)
+			return
+		}
+
+		var sent uint64
+		sendEvent := func(n Notification) error {
+			seq := eventSeq(n)
+			if seq <= sent || !filter.Match(n) {
+				return nil
+			}
+			sent = seq
+			return s.sendID(n.Event.Id, n.Event.Type, n.Event)
+		}
+		if lastId != "" || !follow {
+			for _, n := range d.Events.Since(after) {
+				if err := sendEvent(n); err != nil {
+					log.Info("event stream aborted", "err", err)
+					return
+				}
+			}
+		}
+		if !follow {
+			return
+		}
+
+		tick := time.NewTicker(sseKeepAlive)
+		defer tick.Stop()
+		for {
+			var err error
+			select {
+			case <-r.Context().Done():
+				return
+			case <-tick.C:
+				err = s.comment("keep-alive")
+			case n, ok := <-events:
+				if !ok {
+					log.Info("event stream reader fell behind, disconnecting")
+					return
+				}
+				err = sendEvent(n)
+			}
+			if err != nil {
+				log.Info("event stream aborted", "err", err)
+				return
+			}
+		}
+	}
+}
+
+// buildEventType names the event sent for a build entering state.
+func buildEventType(state lib.BuildState) string {
+	switch state {
+	case lib.BuildQueued:
+		return buildEventQueued
+	case lib.BuildRunning:
+		return buildEventStarted
+	case lib.BuildSucceeded:
+		return buildEventCompleted
+	}
+	return buildEventFailed
+}
+
+// sseWriter writes server-sent events, numbering them from 1 and flushing
+// each one.
+type sseWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+	id int
+}
+
+func (s *sseWriter) send(event string, v interface{}) error {
+	s.id++
+	return s.sendID(strconv.Itoa(s.id), event, v)
+}
+
+// sendID sends an event with an id of the caller's rather than the next
+// number.
+func (s *sseWriter) sendID(id, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sseWriter) comment(text string) error {
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	publishOnce sync.Once
+	statsDeps   atomic.Pointer[Deps]
+)
+
+// publishStats exposes the build queue metrics under the "builds" expvar,
+// served by the DebugVars route. expvar is process wide, so when several
+// servers run in one process the most recently created one is reported.
+func publishStats(d *Deps) {
+	statsDeps.Store(d)
+	publishOnce.Do(func() {
+		expvar.Publish("builds", expvar.Func(func() interface{} {
+			return statsDeps.Load().Builds.Stats()
+		}))
+	})
+}
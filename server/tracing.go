@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/xbcsmith/antares/lib"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/xbcsmith/antares/server"
+
+// traceRequest continues the trace named in the request's traceparent
+// header, or starts a new one, with a server span for route. Spans go to
+// the global tracer provider, so nothing is recorded until one is
+// installed.
+func traceRequest(route Route) Middleware {
+	tracer := otel.Tracer(tracerName)
+	name := route.Pattern
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			spanName := r.Method
+			if name != "" {
+				spanName += " " + name
+			}
+			ctx, span := tracer.Start(ctx, spanName,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("http.route", name),
+					attribute.String("url.path", r.URL.Path),
+					attribute.String("antares.request_id", RequestID(r.Context())),
+				))
+			defer span.End()
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
+
+// repo returns d.Repo as seen by the request in ctx: confined to its
+// namespace, if it has one, and recording a span for every call under the
+// span in ctx, if that is recording.
+func (d *Deps) repo(ctx context.Context) Repository {
+	repo := d.Repo
+	if ns, ok := NamespaceFrom(ctx); ok {
+		repo = &namespacedRepo{Repository: repo, ns: ns}
+	}
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return repo
+	}
+	return &tracedRepo{Repository: repo, ctx: ctx, backend: d.Config.Backend}
+}
+
+// tracedRepo wraps the calls of one request in child spans.
+type tracedRepo struct {
+	Repository
+	ctx     context.Context
+	backend string
+}
+
+// span starts the span of operation op. The returned function ends it,
+// marking it failed when *err holds anything but ErrNotFound.
+func (r *tracedRepo) span(op string, err *error, attrs ...attribute.KeyValue) func() {
+	_, span := otel.Tracer(tracerName).Start(r.ctx, "repository."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, attribute.String("antares.backend", r.backend))...))
+	return func() {
+		if err != nil && *err != nil && *err != ErrNotFound {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
+
+func (r *tracedRepo) ListAntarians() (list lib.Antarians, err error) {
+	defer r.span("ListAntarians", &err)()
+	return r.Repository.ListAntarians()
+}
+
+func (r *tracedRepo) EachAntarian(fn func(lib.Antarian) error) (err error) {
+	defer r.span("EachAntarian", &err)()
+	return r.Repository.EachAntarian(fn)
+}
+
+func (r *tracedRepo) FindAntarian(id string) (a lib.Antarian, err error) {
+	defer r.span("FindAntarian", &err, attribute.String("antares.antarian_id", id))()
+	return r.Repository.FindAntarian(id)
+}
+
+func (r *tracedRepo) AntariansNamed(name string) (list lib.Antarians, err error) {
+	defer r.span("AntariansNamed", &err, attribute.String("antares.name", name))()
+	return r.Repository.AntariansNamed(name)
+}
+
+func (r *tracedRepo) NameSummaries(prefix string, labels lib.LabelSelector) (list []NameSummary, err error) {
+	defer r.span("NameSummaries", &err)()
+	return r.Repository.NameSummaries(prefix, labels)
+}
+
+func (r *tracedRepo) CreateAntarian(s lib.Antarian) (a lib.Antarian, err error) {
+	defer r.span("CreateAntarian", &err, attribute.String("antares.name", s.Name))()
+	return r.Repository.CreateAntarian(s)
+}
+
+func (r *tracedRepo) UpdateAntarian(s lib.Antarian) (a lib.Antarian, err error) {
+	defer r.span("UpdateAntarian", &err, attribute.String("antares.antarian_id", s.Id))()
+	return r.Repository.UpdateAntarian(s)
+}
+
+func (r *tracedRepo) DestroyAntarian(id string) (err error) {
+	defer r.span("DestroyAntarian", &err, attribute.String("antares.antarian_id", id))()
+	return r.Repository.DestroyAntarian(id)
+}
+
+func (r *tracedRepo) Purge() (antarians, builds int, err error) {
+	defer r.span("Purge", &err)()
+	return r.Repository.Purge()
+}
+
+func (r *tracedRepo) FindBuild(id string) (b lib.Build, ok bool) {
+	defer r.span("FindBuild", nil, attribute.String("antares.build_id", id))()
+	return r.Repository.FindBuild(id)
+}
+
+func (r *tracedRepo) ListBuilds(antarianId string) (list []lib.Build, err error) {
+	defer r.span("ListBuilds", &err, attribute.String("antares.antarian_id", antarianId))()
+	return r.Repository.ListBuilds(antarianId)
+}
+
+func (r *tracedRepo) LatestBuild(antarianId string) (b lib.Build, ok bool, err error) {
+	defer r.span("LatestBuild", &err, attribute.String("antares.antarian_id", antarianId))()
+	return r.Repository.LatestBuild(antarianId)
+}
+
+func (r *tracedRepo) PruneBuilds(cutoff time.Time) (n int, err error) {
+	defer r.span("PruneBuilds", &err)()
+	return r.Repository.PruneBuilds(cutoff)
+}
+
+func (r *tracedRepo) AppendAudit(e lib.AuditEntry) (err error) {
+	defer r.span("AppendAudit", &err, attribute.String("antares.action", e.Action))()
+	return r.Repository.AppendAudit(e)
+}
+
+func (r *tracedRepo) ListAudit(q AuditQuery) (list []lib.AuditEntry, err error) {
+	defer r.span("ListAudit", &err)()
+	return r.Repository.ListAudit(q)
+}
+
+func (r *tracedRepo) CreateWebhook(h lib.Webhook) (err error) {
+	defer r.span("CreateWebhook", &err, attribute.String("antares.webhook_id", h.Id))()
+	return r.Repository.CreateWebhook(h)
+}
+
+func (r *tracedRepo) ListWebhooks() (list []lib.Webhook, err error) {
+	defer r.span("ListWebhooks", &err)()
+	return r.Repository.ListWebhooks()
+}
+
+func (r *tracedRepo) FindWebhook(id string) (h lib.Webhook, err error) {
+	defer r.span("FindWebhook", &err, attribute.String("antares.webhook_id", id))()
+	return r.Repository.FindWebhook(id)
+}
+
+func (r *tracedRepo) DestroyWebhook(id string) (err error) {
+	defer r.span("DestroyWebhook", &err, attribute.String("antares.webhook_id", id))()
+	return r.Repository.DestroyWebhook(id)
+}
+
+func (r *tracedRepo) CreateSchedule(s lib.Schedule) (err error) {
+	defer r.span("CreateSchedule", &err, attribute.String("antares.schedule_id", s.Id))()
+	return r.Repository.CreateSchedule(s)
+}
+
+func (r *tracedRepo) ListSchedules() (list []lib.Schedule, err error) {
+	defer r.span("ListSchedules", &err)()
+	return r.Repository.ListSchedules()
+}
+
+func (r *tracedRepo) FindSchedule(id string) (s lib.Schedule, err error) {
+	defer r.span("FindSchedule", &err, attribute.String("antares.schedule_id", id))()
+	return r.Repository.FindSchedule(id)
+}
+
+func (r *tracedRepo) UpdateSchedule(s lib.Schedule) (err error) {
+	defer r.span("UpdateSchedule", &err, attribute.String("antares.schedule_id", s.Id))()
+	return r.Repository.UpdateSchedule(s)
+}
+
+func (r *tracedRepo) DestroySchedule(id string) (err error) {
+	defer r.span("DestroySchedule", &err, attribute.String("antares.schedule_id", id))()
+	return r.Repository.DestroySchedule(id)
+}
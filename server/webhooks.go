@@ -0,0 +1,331 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+// maxDeliveries is how many deliveries are kept per webhook for
+// WebhookDeliveries. They are kept in memory only.
+const maxDeliveries = 50
+
+// Headers of a webhook request. The signature is "sha256=" followed by the
+// hex HMAC-SHA256 of the body, keyed with the webhook's secret.
+const (
+	headerWebhookEvent     = "X-Antares-Event"
+	headerWebhookDelivery  = "X-Antares-Delivery"
+	headerWebhookSignature = "X-Antares-Signature"
+)
+
+// webhookRequest is the body of WebhookCreate. A secret is generated when
+// none is given.
+type webhookRequest struct {
+	Url    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// WebhookIndex lists the registered webhooks, without their secrets.
+func WebhookIndex(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := d.repo(r.Context()).ListWebhooks()
+		if err != nil {
+			internalError(d, w, r, "list webhooks", err)
+			return
+		}
+		for i := range list {
+			list[i].Secret = ""
+		}
+		writeJSON(d, w, r, http.StatusOK, list)
+	}
+}
+
+// WebhookCreate registers a webhook. The response is the only one that
+// includes its secret.
+func WebhookCreate(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req webhookRequest
+		if err := decodeJSON(d, r, &req); err != nil {
+			writeDecodeError(d, w, r, err)
+			return
+		}
+		if err := validateWebhook(req); err != nil {
+			writeError(d, w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		id, err := lib.NewUUID()
+		if err != nil {
+			internalError(d, w, r, "create webhook", err)
+			return
+		}
+		h := lib.Webhook{Id: id, Url: req.Url, Secret: req.Secret, Events: req.Events, Created: time.Now().UTC()}
+		if h.Secret == "" {
+			if h.Secret, err = newWebhookSecret(); err != nil {
+				internalError(d, w, r, "create webhook", err)
+				return
+			}
+		}
+		if err := d.repo(r.Context()).CreateWebhook(h); err != nil {
+			internalError(d, w, r, "create webhook", err)
+			return
+		}
+		requestLogger(d.Logger, r).Info("created webhook", "webhook_id", h.Id, "url", h.Url)
+		e := requestAudit(r, lib.AuditWebhookCreate)
+		e.After = h.Id + " " + h.Url
+		audit(r.Context(), d, e)
+		writeJSON(d, w, r, http.StatusCreated, h)
+	}
+}
+
+// WebhookShow shows a webhook, without its secret.
+func WebhookShow(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, ok := findWebhook(d, w, r)
+		if !ok {
+			return
+		}
+		h.Secret = ""
+		writeJSON(d, w, r, http.StatusOK, h)
+	}
+}
+
+// WebhookDelete removes a webhook. Deliveries already under way are still
+// attempted.
+func WebhookDelete(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, ok := findWebhook(d, w, r)
+		if !ok {
+			return
+		}
+		if err := d.repo(r.Context()).DestroyWebhook(h.Id); err != nil && err != ErrNotFound {
+			internalError(d, w, r, "delete webhook", err)
+			return
+		}
+		d.webhooks.forget(h.Id)
+		requestLogger(d.Logger, r).Info("deleted webhook", "webhook_id", h.Id, "url", h.Url)
+		e := requestAudit(r, lib.AuditWebhookDelete)
+		e.Before = h.Id + " " + h.Url
+		audit(r.Context(), d, e)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// WebhookDeliveries lists the recent deliveries to a webhook, newest
+// first, with the outcome of each.
+func WebhookDeliveries(d *Deps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, ok := findWebhook(d, w, r)
+		if !ok {
+			return
+		}
+		writeJSON(d, w, r, http.StatusOK, d.webhooks.deliveries(h.Id))
+	}
+}
+
+// findWebhook looks up the webhook in the path, answering 404 or 500
+// itself when it cannot.
+func findWebhook(d *Deps, w http.ResponseWriter, r *http.Request) (lib.Webhook, bool) {
+	id := mux.Vars(r)["webhookId"]
+	h, err := d.repo(r.Context()).FindWebhook(id)
+	if err == ErrNotFound {
+		writeError(d, w, r, http.StatusNotFound, fmt.Sprintf("Could not find Webhook with id of %s", id))
+		return lib.Webhook{}, false
+	}
+	if err != nil {
+		internalError(d, w, r, "find webhook", err)
+		return lib.Webhook{}, false
+	}
+	return h, true
+}
+
+func validateWebhook(req webhookRequest) error {
+	u, err := url.Parse(req.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url: %q is not an absolute http or https URL", req.Url)
+	}
+	for _, ev := range req.Events {
+		if !matchAny(lib.EventTypes, ev) {
+			return fmt.Errorf("events: %q is not one of %s", ev, strings.Join(lib.EventTypes, ", "))
+		}
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// signWebhook returns the signature header value of body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDispatcher POSTs the events of a hub to the webhooks registered
+// for them, retrying failed attempts with exponential backoff, and keeps
+// the recent deliveries of each webhook.
+type webhookDispatcher struct {
+	repo   Repository
+	cfg    config.Webhooks
+	log    *slog.Logger
+	client *http.Client
+
+	mu sync.Mutex
+	// byWebhook holds the deliveries of each webhook, oldest first
+	byWebhook map[string][]*lib.WebhookDelivery
+}
+
+func newWebhookDispatcher(repo Repository, cfg config.Webhooks, log *slog.Logger) *webhookDispatcher {
+	return &webhookDispatcher{
+		repo:      repo,
+		cfg:       cfg,
+		log:       log,
+		client:    &http.Client{Timeout: cfg.Timeout},
+		byWebhook: map[string][]*lib.WebhookDelivery{},
+	}
+}
+
+// run delivers the events published to hub until ctx is done.
+func (wd *webhookDispatcher) run(ctx context.Context, hub *EventHub) {
+	hub.follow(ctx, wd.log.With("subscriber", "webhooks"), func(n Notification) {
+		wd.dispatch(ctx, n.Event)
+	})
+}
+
+// dispatch starts a delivery of ev to every webhook that wants it.
+func (wd *webhookDispatcher) dispatch(ctx context.Context, ev lib.Event) {
+	hooks, err := wd.repo.ListWebhooks()
+	if err != nil {
+		wd.log.Error("list webhooks", "err", err, "event_id", ev.Id)
+		return
+	}
+	var body []byte
+	for _, h := range hooks {
+		if !matchAny(h.Events, ev.Type) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(ev); err != nil {
+				wd.log.Error("encode event", "err", err, "event_id", ev.Id)
+				return
+			}
+		}
+		id, err := lib.NewUUID()
+		if err != nil {
+			wd.log.Error("create delivery", "err", err, "webhook_id", h.Id)
+			continue
+		}
+		now := time.Now().UTC()
+		dl := &lib.WebhookDelivery{Id: id, WebhookId: h.Id, EventId: ev.Id, EventType: ev.Type,
+			State: lib.DeliveryPending, Created: now, Updated: now}
+		wd.mu.Lock()
+		list := append(wd.byWebhook[h.Id], dl)
+		if len(list) > maxDeliveries {
+			list = list[len(list)-maxDeliveries:]
+		}
+		wd.byWebhook[h.Id] = list
+		wd.mu.Unlock()
+		go wd.deliver(ctx, h, dl, body)
+	}
+}
+
+// deliver attempts to POST body to h until it is accepted, a permanent
+// error is returned, the attempts run out or ctx is done.
+func (wd *webhookDispatcher) deliver(ctx context.Context, h lib.Webhook, dl *lib.WebhookDelivery, body []byte) {
+	log := wd.log.With("webhook_id", h.Id, "delivery_id", dl.Id, "event_id", dl.EventId)
+	delay := wd.cfg.RetryDelay
+	for attempt := 1; ; attempt++ {
+		status, err := wd.post(ctx, h, dl, body)
+		state := lib.DeliveryPending
+		switch {
+		case err == nil && status >= 200 && status < 300:
+			state = lib.DeliverySucceeded
+		case attempt >= wd.cfg.MaxAttempts || (err == nil && !retryStatus(status)):
+			state = lib.DeliveryFailed
+		}
+		wd.mu.Lock()
+		dl.Attempts, dl.StatusCode, dl.State, dl.Updated = attempt, status, state, time.Now().UTC()
+		dl.Error = ""
+		if err != nil {
+			dl.Error = err.Error()
+		}
+		wd.mu.Unlock()
+		if state == lib.DeliverySucceeded {
+			return
+		}
+		if state == lib.DeliveryFailed {
+			log.Warn("webhook delivery failed", "err", err, "status", status, "attempts", attempt)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// retryStatus reports whether a delivery answered with status is worth
+// trying again: server errors, timeouts and rate limiting.
+func retryStatus(status int) bool {
+	return status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+func (wd *webhookDispatcher) post(ctx context.Context, h lib.Webhook, dl *lib.WebhookDelivery, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "antares-webhook")
+	req.Header.Set(headerWebhookEvent, dl.EventType)
+	req.Header.Set(headerWebhookDelivery, dl.Id)
+	req.Header.Set(headerWebhookSignature, signWebhook(h.Secret, body))
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// deliveries returns copies of the deliveries to webhook id, newest first.
+func (wd *webhookDispatcher) deliveries(id string) []lib.WebhookDelivery {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	list := wd.byWebhook[id]
+	out := make([]lib.WebhookDelivery, 0, len(list))
+	for i := len(list) - 1; i >= 0; i-- {
+		out = append(out, *list[i])
+	}
+	return out
+}
+
+// forget drops the deliveries of a removed webhook.
+func (wd *webhookDispatcher) forget(id string) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	delete(wd.byWebhook, id)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xbcsmith/antares/config"
+	"github.com/xbcsmith/antares/lib"
+)
+
+func TestSignWebhook(t *testing.T) {
+	// the example of GitHub's webhook documentation, which receivers
+	// written for it check the same way
+	got := signWebhook("It's a Secret to Everybody", []byte("Hello, World!"))
+	want := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	if got != want {
+		t.Errorf("signWebhook = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookSignatureHeader(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   string
+	}
+	got := make(chan received, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Clone(), string(body)}
+	}))
+	defer receiver.Close()
+
+	wd := newWebhookDispatcher(nil, config.Webhooks{Timeout: 5 * time.Second, MaxAttempts: 1}, testLogger())
+	h := lib.Webhook{Id: "w1", Url: receiver.URL, Secret: "It's a Secret to Everybody"}
+	dl := &lib.WebhookDelivery{Id: "d1", WebhookId: h.Id, EventType: "build.finished"}
+	status, err := wd.post(context.Background(), h, dl, []byte("Hello, World!"))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("post = %d, %v", status, err)
+	}
+	r := <-got
+	if r.body != "Hello, World!" {
+		t.Errorf("body = %q", r.body)
+	}
+	for name, want := range map[string]string{
+		headerWebhookSignature: "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+		headerWebhookEvent:     "build.finished",
+		headerWebhookDelivery:  "d1",
+	} {
+		if v := r.header.Get(name); v != want {
+			t.Errorf("%s = %q, want %q", name, v, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsPingInterval is how often an idle WebSocket is pinged; a client
+	// that has not answered within wsPongWait is disconnected.
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = wsPingInterval + 10*time.Second
+	wsWriteWait    = 10 * time.Second
+	// wsMaxMessage bounds the filter messages read from clients.
+	wsMaxMessage = 64 << 10
+)
+
+// Websocket pushes the events of every change to an Antarian or its builds
+// to the client as JSON text messages, each a lib.Event. The comma
+// separated name, namespace and types parameters set the initial filter;
+// the client replaces it at any time by sending an EventFilter, e.g.
+// {"names":["libfoo"],"namespaces":["team-a"]}. A client that reads too
+// slowly is disconnected with a policy violation.
+func Websocket(d *Deps) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			u, err := url.Parse(origin)
+			if err == nil && strings.EqualFold(u.Host, r.Host) {
+				return true
+			}
+			return allowedOrigin(d.Config.CORSOrigins, origin)
+		},
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := EventFilter{
+			Names:      splitList(q.Get("name")),
+			Namespaces: splitList(q.Get("namespace")),
+			Types:      splitList(q.Get("types")),
+		}
+		// subscribe before upgrading, so no event is missed in between
+		events, unsubscribe := d.Events.Subscribe()
+		defer unsubscribe()
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// the upgrader has already answered
+			return
+		}
+		defer conn.Close()
+		log := requestLogger(d.Logger, r)
+
+		filters := make(chan EventFilter, 1)
+		closed := make(chan struct{})
+		conn.SetReadLimit(wsMaxMessage)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		go func() {
+			defer close(closed)
+			for {
+				var f EventFilter
+				if err := conn.ReadJSON(&f); err != nil {
+					if _, ok := err.(*websocket.CloseError); !ok {
+						log.Info("websocket read", "err", err)
+					}
+					return
+				}
+				conn.SetReadDeadline(time.Now().Add(wsPongWait))
+				// only the latest filter matters
+				select {
+				case <-filters:
+				default:
+				}
+				filters <- f
+			}
+		}()
+
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+		for {
+			var err error
+			select {
+			case <-closed:
+				return
+			case f := <-filters:
+				filter = f
+			case <-ping.C:
+				err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			case n, ok := <-events:
+				if !ok {
+					conn.WriteControl(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too slow"),
+						time.Now().Add(wsWriteWait))
+					return
+				}
+				if filter.Match(n) {
+					conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+					err = conn.WriteJSON(n.Event)
+				}
+			}
+			if err != nil {
+				log.Info("websocket aborted", "err", err)
+				return
+			}
+		}
+	}
+}
+
+// splitList splits a comma separated parameter, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const tmpPrefix = ".tmp-"
+
+// Local stores files on disk as <root>/<id>/<name>.
+type Local struct {
+	root  string
+	fsync bool
+	// createTemp opens the file Put writes before renaming it into place;
+	// tests swap it to simulate a full disk.
+	createTemp func(dir, pattern string) (tempFile, error)
+}
+
+// tempFile is the part of *os.File that Put writes through.
+type tempFile interface {
+	io.WriteCloser
+	Sync() error
+	Name() string
+}
+
+func createTemp(dir, pattern string) (tempFile, error) {
+	return os.CreateTemp(dir, pattern)
+}
+
+// NewLocal returns a Local rooted at root, creating the directory if needed.
+// With fsync set, Put flushes the file and its directory before returning.
+func NewLocal(root string, fsync bool) (*Local, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{root: abs, fsync: fsync, createTemp: createTemp}, nil
+}
+
+// Root is the absolute directory files are stored under.
+func (l *Local) Root() string {
+	return l.root
+}
+
+// path returns the location of id/name, checking that it stays inside the
+// root even after cleaning.
+func (l *Local) path(id, name string) (string, error) {
+	if err := checkName(id, name); err != nil {
+		return "", err
+	}
+	p := filepath.Join(l.root, id, name)
+	rel, err := filepath.Rel(l.root, p)
+	if err != nil || rel != filepath.Join(id, name) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return p, nil
+}
+
+func (l *Local) Put(ctx context.Context, id, name string, r io.Reader) (Info, error) {
+	p, err := l.path(id, name)
+	if err != nil {
+		return Info{}, err
+	}
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Info{}, err
+	}
+
+	tmp, err := l.createTemp(dir, tmpPrefix+name+"-")
+	if err != nil {
+		return Info{}, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sum), contextReader{ctx, r})
+	if err != nil {
+		return Info{}, err
+	}
+	if l.fsync {
+		if err := tmp.Sync(); err != nil {
+			return Info{}, err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return Info{}, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return Info{}, err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return Info{}, err
+	}
+	committed = true
+	if l.fsync {
+		if err := syncDir(dir); err != nil {
+			return Info{}, err
+		}
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Id: id, Name: name, Size: size, ModTime: fi.ModTime(), Checksum: hex.EncodeToString(sum.Sum(nil))}, nil
+}
+
+func (l *Local) Get(ctx context.Context, id, name string) (File, Info, error) {
+	p, err := l.path(id, name)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, Info{}, notFound(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, Info{}, err
+	}
+	return f, Info{Id: id, Name: name, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (l *Local) Delete(ctx context.Context, id, name string) error {
+	p, err := l.path(id, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		return notFound(err)
+	}
+	// drop the per-id directory once it is empty
+	os.Remove(filepath.Dir(p))
+	return nil
+}
+
+func (l *Local) Stat(ctx context.Context, id, name string) (Info, error) {
+	p, err := l.path(id, name)
+	if err != nil {
+		return Info{}, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return Info{}, notFound(err)
+	}
+	return Info{Id: id, Name: name, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (l *Local) List(ctx context.Context, id string) ([]Info, error) {
+	dirs := []string{id}
+	if id == "" {
+		entries, err := os.ReadDir(l.root)
+		if err != nil {
+			return nil, err
+		}
+		dirs = dirs[:0]
+		for _, e := range entries {
+			if e.IsDir() && safeName.MatchString(e.Name()) {
+				dirs = append(dirs, e.Name())
+			}
+		}
+	} else if err := checkComponent(id); err != nil {
+		return nil, err
+	}
+
+	var infos []Info
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(filepath.Join(l.root, dir))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), tmpPrefix) {
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil {
+				continue
+			}
+			infos = append(infos, Info{Id: dir, Name: e.Name(), Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+	}
+	return infos, nil
+}
+
+// SignedURL is not supported: a local file is served by Antares itself.
+func (l *Local) SignedURL(ctx context.Context, id, name string, ttl time.Duration) (string, error) {
+	return "", errors.ErrUnsupported
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// contextReader stops a copy once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func newLocal(t *testing.T) *Local {
+	t.Helper()
+	l, err := NewLocal(filepath.Join(t.TempDir(), "artifacts"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	l := newLocal(t)
+	ctx := context.Background()
+	content := []byte("libfoo 1.0.0")
+	info, err := l.Put(ctx, "a1", "libfoo.tar.gz", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	if info.Size != int64(len(content)) || info.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("Put = %+v", info)
+	}
+
+	f, info, err := l.Get(ctx, "a1", "libfoo.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(f)
+	f.Close()
+	if !bytes.Equal(got, content) || info.Size != int64(len(content)) {
+		t.Errorf("Get = %q, %+v", got, info)
+	}
+
+	infos, err := l.List(ctx, "")
+	if err != nil || len(infos) != 1 || infos[0].Id != "a1" || infos[0].Name != "libfoo.tar.gz" {
+		t.Errorf("List = %+v, %v", infos, err)
+	}
+	if err := l.Delete(ctx, "a1", "libfoo.tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stat(ctx, "a1", "libfoo.tar.gz"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete = %v, want ErrNotFound", err)
+	}
+	if _, err := os.Stat(filepath.Join(l.Root(), "a1")); !os.IsNotExist(err) {
+		t.Errorf("the empty id directory was left behind: %v", err)
+	}
+}
+
+func TestLocalTraversal(t *testing.T) {
+	l := newLocal(t)
+	ctx := context.Background()
+	// a file beside the root that a successful escape would reach
+	secret := filepath.Join(filepath.Dir(l.Root()), "secret")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id, name string
+	}{
+		{"a1", "../secret"},
+		{"a1", "../../secret"},
+		{"..", "secret"},
+		{"a1/..", "secret"},
+		{"a1", "sub/file"},
+		{"a1", `..\secret`},
+		{"a1", ".."},
+		{"a1", "."},
+		{"a1", ".hidden"},
+		{"a1", ""},
+		{"", "file"},
+		{"a1", secret},
+		{"a1", "file\x00.txt"},
+		{"a1", "%2e%2e%2fsecret"},
+		{"a1", strings.Repeat("a", 256)},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q/%q", tt.id, tt.name), func(t *testing.T) {
+			if _, err := l.Put(ctx, tt.id, tt.name, strings.NewReader("pwned")); !errors.Is(err, ErrInvalidName) {
+				t.Errorf("Put error = %v, want ErrInvalidName", err)
+			}
+			if f, _, err := l.Get(ctx, tt.id, tt.name); !errors.Is(err, ErrInvalidName) {
+				if f != nil {
+					f.Close()
+				}
+				t.Errorf("Get error = %v, want ErrInvalidName", err)
+			}
+			if _, err := l.Stat(ctx, tt.id, tt.name); !errors.Is(err, ErrInvalidName) {
+				t.Errorf("Stat error = %v, want ErrInvalidName", err)
+			}
+			if err := l.Delete(ctx, tt.id, tt.name); !errors.Is(err, ErrInvalidName) {
+				t.Errorf("Delete error = %v, want ErrInvalidName", err)
+			}
+		})
+	}
+	if _, err := l.List(ctx, ".."); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("List(\"..\") error = %v, want ErrInvalidName", err)
+	}
+	if got, err := ioutil.ReadFile(secret); err != nil || string(got) != "secret" {
+		t.Errorf("the file outside the root became %q, %v", got, err)
+	}
+	if infos, _ := l.List(ctx, ""); len(infos) != 0 {
+		t.Errorf("rejected writes stored %+v", infos)
+	}
+}
+
+func TestLocalConcurrent(t *testing.T) {
+	l := newLocal(t)
+	ctx := context.Background()
+	versions := map[string]bool{}
+	for i := 0; i < 8; i++ {
+		versions[strings.Repeat(fmt.Sprint(i), 64<<10)] = true
+	}
+	if _, err := l.Put(ctx, "a1", "blob", strings.NewReader(strings.Repeat("0", 64<<10))); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for content := range versions {
+		wg.Add(1)
+		go func(content string) {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				if _, err := l.Put(ctx, "a1", "blob", strings.NewReader(content)); err != nil {
+					errs <- err
+				}
+			}
+		}(content)
+	}
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				f, _, err := l.Get(ctx, "a1", "blob")
+				if err != nil {
+					errs <- err
+					continue
+				}
+				got, err := ioutil.ReadAll(f)
+				f.Close()
+				// a reader sees one whole version, never a mix or a prefix
+				if err != nil || !versions[string(got)] {
+					errs <- fmt.Errorf("read %d bytes that are no version written: %v", len(got), err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(l.Root(), "a1"))
+	if len(entries) != 1 {
+		t.Errorf("a1 holds %d entries after the writers finished, want 1", len(entries))
+	}
+}
+
+// fullFile is a temporary file on a disk with room for only space more bytes.
+type fullFile struct {
+	*os.File
+	space int
+}
+
+func (f *fullFile) Write(p []byte) (int, error) {
+	if len(p) > f.space {
+		n, _ := f.File.Write(p[:f.space])
+		f.space = 0
+		return n, &os.PathError{Op: "write", Path: f.Name(), Err: syscall.ENOSPC}
+	}
+	f.space -= len(p)
+	return f.File.Write(p)
+}
+
+func TestLocalDiskFull(t *testing.T) {
+	l := newLocal(t)
+	ctx := context.Background()
+	if _, err := l.Put(ctx, "a1", "blob", strings.NewReader("version one")); err != nil {
+		t.Fatal(err)
+	}
+	l.createTemp = func(dir, pattern string) (tempFile, error) {
+		f, err := os.CreateTemp(dir, pattern)
+		if err != nil {
+			return nil, err
+		}
+		return &fullFile{File: f, space: 1024}, nil
+	}
+
+	_, err := l.Put(ctx, "a1", "blob", bytes.NewReader(make([]byte, 4096)))
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Put error = %v, want ENOSPC", err)
+	}
+	// the old file is untouched and the partial write is gone
+	f, _, err := l.Get(ctx, "a1", "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(f)
+	f.Close()
+	if string(got) != "version one" {
+		t.Errorf("after a failed Put the file holds %q", got)
+	}
+	entries, _ := os.ReadDir(filepath.Join(l.Root(), "a1"))
+	if len(entries) != 1 {
+		t.Errorf("a1 holds %d entries, want the temporary file removed", len(entries))
+	}
+	if _, err := l.Put(ctx, "a1", "small", strings.NewReader("fits")); err != nil {
+		t.Errorf("a Put that fits failed: %v", err)
+	}
+}
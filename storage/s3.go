@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config locates a bucket on an S3-compatible service.
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// S3 stores files as objects named <prefix><id>/<name>.
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	prefix := cfg.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &S3{client: client, bucket: cfg.Bucket, prefix: prefix}, nil
+}
+
+func (s *S3) key(id, name string) (string, error) {
+	if err := checkName(id, name); err != nil {
+		return "", err
+	}
+	return s.prefix + id + "/" + name, nil
+}
+
+// Put streams r to the bucket. The upload is a single object write, so
+// readers see either the old object or the new one.
+func (s *S3) Put(ctx context.Context, id, name string, r io.Reader) (Info, error) {
+	key, err := s.key(id, name)
+	if err != nil {
+		return Info{}, err
+	}
+	sum := sha256.New()
+	up, err := s.client.PutObject(ctx, s.bucket, key, io.TeeReader(r, sum), -1, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Id: id, Name: name, Size: up.Size, ModTime: up.LastModified, Checksum: hex.EncodeToString(sum.Sum(nil))}, nil
+}
+
+func (s *S3) Get(ctx context.Context, id, name string) (File, Info, error) {
+	key, err := s.key(id, name)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, Info{}, s3NotFound(err)
+	}
+	st, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, Info{}, s3NotFound(err)
+	}
+	return obj, Info{Id: id, Name: name, Size: st.Size, ModTime: st.LastModified}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, id, name string) error {
+	key, err := s.key(id, name)
+	if err != nil {
+		return err
+	}
+	// RemoveObject succeeds for missing keys, so check first to report it
+	if _, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{}); err != nil {
+		return s3NotFound(err)
+	}
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) Stat(ctx context.Context, id, name string) (Info, error) {
+	key, err := s.key(id, name)
+	if err != nil {
+		return Info{}, err
+	}
+	st, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return Info{}, s3NotFound(err)
+	}
+	return Info{Id: id, Name: name, Size: st.Size, ModTime: st.LastModified}, nil
+}
+
+func (s *S3) List(ctx context.Context, id string) ([]Info, error) {
+	prefix := s.prefix
+	if id != "" {
+		if err := checkComponent(id); err != nil {
+			return nil, err
+		}
+		prefix += id + "/"
+	}
+	var infos []Info
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		parts := strings.Split(strings.TrimPrefix(obj.Key, s.prefix), "/")
+		if len(parts) != 2 || checkName(parts[0], parts[1]) != nil {
+			continue
+		}
+		infos = append(infos, Info{Id: parts[0], Name: parts[1], Size: obj.Size, ModTime: obj.LastModified})
+	}
+	return infos, nil
+}
+
+// SignedURL presigns a GET of the object, which must exist, that saves it
+// under its name.
+func (s *S3) SignedURL(ctx context.Context, id, name string, ttl time.Duration) (string, error) {
+	key, err := s.key(id, name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{}); err != nil {
+		return "", s3NotFound(err)
+	}
+	params := url.Values{"response-content-disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": name})}}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, ttl, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func s3NotFound(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
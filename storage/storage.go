@@ -0,0 +1,73 @@
+// Package storage keeps artifact files, addressed by Antarian id and file
+// name.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no file is stored under the id and name.
+	ErrNotFound = errors.New("storage: file not found")
+	// ErrInvalidName is returned for ids or names that are not a single safe
+	// path component.
+	ErrInvalidName = errors.New("storage: invalid id or file name")
+)
+
+// Storage is implemented by every artifact backend.
+type Storage interface {
+	// Put stores r as name under id, replacing any existing file. Readers
+	// never observe a partially written file.
+	Put(ctx context.Context, id, name string, r io.Reader) (Info, error)
+	// Get opens a stored file for reading.
+	Get(ctx context.Context, id, name string) (File, Info, error)
+	Delete(ctx context.Context, id, name string) error
+	Stat(ctx context.Context, id, name string) (Info, error)
+	// List returns the files stored under id, or every file if id is empty.
+	List(ctx context.Context, id string) ([]Info, error)
+	// SignedURL returns a URL that downloads the file straight from the
+	// backend until ttl has passed. Backends that cannot serve files
+	// themselves return errors.ErrUnsupported.
+	SignedURL(ctx context.Context, id, name string, ttl time.Duration) (string, error)
+}
+
+// File is an open stored file. It supports seeking so it can be served with
+// range requests.
+type File interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// Info describes a stored file. Checksum is the hex sha256 of the content
+// and is only filled in by Put.
+type Info struct {
+	Id       string    `json:"id"`
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modtime"`
+	Checksum string    `json:"checksum,omitempty"`
+}
+
+var safeName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// checkName rejects anything but a single path component made of a
+// conservative character set, so ids and names can never address files
+// outside their own directory.
+func checkName(id, name string) error {
+	if err := checkComponent(id); err != nil {
+		return err
+	}
+	return checkComponent(name)
+}
+
+func checkComponent(s string) error {
+	if len(s) > 255 || !safeName.MatchString(s) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, s)
+	}
+	return nil
+}